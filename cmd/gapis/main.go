@@ -15,8 +15,10 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -28,6 +30,7 @@ import (
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/auth"
 	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/android/adb"
@@ -61,6 +64,11 @@ var (
 	enableLocalFiles = flag.Bool("enable-local-files", false, "Allow clients to access local .gfxtrace files by path")
 	remoteSSHConfig  = flag.String("ssh-config", "", "_Path to an ssh config file for remote devices")
 	preloadDepGraph  = flag.Bool("preload-dep-graph", true, "_Preload the dependency graph when loading captures")
+	cacheDir         = flag.String("cache-dir", "", "Directory used to persist resolved data between runs; only data with a proto form is kept, so objects such as dependency graphs are rebuilt. Leave empty to only hold data in memory")
+	cacheSize        = flag.Int("cache-size", 4096, "Maximum size of the cache directory in MB")
+	selfProfile      = flag.String("self-profile", "", "File to write a trace of the server's tasks, database resolves and replays to, in the Chrome trace format (viewable in Perfetto)")
+	memoryLimit      = flag.Int("memory-limit", 0, "Size in MB of the resolved data held in memory before the least recently used data is evicted; 0 means no limit")
+	packVersion      = flag.Int("capture-pack-version", 3, "Pack format version of saved captures: 3 for compressed, indexed files, or 2 for files readable by older versions")
 )
 
 func main() {
@@ -96,12 +104,27 @@ func run(ctx context.Context) error {
 		adb.ADB = file.Abs(*adbPath)
 	}
 
+	if *selfProfile != "" {
+		stop, err := startSelfProfile(ctx, *selfProfile)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
 	r := bind.NewRegistry()
 	ctx = bind.PutRegistry(ctx, r)
 	m := replay.New(ctx)
 	ctx = replay.PutManager(ctx, m)
 	ctx = trace.PutManager(ctx, trace.New(ctx))
-	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	db, err := newDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = database.Put(ctx, db)
+	if *memoryLimit > 0 {
+		database.SetMemoryLimit(ctx, uint64(*memoryLimit)*1024*1024)
+	}
 
 	// Grpc is very verbose, turn that down
 	grpclog.SetLogger(log.From(ctx).SetFilter(log.SeverityFilter(log.Error)))
@@ -145,14 +168,51 @@ func run(ctx context.Context) error {
 			Features:          features,
 			ServerLocalDevice: hostDevice,
 		},
-		StringTables:     loadStrings(ctx),
-		EnableLocalFiles: *enableLocalFiles,
-		PreloadDepGraph:  *preloadDepGraph,
-		AuthToken:        auth.Token(*gapisAuthToken),
-		DeviceScanDone:   deviceScanDone,
-		LogBroadcaster:   logBroadcaster,
-		IdleTimeout:      *idleTimeout,
+		StringTables:       loadStrings(ctx),
+		EnableLocalFiles:   *enableLocalFiles,
+		PreloadDepGraph:    *preloadDepGraph,
+		AuthToken:          auth.Token(*gapisAuthToken),
+		DeviceScanDone:     deviceScanDone,
+		LogBroadcaster:     logBroadcaster,
+		IdleTimeout:        *idleTimeout,
+		CapturePackVersion: *packVersion,
+	})
+}
+
+// startSelfProfile starts writing a trace of the server's status updates and
+// memory usage to the file at path. The returned function stops the trace.
+func startSelfProfile(ctx context.Context, path string) (stop func(), err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to create the self-profile file %v", path)
+	}
+	w := bufio.NewWriter(f)
+	unregister := status.RegisterTracer(w)
+	stopSnapshots := task.Async(ctx, func(ctx context.Context) error {
+		return task.Poll(ctx, time.Second, func(ctx context.Context) error {
+			status.SnapshotMemory(ctx)
+			return nil
+		})
 	})
+	log.I(ctx, "Writing self-profile trace to %v", path)
+	return func() {
+		stopSnapshots()
+		unregister()
+		w.Flush()
+		f.Close()
+	}, nil
+}
+
+// newDatabase returns the database to use for the server, which is persisted
+// to the cache directory if one was specified.
+func newDatabase(ctx context.Context) (database.Database, error) {
+	if *cacheDir == "" {
+		return database.NewInMemory(ctx), nil
+	}
+	if *cacheSize <= 0 {
+		return nil, fmt.Errorf("Invalid cache size: %vMB", *cacheSize)
+	}
+	return database.NewOnDisk(ctx, *cacheDir, app.Version.String(), uint64(*cacheSize)*1024*1024)
 }
 
 func monitorAndroidDevices(ctx context.Context, r *bind.Registry, scanDone func()) {
@@ -68,6 +68,9 @@ func (verb *commandsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	treePath.GroupByFrame = verb.GroupByFrame
 	treePath.GroupByUserMarkers = verb.GroupByUserMarkers
 	treePath.GroupBySubmission = verb.GroupBySubmission
+	treePath.GroupByRenderPass = verb.GroupByRenderPass
+	treePath.GroupByPipeline = verb.GroupByPipeline
+	treePath.GroupByCommandBuffer = verb.GroupByCommandBuffer
 	treePath.AllowIncompleteFrame = verb.AllowIncompleteFrame
 
 	treePath.MaxChildren = int32(verb.MaxChildren)
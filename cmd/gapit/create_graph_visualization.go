@@ -20,6 +20,7 @@ import (
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/service"
+	"math"
 	"os"
 )
 
@@ -27,6 +28,7 @@ type createGraphVisualizationVerb struct{ CreateGraphVisualizationFlags }
 
 func init() {
 	verb := &createGraphVisualizationVerb{}
+	verb.Commands.To = -1
 	app.AddVerb(&app.Verb{
 		Name:      "create_graph_visualization",
 		ShortHelp: "Create graph visualization file from capture",
@@ -40,7 +42,7 @@ func (verb *createGraphVisualizationVerb) Run(ctx context.Context, flags flag.Fl
 		return nil
 	}
 	if verb.Format == "" {
-		app.Usage(ctx, "specify an output format with --format <format> (supported formats: pbtxt and dot)")
+		app.Usage(ctx, "specify an output format with --format <format> (supported formats: pbtxt, dot, graphml and json)")
 		return nil
 	}
 	var format service.GraphFormat
@@ -48,8 +50,12 @@ func (verb *createGraphVisualizationVerb) Run(ctx context.Context, flags flag.Fl
 		format = service.GraphFormat_PBTXT
 	} else if verb.Format == "dot" {
 		format = service.GraphFormat_DOT
+	} else if verb.Format == "graphml" {
+		format = service.GraphFormat_GRAPHML
+	} else if verb.Format == "json" {
+		format = service.GraphFormat_JSON
 	} else {
-		app.Usage(ctx, "invalid format (supported formats: pbtxt and dot)")
+		app.Usage(ctx, "invalid format (supported formats: pbtxt, dot, graphml and json)")
 		return nil
 	}
 
@@ -61,7 +67,20 @@ func (verb *createGraphVisualizationVerb) Run(ctx context.Context, flags flag.Fl
 
 	log.I(ctx, "Creating graph visualization file from capture id: %s", capture.ID)
 
-	graphVisualization, err := client.GetGraphVisualization(ctx, capture, format)
+	opts := &service.GraphVisualizationOptions{
+		Frame:               uint32(verb.Frame),
+		Labels:              verb.Labels,
+		CollapseSubcommands: verb.Collapse,
+	}
+	if verb.Commands.From > 0 || verb.Commands.To >= 0 {
+		to := uint64(math.MaxUint64)
+		if verb.Commands.To >= 0 {
+			to = uint64(verb.Commands.To)
+		}
+		opts.Commands = capture.CommandRange(uint64(verb.Commands.From), to)
+	}
+
+	graphVisualization, err := client.GetGraphVisualization(ctx, capture, format, opts)
 	if err != nil {
 		return log.Errf(ctx, err, "GetGraphVisualization(%v)", capture)
 	}
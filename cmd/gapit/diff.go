@@ -0,0 +1,179 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type diffVerb struct{ DiffFlags }
+
+func init() {
+	verb := &diffVerb{
+		DiffFlags{
+			Format: "text",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "diff",
+		ShortHelp: "Compares the commands and resources of two .gfxtrace files",
+		Action:    verb,
+	})
+}
+
+func (verb *diffVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly two gfx trace files expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Format != "text" && verb.Format != "json" {
+		app.Usage(ctx, "Unknown output format '%v', expected 'text' or 'json'", verb.Format)
+		return nil
+	}
+
+	client, reference, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var value *path.Capture
+	if verb.CaptureID {
+		captureID, err := id.Parse(flags.Arg(1))
+		if err != nil {
+			return log.Err(ctx, err, "Could not parse capture ID")
+		}
+		value = &path.Capture{ID: path.NewID(captureID)}
+	} else {
+		capturePath, err := filepath.Abs(flags.Arg(1))
+		if err != nil {
+			return log.Err(ctx, err, "Could not find capture file")
+		}
+		if value, err = client.LoadCapture(ctx, capturePath); err != nil {
+			return log.Err(ctx, err, "Failed to load the capture file")
+		}
+	}
+
+	diff, err := client.DiffCaptures(ctx, reference, value, &service.DiffCapturesOptions{
+		MaxDifferences:  uint32(verb.Max),
+		Resources:       verb.Resources,
+		ComparePointers: verb.Pointers,
+	})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to compare the captures")
+	}
+
+	out := io.Writer(os.Stdout)
+	if verb.Out != "" {
+		f, err := os.Create(verb.Out)
+		if err != nil {
+			return log.Errf(ctx, err, "Creating file (%v)", verb.Out)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if verb.Format == "json" {
+		m := &jsonpb.Marshaler{Indent: " "}
+		return m.Marshal(out, diff)
+	}
+	printDiff(out, diff)
+	return nil
+}
+
+var diffKindSigns = map[service.DiffKind]string{
+	service.DiffKind_DiffChanged:  "~",
+	service.DiffKind_DiffInserted: "+",
+	service.DiffKind_DiffRemoved:  "-",
+}
+
+// printDiff prints the capture differences in a human readable form. Removed
+// commands and resources are prefixed by '-', inserted ones by '+' and changed
+// ones by '~'.
+func printDiff(w io.Writer, diff *service.CaptureDiff) {
+	if len(diff.Frames) == 0 {
+		fmt.Fprintln(w, "No differences found")
+		return
+	}
+	for _, f := range diff.Frames {
+		fmt.Fprintf(w, "Frame %d:\n", f.Frame)
+		switch {
+		case f.ReferenceEnd == nil:
+			fmt.Fprintln(w, "  Only in the second capture")
+		case f.ValueEnd == nil:
+			fmt.Fprintln(w, "  Only in the first capture")
+		}
+		for _, c := range f.Commands {
+			fmt.Fprintf(w, "  %v %v %v", diffKindSigns[c.Kind], commandIndices(c.Reference, c.Value), c.Name)
+			if c.Marker != "" {
+				fmt.Fprintf(w, " (in %v)", c.Marker)
+			}
+			fmt.Fprintln(w)
+			printValueDiffs(w, c.Parameters)
+		}
+		if len(f.Resources) > 0 {
+			fmt.Fprintf(w, "  Resources after %v:\n", commandIndices(f.ReferenceEnd, f.ValueEnd))
+		}
+		for _, r := range f.Resources {
+			fmt.Fprintf(w, "  %v %v", diffKindSigns[r.Kind], r.Type)
+			if r.Label != "" {
+				fmt.Fprintf(w, " %q", r.Label)
+			}
+			switch r.Kind {
+			case service.DiffKind_DiffInserted:
+				fmt.Fprintf(w, " %v\n", r.ValueHandle)
+			case service.DiffKind_DiffRemoved:
+				fmt.Fprintf(w, " %v\n", r.ReferenceHandle)
+			default:
+				fmt.Fprintf(w, " %v -> %v\n", r.ReferenceHandle, r.ValueHandle)
+			}
+			printValueDiffs(w, r.Fields)
+		}
+	}
+	if diff.Truncated {
+		fmt.Fprintln(w, "Maximum number of differences reached, the remaining differences were not reported")
+	}
+}
+
+func printValueDiffs(w io.Writer, diffs []*service.ValueDiff) {
+	for _, d := range diffs {
+		fmt.Fprintf(w, "        %v: %v -> %v\n", d.Path, d.Reference, d.Value)
+	}
+}
+
+// commandIndices returns the indices of the commands in both captures, or of
+// the single command if the other is nil.
+func commandIndices(reference, value *path.Command) string {
+	switch {
+	case reference == nil:
+		return fmt.Sprint(value.Indices)
+	case value == nil:
+		return fmt.Sprint(reference.Indices)
+	default:
+		return fmt.Sprintf("%v -> %v", reference.Indices, value.Indices)
+	}
+}
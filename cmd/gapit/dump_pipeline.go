@@ -74,13 +74,20 @@ func (verb *pipeVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 }
 
 func (verb *pipeVerb) getBoundPipelineResource(ctx context.Context, c client.Client, cmd *path.Command) (*api.Pipeline, error) {
+	_, pipelineData, err := getBoundPipeline(ctx, c, cmd, verb.Compute)
+	return pipelineData, err
+}
+
+// getBoundPipeline returns the resource ID and data of the graphics or
+// compute pipeline bound at the command.
+func getBoundPipeline(ctx context.Context, c client.Client, cmd *path.Command, compute bool) (*path.ID, *api.Pipeline, error) {
 	boxedResources, err := c.Get(ctx, (&path.Resources{Capture: cmd.Capture}).Path(), nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	targetType := api.Pipeline_GRAPHICS
-	if verb.Compute {
+	if compute {
 		targetType = api.Pipeline_COMPUTE
 	}
 
@@ -93,16 +100,16 @@ func (verb *pipeVerb) getBoundPipelineResource(ctx context.Context, c client.Cli
 		for _, resource := range typ.Resources {
 			boxedResourceData, err := c.Get(ctx, cmd.ResourceAfter(resource.ID).Path(), nil)
 			if err != nil {
-				return nil, log.Err(ctx, err, "Failed to load the pipeline resource")
+				return nil, nil, log.Err(ctx, err, "Failed to load the pipeline resource")
 			}
 			resourceData := boxedResourceData.(*api.ResourceData)
 			pipelineData := protoutil.OneOf(resourceData.Data).(*api.Pipeline)
 			if pipelineData.Bound && pipelineData.PipelineType == targetType {
-				return pipelineData, nil
+				return resource.ID, pipelineData, nil
 			}
 		}
 	}
-	return nil, fmt.Errorf("No bound %v pipeline found", targetType)
+	return nil, nil, fmt.Errorf("No bound %v pipeline found", targetType)
 }
 
 func toString(dataval *api.DataValue) string {
@@ -186,6 +193,13 @@ func (verb *pipeVerb) printPipelineData(ctx context.Context, c client.Client, da
 							}
 						}
 					}
+
+				case *api.DataGroup_Shader:
+					if verb.Print.Shaders {
+						for _, line := range strings.Split(x.Shader.SpirvSource, "\n") {
+							fmt.Fprintf(w, "    %s%s\t\t%s\n", prefix, groupPrefix, line)
+						}
+					}
 				}
 			}
 		}
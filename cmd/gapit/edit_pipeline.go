@@ -0,0 +1,310 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type editPipelineVerb struct{ EditPipelineFlags }
+
+func init() {
+	verb := &editPipelineVerb{
+		EditPipelineFlags{
+			OutputTraceFile: "newcapture.gfxtrace",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "edit_pipeline",
+		ShortHelp: "Produce a new trace with the state of the bound pipeline edited by a JSON patch",
+		Action:    verb,
+	})
+}
+
+func (verb *editPipelineVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	if verb.Patch == "" {
+		app.Usage(ctx, "-patch argument is required")
+		return nil
+	}
+
+	patchBytes, err := ioutil.ReadFile(verb.Patch)
+	if err != nil {
+		return log.Errf(ctx, err, "Could not read pipeline patch file %s", verb.Patch)
+	}
+	patch := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		return log.Errf(ctx, err, "Could not parse pipeline patch file %s", verb.Patch)
+	}
+
+	client, c, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if len(verb.At) == 0 {
+		boxedCapture, err := client.Get(ctx, c.Path(), nil)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture")
+		}
+		verb.At = []uint64{uint64(boxedCapture.(*service.Capture).NumCommands) - 1}
+	}
+
+	cmd := c.Command(verb.At[0], verb.At[1:]...)
+	id, pipelineData, err := getBoundPipeline(ctx, client, cmd, verb.Compute)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get bound pipeline resource data")
+	}
+
+	if err := applyPipelinePatch(pipelineData, patch); err != nil {
+		return log.Errf(ctx, err, "Could not apply pipeline patch %s", verb.Patch)
+	}
+
+	resourcePath := cmd.ResourceAfter(id).Path()
+	newResourcePath, err := client.Set(ctx, resourcePath, api.NewResourceData(pipelineData), nil)
+	if err != nil {
+		return log.Errf(ctx, err, "Could not update pipeline data: %v", resourcePath)
+	}
+	newCapture := path.FindCapture(newResourcePath.Node())
+	log.I(ctx, "New capture id: %s", newCapture.ID)
+
+	if verb.SkipOutput {
+		log.I(ctx, "Skipped writing new capture to file.")
+		return nil
+	}
+	newCaptureFilepath, err := filepath.Abs(verb.OutputTraceFile)
+	if err != nil {
+		return log.Errf(ctx, err, "Could not handle capture file path '%s'", newCaptureFilepath)
+	}
+	if err := client.SaveCapture(ctx, newCapture, newCaptureFilepath); err != nil {
+		return log.Errf(ctx, err, "Failed to write capture to: '%s'", newCaptureFilepath)
+	}
+	log.I(ctx, "Capture written to: '%s'", newCaptureFilepath)
+	return nil
+}
+
+// applyPipelinePatch sets the values of the patch in the pipeline data. The
+// patch maps stage names to group names to the values of the group: an object
+// of values by name for a list of values, and an object of rows by row index
+// for a table, each an object of values by column header.
+func applyPipelinePatch(p *api.Pipeline, patch map[string]map[string]interface{}) error {
+	for stageName, groups := range patch {
+		var stage *api.Stage
+		for _, s := range p.Stages {
+			if s.StageName == stageName {
+				stage = s
+			}
+		}
+		if stage == nil {
+			return fmt.Errorf("The pipeline has no %v stage", stageName)
+		}
+
+		for groupName, values := range groups {
+			var group *api.DataGroup
+			for _, g := range stage.Groups {
+				if g.GroupName == groupName {
+					group = g
+				}
+			}
+			if group == nil {
+				return fmt.Errorf("The %v stage has no %v group", stageName, groupName)
+			}
+
+			fields, ok := values.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%v/%v: expected an object, got %v", stageName, groupName, values)
+			}
+			switch data := group.Data.(type) {
+			case *api.DataGroup_KeyValues:
+				for name, value := range fields {
+					var pair *api.KeyValuePair
+					for _, kv := range data.KeyValues.KeyValues {
+						if kv.Name == name {
+							pair = kv
+						}
+					}
+					if pair == nil {
+						return fmt.Errorf("%v/%v has no %v", stageName, groupName, name)
+					}
+					v, err := patchDataValue(pair.Value, value)
+					if err != nil {
+						return fmt.Errorf("%v/%v/%v: %v", stageName, groupName, name, err)
+					}
+					pair.Value = v
+				}
+
+			case *api.DataGroup_Table:
+				for index, row := range fields {
+					i, err := strconv.Atoi(index)
+					if err != nil || i < 0 || i >= len(data.Table.Rows) {
+						return fmt.Errorf("%v/%v has no row %v", stageName, groupName, index)
+					}
+					columns, ok := row.(map[string]interface{})
+					if !ok {
+						return fmt.Errorf("%v/%v[%v]: expected an object, got %v", stageName, groupName, index, row)
+					}
+					for header, value := range columns {
+						j := -1
+						for k, h := range data.Table.Headers {
+							if h == header {
+								j = k
+							}
+						}
+						if j < 0 || j >= len(data.Table.Rows[i].RowValues) {
+							return fmt.Errorf("%v/%v has no %v column", stageName, groupName, header)
+						}
+						v, err := patchDataValue(data.Table.Rows[i].RowValues[j], value)
+						if err != nil {
+							return fmt.Errorf("%v/%v[%v]/%v: %v", stageName, groupName, index, header, err)
+						}
+						data.Table.Rows[i].RowValues[j] = v
+					}
+				}
+
+			default:
+				return fmt.Errorf("%v/%v cannot be patched", stageName, groupName)
+			}
+		}
+	}
+	return nil
+}
+
+// patchDataValue returns the data value of the same kind as old, holding the
+// JSON value v. Enum and bitfield values are given by name, or by value.
+func patchDataValue(old *api.DataValue, v interface{}) (*api.DataValue, error) {
+	switch x := old.Val.(type) {
+	case *api.DataValue_Value:
+		val, err := patchPodValue(x.Value.Get(), v)
+		if err != nil {
+			return nil, err
+		}
+		return api.CreatePoDDataValue(old.TypeName, val), nil
+
+	case *api.DataValue_EnumVal:
+		switch v := v.(type) {
+		case string:
+			return &api.DataValue{
+				TypeName: old.TypeName,
+				Val:      &api.DataValue_EnumVal{&api.EnumValue{StringValue: v, DisplayValue: v}},
+			}, nil
+		case float64:
+			return &api.DataValue{
+				TypeName: old.TypeName,
+				Val:      &api.DataValue_EnumVal{&api.EnumValue{Value: uint64(v)}},
+			}, nil
+		}
+
+	case *api.DataValue_Bitfield:
+		names := []string{}
+		switch v := v.(type) {
+		case string:
+			for _, name := range strings.Split(v, "|") {
+				names = append(names, strings.TrimSpace(name))
+			}
+		case []interface{}:
+			for _, name := range v {
+				s, ok := name.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected %v bit names, got %v", old.TypeName, v)
+				}
+				names = append(names, s)
+			}
+		case float64:
+			return &api.DataValue{
+				TypeName: old.TypeName,
+				Val:      &api.DataValue_Bitfield{&api.BitfieldValue{SetBits: []uint64{uint64(v)}}},
+			}, nil
+		default:
+			return nil, fmt.Errorf("expected %v bit names, got %v", old.TypeName, v)
+		}
+		return &api.DataValue{
+			TypeName: old.TypeName,
+			Val:      &api.DataValue_Bitfield{&api.BitfieldValue{SetBitnames: names, SetDisplayNames: names}},
+		}, nil
+	}
+	return nil, fmt.Errorf("cannot set a %v value to %v", old.TypeName, v)
+}
+
+// patchPodValue returns the JSON value v as the type of the plain value old.
+// Numbers given for string values, such as the hexadecimal masks, are passed
+// through as numbers.
+func patchPodValue(old, v interface{}) (interface{}, error) {
+	switch old.(type) {
+	case bool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", v)
+	case string:
+		switch v.(type) {
+		case string, float64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a string or a number, got %v", v)
+	}
+
+	t := reflect.TypeOf(old)
+	if t.Kind() == reflect.Slice {
+		elements, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array, got %v", v)
+		}
+		out := reflect.MakeSlice(t, len(elements), len(elements))
+		for i, e := range elements {
+			el, err := patchPodValue(reflect.Zero(t.Elem()).Interface(), e)
+			if err != nil {
+				return nil, err
+			}
+			out.Index(i).Set(reflect.ValueOf(el))
+		}
+		return out.Interface(), nil
+	}
+
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("expected a number, got %v", v)
+	}
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("expected an integer, got %v", v)
+		}
+	default:
+		return nil, fmt.Errorf("cannot set a %v to %v", t, v)
+	}
+	return reflect.ValueOf(f).Convert(t).Interface(), nil
+}
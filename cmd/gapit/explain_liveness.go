@@ -0,0 +1,75 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+)
+
+type explainLivenessVerb struct{ ExplainLivenessFlags }
+
+func init() {
+	verb := &explainLivenessVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "explain-liveness",
+		ShortHelp: "Prints the chain of dependencies through which trim keeps a command",
+		Action:    verb,
+	})
+}
+
+func (verb *explainLivenessVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if len(verb.Requested) == 0 || len(verb.Kept) == 0 {
+		app.Usage(ctx, "Both the requested and the kept commands must be specified")
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	requested := capture.Command(verb.Requested[0], verb.Requested[1:]...)
+	kept := capture.Command(verb.Kept[0], verb.Kept[1:]...)
+	chain, err := client.ExplainLiveness(ctx, requested, kept)
+	if err != nil {
+		return log.Errf(ctx, err, "ExplainLiveness(%v, %v)", requested.Indices, kept.Indices)
+	}
+
+	for _, step := range chain.Steps {
+		cmd, err := getCommand(ctx, client, step.Command)
+		if err != nil {
+			return err
+		}
+		if step.Observation {
+			fmt.Printf("%v %v (memory observation)\n", step.Command.Indices, cmd.Name)
+		} else {
+			fmt.Printf("%v %v\n", step.Command.Indices, cmd.Name)
+		}
+		for _, access := range step.Accesses {
+			fmt.Printf("    %v\n", access)
+		}
+	}
+	return nil
+}
@@ -143,6 +143,7 @@ func (verb *exportReplayVerb) Run(ctx context.Context, flags flag.FlagSet) error
 		FramebufferAttachments: fbreqs,
 		GetTimestampsRequest:   tsreq,
 		DisplayToSurface:       onscreen,
+		Verify:                 verb.Verify,
 	}
 
 	if err := client.ExportReplay(ctx, capturePath, device, verb.Out, opts); err != nil {
@@ -0,0 +1,149 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/file"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type exportTexturesVerb struct{ ExportTexturesFlags }
+
+func init() {
+	verb := &exportTexturesVerb{
+		ExportTexturesFlags{
+			At:     -1,
+			Out:    ".",
+			Format: "ktx2",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "export_textures",
+		ShortHelp: "Export all textures at a particular command from a .gfxtrace as KTX2 or DDS files",
+		Action:    verb,
+	})
+}
+
+func (verb *exportTexturesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Format != "ktx2" && verb.Format != "dds" {
+		app.Usage(ctx, "Unknown texture file format '%v', expected 'ktx2' or 'dds'", verb.Format)
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	device, err := getDevice(ctx, client, capture, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	resolveConfig := path.ResolveConfig{ReplayDevice: device}
+
+	boxedResources, err := client.Get(ctx, capture.Resources().Path(), &resolveConfig)
+	if err != nil {
+		return log.Err(ctx, err, "Could not find the capture's resources")
+	}
+	resources := boxedResources.(*service.Resources)
+
+	if verb.At == -1 {
+		boxedCapture, err := client.Get(ctx, capture.Path(), &resolveConfig)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture")
+		}
+		verb.At = int(boxedCapture.(*service.Capture).NumCommands) - 1
+	}
+
+	if err := os.MkdirAll(verb.Out, 0755); err != nil {
+		return log.Errf(ctx, err, "Could not create the output directory %v", verb.Out)
+	}
+
+	getImage := func(ctx context.Context, info *image.Info) ([]byte, error) {
+		data, err := client.Get(ctx, path.NewBlob(info.Bytes.ID()).Path(), &resolveConfig)
+		if err != nil {
+			return nil, err
+		}
+		return data.([]byte), nil
+	}
+
+	for _, types := range resources.GetTypes() {
+		if types.Type != path.ResourceType_Texture {
+			continue
+		}
+		for _, v := range types.GetResources() {
+			if !v.ID.IsValid() {
+				log.E(ctx, "Got resource with invalid ID!\n%+v", v)
+				continue
+			}
+			resourcePath := capture.Command(uint64(verb.At)).ResourceAfter(v.ID)
+			resourceData, err := client.Get(ctx, resourcePath.Path(), &resolveConfig)
+			if err != nil {
+				log.E(ctx, "Could not get data for texture: %v %v", v.GetHandle(), err)
+				continue
+			}
+			texture := resourceData.(*api.ResourceData).GetTexture()
+			if texture == nil {
+				continue
+			}
+
+			tex, err := texture.ImageTexture(ctx, getImage)
+			if err != nil {
+				log.E(ctx, "Could not get the images of texture %v: %v", v.GetHandle(), err)
+				continue
+			}
+
+			ext, data := verb.Format, []byte(nil)
+			if ext == "dds" {
+				if data, err = tex.DDS(); err != nil {
+					log.W(ctx, "Could not export texture %v as DDS, using KTX2 instead: %v", v.GetHandle(), err)
+					ext = "ktx2"
+				}
+			}
+			if ext == "ktx2" {
+				if data, err = tex.KTX2(); err != nil {
+					log.E(ctx, "Could not export texture %v: %v", v.GetHandle(), err)
+					continue
+				}
+			}
+
+			filename := filepath.Join(verb.Out, file.SanitizePath(v.GetHandle()+"."+ext))
+			if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+				log.E(ctx, "Could not write file %v: %v", filename, err)
+				continue
+			}
+			log.I(ctx, "Exported texture %v to %v", v.GetHandle(), filename)
+		}
+	}
+
+	return nil
+}
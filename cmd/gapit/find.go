@@ -0,0 +1,86 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type findVerb struct{ FindFlags }
+
+func init() {
+	verb := &findVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "find",
+		ShortHelp: "Prints the commands of a .gfxtrace file matching a query",
+		Action:    verb,
+	})
+}
+
+func (verb *findVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly one gfx trace file and one query expected, got %d arguments.\n"+
+			"Queries are a command name pattern and a where clause, for example:\n"+
+			"  vkCmdDrawIndexed where indexCount > 30000\n"+
+			"  vkQueueSubmit where queue == 0x1234\n"+
+			"  vkCmdBindPipeline where shaderModules(pipeline) contains 0x5678", flags.NArg())
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filter, err := verb.commandFilter(ctx, client, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to build the CommandFilter")
+	}
+
+	boxedTree, err := client.Get(ctx, capture.CommandTree(filter).Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the command tree")
+	}
+	tree := boxedTree.(*service.CommandTree)
+
+	req := &service.FindRequest{
+		From:            &service.FindRequest_CommandTreeNode{CommandTreeNode: tree.Root},
+		MaxItems:        uint32(verb.Max),
+		Text:            flags.Arg(1),
+		IsRegex:         verb.Regex,
+		IsCaseSensitive: verb.CaseSensitive,
+		IsQuery:         !verb.Text && !verb.Regex,
+	}
+	return client.Find(ctx, req, func(r *service.FindResponse) error {
+		boxedNode, err := client.Get(ctx, r.GetCommandTreeNode().Path(), nil)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the command tree node")
+		}
+		n := boxedNode.(*service.CommandTreeNode)
+		if n.Group != "" {
+			fmt.Fprintln(os.Stdout, n.Group)
+			return nil
+		}
+		return getAndPrintCommand(ctx, client, n.Commands.First(), verb.Observations)
+	})
+}
@@ -180,10 +180,22 @@ type (
 		DeviceFlags
 	}
 	ReportFlags struct {
-		Gapis            GapisFlags
-		Gapir            GapirFlags
-		Out              string `help:"output report path"`
-		DisplayToSurface bool   `help:"display the frames rendered in the replay back to the surface"`
+		Gapis              GapisFlags
+		Gapir              GapirFlags
+		Out                string            `help:"output report path"`
+		DisplayToSurface   bool              `help:"display the frames rendered in the replay back to the surface"`
+		FramegraphAnalysis bool              `help:"include the framegraph analysis of wasteful renderpasses on tile-based GPUs"`
+		Lint               bool              `help:"include the static best-practices lint of the commands"`
+		LintRules          flags.StringSlice `help:"the lint rules to check, all of them if empty (Vulkan: redundant-bind, per-draw-descriptor-sets, tiny-allocations, queue-wait-idle, full-pipeline-barrier, general-layout)"`
+		CaptureFileFlags
+	}
+	DiffFlags struct {
+		Gapis     GapisFlags
+		Out       string `help:"output file path, stdout if empty"`
+		Format    string `help:"output format, either 'text' or 'json'"`
+		Max       int    `help:"maximum number of differences to report, 0 for no limit"`
+		Resources bool   `help:"if true then also compare the resources at the end of each frame"`
+		Pointers  bool   `help:"if true then also compare pointer parameters"`
 		CaptureFileFlags
 	}
 	ExportReplayFlags struct {
@@ -195,6 +207,7 @@ type (
 		Apk            string     `help:"(experimental) name of the stand-alone APK created to perform the replay. This name must be <app_package>.apk (e.g. com.example.replay.apk)"`
 		SdkPath        string     `help:"Path to Android SDK directory (default: ANDROID_SDK_HOME environment variable)"`
 		LoopCount      int        `help:"_The number of times to loop the trace. (experimental)"`
+		Verify         bool       `help:"verify the exported replay payload with the replay interpreter"`
 		CommandFilterFlags
 		CaptureFileFlags
 	}
@@ -225,6 +238,14 @@ type (
 		At    int `help:"command index to dump the resources after, e.g. '1234'"`
 		CaptureFileFlags
 	}
+	ExportTexturesFlags struct {
+		Gapis  GapisFlags
+		Gapir  GapirFlags
+		At     int    `help:"command index to export the textures after, e.g. '1234'"`
+		Out    string `help:"output directory path (default the current directory)"`
+		Format string `help:"texture file format, either 'ktx2' or 'dds'"`
+		CaptureFileFlags
+	}
 	DumpFBOFlags struct {
 		Gapis GapisFlags
 		Gapir GapirFlags
@@ -253,17 +274,31 @@ type (
 		GroupByFrame         bool   `help:"Group commands by frame"`
 		GroupByUserMarkers   bool   `help:"Group commands by user markers"`
 		GroupBySubmission    bool   `help:"Group commands by submissions"`
+		GroupByRenderPass    bool   `help:"Group commands by render pass instance and subpass"`
+		GroupByPipeline      bool   `help:"Group commands by bound graphics pipeline"`
+		GroupByCommandBuffer bool   `help:"Group commands by command buffer, nested under their submission"`
 		AllowIncompleteFrame bool   `help:"_Make a group for incomplete frames"`
 		OnlyExecutedDraws    bool   `help:"Only show executed draw calls from within command buffers"`
 		Observations         ObservationFlags
 		CommandFilterFlags
 		CaptureFileFlags
 	}
+	FindFlags struct {
+		Gapis         GapisFlags
+		Gapir         GapirFlags
+		Max           int  `help:"maximum number of commands to print, 0 for no limit"`
+		Text          bool `help:"if true then search for the text of the commands instead of a query"`
+		Regex         bool `help:"if true then the text to search for is a regular expression. Implies text."`
+		CaseSensitive bool `help:"if true then the text search is case sensitive"`
+		Observations  ObservationFlags
+		CommandFilterFlags
+		CaptureFileFlags
+	}
 	ReplaceResourceFlags struct {
 		Gapis                GapisFlags
 		Gapir                GapirFlags
 		Handle               string `help:"required. handle or ID of the resource to replace"`
-		ResourcePath         string `help:"file path for the new resource"`
+		ResourcePath         string `help:"file path for the new resource: a shader, a .png, .ktx2 or .dds texture, or the raw contents of a buffer"`
 		At                   int    `help:"command index to replace the resource(s) at, e.g. '1234'"`
 		UpdateResourceBinary string `help:"shaders only. binary to run for every shader; consumes resource data from standard input and writes to standard output"`
 		OutputTraceFile      string `help:"file name for the updated trace"`
@@ -350,8 +385,10 @@ type (
 
 	StatusFlags struct {
 		Gapis                GapisFlags
-		StatusUpdateInterval int `help:"Provides status updates at the given interval (in ms)"`
-		MemoryUpdateInterval int `help:"Provides memory updates at the given interval (in ms)"`
+		StatusUpdateInterval int    `help:"Provides status updates at the given interval (in ms)"`
+		MemoryUpdateInterval int    `help:"Provides memory updates at the given interval (in ms)"`
+		Database             bool   `help:"Displays the record counts and sizes of the server's database"`
+		Record               string `help:"Records a Chrome trace of the server's tasks, database resolves and replays to the file until interrupted"`
 	}
 
 	PackagesFlags struct {
@@ -378,17 +415,36 @@ type (
 		Max           struct {
 			Overdraw int `help:"the amount of overdraw to map to white in the output"`
 		}
-		DisplayToSurface bool `help:"display the frames rendered in the replay back to the surface"`
+		DisplayToSurface bool    `help:"display the frames rendered in the replay back to the surface"`
+		Compare          string  `help:"reference png image to compare the screenshot against (e.g. 'reference_%d.png' for multiple screenshots)"`
+		Threshold        float64 `help:"the largest root mean square error permitted when comparing screenshots"`
+		HeatMap          string  `help:"output image file of the heat-map of the differences found by comparing screenshots"`
+		Observations     bool    `help:"compare the replayed framebuffers against the framebuffer observations of the capture instead"`
 		CommandFilterFlags
 		CaptureFileFlags
 	}
 	UnpackFlags struct {
-		Verbose bool `help:"if true, then output will not be truncated"`
+		Verbose bool   `help:"if true, then output will not be truncated"`
+		Index   bool   `help:"if true, then print the block index of version 3 files instead of their protos"`
+		First   uint64 `help:"index of the first root group (the initial state, if any, then the commands) to print"`
+		Count   uint64 `help:"number of root groups to print from version 3 files, only reading the blocks holding them. 0 prints the whole file"`
 	}
 
 	MemoryFlags struct {
-		Gapis GapisFlags
-		At    flags.U64Slice `help:"command/subcommand index to get the memory after, e.g. '[123, 0, 0, 4]'. Empty for last"`
+		Gapis    GapisFlags
+		At       flags.U64Slice `help:"command/subcommand index to get the memory after, e.g. '[123, 0, 0, 4]'. Empty for last"`
+		Timeline bool           `help:"print the device memory events of the whole capture as CSV instead"`
+		Out      string         `help:"output file of the timeline, stdout if empty"`
+		CaptureFileFlags
+	}
+	MeshFlags struct {
+		Gapis   GapisFlags
+		At      flags.U64Slice `help:"command/subcommand index of the draw call, e.g. '[123, 0, 0, 4]'. Empty for every draw call of the frame"`
+		Frame   int            `help:"frame index to export every draw call of. Defaults to the last frame"`
+		Out     string         `help:"output mesh file (default 'mesh.<format>'). Numbered when exporting multiple meshes"`
+		Format  string         `help:"mesh file format, one of 'glb', 'obj' or 'ply'"`
+		Faceted bool           `help:"if true then normals are calculated from each face"`
+		CommandFilterFlags
 		CaptureFileFlags
 	}
 	PipelineFlags struct {
@@ -400,6 +456,15 @@ type (
 		Compute bool `help:"print out the most recently bound compute pipeline instead of graphics pipeline"`
 		CaptureFileFlags
 	}
+	EditPipelineFlags struct {
+		Gapis           GapisFlags
+		At              flags.U64Slice `help:"command/subcommand index to edit the bound pipeline at, e.g. '[123, 0, 0, 4]'. Empty for last"`
+		Compute         bool           `help:"edit the most recently bound compute pipeline instead of graphics pipeline"`
+		Patch           string         `help:"required. JSON file of the pipeline state to set, as {stage: {group: {name: value}}}, with table rows as {stage: {table: {row index: {column: value}}}}"`
+		OutputTraceFile string         `help:"file name for the updated trace"`
+		SkipOutput      bool           `help:"skip writing the modified trace to a file"`
+		CaptureFileFlags
+	}
 	TrimFlags struct {
 		Gapis         GapisFlags
 		Gapir         GapirFlags
@@ -413,6 +478,12 @@ type (
 		CommandFilterFlags
 		CaptureFileFlags
 	}
+	ExplainLivenessFlags struct {
+		Gapis     GapisFlags
+		Requested flags.U64Slice `help:"command/subcommand index requested to trim, e.g. '[123, 0, 0, 4]'"`
+		Kept      flags.U64Slice `help:"command/subcommand index kept by trim, e.g. '[45]'"`
+		CaptureFileFlags
+	}
 	GetTimestampsFlags struct {
 		Gapis     GapisFlags
 		Gapir     GapirFlags
@@ -425,14 +496,30 @@ type (
 		Gapir        GapirFlags
 		Out          string           `help:"Output file (optional, if none then output goes to stdout)"`
 		Json         bool             `help:"Return replay profiling data as JSON instead of text"`
+		Format       string           `help:"output format: 'text', 'json', 'perfetto' (ui.perfetto.dev), 'chrome' (chrome://tracing) or 'csv' (tables written next to -out)"`
 		DisabledCmds []flags.U64Slice `help:"command/subcommand index (e.g. '[123, 0, 0, 4]') for disabling a draw call (repeatable)"`
 		DisableAF    bool             `help:"Disable Anisotropic Filtering for all samplers"`
+		Baseline     string           `help:"profile saved by a previous run (text or JSON) to compare against, writing the differences in the -compare.format instead of the profile"`
+		Metrics      string           `help:"JSON file of derived metrics to compute from the counters of the profile"`
+		Compare      struct {
+			Format        string  `help:"format of the comparison against the baseline: 'csv', 'json' or 'markdown'"`
+			Threshold     float64 `help:"smallest relative change of a metric that is significant"`
+			MaxIndexShift int     `help:"largest difference of the command indices of matched entries"`
+			Fail          bool    `help:"fail if a significant regression is found"`
+		}
 	}
 
 	CreateGraphVisualizationFlags struct {
-		Gapis  GapisFlags
-		Out    string `help:"path to save graph visualization"`
-		Format string `help:"output format of the graph: 'pbtxt' (Tensorboard) or 'dot' (Graphviz)"`
+		Gapis    GapisFlags
+		Out      string `help:"path to save graph visualization"`
+		Format   string `help:"output format of the graph: 'pbtxt' (Tensorboard), 'dot' (Graphviz), 'graphml' (Gephi) or 'json' (Cytoscape)"`
+		Commands struct {
+			From int `help:"index of the first command of the graph (default 0)"`
+			To   int `help:"index of the last command of the graph: -1 for the last command (default -1)"`
+		}
+		Frame    int               `help:"1-based frame to restrict the graph to: 0 for all frames"`
+		Labels   flags.StringSlice `help:"label levels to restrict the graph to, e.g. '[vkRenderPass2, vkCmdDraw]'"`
+		Collapse bool              `help:"merge the subcommand nodes into the command submitting them"`
 	}
 
 	FramegraphFlags struct {
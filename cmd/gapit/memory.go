@@ -16,8 +16,10 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -53,6 +55,10 @@ func (verb *memoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	defer client.Close()
 
+	if verb.Timeline {
+		return verb.timeline(ctx, client, capture)
+	}
+
 	if len(verb.At) == 0 {
 		boxedCapture, err := client.Get(ctx, capture.Path(), nil)
 		if err != nil {
@@ -192,6 +198,64 @@ func (verb *memoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	return nil
 }
 
+// timeline prints the device memory events of the capture as CSV, followed
+// by the heap peaks when writing to a file.
+func (verb *memoryVerb) timeline(ctx context.Context, client service.Service, capture *path.Capture) error {
+	boxedVal, err := client.Get(ctx, capture.MemoryTimeline().Path(), nil)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to load the memory timeline")
+	}
+	timeline := boxedVal.(*api.MemoryTimeline)
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the timeline output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	header := []string{"Command", "Frame", "Event", "Device", "Heap", "MemoryType",
+		"Allocation", "Size", "Resource", "ResourceType", "Offset", "HeapTotal"}
+	if err := w.Write(header); err != nil {
+		return log.Err(ctx, err, "Failed to write the timeline")
+	}
+	for _, e := range timeline.Events {
+		command := ""
+		if e.Command != uint64(api.CmdNoID) {
+			command = fmt.Sprint(e.Command)
+		}
+		resource, resourceType := "", ""
+		if e.Kind == api.MemoryEvent_BIND {
+			resource, resourceType = fmt.Sprint(e.Resource), "Buffer"
+			if e.Image {
+				resourceType = "Image"
+			}
+		}
+		row := []string{command, fmt.Sprint(e.Frame), e.Kind.String(), fmt.Sprint(e.Device),
+			fmt.Sprint(e.Heap), fmt.Sprint(e.MemoryType), fmt.Sprint(e.Allocation), fmt.Sprint(e.Size),
+			resource, resourceType, fmt.Sprint(e.Offset), fmt.Sprint(e.HeapTotal)}
+		if err := w.Write(row); err != nil {
+			return log.Err(ctx, err, "Failed to write the timeline")
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return log.Err(ctx, err, "Failed to write the timeline")
+	}
+
+	if verb.Out != "" {
+		for _, heap := range timeline.Heaps {
+			fmt.Printf("Device %v heap %v: size %v, peak %v at command %v\n",
+				heap.Device, heap.Index, heap.Size, heap.Peak, heap.PeakCommand)
+		}
+	}
+	return nil
+}
+
 type bindingSlice []*api.MemoryBinding
 
 func (bindings bindingSlice) bindingLess(i, j int) bool {
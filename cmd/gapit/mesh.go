@@ -0,0 +1,154 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/meshexport"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type meshVerb struct{ MeshFlags }
+
+var meshWriters = map[string]func(io.Writer, *api.Mesh, string) error{
+	"glb": meshexport.GLB,
+	"obj": meshexport.OBJ,
+	"ply": meshexport.PLY,
+}
+
+func init() {
+	verb := &meshVerb{
+		MeshFlags{
+			Format: "glb",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "mesh",
+		ShortHelp: "Exports the mesh of a draw call, or of every draw call of a frame, from a .gfxtrace",
+		Action:    verb,
+	})
+}
+
+func (verb *meshVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	write, ok := meshWriters[verb.Format]
+	if !ok {
+		app.Usage(ctx, "Unknown mesh file format '%v', expected 'glb', 'obj' or 'ply'", verb.Format)
+		return nil
+	}
+	if verb.Out == "" {
+		verb.Out = "mesh." + verb.Format
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var commands []*path.Command
+	if len(verb.At) > 0 {
+		commands = []*path.Command{capture.Command(verb.At[0], verb.At[1:]...)}
+	} else {
+		commands, err = verb.frameDrawCalls(ctx, capture, client)
+		if err != nil {
+			return err
+		}
+		if len(commands) == 0 {
+			return fmt.Errorf("No draw calls found in frame %d", verb.Frame)
+		}
+	}
+
+	multi := len(commands) > 1
+	for idx, cmd := range commands {
+		boxedMesh, err := client.Get(ctx, cmd.Mesh(path.NewMeshOptions(verb.Faceted)).Path(), nil)
+		if err != nil {
+			log.E(ctx, "Could not get the mesh of command %v: %v", cmd.Indices, err)
+			continue
+		}
+		out := formatOut(verb.Out, idx, multi)
+		if err := verb.writeMesh(write, boxedMesh.(*api.Mesh), cmd, out); err != nil {
+			log.E(ctx, "Could not write the mesh of command %v: %v", cmd.Indices, err)
+			continue
+		}
+		log.I(ctx, "Exported the mesh of command %v to %v", cmd.Indices, out)
+	}
+	return nil
+}
+
+func (verb *meshVerb) writeMesh(write func(io.Writer, *api.Mesh, string) error, mesh *api.Mesh, cmd *path.Command, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := write(f, mesh, fmt.Sprintf("Command %v", cmd.Indices)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// frameDrawCalls returns the draw calls of the frame selected by the flags.
+func (verb *meshVerb) frameDrawCalls(ctx context.Context, capture *path.Capture, client service.Service) ([]*path.Command, error) {
+	filter, err := verb.CommandFilterFlags.commandFilter(ctx, client, capture)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't get filter")
+	}
+
+	events, err := getEvents(ctx, client, &path.Events{
+		Capture:     capture,
+		LastInFrame: true,
+		DrawCalls:   true,
+		Filter:      filter,
+	})
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't get frame events")
+	}
+
+	frames := [][]*path.Command{{}}
+	for _, e := range events {
+		switch e.Kind {
+		case service.EventKind_DrawCall:
+			frames[len(frames)-1] = append(frames[len(frames)-1], e.Command)
+		case service.EventKind_LastInFrame:
+			frames = append(frames, []*path.Command{})
+		}
+	}
+	// Drop the draw calls after the last end of frame, unless the capture has
+	// no ends of frames.
+	if len(frames) > 1 {
+		frames = frames[:len(frames)-1]
+	}
+
+	if verb.Frame == 0 {
+		verb.Frame = len(frames)
+	}
+	if verb.Frame < 1 || verb.Frame > len(frames) {
+		return nil, fmt.Errorf("Invalid frame number %d (last frame is %d)", verb.Frame, len(frames))
+	}
+	return frames[verb.Frame-1], nil
+}
@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -28,6 +30,7 @@ import (
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
 )
 
 type profileVerb struct{ GpuProfileFlags }
@@ -36,7 +39,11 @@ func init() {
 	verb := &profileVerb{GpuProfileFlags{
 		DisabledCmds: []flags.U64Slice{},
 		DisableAF:    false,
+		Format:       "text",
 	}}
+	verb.Compare.Format = "csv"
+	verb.Compare.Threshold = 0.05
+	verb.Compare.MaxIndexShift = 8
 	app.AddVerb(&app.Verb{
 		Name:      "profile",
 		ShortHelp: "Profile a replay to get GPU activity and counter data.",
@@ -49,6 +56,25 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
 		return nil
 	}
+	format := verb.Format
+	if verb.Json {
+		format = "json"
+	}
+	switch format {
+	case "text", "json", "perfetto", "chrome", "csv":
+	default:
+		app.Usage(ctx, "Unknown format %v, expected 'text', 'json', 'perfetto', 'chrome' or 'csv'", format)
+		return nil
+	}
+	if verb.Baseline != "" && format != "text" {
+		app.Usage(ctx, "The format of the comparison against the baseline is set with -compare.format, not -format")
+		return nil
+	}
+	if format == "csv" && verb.Out == "" {
+		app.Usage(ctx, "The csv format requires an output file, set with -out")
+		return nil
+	}
+
 	capture, err := filepath.Abs(flags.Arg(0))
 	if err != nil {
 		log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
@@ -91,6 +117,22 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		return err
 	}
 
+	if verb.Metrics != "" {
+		if err := addDerivedMetrics(ctx, res, verb.Metrics); err != nil {
+			return err
+		}
+	}
+
+	var labels profile.CommandLabels
+	if format != "text" && format != "json" {
+		if labels, err = profileCommandLabels(ctx, client, capturePath, res); err != nil {
+			return err
+		}
+		if format == "csv" {
+			return writeProfileCSV(ctx, verb.Out, res, labels)
+		}
+	}
+
 	out := os.Stdout
 	if verb.Out != "" {
 		out, err = os.Create(verb.Out)
@@ -100,17 +142,64 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		defer out.Close()
 	}
 
-	if verb.Json {
+	if verb.Baseline != "" {
+		return verb.writeComparison(ctx, out, res)
+	}
+
+	switch format {
+	case "json":
 		jsonBytes, err := json.MarshalIndent(res, "", "  ")
 		if err != nil {
 			return log.Err(ctx, err, "Couldn't marshal trace to JSON")
 		}
 		fmt.Fprintln(out, string(jsonBytes))
-	} else {
+	case "text":
 		err = proto.MarshalText(out, res)
 		if err != nil {
 			return log.Err(ctx, err, "Couldn't marshal trace to text")
 		}
+	default:
+		return writeProfileTrace(ctx, out, res, labels, format)
 	}
 	return nil
 }
+
+// writeComparison writes the differences between the profile and the baseline
+// profile.
+func (verb *profileVerb) writeComparison(ctx context.Context, out io.Writer, res *service.ProfilingData) error {
+	baseline, err := loadBaselineProfile(ctx, verb.Baseline)
+	if err != nil {
+		return err
+	}
+	if res.GpuCounters == nil {
+		return log.Err(ctx, nil, "The profile has no GPU counters")
+	}
+	comparison := profile.Compare(baseline, res.GpuCounters, profile.CompareOptions{
+		MaxIndexShift: uint64(verb.Compare.MaxIndexShift),
+		Threshold:     verb.Compare.Threshold,
+	})
+	if err := writeProfileComparison(ctx, out, comparison, verb.Compare.Format); err != nil {
+		return err
+	}
+	if n := comparison.Regressions(); n > 0 {
+		log.W(ctx, "Found %v significant regressions against the baseline", n)
+		if verb.Compare.Fail {
+			return log.Errf(ctx, nil, "Found %v significant regressions against the baseline", n)
+		}
+	}
+	return nil
+}
+
+// addDerivedMetrics adds the derived metrics defined in the file to the
+// profile.
+func addDerivedMetrics(ctx context.Context, res *service.ProfilingData, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to read the derived metrics %v", filename)
+	}
+	defs, err := profile.ParseDerivedMetrics(data)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to parse the derived metrics %v", filename)
+	}
+	return profile.AddDerivedMetrics(ctx, res, defs)
+}
@@ -0,0 +1,187 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// loadBaselineProfile returns the GPU counters of the profile saved by a
+// previous run of the profile verb, in either the text or the JSON format.
+func loadBaselineProfile(ctx context.Context, filename string) (*service.ProfilingData_GpuCounters, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the baseline profile %v", filename)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		// Only the GPU counters are decoded, as the slice extras can't be
+		// decoded from JSON.
+		var baseline struct {
+			GpuCounters *service.ProfilingData_GpuCounters `json:"gpu_counters"`
+		}
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			return nil, log.Errf(ctx, err, "Failed to parse the baseline profile %v", filename)
+		}
+		if baseline.GpuCounters == nil {
+			return nil, log.Errf(ctx, nil, "The baseline profile %v has no GPU counters", filename)
+		}
+		return baseline.GpuCounters, nil
+	}
+
+	baseline := &service.ProfilingData{}
+	if err := proto.UnmarshalText(string(data), baseline); err != nil {
+		return nil, log.Errf(ctx, err, "Failed to parse the baseline profile %v", filename)
+	}
+	if baseline.GpuCounters == nil {
+		return nil, log.Errf(ctx, nil, "The baseline profile %v has no GPU counters", filename)
+	}
+	return baseline.GpuCounters, nil
+}
+
+type perfRange struct {
+	Estimate float64 `json:"estimate"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+// profileDiffRow is a row of the comparison of two profiles. Entries found in
+// only one of the profiles have a single row without a metric.
+type profileDiffRow struct {
+	Command  string     `json:"command"`
+	Label    string     `json:"label"`
+	Metric   string     `json:"metric,omitempty"`
+	Unit     string     `json:"unit,omitempty"`
+	Baseline *perfRange `json:"baseline,omitempty"`
+	Current  *perfRange `json:"current,omitempty"`
+	Delta    float64    `json:"delta"`
+	// Relative is nil if the baseline estimate is zero.
+	Relative *float64 `json:"relative,omitempty"`
+	Status   string   `json:"status,omitempty"`
+}
+
+func profileDiffRows(c *profile.Comparison) []profileDiffRow {
+	rows := []profileDiffRow{}
+	for _, e := range c.Entries {
+		command := fmt.Sprint(e.Command())
+		switch {
+		case e.Baseline == nil:
+			rows = append(rows, profileDiffRow{Command: command, Label: e.Label, Status: "added"})
+			continue
+		case e.Current == nil:
+			rows = append(rows, profileDiffRow{Command: command, Label: e.Label, Status: "removed"})
+			continue
+		}
+		for _, m := range e.Metrics {
+			row := profileDiffRow{
+				Command:  command,
+				Label:    e.Label,
+				Metric:   m.Metric.Name,
+				Unit:     m.Metric.Unit,
+				Baseline: &perfRange{m.Baseline.Estimate, m.Baseline.Min, m.Baseline.Max},
+				Current:  &perfRange{m.Current.Estimate, m.Current.Min, m.Current.Max},
+				Delta:    m.Delta,
+				Status:   m.Status.String(),
+			}
+			if !math.IsInf(m.Relative, 0) {
+				relative := m.Relative
+				row.Relative = &relative
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func formatRelative(r *float64) string {
+	if r == nil {
+		return "inf"
+	}
+	return fmt.Sprintf("%+.2f%%", *r*100)
+}
+
+// writeProfileComparison writes the comparison of two profiles in the format,
+// which is one of "csv", "json" or "markdown".
+func writeProfileComparison(ctx context.Context, out io.Writer, c *profile.Comparison, format string) error {
+	rows := profileDiffRows(c)
+	switch format {
+	case "csv":
+		w := csv.NewWriter(out)
+		header := []string{"Command", "Label", "Metric", "Unit", "Baseline", "BaselineMin", "BaselineMax",
+			"Current", "CurrentMin", "CurrentMax", "Delta", "Relative", "Status"}
+		if err := w.Write(header); err != nil {
+			return log.Err(ctx, err, "Failed to write the comparison")
+		}
+		for _, r := range rows {
+			record := []string{r.Command, r.Label, r.Metric, r.Unit, "", "", "", "", "", "", "", "", r.Status}
+			if r.Baseline != nil && r.Current != nil {
+				record[4], record[5], record[6] = fmt.Sprint(r.Baseline.Estimate), fmt.Sprint(r.Baseline.Min), fmt.Sprint(r.Baseline.Max)
+				record[7], record[8], record[9] = fmt.Sprint(r.Current.Estimate), fmt.Sprint(r.Current.Min), fmt.Sprint(r.Current.Max)
+				record[10], record[11] = fmt.Sprint(r.Delta), formatRelative(r.Relative)
+			}
+			if err := w.Write(record); err != nil {
+				return log.Err(ctx, err, "Failed to write the comparison")
+			}
+		}
+		w.Flush()
+		return w.Error()
+
+	case "json":
+		jsonBytes, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return log.Err(ctx, err, "Couldn't marshal the comparison to JSON")
+		}
+		_, err = fmt.Fprintln(out, string(jsonBytes))
+		return err
+
+	case "markdown":
+		escape := strings.NewReplacer("|", "\\|").Replace
+		fmt.Fprintln(out, "| Command | Label | Metric | Baseline | Current | Delta | Change | Status |")
+		fmt.Fprintln(out, "|---|---|---|---:|---:|---:|---:|---|")
+		for _, r := range rows {
+			if r.Baseline == nil || r.Current == nil {
+				fmt.Fprintf(out, "| %v | %v | | | | | | %v |\n", r.Command, escape(r.Label), r.Status)
+				continue
+			}
+			status := r.Status
+			if r.Status == profile.Regression.String() {
+				status = "**" + r.Status + "**"
+			}
+			fmt.Fprintf(out, "| %v | %v | %v | %.4g [%.4g, %.4g] | %.4g [%.4g, %.4g] | %+.4g | %v | %v |\n",
+				r.Command, escape(r.Label), escape(r.Metric),
+				r.Baseline.Estimate, r.Baseline.Min, r.Baseline.Max,
+				r.Current.Estimate, r.Current.Min, r.Current.Max,
+				r.Delta, formatRelative(r.Relative), status)
+		}
+		_, err := fmt.Fprintf(out, "\n%v regressions\n", c.Regressions())
+		return err
+
+	default:
+		return log.Errf(ctx, nil, "Unknown comparison format %v, expected 'csv', 'json' or 'markdown'", format)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// profileCommandLabels returns the labels of the commands the slice groups of
+// the profile link to, resolved from the command tree of the capture.
+func profileCommandLabels(ctx context.Context, c client.Client, capture *path.Capture, data *service.ProfilingData) (profile.CommandLabels, error) {
+	boxedTree, err := c.Get(ctx, (&path.CommandTree{
+		Capture:              capture,
+		GroupByFrame:         true,
+		GroupByDrawCall:      true,
+		GroupByUserMarkers:   true,
+		GroupBySubmission:    true,
+		AllowIncompleteFrame: true,
+		MaxChildren:          2000,
+	}).Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to load the command tree")
+	}
+	tree := boxedTree.(*service.CommandTree).GetRoot().GetTree()
+
+	labels := profile.CommandLabels{}
+	for _, g := range data.GetSlices().GetGroups() {
+		if g.Link == nil {
+			continue
+		}
+		label, err := commandLabel(ctx, c, tree, g.Link)
+		if err != nil {
+			log.W(ctx, "Failed to resolve the label of command %v: %v", g.Link.Indices, err)
+			continue
+		}
+		labels[g.Id] = label
+	}
+	return labels, nil
+}
+
+// commandLabel returns the name of the command tree group the command
+// represents, or the name of the command if it doesn't represent a group.
+func commandLabel(ctx context.Context, c client.Client, tree *path.ID, cmd *path.Command) (string, error) {
+	boxedNodePath, err := c.Get(ctx, (&path.CommandTreeNodeForCommand{
+		Tree:        tree,
+		Command:     cmd,
+		PreferGroup: true,
+	}).Path(), nil)
+	if err != nil {
+		return "", err
+	}
+	boxedNode, err := c.Get(ctx, boxedNodePath.(*path.CommandTreeNode).Path(), nil)
+	if err != nil {
+		return "", err
+	}
+	if group := boxedNode.(*service.CommandTreeNode).Group; group != "" {
+		return group, nil
+	}
+	boxedCmd, err := c.Get(ctx, cmd.Path(), nil)
+	if err != nil {
+		return "", err
+	}
+	return boxedCmd.(*api.Command).Name, nil
+}
+
+// writeProfileTrace writes the profile as a trace in the format, which is
+// either "perfetto" or "chrome".
+func writeProfileTrace(ctx context.Context, out io.Writer, data *service.ProfilingData, labels profile.CommandLabels, format string) error {
+	write, name := profile.WritePerfettoTrace, "Perfetto"
+	if format == "chrome" {
+		write, name = profile.WriteChromeTrace, "Chrome"
+	}
+	if err := write(out, data, labels); err != nil {
+		return log.Errf(ctx, err, "Failed to write the %v trace", name)
+	}
+	return nil
+}
+
+// writeProfileCSV writes the slices, counters and command metrics of the
+// profile as CSV tables, to files named after the output file with the
+// suffixes "_slices", "_counters" and "_commands".
+func writeProfileCSV(ctx context.Context, outFile string, data *service.ProfilingData, labels profile.CommandLabels) error {
+	if outFile == "" {
+		return log.Err(ctx, nil, "The csv format requires an output file")
+	}
+	base := strings.TrimSuffix(outFile, filepath.Ext(outFile))
+	tables := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"slices", func(w io.Writer) error { return profile.WriteSlicesCSV(w, data, labels) }},
+		{"counters", func(w io.Writer) error { return profile.WriteCountersCSV(w, data) }},
+		{"commands", func(w io.Writer) error { return profile.WriteCommandsCSV(w, data, labels) }},
+	}
+	for _, table := range tables {
+		filename := base + "_" + table.name + ".csv"
+		f, err := os.Create(filename)
+		if err != nil {
+			return log.Errf(ctx, err, "Creating file (%v)", filename)
+		}
+		err = table.write(f)
+		f.Close()
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to write the %v table", table.name)
+		}
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/image"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/shell"
 	"github.com/google/gapid/gapis/api"
@@ -88,28 +89,48 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 
 	switch {
 	case verb.Handle != "":
+		var matchedType path.ResourceType
 		matchedResource, err := resources.FindSingle(func(t path.ResourceType, r service.Resource) bool {
-			return t == path.ResourceType_Shader &&
-				(strings.Contains(r.GetHandle(), verb.Handle) || strings.Contains(r.GetID().ID().String(), verb.Handle))
+			switch t {
+			case path.ResourceType_Shader, path.ResourceType_Texture, path.ResourceType_Buffer:
+			default:
+				return false
+			}
+			if strings.Contains(r.GetHandle(), verb.Handle) || strings.Contains(r.GetID().ID().String(), verb.Handle) {
+				matchedType = t
+				return true
+			}
+			return false
 		})
 		if err != nil {
 			return err
 		}
 		resourcePath = capture.Command(uint64(verb.At)).ResourceAfter(matchedResource.ID).Path()
-		oldResourceData, err := client.Get(ctx, resourcePath, nil)
-		if err != nil {
-			log.Errf(ctx, err, "Could not get data for shader: %v", matchedResource)
-			return err
-		}
-		shaderResourceData := oldResourceData.(*api.ResourceData).GetShader()
 		newResourceBytes, err := ioutil.ReadFile(verb.ResourcePath)
 		if err != nil {
 			return log.Errf(ctx, err, "Could not read resource file %s", verb.ResourcePath)
 		}
-		resourceData = api.NewResourceData(&api.Shader{
-			Type:   shaderResourceData.GetType(),
-			Source: string(newResourceBytes),
-		})
+		switch matchedType {
+		case path.ResourceType_Shader:
+			oldResourceData, err := client.Get(ctx, resourcePath, nil)
+			if err != nil {
+				log.Errf(ctx, err, "Could not get data for shader: %v", matchedResource)
+				return err
+			}
+			shaderResourceData := oldResourceData.(*api.ResourceData).GetShader()
+			resourceData = api.NewResourceData(&api.Shader{
+				Type:   shaderResourceData.GetType(),
+				Source: string(newResourceBytes),
+			})
+		case path.ResourceType_Texture:
+			texture, err := loadTextureFile(verb.ResourcePath, newResourceBytes)
+			if err != nil {
+				return log.Errf(ctx, err, "Could not load texture file %s", verb.ResourcePath)
+			}
+			resourceData = api.NewResourceData(api.NewTextureData(texture))
+		case path.ResourceType_Buffer:
+			resourceData = api.NewResourceData(&api.Buffer{Data: newResourceBytes})
+		}
 	case verb.UpdateResourceBinary != "":
 		shaderResources := resources.FindAll(func(t path.ResourceType, r service.Resource) bool {
 			return t == path.ResourceType_Shader
@@ -162,6 +183,33 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 	return nil
 }
 
+// loadTextureFile decodes the texture held by the PNG, KTX2 or DDS file.
+func loadTextureFile(filename string, data []byte) (*image.Texture, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png":
+		img, err := image.PNGFrom(data)
+		if err != nil {
+			return nil, err
+		}
+		if img, err = img.Convert(image.RGBA_U8_NORM); err != nil {
+			return nil, err
+		}
+		return &image.Texture{
+			Format: img.Format,
+			Width:  img.Width,
+			Height: img.Height,
+			Depth:  1,
+			Faces:  1,
+			Levels: [][][]byte{{img.Bytes}},
+		}, nil
+	case ".ktx2":
+		return image.KTX2From(data)
+	case ".dds":
+		return image.DDSFrom(data)
+	}
+	return nil, fmt.Errorf("Unknown texture file format '%v', expected a .png, .ktx2 or .dds file", filepath.Ext(filename))
+}
+
 // getNewResourceData runs the update resource binary on the old resource data
 // and returns the newly generated resource data
 func (verb *replaceResourceVerb) getNewResourceData(ctx context.Context, resourceData string) (string, error) {
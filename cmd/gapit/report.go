@@ -87,7 +87,11 @@ func (verb *reportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	commands := boxedCommands.(*service.Commands).List
 
-	boxedReport, err := client.Get(ctx, capturePath.Report(device, verb.DisplayToSurface).Path(), nil)
+	reportPath := capturePath.Report(device, verb.DisplayToSurface)
+	reportPath.FramegraphAnalysis = verb.FramegraphAnalysis
+	reportPath.Lint = verb.Lint
+	reportPath.LintRules = verb.LintRules
+	boxedReport, err := client.Get(ctx, reportPath.Path(), nil)
 	if err != nil {
 		return log.Err(ctx, err, "Failed to acquire the capture's report")
 	}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"image"
 	"image/png"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/image/compare"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/client"
 	"github.com/google/gapid/gapis/service"
@@ -40,10 +42,11 @@ type screenshotVerb struct{ ScreenshotFlags }
 func init() {
 	verb := &screenshotVerb{
 		ScreenshotFlags{
-			At:    []flags.U64Slice{},
-			Frame: []int{},
-			Out:   "screenshot.png",
-			NoOpt: false,
+			At:        []flags.U64Slice{},
+			Frame:     []int{},
+			Out:       "screenshot.png",
+			NoOpt:     false,
+			Threshold: 0.01,
 		},
 	}
 
@@ -71,6 +74,10 @@ func (verb *screenshotVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		return err
 	}
 
+	if verb.Observations {
+		return verb.compareObservations(ctx, capture, device, client)
+	}
+
 	var commands []*path.Command
 	if len(verb.At) > 0 {
 		for _, at := range verb.At {
@@ -99,7 +106,16 @@ func (verb *screenshotVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 
 			frame, err := verb.getSingleFrame(ctx, command, device, client)
 			if err == nil {
-				err = verb.writeSingleFrame(flipImg(frame), formatOut(verb.Out, idx, multi))
+				frame = flipImg(frame)
+				err = verb.writeSingleFrame(frame, formatOut(verb.Out, idx, multi))
+			}
+			if err == nil && verb.Compare != "" {
+				var reference *img.Data
+				reference, err = readReferenceImage(formatOut(verb.Compare, idx, multi))
+				if err == nil {
+					ctx := log.V{"cmd": command.Indices}.Bind(ctx)
+					err = verb.compareFrame(ctx, frame, reference, idx, multi)
+				}
 			}
 			c <- err
 		}(idx, command)
@@ -137,6 +153,151 @@ func (verb *screenshotVerb) writeSingleFrame(frame image.Image, fn string) error
 	return png.Encode(out, frame)
 }
 
+// readReferenceImage returns the image of the png file.
+func readReferenceImage(fn string) (*img.Data, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return img.PNGFrom(data)
+}
+
+// compareFrame compares the frame against the reference image, writing the
+// heat-map of their differences if requested. It returns an error if the root
+// mean square error exceeds the threshold.
+func (verb *screenshotVerb) compareFrame(ctx context.Context, frame *image.NRGBA, reference *img.Data, idx int, multi bool) error {
+	data := &img.Data{
+		Format: img.RGBA_U8_NORM,
+		Width:  uint32(frame.Rect.Dx()),
+		Height: uint32(frame.Rect.Dy()),
+		Depth:  1,
+		Bytes:  frame.Pix,
+	}
+	res, err := compare.Compare(reference, data)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to compare the frame with the reference")
+	}
+	log.I(ctx, "%v", res)
+
+	if verb.HeatMap != "" {
+		heat, err := compare.HeatMap(reference, data, res.MaxError)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to create the heat-map")
+		}
+		w, h := int(heat.Width), int(heat.Height)
+		err = verb.writeSingleFrame(&image.NRGBA{
+			Rect:   image.Rect(0, 0, w, h),
+			Stride: w * 4,
+			Pix:    heat.Bytes,
+		}, formatOut(verb.HeatMap, idx, multi))
+		if err != nil {
+			return err
+		}
+	}
+
+	if res.RMSE > verb.Threshold {
+		return log.Errf(ctx, nil, "Frame differs from the reference by more than the threshold %v (%v)", verb.Threshold, res)
+	}
+	return nil
+}
+
+// compareObservations compares the replayed framebuffers against the
+// framebuffer observations of the capture.
+func (verb *screenshotVerb) compareObservations(ctx context.Context, capture *path.Capture, device *path.Device, client service.Service) error {
+	filter, err := verb.CommandFilterFlags.commandFilter(ctx, client, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't get filter")
+	}
+
+	events, err := getEvents(ctx, client, &path.Events{
+		Capture:                 capture,
+		LastInFrame:             true,
+		FramebufferObservations: true,
+		Filter:                  filter,
+	})
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't get framebuffer observation events")
+	}
+
+	type observation struct {
+		observed, rendered *path.Command
+	}
+	var observations []observation
+	var lastFrameEvent *path.Command
+	for _, e := range events {
+		switch e.Kind {
+		case service.EventKind_FramebufferObservation:
+			// We assume FBO events come after other events on a command.
+			if lastFrameEvent == nil {
+				log.W(ctx, "Got framebuffer observation but nothing wrote to the frame")
+				continue
+			}
+			observations = append(observations, observation{e.Command, lastFrameEvent})
+		case service.EventKind_LastInFrame:
+			lastFrameEvent = e.Command
+		}
+	}
+	if len(observations) == 0 {
+		return log.Err(ctx, nil, "The capture has no framebuffer observations")
+	}
+
+	// Submit requests in parallel, so that gapis will batch them.
+	var wg sync.WaitGroup
+	c := make(chan error)
+	for idx, o := range observations {
+		wg.Add(1)
+		go func(idx int, o observation) {
+			defer wg.Done()
+			ctx := log.V{"observation": o.observed.Indices}.Bind(ctx)
+
+			observed, err := getFBO(ctx, client, o.observed)
+			if err != nil {
+				c <- log.Err(ctx, err, "Get framebuffer observation failed")
+				return
+			}
+			// Flip the observation to the orientation of the frame.
+			observedFrame, err := img.Convert(observed.Bytes, int(observed.Width), int(observed.Height), 1, observed.Format, img.RGBA_U8_NORM)
+			if err != nil {
+				c <- log.Err(ctx, err, "Failed to convert the framebuffer observation to RGBA")
+				return
+			}
+			observed = &img.Data{
+				Format: img.RGBA_U8_NORM,
+				Width:  observed.Width,
+				Height: observed.Height,
+				Depth:  1,
+				Bytes: flipImg(&image.NRGBA{
+					Rect:   image.Rect(0, 0, int(observed.Width), int(observed.Height)),
+					Stride: int(observed.Width) * 4,
+					Pix:    observedFrame,
+				}).Pix,
+			}
+
+			frame, err := verb.getSingleFrame(ctx, o.rendered, device, client)
+			if err == nil {
+				err = verb.compareFrame(ctx, flipImg(frame), observed, idx, true)
+			}
+			c <- err
+		}(idx, o)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+
+	failed := 0
+	for err := range c {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return log.Errf(ctx, nil, "%v of %v replayed frames differ from the framebuffer observations", failed, len(observations))
+	}
+	log.I(ctx, "All %v replayed frames match the framebuffer observations", len(observations))
+	return nil
+}
+
 func (verb *screenshotVerb) getSingleFrame(ctx context.Context, cmd *path.Command, device *path.Device, client service.Service) (*image.NRGBA, error) {
 	ctx = log.V{"cmd": cmd.Indices}.Bind(ctx)
 	settings := &path.RenderSettings{
@@ -24,12 +24,14 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/client"
 	"github.com/google/gapid/gapis/service"
 )
 
@@ -76,6 +78,32 @@ func readableBytes(nBytes uint64) string {
 	}
 }
 
+// printDatabaseStats prints a table of the database record statistics, with the
+// record types using the most memory first.
+func printDatabaseStats(stats []*service.DatabaseRecordStats) {
+	sorted := append([]*service.DatabaseRecordStats{}, stats...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DataBytes+sorted[i].ObjectBytes > sorted[j].DataBytes+sorted[j].ObjectBytes
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Database Records:")
+	fmt.Fprintln(w, "\tType\tCount\tResolved\tEvicted\tData\tObjects")
+	total := service.DatabaseRecordStats{}
+	for _, s := range sorted {
+		fmt.Fprintf(w, "\t%v\t%v\t%v\t%v\t%v\t%v\n", s.Type, s.Count, s.Resolved, s.Evicted,
+			readableBytes(s.DataBytes), readableBytes(s.ObjectBytes))
+		total.Count += s.Count
+		total.Resolved += s.Resolved
+		total.Evicted += s.Evicted
+		total.DataBytes += s.DataBytes
+		total.ObjectBytes += s.ObjectBytes
+	}
+	fmt.Fprintf(w, "\tTotal\t%v\t%v\t%v\t%v\t%v\n", total.Count, total.Resolved, total.Evicted,
+		readableBytes(total.DataBytes), readableBytes(total.ObjectBytes))
+	w.Flush()
+}
+
 func newTask(id, parent uint64, name string, background bool) *tsk {
 	return &tsk{
 		id:         id,
@@ -108,7 +136,37 @@ func (s u64List) Less(i, j int) bool { return s[i] < s[j] }
 // Swap swaps the elements with indexes i and j.
 func (s u64List) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// startRecording starts recording the server's trace to the record file. The
+// returned function stops the recording.
+func (verb *statusVerb) startRecording(ctx context.Context, c client.Client) (stop func(), err error) {
+	f, err := os.Create(verb.Record)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to create the record file %v", verb.Record)
+	}
+	snapshotInterval := uint32(verb.MemoryUpdateInterval / 1000)
+	if snapshotInterval == 0 {
+		snapshotInterval = 1
+	}
+	stopProfile, err := c.Profile(ctx, nil, f, snapshotInterval)
+	if err != nil {
+		f.Close()
+		return nil, log.Err(ctx, err, "Failed to start recording the server's trace")
+	}
+	return func() {
+		if err := stopProfile(); err != nil {
+			log.E(ctx, "Error stopping the recording: %v", err)
+		}
+		f.Close()
+		log.I(ctx, "Trace recorded to %v", verb.Record)
+	}, nil
+}
+
 func (verb *statusVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if verb.Database && verb.MemoryUpdateInterval == 0 {
+		// The database statistics are sent with the memory updates.
+		verb.MemoryUpdateInterval = verb.StatusUpdateInterval
+	}
+
 	client, err := getGapis(ctx, verb.Gapis, GapirFlags{})
 	if err != nil {
 		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
@@ -119,6 +177,14 @@ func (verb *statusVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		}
 	}()
 
+	if verb.Record != "" {
+		stopRecording, err := verb.startRecording(ctx, client)
+		if err != nil {
+			return err
+		}
+		defer stopRecording()
+	}
+
 	statusMutex := sync.Mutex{}
 
 	ancestors := make(map[uint64][]uint64)
@@ -126,6 +192,7 @@ func (verb *statusVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	totalBlocked := 0
 	currentMemoryUsage := uint64(0)
 	maxMemoryUsage := uint64(0)
+	databaseStats := []*service.DatabaseRecordStats{}
 	replayTotalInstrs := uint32(0)
 	replayFinishedInstrs := uint32(0)
 
@@ -191,6 +258,9 @@ func (verb *statusVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 			fmt.Printf("Background Tasks: \n")
 			print(activeTasks, 1, true)
 			fmt.Printf("Blocked Task Count: %d\n", totalBlocked)
+			if verb.Database {
+				printDatabaseStats(databaseStats)
+			}
 			return nil
 		})
 	})
@@ -309,10 +379,14 @@ func (verb *statusVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 					fmt.Printf("EVENT--> %+v\n", tu.Event)
 				}
 			}, func(tu *service.MemoryStatus) {
+				statusMutex.Lock()
+				defer statusMutex.Unlock()
+
 				if tu.TotalHeap > maxMemoryUsage {
 					maxMemoryUsage = tu.TotalHeap
 				}
 				currentMemoryUsage = tu.TotalHeap
+				databaseStats = tu.Database
 			}, func(tu *service.ReplayUpdate) {
 				replayTotalInstrs = tu.TotalInstrs
 				replayFinishedInstrs = tu.FinishedInstrs
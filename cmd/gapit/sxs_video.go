@@ -26,6 +26,7 @@ import (
 
 	"github.com/google/gapid/core/event/task"
 	img "github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/image/compare"
 	"github.com/google/gapid/core/image/font"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/math/f32"
@@ -314,30 +315,10 @@ func diff(x, y color.Color) (r, g, b, a int) {
 	return sint.Abs(int(r0) - int(r1)), sint.Abs(int(g0) - int(g1)), sint.Abs(int(b0) - int(b1)), sint.Abs(int(a0) - int(a1))
 }
 
-var heatGradient = [8][3]int{
-	{0x00, 0x00, 0x48},
-	{0x00, 0x58, 0xbf},
-	{0x00, 0xd8, 0xfe},
-	{0x00, 0xed, 0x06},
-	{0xb0, 0xeb, 0x00},
-	{0xff, 0xb9, 0x19},
-	{0xff, 0x00, 0x00},
-	{0xff, 0xff, 0xff},
-}
-
 // heat returns a head-map RGB value for the value v that ranges between [0-0xffff].
 func heat(v int) (r, g, b, a int) {
-	c := len(heatGradient) - 1
-	i := v * c
-	indexA := sint.Min(i>>16, c-1)
-	colorA := heatGradient[indexA]
-	colorB := heatGradient[indexA+1]
-	weightB := i & 0xffff
-	weightA := 0x10000 - weightB
-	r = (weightA*colorA[0] + weightB*colorB[0]) >> 16
-	g = (weightA*colorA[1] + weightB*colorB[1]) >> 16
-	b = (weightA*colorA[2] + weightB*colorB[2]) >> 16
-	return r, g, b, 0xff
+	c := compare.Heat(float64(v) / 0xffff)
+	return int(c.R), int(c.G), int(c.B), int(c.A)
 }
 
 const bins = 32
@@ -57,9 +57,71 @@ func (verb *unpackVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	defer r.Close()
 
+	if verb.Index {
+		return printIndex(ctx, r)
+	}
+	if verb.Count > 0 {
+		return printGroups(ctx, r, verb.First, verb.Count, unpacker{verb.Verbose, map[uint64]int{}})
+	}
 	return pack.Read(ctx, r, unpacker{verb.Verbose, map[uint64]int{}}, true)
 }
 
+// printGroups prints the count root groups of the indexed pack file f starting
+// with the root group first. Only the blocks holding these groups are read.
+func printGroups(ctx context.Context, f *os.File, first, count uint64, u unpacker) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	index, err := pack.NewIndexedReader(f, fi.Size(), true)
+	if err != nil {
+		return log.Err(ctx, err, "Could not read the pack index")
+	}
+	return index.ReadGroups(ctx, first, count, u)
+}
+
+// printIndex prints the blocks of the indexed pack file f.
+func printIndex(ctx context.Context, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	index, err := pack.NewIndexedReader(f, fi.Size(), true)
+	if err != nil {
+		return log.Err(ctx, err, "Could not read the pack index")
+	}
+	for i, b := range index.Blocks {
+		switch b.Kind {
+		case pack.GroupsBlock:
+			fmt.Fprintf(os.Stdout, "%4d: %v offset: %v size: %v first id: %v root groups: [%v, %v)\n",
+				i, b.Kind, b.Offset, b.Size, b.FirstID, b.FirstGroup, b.FirstGroup+b.Groups)
+		default:
+			counts := map[string]int{}
+			names := []string{}
+			for _, ty := range b.Objects {
+				name := index.TypeName(ty)
+				if counts[name] == 0 {
+					names = append(names, name)
+				}
+				counts[name]++
+			}
+			objects := make([]string, len(names))
+			for j, name := range names {
+				objects[j] = fmt.Sprintf("%v x %v", counts[name], name)
+			}
+			keyed := 0
+			for _, key := range b.Keys {
+				if key != nil {
+					keyed++
+				}
+			}
+			fmt.Fprintf(os.Stdout, "%4d: %v offset: %v size: %v objects: [%v] keyed: %v\n",
+				i, b.Kind, b.Offset, b.Size, strings.Join(objects, ", "), keyed)
+		}
+	}
+	return nil
+}
+
 type unpacker struct {
 	Verbose bool
 	DepthOf map[uint64]int
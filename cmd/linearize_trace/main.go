@@ -88,7 +88,7 @@ func run(ctx context.Context) error {
 	}
 	defer f.Close()
 
-	if err = capt.Export(ctx, f); err != nil {
+	if err = capt.Export(ctx, f, capture.ExportOptions{}); err != nil {
 		return err
 	}
 	log.I(ctx, "Capture written to: %v", *output)
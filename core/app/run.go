@@ -278,8 +278,11 @@ func doRun(main task.Task) int {
 		if err != nil {
 			log.E(ctx, "Could not start trace profiling")
 		} else {
-			status.RegisterTracer(f)
-			defer f.Close()
+			stop := status.RegisterTracer(f)
+			defer func() {
+				stop()
+				f.Close()
+			}()
 		}
 	}
 
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -29,22 +31,49 @@ const (
 	eventDurtationStart = "B"
 	eventDurtationEnd   = "E"
 	eventInstance       = "i"
+	eventCounter        = "C"
+	eventAsyncStart     = "b"
+	eventAsyncEnd       = "e"
+	eventFlowStart      = "s"
+	eventFlowEnd        = "f"
+	eventMetadata       = "M"
 	eventMemoryDump     = "v"
 )
 
+// The name prefixes of the tasks of the database resolves, and of the tasks
+// waiting on them. A waiting task is named after the resolve it waits on.
+const (
+	dbResolvePrefix = "DB Resolve<"
+	dbWaitPrefix    = "Wait DB Resolve<"
+)
+
 type traceEvent struct {
-	Name      string                 `json:"name,omitempty"`
-	ProcessID uint64                 `json:"pid"`
-	TaskID    uint64                 `json:"tid"`
-	EventType string                 `json:"ph"`
-	Timestamp int64                  `json:"ts"`
-	Scope     string                 `json:"s,omitempty"`
-	Args      map[string]interface{} `json:"args,omitempty"`
-	ID        string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Category     string                 `json:"cat,omitempty"`
+	ProcessID    uint64                 `json:"pid"`
+	TaskID       uint64                 `json:"tid"`
+	EventType    string                 `json:"ph"`
+	Timestamp    int64                  `json:"ts"`
+	Scope        string                 `json:"s,omitempty"`
+	Args         map[string]interface{} `json:"args,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	BindingPoint string                 `json:"bp,omitempty"`
 }
 
 // RegisterTracer registers a status listener that writes all status updates in
-// the Chrome Trace Event Format to the writer w.
+// the Chrome Trace Event Format to the writer w. The trace can be opened with
+// chrome://tracing or the Perfetto UI.
+//
+// Tasks are nested in the track of their parent task, unless the parent task
+// already has a running sub-task or is blocked, in which case the task starts
+// a new track linked to the parent by a flow event. When a task finishes
+// before the tasks nested in its track, these are moved to a new track, so
+// that the slices of each track stay nested. Tasks waiting on a database resolve
+// are linked to the resolve by a flow event. Replays are recorded as async
+// slices, with a counter of their progress.
+//
+// Calling the returned function unregisters the listener and terminates the
+// trace.
 // See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
 // for documentation on the trace event format.
 func RegisterTracer(w io.Writer) Unregister {
@@ -53,12 +82,22 @@ func RegisterTracer(w io.Writer) Unregister {
 		processID: os.Getpid(),
 		start:     time.Now(),
 		taskIDs:   map[*Task]uint64{},
+		tracks:    map[uint64][]*Task{},
+		blocked:   map[*Task]bool{},
+		resolves:  map[string]*Task{},
+		replays:   map[uint32]string{},
 	}
 	w.Write([]byte("["))
 
 	app.Traverse(l.begin)
 
-	return RegisterListener(l)
+	unregister := RegisterListener(l)
+	return func() {
+		unregister()
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.close()
+	}
 }
 
 type statusTracer struct {
@@ -66,8 +105,13 @@ type statusTracer struct {
 	start           time.Time
 	processID       int
 	taskIDs         map[*Task]uint64
+	tracks          map[uint64][]*Task // The running tasks of each track, innermost last.
+	blocked         map[*Task]bool     // The tasks with an open blocked slice.
+	resolves        map[string]*Task   // The running database resolve tasks by name.
+	replays         map[uint32]string  // The current async slice of each replay.
 	freeTaskIDs     []uint64
 	nextAllocTaskID uint64
+	nextFlowID      uint64
 	nextMemoryID    uint64
 	mutex           sync.Mutex
 }
@@ -94,10 +138,28 @@ func (s *statusTracer) OnTaskStart(ctx context.Context, t *Task) {
 	s.begin(t)
 }
 
-func (s *statusTracer) OnTaskProgress(ctx context.Context, t *Task) {}
-func (s *statusTracer) OnTaskBlock(ctx context.Context, t *Task)    {}
-func (s *statusTracer) OnTaskUnblock(ctx context.Context, t *Task)  {}
+func (s *statusTracer) OnTaskProgress(ctx context.Context, t *Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.progress(t)
+}
+
+func (s *statusTracer) OnTaskBlock(ctx context.Context, t *Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.block(t, eventDurtationStart)
+}
+
+func (s *statusTracer) OnTaskUnblock(ctx context.Context, t *Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.block(t, eventDurtationEnd)
+}
+
 func (s *statusTracer) OnReplayStatusUpdate(ctx context.Context, r *Replay, label uint64, totalInstrs, finishedInstrs uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.replay(r, label, totalInstrs, finishedInstrs)
 }
 
 func (s *statusTracer) OnTaskFinish(ctx context.Context, t *Task) {
@@ -118,45 +180,268 @@ func (s *statusTracer) OnMemorySnapshot(ctx context.Context, stats runtime.MemSt
 	s.memorySnapshot(ctx, stats)
 }
 
-func (s *statusTracer) begin(t *Task) {
-	e := traceEvent{
-		Name:      t.name,
-		EventType: eventDurtationStart,
-		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
-		ProcessID: uint64(s.processID),
-	}
-
-	if t.parent == &app {
-		e.TaskID = s.allocTaskID()
-	} else {
-		e.TaskID = s.taskIDs[t.parent]
-	}
-	s.taskIDs[t] = e.TaskID
+func (s *statusTracer) timestamp() int64 {
+	return time.Since(s.start).Nanoseconds() / 1000
+}
 
+func (s *statusTracer) write(e traceEvent) {
+	e.ProcessID = uint64(s.processID)
 	b, _ := json.Marshal(e)
 	s.writer.Write([]byte("\n"))
 	s.writer.Write(b)
 	s.writer.Write([]byte(","))
 }
 
-func (s *statusTracer) end(t *Task) {
-	e := traceEvent{
-		Name:      "",
-		TaskID:    s.taskIDs[t],
-		EventType: eventDurtationEnd,
-		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
+// close terminates the trace with the name of the process.
+func (s *statusTracer) close() {
+	b, _ := json.Marshal(traceEvent{
+		Name:      "process_name",
+		EventType: eventMetadata,
 		ProcessID: uint64(s.processID),
+		Args:      map[string]interface{}{"name": filepath.Base(os.Args[0])},
+	})
+	s.writer.Write([]byte("\n"))
+	s.writer.Write(b)
+	s.writer.Write([]byte("]\n"))
+}
+
+// flow links the slices running on the tracks from and to.
+func (s *statusTracer) flow(name string, from, to uint64) {
+	id := fmt.Sprint(s.nextFlowID)
+	s.nextFlowID++
+	ts := s.timestamp()
+	s.write(traceEvent{
+		Name:      name,
+		Category:  "task",
+		TaskID:    from,
+		EventType: eventFlowStart,
+		Timestamp: ts,
+		ID:        id,
+	})
+	s.write(traceEvent{
+		Name:         name,
+		Category:     "task",
+		TaskID:       to,
+		EventType:    eventFlowEnd,
+		Timestamp:    ts,
+		ID:           id,
+		BindingPoint: "e",
+	})
+}
+
+func (s *statusTracer) begin(t *Task) {
+	parentTID, hasParent := s.taskIDs[t.parent]
+	tid, nested := parentTID, false
+	if stack := s.tracks[parentTID]; hasParent && stack[len(stack)-1] == t.parent && !s.blocked[t.parent] {
+		nested = true
+	} else {
+		tid = s.allocTaskID()
+	}
+	s.taskIDs[t] = tid
+	s.tracks[tid] = append(s.tracks[tid], t)
+	s.beginSlice(t, tid, false)
+
+	if hasParent && !nested {
+		s.flow("sub-task", parentTID, tid)
+	}
+	if strings.HasPrefix(t.name, dbWaitPrefix) {
+		if r, ok := s.resolves[strings.TrimPrefix(t.name, "Wait ")]; ok {
+			s.flow("wait", tid, s.taskIDs[r])
+		}
+	} else if strings.HasPrefix(t.name, dbResolvePrefix) {
+		s.resolves[t.name] = t
+	}
+}
+
+func (s *statusTracer) end(t *Task) {
+	tid, ok := s.taskIDs[t]
+	if !ok {
+		return
 	}
 	delete(s.taskIDs, t)
+	if s.resolves[t.name] == t {
+		delete(s.resolves, t.name)
+	}
 
-	if t.parent == &app {
-		s.freeTaskID(e.TaskID)
+	stack := s.tracks[tid]
+	i := len(stack) - 1
+	for i > 0 && stack[i] != t {
+		i--
+	}
+	// The tasks nested above t are still running. End their slices along with
+	// the slice of t, innermost first, and continue them on a new track.
+	moved := append([]*Task{}, stack[i+1:]...)
+	for j := len(moved) - 1; j >= 0; j-- {
+		s.endSlice(moved[j], tid)
 	}
+	s.endSlice(t, tid)
+	delete(s.blocked, t)
 
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	var movedTID uint64
+	if len(moved) > 0 {
+		// Allocate the new track before tid may be freed, so that the moved
+		// tasks don't continue on the track they were moved from.
+		movedTID = s.allocTaskID()
+	}
+	if stack = stack[:i]; len(stack) == 0 {
+		delete(s.tracks, tid)
+		s.freeTaskID(tid)
+	} else {
+		s.tracks[tid] = stack
+	}
+	if len(moved) > 0 {
+		s.tracks[movedTID] = moved
+		for _, m := range moved {
+			s.taskIDs[m] = movedTID
+			s.beginSlice(m, movedTID, true)
+		}
+		s.flow("moved", tid, movedTID)
+	}
+}
+
+// beginSlice starts the slice of the task t on the track tid, followed by its
+// blocked slice if the task is blocked. continued is true if the task was
+// moved from another track.
+func (s *statusTracer) beginSlice(t *Task, tid uint64, continued bool) {
+	parentID := uint64(0)
+	if t.parent != &app {
+		parentID = t.parent.id
+	}
+	args := map[string]interface{}{
+		"id":         t.id,
+		"parent":     parentID,
+		"background": t.background,
+	}
+	if continued {
+		args["continued"] = true
+	}
+	ts := s.timestamp()
+	s.write(traceEvent{
+		Name:      t.name,
+		TaskID:    tid,
+		EventType: eventDurtationStart,
+		Timestamp: ts,
+		Args:      args,
+	})
+	if s.blocked[t] {
+		s.write(traceEvent{
+			Name:      "Blocked",
+			TaskID:    tid,
+			EventType: eventDurtationStart,
+			Timestamp: ts,
+		})
+	}
+}
+
+// endSlice ends the blocked slice of the task t on the track tid, if the task
+// is blocked, followed by the slice of the task.
+func (s *statusTracer) endSlice(t *Task, tid uint64) {
+	ts := s.timestamp()
+	if s.blocked[t] {
+		s.write(traceEvent{
+			Name:      "Blocked",
+			TaskID:    tid,
+			EventType: eventDurtationEnd,
+			Timestamp: ts,
+		})
+	}
+	s.write(traceEvent{
+		Name:      t.name,
+		TaskID:    tid,
+		EventType: eventDurtationEnd,
+		Timestamp: ts,
+	})
+}
+
+func (s *statusTracer) progress(t *Task) {
+	if _, ok := s.taskIDs[t]; !ok {
+		return
+	}
+	s.write(traceEvent{
+		Name:      t.name,
+		EventType: eventCounter,
+		Timestamp: s.timestamp(),
+		ID:        fmt.Sprint(t.id),
+		Args:      map[string]interface{}{"completion": t.Completion()},
+	})
+}
+
+// block starts or ends a blocked slice in the track of the task. Tasks only
+// start a blocked slice while they are the innermost task of their track, and
+// no task is nested in a blocked task, so that the slices stay nested.
+func (s *statusTracer) block(t *Task, eventType string) {
+	tid, ok := s.taskIDs[t]
+	if !ok {
+		return
+	}
+	if eventType == eventDurtationStart {
+		stack := s.tracks[tid]
+		if s.blocked[t] || stack[len(stack)-1] != t {
+			return
+		}
+		s.blocked[t] = true
+	} else {
+		if !s.blocked[t] {
+			return
+		}
+		delete(s.blocked, t)
+	}
+	s.write(traceEvent{
+		Name:      "Blocked",
+		TaskID:    tid,
+		EventType: eventType,
+		Timestamp: s.timestamp(),
+	})
+}
+
+func (s *statusTracer) replay(r *Replay, label uint64, totalInstrs, finishedInstrs uint32) {
+	phase := "Replay queued"
+	switch {
+	case r.Finished():
+		phase = ""
+	case r.Started():
+		phase = "Replay running"
+	}
+
+	id := fmt.Sprintf("replay%v", r.ID)
+	current, ok := s.replays[r.ID]
+	if ok && current != phase {
+		s.write(traceEvent{
+			Name:      current,
+			Category:  "replay",
+			EventType: eventAsyncEnd,
+			Timestamp: s.timestamp(),
+			ID:        id,
+		})
+		delete(s.replays, r.ID)
+	}
+	if phase != "" && current != phase {
+		s.write(traceEvent{
+			Name:      phase,
+			Category:  "replay",
+			EventType: eventAsyncStart,
+			Timestamp: s.timestamp(),
+			ID:        id,
+			Args: map[string]interface{}{
+				"replay": r.ID,
+				"device": r.Device.String(),
+			},
+		})
+		s.replays[r.ID] = phase
+	}
+
+	if totalInstrs > 0 {
+		s.write(traceEvent{
+			Name:      fmt.Sprintf("Replay %v", r.ID),
+			EventType: eventCounter,
+			Timestamp: s.timestamp(),
+			Args: map[string]interface{}{
+				"finished instructions": finishedInstrs,
+				"total instructions":    totalInstrs,
+				"label":                 label,
+			},
+		})
+	}
 }
 
 func (s *statusTracer) event(ctx context.Context, t *Task, n string, scope EventScope) {
@@ -164,24 +449,21 @@ func (s *statusTracer) event(ctx context.Context, t *Task, n string, scope Event
 	sc := "g"
 	switch scope {
 	case TaskScope:
-		tid, sc = t.id, "t"
+		if id, ok := s.taskIDs[t]; ok {
+			tid, sc = id, "t"
+		}
 	case GlobalScope:
 		sc = "g"
 	case ProcessScope:
 		sc = "p"
 	}
-	e := traceEvent{
+	s.write(traceEvent{
 		Name:      n,
 		TaskID:    tid,
 		EventType: eventInstance,
-		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
-		ProcessID: uint64(s.processID),
+		Timestamp: s.timestamp(),
 		Scope:     sc,
-	}
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	})
 }
 
 func (s *statusTracer) memorySnapshot(ctx context.Context, stats runtime.MemStats) {
@@ -196,16 +478,11 @@ func (s *statusTracer) memorySnapshot(ctx context.Context, stats runtime.MemStat
 
 	dumps := make(map[string]interface{})
 	dumps["process_totals"] = processTotals
-	e := traceEvent{
+	s.write(traceEvent{
 		Name:      "periodic_interval",
 		EventType: eventMemoryDump,
-		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
-		ProcessID: uint64(s.processID),
+		Timestamp: s.timestamp(),
 		ID:        fmt.Sprintf("mem%+v", id),
 		Args:      map[string]interface{}{"dumps": dumps},
-	}
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	})
 }
@@ -0,0 +1,179 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/data/id"
+)
+
+type traceEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"ph"`
+	TID   uint64 `json:"tid"`
+	ID    string `json:"id"`
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	stop := status.RegisterTracer(buf)
+
+	root := status.Start(ctx, "root")
+	nested := status.Start(root, "nested")
+	concurrent := status.Start(root, "concurrent")
+	resolve := status.Start(concurrent, "DB Resolve<int> 0x1")
+	wait := status.StartBackground(nested, "Wait DB Resolve<int> 0x1")
+	status.Block(wait)
+	status.UpdateProgress(resolve, 1, 2)
+	status.Unblock(wait)
+	status.Finish(wait)
+	status.Finish(resolve)
+	status.Finish(concurrent)
+	status.Finish(nested)
+
+	r := status.ReplayQueued(root, 1, id.ID{})
+	r.Start(root)
+	r.Progress(root, 0, 10, 5)
+	r.Finish(root)
+	status.Event(root, status.TaskScope, "event")
+	status.Finish(root)
+	stop()
+
+	events := parseTrace(t, buf)
+	checkSlices(t, events)
+
+	tids := map[string]uint64{}
+	flows := map[string]int{}
+	replays := map[string]int{}
+	for _, e := range events {
+		switch e.Phase {
+		case "B":
+			tids[e.Name] = e.TID
+		case "s", "f":
+			flows[e.Name]++
+		case "b", "e":
+			replays[e.Phase]++
+		}
+	}
+
+	if tids["nested"] != tids["root"] {
+		t.Errorf("Task nested was not nested in the track of its parent")
+	}
+	if tids["concurrent"] == tids["root"] {
+		t.Errorf("Task concurrent was nested in the track of its parent, which has a running sub-task")
+	}
+	if tids["Blocked"] != tids["Wait DB Resolve<int> 0x1"] {
+		t.Errorf("Blocked slice was not in the track of the blocked task")
+	}
+	if got := flows["sub-task"]; got != 2 {
+		t.Errorf("Got %v sub-task flow events, expected 2", got)
+	}
+	if got := flows["wait"]; got != 2 {
+		t.Errorf("Got %v wait flow events, expected 2", got)
+	}
+	if replays["b"] != 2 || replays["e"] != 2 {
+		t.Errorf("Got %v replay begin and %v replay end events, expected 2 of each", replays["b"], replays["e"])
+	}
+}
+
+func TestTracerParentEndsFirst(t *testing.T) {
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	stop := status.RegisterTracer(buf)
+
+	root := status.Start(ctx, "root")
+	parent := status.Start(root, "parent")
+	child := status.Start(parent, "child")
+	grandchild := status.Start(child, "grandchild")
+	status.Block(grandchild)
+	status.Finish(parent)
+	status.Unblock(grandchild)
+	status.Finish(grandchild)
+	status.Finish(child)
+	status.Finish(root)
+	stop()
+
+	events := parseTrace(t, buf)
+	checkSlices(t, events)
+
+	tids := map[string][]uint64{}
+	flows := map[string]int{}
+	for _, e := range events {
+		switch e.Phase {
+		case "B":
+			tids[e.Name] = append(tids[e.Name], e.TID)
+		case "s", "f":
+			flows[e.Name]++
+		}
+	}
+
+	if got := tids["parent"]; len(got) != 1 || got[0] != tids["root"][0] {
+		t.Errorf("Task parent was not nested in the track of its parent")
+	}
+	for _, name := range []string{"child", "grandchild", "Blocked"} {
+		got := tids[name]
+		if len(got) != 2 || got[0] != tids["root"][0] || got[1] == tids["root"][0] {
+			t.Errorf("Task %v was not moved to a new track when its parent finished: %v", name, got)
+		}
+	}
+	if tids["child"][1] != tids["grandchild"][1] {
+		t.Errorf("Task grandchild was not moved to the track of its parent")
+	}
+	if got := flows["moved"]; got != 2 {
+		t.Errorf("Got %v moved flow events, expected 2", got)
+	}
+}
+
+// parseTrace returns the events of the trace written to buf.
+func parseTrace(t *testing.T, buf *bytes.Buffer) []traceEvent {
+	events := []traceEvent{}
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("Trace is not valid JSON: %v\n%v", err, buf.String())
+	}
+	return events
+}
+
+// checkSlices checks that the slices of each track of the trace are nested,
+// each end event ending the innermost running slice of its track.
+func checkSlices(t *testing.T, events []traceEvent) {
+	open := map[uint64][]string{}
+	for _, e := range events {
+		switch e.Phase {
+		case "B":
+			open[e.TID] = append(open[e.TID], e.Name)
+		case "E":
+			stack := open[e.TID]
+			if len(stack) == 0 {
+				t.Errorf("End event on track %v without a begin event", e.TID)
+				continue
+			}
+			if top := stack[len(stack)-1]; e.Name != top {
+				t.Errorf("End event of %v on track %v while %v is running", e.Name, e.TID, top)
+			}
+			open[e.TID] = stack[:len(stack)-1]
+		}
+	}
+	for tid, names := range open {
+		if len(names) > 0 {
+			t.Errorf("Track %v has unfinished slices: %v", tid, names)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/google/gapid/core/fault"
+)
+
+const (
+	// ErrMissingIndex is the error returned when a version 3 pack file does
+	// not end with an index.
+	ErrMissingIndex = fault.Const("Missing pack index")
+
+	// DefaultBlockSize is the default uncompressed size of the blocks written
+	// by NewBlockWriter.
+	DefaultBlockSize = 1 << 20
+
+	// indexMagic ends the trailer of version 3 pack files.
+	indexMagic = "PackIdx\n"
+	// trailerSize is the size of the trailer: the offset of the index block
+	// followed by indexMagic.
+	trailerSize = 8 + len(indexMagic)
+	// maxBlockHeaderSize is the size of the largest possible block header.
+	maxBlockHeaderSize = 2 + 2*maxVarintSize
+	// firstBlockID is the identifier of the first chunk of version 3 files.
+	// Like in version 2 files, where the first chunk is a type definition, 0
+	// is never the identifier of a group.
+	firstBlockID = 1
+)
+
+// BlockKind is the kind of the chunks stored in a block of a version 3 pack
+// file.
+type BlockKind byte
+
+const (
+	// GroupsBlock holds the chunks of root groups, their children and their
+	// terminators.
+	GroupsBlock BlockKind = 1
+	// ObjectsBlock holds type definitions and root objects. The chunks of
+	// these blocks are not counted in the chunk identifiers.
+	ObjectsBlock BlockKind = 2
+	// indexBlock holds the index, and is the last block of the file.
+	indexBlock BlockKind = 3
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case GroupsBlock:
+		return "Groups"
+	case ObjectsBlock:
+		return "Objects"
+	case indexBlock:
+		return "Index"
+	default:
+		return fmt.Sprintf("BlockKind(%d)", k)
+	}
+}
+
+// codec is the compression of a block.
+type codec byte
+
+const (
+	codecNone  codec = 0
+	codecFlate codec = 1
+)
+
+// Block is the index entry of a block of a version 3 pack file.
+type Block struct {
+	// Kind is the kind of chunks stored in the block.
+	Kind BlockKind
+	// Offset is the offset of the block from the start of the file.
+	Offset int64
+	// Size is the size of the block in the file, including its header.
+	Size int64
+	// FirstID is the identifier of the first chunk of a groups block.
+	FirstID uint64
+	// FirstGroup is the number of root groups started before the block.
+	FirstGroup uint64
+	// Groups is the number of root groups started in the block.
+	Groups uint64
+	// Objects are the type indices of the root objects of an objects block,
+	// in order.
+	Objects []uint64
+	// Keys are the keys of the root objects of an objects block, in the same
+	// order as Objects. The key of an object written without one is nil.
+	Keys [][]byte
+}
+
+// blockWriter accumulates the chunks written by a Writer into compressed
+// blocks.
+type blockWriter struct {
+	to        io.Writer
+	blockSize int
+	offset    int64
+	groups    bytes.Buffer
+	objects   bytes.Buffer
+	pending   Block // The index entry of the pending groups block.
+	types     []uint64
+	keys      [][]byte
+	index     []Block
+	compress  bytes.Buffer
+	flate     *flate.Writer
+}
+
+func newBlockWriter(to io.Writer, blockSize int) (*blockWriter, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	zw, err := flate.NewWriter(nil, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := to.Write(blockHeader); err != nil {
+		return nil, err
+	}
+	return &blockWriter{
+		to:        to,
+		blockSize: blockSize,
+		offset:    int64(len(blockHeader)),
+		flate:     zw,
+	}, nil
+}
+
+// group appends the chunk size and data to the pending groups block. id is
+// the identifier of the chunk and rootGroups the number of root groups started
+// before it.
+func (b *blockWriter) group(size, data []byte, id, rootGroups uint64) {
+	if b.groups.Len() == 0 {
+		b.pending = Block{Kind: GroupsBlock, FirstID: id, FirstGroup: rootGroups}
+	}
+	b.groups.Write(size)
+	b.groups.Write(data)
+}
+
+// object appends the chunk size and data to the pending objects block. tyIdx
+// is the type index of root objects, or 0 for type definitions, and key the
+// optional key of root objects.
+func (b *blockWriter) object(size, data []byte, tyIdx uint64, key []byte) error {
+	b.objects.Write(size)
+	b.objects.Write(data)
+	if tyIdx != 0 {
+		b.types = append(b.types, tyIdx)
+		b.keys = append(b.keys, append([]byte(nil), key...))
+	}
+	// Objects blocks always precede the pending groups block, so they can be
+	// flushed at any time.
+	if b.objects.Len() >= b.blockSize {
+		return b.flushObjects()
+	}
+	return nil
+}
+
+// flush writes the pending blocks if the groups block is full or force is
+// true. It must only be called when no group is open.
+func (b *blockWriter) flush(force bool, rootGroups uint64) error {
+	if !force && b.groups.Len() < b.blockSize {
+		return nil
+	}
+	if err := b.flushObjects(); err != nil {
+		return err
+	}
+	if b.groups.Len() == 0 {
+		return nil
+	}
+	entry := b.pending
+	entry.Groups = rootGroups - entry.FirstGroup
+	err := b.writeBlock(entry, b.groups.Bytes())
+	b.groups.Reset()
+	return err
+}
+
+func (b *blockWriter) flushObjects() error {
+	if b.objects.Len() == 0 {
+		return nil
+	}
+	entry := Block{Kind: ObjectsBlock, Objects: b.types, Keys: b.keys}
+	err := b.writeBlock(entry, b.objects.Bytes())
+	b.objects.Reset()
+	b.types, b.keys = nil, nil
+	return err
+}
+
+// writeBlock compresses and writes the block data, and adds entry to the
+// index.
+func (b *blockWriter) writeBlock(entry Block, data []byte) error {
+	b.compress.Reset()
+	b.flate.Reset(&b.compress)
+	if _, err := b.flate.Write(data); err != nil {
+		return err
+	}
+	if err := b.flate.Close(); err != nil {
+		return err
+	}
+	c, payload := codecFlate, b.compress.Bytes()
+	if len(payload) >= len(data) {
+		c, payload = codecNone, data
+	}
+	entry.Offset = b.offset
+	size, err := b.write(entry.Kind, c, len(data), payload)
+	if err != nil {
+		return err
+	}
+	entry.Size = size
+	b.index = append(b.index, entry)
+	return nil
+}
+
+// write writes a block with its header, and returns the number of bytes
+// written.
+func (b *blockWriter) write(kind BlockKind, c codec, size int, payload []byte) (int64, error) {
+	hdr := make([]byte, 2, maxBlockHeaderSize)
+	hdr[0], hdr[1] = byte(kind), byte(c)
+	hdr = append(hdr, proto.EncodeVarint(uint64(size))...)
+	hdr = append(hdr, proto.EncodeVarint(uint64(len(payload)))...)
+	if _, err := b.to.Write(hdr); err != nil {
+		return 0, err
+	}
+	if _, err := b.to.Write(payload); err != nil {
+		return 0, err
+	}
+	n := int64(len(hdr) + len(payload))
+	b.offset += n
+	return n, nil
+}
+
+// close writes the pending blocks, followed by the index and the trailer.
+func (b *blockWriter) close(rootGroups uint64, t *types) error {
+	if err := b.flush(true, rootGroups); err != nil {
+		return err
+	}
+	index, err := encodeIndex(t, b.index)
+	if err != nil {
+		return err
+	}
+	offset := b.offset
+	if _, err := b.write(indexBlock, codecNone, len(index), index); err != nil {
+		return err
+	}
+	trailer := make([]byte, trailerSize)
+	binary.LittleEndian.PutUint64(trailer, uint64(offset))
+	copy(trailer[8:], indexMagic)
+	_, err = b.to.Write(trailer)
+	return err
+}
+
+// encodeIndex encodes the types and the blocks of a pack file.
+func encodeIndex(t *types, blocks []Block) ([]byte, error) {
+	buf := proto.NewBuffer(nil)
+	buf.EncodeVarint(t.count() - 1)
+	for _, ty := range t.entries[1:] {
+		desc := []byte{}
+		if ty.desc != nil {
+			var err error
+			if desc, err = proto.Marshal(ty.desc); err != nil {
+				return nil, err
+			}
+		}
+		buf.EncodeStringBytes(ty.name)
+		buf.EncodeRawBytes(desc)
+	}
+	buf.EncodeVarint(uint64(len(blocks)))
+	for _, b := range blocks {
+		buf.EncodeVarint(uint64(b.Kind))
+		buf.EncodeVarint(uint64(b.Offset))
+		buf.EncodeVarint(uint64(b.Size))
+		buf.EncodeVarint(b.FirstID)
+		buf.EncodeVarint(b.FirstGroup)
+		buf.EncodeVarint(b.Groups)
+		buf.EncodeVarint(uint64(len(b.Objects)))
+		for i, o := range b.Objects {
+			buf.EncodeVarint(o)
+			var key []byte
+			if i < len(b.Keys) {
+				key = b.Keys[i]
+			}
+			buf.EncodeRawBytes(key)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeIndex decodes the index encoded by encodeIndex, adding the types to t.
+func decodeIndex(data []byte, t *types) ([]Block, error) {
+	buf := proto.NewBuffer(data)
+	count, err := buf.DecodeVarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := buf.DecodeStringBytes()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := buf.DecodeRawBytes(false)
+		if err != nil {
+			return nil, err
+		}
+		desc := &descriptor.DescriptorProto{}
+		if err := proto.Unmarshal(raw, desc); err != nil {
+			return nil, err
+		}
+		t.add(name, desc)
+	}
+
+	count, err = buf.DecodeVarint()
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]Block, count)
+	for i := range blocks {
+		var v [7]uint64
+		for j := range v {
+			if v[j], err = buf.DecodeVarint(); err != nil {
+				return nil, err
+			}
+		}
+		b := Block{
+			Kind:       BlockKind(v[0]),
+			Offset:     int64(v[1]),
+			Size:       int64(v[2]),
+			FirstID:    v[3],
+			FirstGroup: v[4],
+			Groups:     v[5],
+		}
+		if v[6] > uint64(len(data)) {
+			return nil, fmt.Errorf("Invalid object count %v in block %v", v[6], i)
+		}
+		b.Objects = make([]uint64, v[6])
+		b.Keys = make([][]byte, v[6])
+		for j := range b.Objects {
+			if b.Objects[j], err = buf.DecodeVarint(); err != nil {
+				return nil, err
+			}
+			if b.Keys[j], err = buf.DecodeRawBytes(true); err != nil {
+				return nil, err
+			}
+			if len(b.Keys[j]) == 0 {
+				b.Keys[j] = nil
+			}
+		}
+		blocks[i] = b
+	}
+	return blocks, nil
+}
+
+// blockReader is the interface of the readers blocks are read from.
+type blockReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readBlock reads the next block from r, returning its kind and uncompressed
+// data.
+func readBlock(r blockReader) (BlockKind, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	stored, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := decompress(codec(c), io.LimitReader(r, int64(stored)), size)
+	return BlockKind(kind), data, err
+}
+
+// decompress reads and decompresses the payload of a block of the given
+// uncompressed size.
+func decompress(c codec, payload io.Reader, size uint64) ([]byte, error) {
+	switch c {
+	case codecNone:
+	case codecFlate:
+		zr := flate.NewReader(payload)
+		defer zr.Close()
+		payload = zr
+	default:
+		return nil, fmt.Errorf("Unknown block compression: %v", c)
+	}
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
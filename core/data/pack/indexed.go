@@ -0,0 +1,154 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// IndexedReader reads the blocks of a version 3 pack file in any order, using
+// the index at the end of the file.
+// It is safe to read blocks from multiple goroutines.
+type IndexedReader struct {
+	from  io.ReaderAt
+	types *types
+	// Blocks is the index of the blocks of the file, in file order.
+	Blocks []Block
+}
+
+// NewIndexedReader reads the header and the index of the pack file of the
+// given size from the supplied stream.
+// It returns ErrMissingIndex if the file has no index, which is the case of
+// files of versions prior to 3.
+func NewIndexedReader(from io.ReaderAt, size int64, forceDynamic bool) (*IndexedReader, error) {
+	hdr := make([]byte, maxHeaderSize)
+	if _, err := from.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	version, err := parseVersion(hdr)
+	switch {
+	case err != nil:
+		return nil, err
+	case version.Major > MaxMajorVersion:
+		return nil, ErrUnsupportedVersion{Version: version}
+	case version.Major < 3:
+		return nil, ErrMissingIndex
+	case size < int64(maxHeaderSize+trailerSize):
+		return nil, ErrMissingIndex
+	}
+
+	trailer := make([]byte, trailerSize)
+	if _, err := from.ReadAt(trailer, size-int64(trailerSize)); err != nil {
+		return nil, err
+	}
+	offset := int64(binary.LittleEndian.Uint64(trailer))
+	end := size - int64(trailerSize)
+	if string(trailer[8:]) != indexMagic || offset < maxHeaderSize || offset >= end {
+		return nil, ErrMissingIndex
+	}
+	kind, data, err := readBlock(bufio.NewReader(io.NewSectionReader(from, offset, end-offset)))
+	if err != nil {
+		return nil, err
+	}
+	if kind != indexBlock {
+		return nil, ErrMissingIndex
+	}
+
+	r := &IndexedReader{from: from, types: newTypes(forceDynamic)}
+	if r.Blocks, err = decodeIndex(data, r.types); err != nil {
+		return nil, fmt.Errorf("Invalid pack index: %v", err)
+	}
+	return r, nil
+}
+
+// TypeName returns the name of the type with the given index, as used by
+// Block.Objects.
+func (r *IndexedReader) TypeName(index uint64) string {
+	if index == 0 || index >= r.types.count() {
+		return ""
+	}
+	return r.types.entries[index].name
+}
+
+// WithReader returns an IndexedReader of the same file that reads its blocks
+// from the supplied stream, sharing the index already read by r.
+func (r *IndexedReader) WithReader(from io.ReaderAt) *IndexedReader {
+	return &IndexedReader{from: from, types: r.types, Blocks: r.Blocks}
+}
+
+// ReadBlock reads the block with the given index, calling events for each of
+// its chunks. The identifiers passed to events are the same as when reading
+// the whole file.
+func (r *IndexedReader) ReadBlock(ctx context.Context, index int, events Events) error {
+	return r.readBlock(ctx, index, events, nil)
+}
+
+// ReadGroups reads the count root groups starting with the root group of the
+// given index, calling events for each of their chunks and the chunks of
+// their children. Only the blocks holding these groups are read.
+func (r *IndexedReader) ReadGroups(ctx context.Context, first, count uint64, events Events) error {
+	end := first + count
+	for i, b := range r.Blocks {
+		if b.Kind != GroupsBlock || b.FirstGroup+b.Groups <= first || b.FirstGroup >= end {
+			continue
+		}
+		filter := &groupFilter{first: first, end: end, next: b.FirstGroup, skipped: map[uint64]bool{}}
+		if err := r.readBlock(ctx, i, events, filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *IndexedReader) readBlock(ctx context.Context, index int, events Events, groups *groupFilter) error {
+	if index < 0 || index >= len(r.Blocks) {
+		return fmt.Errorf("Block index %v out of bounds [0, %v)", index, len(r.Blocks))
+	}
+	b := r.Blocks[index]
+	kind, data, err := readBlock(bufio.NewReader(io.NewSectionReader(r.from, b.Offset, b.Size)))
+	if err != nil {
+		return err
+	}
+	if kind != b.Kind {
+		return fmt.Errorf("Block %v is a %v block, but the index says %v", index, kind, b.Kind)
+	}
+	rd := &reader{
+		types:     r.types,
+		id:        b.FirstID,
+		buf:       make([]byte, 0, initalBufferSize),
+		events:    events,
+		skipTypes: true,
+		groups:    groups,
+	}
+	rd.pb = proto.NewBuffer(rd.buf)
+	return rd.readBlockChunks(ctx, kind, data)
+}
+
+// Read reads all the blocks of the file in order, calling events for each of
+// their chunks.
+func (r *IndexedReader) Read(ctx context.Context, events Events) error {
+	for i := range r.Blocks {
+		if err := r.ReadBlock(ctx, i, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -33,10 +33,14 @@ var (
 	MinMajorVersion = 2
 
 	// MaxMajorVersion is the current maximum supported major version of pack files.
-	MaxMajorVersion = 2
+	MaxMajorVersion = 3
 
-	// header is the header written by this package including the version.
+	// header is the header written by NewWriter including the version.
 	header = []byte("ProtoPack\r\n2.0\n\x00")
+
+	// blockHeader is the header written by NewBlockWriter including the
+	// version.
+	blockHeader = []byte("ProtoPack\r\n3.0\n\x00")
 )
 
 type Version struct {
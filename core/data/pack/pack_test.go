@@ -148,3 +148,173 @@ func TestReaderWriter(t *testing.T) {
 	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, true)
 	assert.For(ctx, "Read (force-dynamic)").ThatError(err).Succeeded()
 }
+
+func TestBlockReaderWriter(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+
+	var id0, id1, id2 uint64
+
+	expected := events{
+		eventObject{&testprotos.MsgA{F32: 1, U32: 2, S32: 3, Str: "four"}},
+		eventBeginGroup{&testprotos.MsgA{F32: 5, U32: 6, S32: 10, Str: "eleven"}, &id0},
+		eventChildObject{&testprotos.MsgB{F64: 6, U64: 7, S64: 11, Bool: false}, &id0},
+		eventBeginChildGroup{&testprotos.MsgB{F64: 8, U64: 9, S64: 13, Bool: true}, &id1, &id0},
+		eventEndGroup{&id1},
+		eventEndGroup{&id0},
+		eventObject{&testprotos.MsgB{F64: 2, U64: 3, S64: 4, Bool: false}},
+		eventBeginGroup{&testprotos.MsgA{F32: 7, U32: 8, S32: 12, Str: "thirteen"}, &id2},
+		eventChildObject{&testprotos.MsgA{F32: 9, U32: 10, S32: 11, Str: "twelve"}, &id2},
+		eventEndGroup{&id2},
+	}
+
+	// Use a tiny block size so that each root group is in its own block.
+	w, err := pack.NewBlockWriter(buf, 1)
+	assert.For(ctx, "NewBlockWriter").ThatError(err).Succeeded()
+	for _, e := range expected {
+		e.write(ctx, w)
+	}
+	assert.For(ctx, "Close").ThatError(w.Close(ctx)).Succeeded()
+
+	got := events{}
+	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, false)
+	assert.For(ctx, "Read").ThatError(err).Succeeded()
+	assert.For(ctx, "events").ThatSlice(got).DeepEquals(expected)
+
+	r, err := pack.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), false)
+	if !assert.For(ctx, "NewIndexedReader").ThatError(err).Succeeded() {
+		return
+	}
+	groups, objects := []int{}, []string{}
+	for i, b := range r.Blocks {
+		if b.Kind == pack.GroupsBlock {
+			groups = append(groups, i)
+		}
+		for _, o := range b.Objects {
+			objects = append(objects, r.TypeName(o))
+		}
+	}
+	assert.For(ctx, "object types").ThatSlice(objects).Equals([]string{"testprotos.MsgA", "testprotos.MsgB"})
+	if !assert.For(ctx, "groups blocks").ThatSlice(groups).IsLength(2) {
+		return
+	}
+	last := r.Blocks[groups[1]]
+	assert.For(ctx, "first group").That(last.FirstGroup).Equals(uint64(1))
+	assert.For(ctx, "groups").That(last.Groups).Equals(uint64(1))
+
+	got = events{}
+	err = r.Read(ctx, &got)
+	assert.For(ctx, "IndexedReader.Read").ThatError(err).Succeeded()
+	assert.For(ctx, "indexed events").ThatSlice(got).DeepEquals(expected)
+
+	got = events{}
+	err = r.ReadBlock(ctx, groups[1], &got)
+	assert.For(ctx, "ReadBlock").ThatError(err).Succeeded()
+	assert.For(ctx, "block events").ThatSlice(got).DeepEquals(expected[7:])
+}
+
+func TestIndexedReaderMissingIndex(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	w, err := pack.NewWriter(buf)
+	assert.For(ctx, "NewWriter").ThatError(err).Succeeded()
+	err = w.Object(ctx, &testprotos.MsgA{F32: 1, U32: 2, S32: 3, Str: "four"})
+	assert.For(ctx, "Object").ThatError(err).Succeeded()
+
+	_, err = pack.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), false)
+	assert.For(ctx, "NewIndexedReader").ThatError(err).Equals(pack.ErrMissingIndex)
+}
+
+func TestIndexedReaderKeys(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+
+	w, err := pack.NewBlockWriter(buf, 0)
+	assert.For(ctx, "NewBlockWriter").ThatError(err).Succeeded()
+	err = w.Object(ctx, &testprotos.MsgA{Str: "unkeyed"})
+	assert.For(ctx, "Object").ThatError(err).Succeeded()
+	err = w.KeyedObject(ctx, &testprotos.MsgB{U64: 1}, []byte("key"))
+	assert.For(ctx, "KeyedObject").ThatError(err).Succeeded()
+	assert.For(ctx, "Close").ThatError(w.Close(ctx)).Succeeded()
+
+	r, err := pack.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), false)
+	if !assert.For(ctx, "NewIndexedReader").ThatError(err).Succeeded() {
+		return
+	}
+	if !assert.For(ctx, "blocks").ThatSlice(r.Blocks).IsLength(1) {
+		return
+	}
+	assert.For(ctx, "keys").ThatSlice(r.Blocks[0].Keys).DeepEquals([][]byte{nil, []byte("key")})
+
+	// Keys are not part of version 2 files.
+	buf.Reset()
+	w, err = pack.NewWriter(buf)
+	assert.For(ctx, "NewWriter").ThatError(err).Succeeded()
+	err = w.KeyedObject(ctx, &testprotos.MsgB{U64: 1}, []byte("key"))
+	assert.For(ctx, "KeyedObject").ThatError(err).Succeeded()
+	got := events{}
+	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, false)
+	assert.For(ctx, "Read").ThatError(err).Succeeded()
+	assert.For(ctx, "events").ThatSlice(got).DeepEquals(events{eventObject{&testprotos.MsgB{U64: 1}}})
+}
+
+func TestIndexedReaderReadGroups(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+
+	var ids [4]uint64
+	var childID uint64
+	all := events{
+		eventBeginGroup{&testprotos.MsgA{Str: "zero"}, &ids[0]},
+		eventChildObject{&testprotos.MsgB{U64: 0}, &ids[0]},
+		eventEndGroup{&ids[0]},
+		eventBeginGroup{&testprotos.MsgA{Str: "one"}, &ids[1]},
+		eventBeginChildGroup{&testprotos.MsgB{U64: 1}, &childID, &ids[1]},
+		eventChildObject{&testprotos.MsgA{Str: "child"}, &childID},
+		eventEndGroup{&childID},
+		eventEndGroup{&ids[1]},
+		eventBeginGroup{&testprotos.MsgA{Str: "two"}, &ids[2]},
+		eventEndGroup{&ids[2]},
+		eventBeginGroup{&testprotos.MsgA{Str: "three"}, &ids[3]},
+		eventEndGroup{&ids[3]},
+	}
+
+	// Use a block size that puts the first two root groups in one block, and
+	// the last two in another.
+	w, err := pack.NewBlockWriter(buf, 40)
+	assert.For(ctx, "NewBlockWriter").ThatError(err).Succeeded()
+	for _, e := range all {
+		e.write(ctx, w)
+	}
+	assert.For(ctx, "Close").ThatError(w.Close(ctx)).Succeeded()
+
+	r, err := pack.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), false)
+	if !assert.For(ctx, "NewIndexedReader").ThatError(err).Succeeded() {
+		return
+	}
+	firstGroups := []uint64{}
+	for _, b := range r.Blocks {
+		if b.Kind == pack.GroupsBlock {
+			firstGroups = append(firstGroups, b.FirstGroup)
+		}
+	}
+	assert.For(ctx, "first groups").ThatSlice(firstGroups).Equals([]uint64{0, 2})
+	for _, test := range []struct {
+		name     string
+		first    uint64
+		count    uint64
+		expected events
+	}{
+		{"first", 0, 1, all[:3]},
+		{"second", 1, 1, all[3:8]},
+		{"across blocks", 1, 2, all[3:10]},
+		{"last", 3, 1, all[10:]},
+		{"past the end", 3, 5, all[10:]},
+		{"none", 4, 1, events{}},
+	} {
+		got := events{}
+		err := r.ReadGroups(ctx, test.first, test.count, &got)
+		assert.For(ctx, "%v ReadGroups", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "%v events", test.name).ThatSlice(got).DeepEquals(test.expected)
+	}
+}
@@ -16,6 +16,7 @@ package pack
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -49,32 +50,35 @@ func Read(ctx context.Context, from io.Reader, events Events, forceDynamic bool)
 		events: events,
 	}
 	r.pb = proto.NewBuffer(r.buf)
-	if version, err := r.readHeader(); err != nil {
+	version, err := r.readHeader()
+	if err != nil {
 		return err
 	} else if !(MinMajorVersion <= version.Major && version.Major <= MaxMajorVersion) {
 		return ErrUnsupportedVersion{Version: version}
 	}
-	for ; !task.Stopped(ctx); r.id++ {
-		if err := r.unmarshal(ctx); err != nil {
-			cause := errors.Cause(err)
-			if cause == io.EOF || cause == io.ErrUnexpectedEOF {
-				return nil
-			}
-			return err
-		}
+	if version.Major >= 3 {
+		return r.readBlocks(ctx)
 	}
-	return task.StopReason(ctx)
+	return r.readChunks(ctx, true)
 }
 
 // CheckMagic checks whether the given stream starts with a pack header.
 // This function will peek the header from the stream without adjusting it's
 // position. The buffer on the reader needs to be at least maxHeaderSize bytes.
 func CheckMagic(from *bufio.Reader) bool {
-	buf, _ := from.Peek(maxHeaderSize)
-	_, err := parseVersion(buf)
+	_, err := PeekVersion(from)
 	return err == nil
 }
 
+// PeekVersion returns the version of the pack file the given stream starts
+// with. This function will peek the header from the stream without adjusting
+// it's position. The buffer on the reader needs to be at least maxHeaderSize
+// bytes.
+func PeekVersion(from *bufio.Reader) (Version, error) {
+	buf, _ := from.Peek(maxHeaderSize)
+	return parseVersion(buf)
+}
+
 // reader is the type for a pack file reader.
 // They should only be constructed by NewReader.
 type reader struct {
@@ -85,6 +89,106 @@ type reader struct {
 	bufOffset int
 	pb        *proto.Buffer
 	from      io.Reader
+	// skipTypes is true if the types have been read from the index, and the
+	// type definition chunks are ignored.
+	skipTypes bool
+	// groups selects the root groups passed to events, or is nil to pass all
+	// of them.
+	groups *groupFilter
+}
+
+// groupFilter selects root groups by their index in the file. The chunks of
+// the other root groups and of their children are skipped without being
+// decoded.
+type groupFilter struct {
+	first, end uint64          // The range of root groups to keep.
+	next       uint64          // The index of the next root group.
+	skipped    map[uint64]bool // The identifiers of the open skipped groups.
+}
+
+// skip returns true if the chunk with the given identifier is skipped.
+// parentID is the identifier of the parent of child chunks and terminators.
+func (f *groupFilter) skip(id, parentID uint64, hasParent, isGroup, isEnd bool) bool {
+	switch {
+	case isEnd:
+		if !f.skipped[parentID] {
+			return false
+		}
+		delete(f.skipped, parentID)
+		return true
+	case !hasParent:
+		if !isGroup {
+			return false
+		}
+		index := f.next
+		f.next++
+		if f.first <= index && index < f.end {
+			return false
+		}
+	case !f.skipped[parentID]:
+		return false
+	}
+	if isGroup {
+		f.skipped[id] = true
+	}
+	return true
+}
+
+// readChunks reads the chunks until the end of the stream. If countIDs is
+// false then the chunks do not increment the chunk identifier.
+func (r *reader) readChunks(ctx context.Context, countIDs bool) error {
+	for !task.Stopped(ctx) {
+		if err := r.unmarshal(ctx); err != nil {
+			cause := errors.Cause(err)
+			if cause == io.EOF || cause == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if countIDs {
+			r.id++
+		}
+	}
+	return task.StopReason(ctx)
+}
+
+// readBlocks reads the blocks of a version 3 pack file until the index.
+func (r *reader) readBlocks(ctx context.Context) error {
+	// The start of the blocks may have been read along with the header. Copy
+	// it, as the buffer is reused for the chunks of each block.
+	read := append([]byte{}, r.buf[r.bufOffset:]...)
+	in := bufio.NewReader(io.MultiReader(bytes.NewReader(read), r.from))
+	r.id = firstBlockID
+	for !task.Stopped(ctx) {
+		kind, data, err := readBlock(in)
+		switch {
+		case err == io.EOF, err == io.ErrUnexpectedEOF:
+			// Like for version 2 files, a truncated file is read up to the
+			// last complete block.
+			return nil
+		case err != nil:
+			return err
+		case kind == indexBlock:
+			return nil
+		}
+		if err := r.readBlockChunks(ctx, kind, data); err != nil {
+			return err
+		}
+	}
+	return task.StopReason(ctx)
+}
+
+// readBlockChunks reads the chunks of the uncompressed block data.
+func (r *reader) readBlockChunks(ctx context.Context, kind BlockKind, data []byte) error {
+	switch kind {
+	case GroupsBlock, ObjectsBlock:
+	default:
+		return fmt.Errorf("Unknown pack block kind: %v", kind)
+	}
+	r.from = bytes.NewReader(data)
+	r.buf = r.buf[:0]
+	r.bufOffset = 0
+	return r.readChunks(ctx, kind == GroupsBlock)
 }
 
 func (r *reader) unmarshal(ctx context.Context) (err error) {
@@ -95,6 +199,9 @@ func (r *reader) unmarshal(ctx context.Context) (err error) {
 
 	// Negated size means this is type definition chunk.
 	if size < 0 {
+		if r.skipTypes {
+			return nil
+		}
 		name, err := r.pb.DecodeStringBytes()
 		if err != nil {
 			return err
@@ -119,6 +226,9 @@ func (r *reader) unmarshal(ctx context.Context) (err error) {
 	}
 	hasParent := int64(parent) < 0
 	hasChildren := int64(tyIdx) < 0
+	if r.groups != nil && r.groups.skip(r.id, r.id+parent, hasParent, hasChildren, tyIdx == 0) {
+		return nil
+	}
 
 	if tyIdx == 0 { // Null-terminator
 		if hasParent {
@@ -25,13 +25,27 @@ import (
 // Writer is the type for a pack file writer.
 // They should only be constructed by NewWriter.
 type Writer struct {
-	types   *types
-	id      uint64
-	buf     *proto.Buffer
-	sizebuf *proto.Buffer
-	to      io.Writer
+	types      *types
+	id         uint64
+	buf        *proto.Buffer
+	sizebuf    *proto.Buffer
+	to         io.Writer
+	blocks     *blockWriter
+	depth      int
+	rootGroups uint64
+	key        []byte // The key of the root object being written.
 }
 
+// chunkKind is the kind of a chunk written by a Writer.
+type chunkKind int
+
+const (
+	typeChunk      chunkKind = iota // A type definition.
+	objectChunk                     // A root object.
+	rootGroupChunk                  // The start of a root group.
+	childChunk                      // A child object, child group or terminator.
+)
+
 // NewWriter constructs and returns a new Writer that writes to the supplied
 // output stream.
 // This method will write the packfile magic and header to the underlying
@@ -49,6 +63,40 @@ func NewWriter(to io.Writer) (*Writer, error) {
 	return w, nil
 }
 
+// NewBlockWriter constructs and returns a new Writer that writes a version 3
+// pack file to the supplied output stream.
+// The chunks are written in compressed blocks of about blockSize bytes, or
+// DefaultBlockSize if blockSize is 0, followed by an index of the blocks when
+// the writer is closed. Root objects are written in separate blocks from the
+// groups, so they can be loaded independently.
+// This method will write the packfile magic and header to the underlying
+// stream.
+func NewBlockWriter(to io.Writer, blockSize int) (*Writer, error) {
+	blocks, err := newBlockWriter(to, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		types:   newTypes(false),
+		id:      firstBlockID,
+		buf:     proto.NewBuffer(make([]byte, 0, initalBufferSize)),
+		sizebuf: proto.NewBuffer(make([]byte, 0, maxVarintSize)),
+		to:      to,
+		blocks:  blocks,
+	}, nil
+}
+
+// Close finishes writing the pack file. For writers constructed with
+// NewBlockWriter, this writes the pending blocks and the index, and nothing
+// can be written after it is called. Groups that are still open are left
+// unterminated.
+func (w *Writer) Close(ctx context.Context) error {
+	if w.blocks == nil {
+		return nil
+	}
+	return w.blocks.close(w.rootGroups, w.types)
+}
+
 // BeginGroup is called to start a new root group.
 func (w *Writer) BeginGroup(ctx context.Context, msg proto.Message) (id uint64, err error) {
 	return w.writeMessage(ctx, msg, true, nil)
@@ -68,7 +116,8 @@ func (w *Writer) EndGroup(ctx context.Context, id uint64) error {
 	if err := w.writeParentID(id); err != nil {
 		return err
 	}
-	return w.flushChunk(false)
+	w.depth--
+	return w.flushChunk(childChunk, 0)
 }
 
 // Object is called to declare an object outside of any group.
@@ -77,6 +126,15 @@ func (w *Writer) Object(ctx context.Context, msg proto.Message) error {
 	return err
 }
 
+// KeyedObject is like Object, but also records key in the index of version 3
+// pack files, so that the object can be found without reading its block.
+// The key is dropped by writers of earlier versions.
+func (w *Writer) KeyedObject(ctx context.Context, msg proto.Message, key []byte) error {
+	w.key = key
+	defer func() { w.key = nil }()
+	return w.Object(ctx, msg)
+}
+
 // ChildObject is called to declare an object in the group with the given
 // identifier.
 func (w *Writer) ChildObject(ctx context.Context, msg proto.Message, parentID uint64) error {
@@ -114,8 +172,20 @@ func (w *Writer) writeMessage(ctx context.Context, msg proto.Message, isGroup bo
 		return 0, err
 	}
 
+	kind := childChunk
+	switch {
+	case parentID != nil:
+	case isGroup:
+		kind = rootGroupChunk
+	default:
+		kind = objectChunk
+	}
+	if isGroup {
+		w.depth++
+	}
+
 	id = w.id // I don't think it is safe to inline it below.
-	return id, w.flushChunk(false)
+	return id, w.flushChunk(kind, ty.index)
 }
 
 func (w *Writer) writeParentID(id uint64) error {
@@ -132,17 +202,22 @@ func (w *Writer) writeType(t *ty) error {
 	if err := w.buf.Marshal(t.desc); err != nil {
 		return err
 	}
-	return w.flushChunk(true)
+	return w.flushChunk(typeChunk, 0)
 }
 
-func (w *Writer) flushChunk(isTypeDef bool) error {
+// flushChunk writes the chunk in the buffer. tyIdx is the type index of root
+// objects.
+func (w *Writer) flushChunk(kind chunkKind, tyIdx uint64) error {
 	size := len(w.buf.Bytes())
-	if isTypeDef {
+	if kind == typeChunk {
 		size = -size
 	}
 	if err := w.sizebuf.EncodeZigzag64(uint64(size)); err != nil {
 		return err
 	}
+	if w.blocks != nil {
+		return w.flushBlockChunk(kind, tyIdx)
+	}
 	_, err := w.to.Write(w.sizebuf.Bytes())
 	w.sizebuf.Reset()
 	if err != nil {
@@ -153,3 +228,26 @@ func (w *Writer) flushChunk(isTypeDef bool) error {
 	w.id++
 	return err
 }
+
+// flushBlockChunk adds the chunk in the buffer to the pending blocks. Only the
+// chunks of groups blocks are counted in the chunk identifiers.
+func (w *Writer) flushBlockChunk(kind chunkKind, tyIdx uint64) error {
+	defer w.sizebuf.Reset()
+	defer w.buf.Reset()
+	switch kind {
+	case typeChunk:
+		return w.blocks.object(w.sizebuf.Bytes(), w.buf.Bytes(), 0, nil)
+	case objectChunk:
+		return w.blocks.object(w.sizebuf.Bytes(), w.buf.Bytes(), tyIdx, w.key)
+	}
+	w.blocks.group(w.sizebuf.Bytes(), w.buf.Bytes(), w.id, w.rootGroups)
+	w.id++
+	if kind == rootGroupChunk {
+		w.rootGroups++
+	}
+	if w.depth == 0 {
+		// Blocks only end between root groups.
+		return w.blocks.flush(false, w.rootGroups)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/math/f16"
+	"github.com/google/gapid/core/math/sint"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/stream"
+)
+
+var (
+	BC6H_RGB_UFLOAT = NewBC6H_RGB_UFLOAT("BC6H_RGB_UFLOAT")
+	BC6H_RGB_SFLOAT = NewBC6H_RGB_SFLOAT("BC6H_RGB_SFLOAT")
+)
+
+func init() {
+	RegisterConverter(BC6H_RGB_UFLOAT, RGBA_F32, func(src []byte, w, h, d int) ([]byte, error) {
+		return decodeBC6H(src, w, h, d, false), nil
+	})
+	RegisterConverter(BC6H_RGB_SFLOAT, RGBA_F32, func(src []byte, w, h, d int) ([]byte, error) {
+		return decodeBC6H(src, w, h, d, true), nil
+	})
+	RegisterConverter(BC6H_RGB_UFLOAT, RGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+		return Convert(decodeBC6H(src, w, h, d, false), w, h, d, RGBA_F32, RGBA_U8_NORM)
+	})
+	RegisterConverter(BC6H_RGB_SFLOAT, RGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+		return Convert(decodeBC6H(src, w, h, d, true), w, h, d, RGBA_F32, RGBA_U8_NORM)
+	})
+}
+
+// NewBC6H_RGB_UFLOAT returns a format representing the BC6H (BPTC_FLOAT)
+// unsigned block texture compression format.
+func NewBC6H_RGB_UFLOAT(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc6HRgbUfloat{&FmtBC6H_RGB_UFLOAT{}}}
+}
+
+func (f *FmtBC6H_RGB_UFLOAT) key() interface{} {
+	return "BC6H_RGB_UFLOAT"
+}
+func (*FmtBC6H_RGB_UFLOAT) size(w, h, d int) int {
+	return d * (sint.Max(sint.AlignUp(w, 4), 4) * sint.Max(sint.AlignUp(h, 4), 4))
+}
+func (f *FmtBC6H_RGB_UFLOAT) check(data []byte, w, h, d int) error {
+	return checkSize(data, f, w, h, d)
+}
+func (*FmtBC6H_RGB_UFLOAT) channels() stream.Channels {
+	return stream.Channels{stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue}
+}
+
+// NewBC6H_RGB_SFLOAT returns a format representing the BC6H (BPTC_FLOAT)
+// signed block texture compression format.
+func NewBC6H_RGB_SFLOAT(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc6HRgbSfloat{&FmtBC6H_RGB_SFLOAT{}}}
+}
+
+func (f *FmtBC6H_RGB_SFLOAT) key() interface{} {
+	return "BC6H_RGB_SFLOAT"
+}
+func (*FmtBC6H_RGB_SFLOAT) size(w, h, d int) int {
+	return d * (sint.Max(sint.AlignUp(w, 4), 4) * sint.Max(sint.AlignUp(h, 4), 4))
+}
+func (f *FmtBC6H_RGB_SFLOAT) check(data []byte, w, h, d int) error {
+	return checkSize(data, f, w, h, d)
+}
+func (*FmtBC6H_RGB_SFLOAT) channels() stream.Channels {
+	return stream.Channels{stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue}
+}
+
+// decodeBC6H decodes the BC6H image to RGBA_F32.
+func decodeBC6H(src []byte, width, height, depth int, signed bool) []byte {
+	texels := make([]rgbaF32, width*height*depth)
+	block := make([]rgbaF32, 16)
+	r := endian.Reader(bytes.NewReader(src), device.LittleEndian)
+	for z := 0; z < depth; z++ {
+		texels := texels[z*width*height:]
+		for y := 0; y < height; y += 4 {
+			for x := 0; x < width; x += 4 {
+				decodeBC6HBlock(r, block, signed)
+				for dy := 0; dy < 4 && y+dy < height; dy++ {
+					for dx := 0; dx < 4 && x+dx < width; dx++ {
+						texels[(y+dy)*width+x+dx] = block[dy*4+dx]
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]byte, len(texels)*4*4)
+	w := endian.Writer(bytes.NewBuffer(out[:0]), device.LittleEndian)
+	for _, t := range texels {
+		w.Float32(t.r)
+		w.Float32(t.g)
+		w.Float32(t.b)
+		w.Float32(t.a)
+	}
+	return out
+}
+
+// bc6hField is a run of bits in a BC6H block header, holding the bits hi to lo
+// (inclusive) of the channel ch of endpoint ep. Endpoints 0 and 1 belong to the
+// first region, 2 and 3 to the second.
+type bc6hField struct {
+	ch, ep, hi, lo int
+}
+
+const (
+	bc6hR = 0
+	bc6hG = 1
+	bc6hB = 2
+)
+
+// bc6hMode describes the layout of a BC6H block for one of the 14 modes.
+type bc6hMode struct {
+	regions     int
+	transformed bool // Endpoints 1-3 are stored as deltas from endpoint 0.
+	bits        int  // Precision of the endpoints.
+	deltaBits   [3]int
+	fields      []bc6hField
+}
+
+// bc6hModes holds the BC6H modes indexed by the mode value.
+// See the BPTC_FLOAT section of the Khronos Data Format Specification.
+var bc6hModes = [32]*bc6hMode{
+	0x00: {2, true, 10, [3]int{5, 5, 5}, []bc6hField{
+		{bc6hG, 2, 4, 4}, {bc6hB, 2, 4, 4}, {bc6hB, 3, 4, 4},
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 4, 0}, {bc6hG, 3, 4, 4}, {bc6hG, 2, 3, 0},
+		{bc6hG, 1, 4, 0}, {bc6hB, 3, 0, 0}, {bc6hG, 3, 3, 0},
+		{bc6hB, 1, 4, 0}, {bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0},
+		{bc6hR, 2, 4, 0}, {bc6hB, 3, 2, 2}, {bc6hR, 3, 4, 0},
+		{bc6hB, 3, 3, 3},
+	}},
+	0x01: {2, true, 7, [3]int{6, 6, 6}, []bc6hField{
+		{bc6hG, 2, 5, 5}, {bc6hG, 3, 4, 4}, {bc6hG, 3, 5, 5},
+		{bc6hR, 0, 6, 0}, {bc6hB, 3, 0, 0}, {bc6hB, 3, 1, 1}, {bc6hB, 2, 4, 4},
+		{bc6hG, 0, 6, 0}, {bc6hB, 2, 5, 5}, {bc6hB, 3, 2, 2}, {bc6hG, 2, 4, 4},
+		{bc6hB, 0, 6, 0}, {bc6hB, 3, 3, 3}, {bc6hB, 3, 5, 5}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 5, 0}, {bc6hG, 2, 3, 0}, {bc6hG, 1, 5, 0},
+		{bc6hG, 3, 3, 0}, {bc6hB, 1, 5, 0}, {bc6hB, 2, 3, 0},
+		{bc6hR, 2, 5, 0}, {bc6hR, 3, 5, 0},
+	}},
+	0x02: {2, true, 11, [3]int{5, 4, 4}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 4, 0}, {bc6hR, 0, 10, 10}, {bc6hG, 2, 3, 0},
+		{bc6hG, 1, 3, 0}, {bc6hG, 0, 10, 10}, {bc6hB, 3, 0, 0},
+		{bc6hG, 3, 3, 0}, {bc6hB, 1, 3, 0}, {bc6hB, 0, 10, 10},
+		{bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 4, 0},
+		{bc6hB, 3, 2, 2}, {bc6hR, 3, 4, 0}, {bc6hB, 3, 3, 3},
+	}},
+	0x06: {2, true, 11, [3]int{4, 5, 4}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 3, 0}, {bc6hR, 0, 10, 10}, {bc6hG, 3, 4, 4},
+		{bc6hG, 2, 3, 0}, {bc6hG, 1, 4, 0}, {bc6hG, 0, 10, 10},
+		{bc6hG, 3, 3, 0}, {bc6hB, 1, 3, 0}, {bc6hB, 0, 10, 10},
+		{bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 3, 0},
+		{bc6hB, 3, 0, 0}, {bc6hB, 3, 2, 2}, {bc6hR, 3, 3, 0},
+		{bc6hG, 2, 4, 4}, {bc6hB, 3, 3, 3},
+	}},
+	0x0a: {2, true, 11, [3]int{4, 4, 5}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 3, 0}, {bc6hR, 0, 10, 10}, {bc6hB, 2, 4, 4},
+		{bc6hG, 2, 3, 0}, {bc6hG, 1, 3, 0}, {bc6hG, 0, 10, 10},
+		{bc6hB, 3, 0, 0}, {bc6hG, 3, 3, 0}, {bc6hB, 1, 4, 0},
+		{bc6hB, 0, 10, 10}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 3, 0},
+		{bc6hB, 3, 1, 1}, {bc6hB, 3, 2, 2}, {bc6hR, 3, 3, 0},
+		{bc6hB, 3, 4, 4}, {bc6hB, 3, 3, 3},
+	}},
+	0x0e: {2, true, 9, [3]int{5, 5, 5}, []bc6hField{
+		{bc6hR, 0, 8, 0}, {bc6hB, 2, 4, 4}, {bc6hG, 0, 8, 0},
+		{bc6hG, 2, 4, 4}, {bc6hB, 0, 8, 0}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 4, 0}, {bc6hG, 3, 4, 4}, {bc6hG, 2, 3, 0},
+		{bc6hG, 1, 4, 0}, {bc6hB, 3, 0, 0}, {bc6hG, 3, 3, 0},
+		{bc6hB, 1, 4, 0}, {bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0},
+		{bc6hR, 2, 4, 0}, {bc6hB, 3, 2, 2}, {bc6hR, 3, 4, 0},
+		{bc6hB, 3, 3, 3},
+	}},
+	0x12: {2, true, 8, [3]int{6, 5, 5}, []bc6hField{
+		{bc6hR, 0, 7, 0}, {bc6hG, 3, 4, 4}, {bc6hB, 2, 4, 4},
+		{bc6hG, 0, 7, 0}, {bc6hB, 3, 2, 2}, {bc6hG, 2, 4, 4},
+		{bc6hB, 0, 7, 0}, {bc6hB, 3, 3, 3}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 5, 0}, {bc6hG, 2, 3, 0}, {bc6hG, 1, 4, 0},
+		{bc6hB, 3, 0, 0}, {bc6hG, 3, 3, 0}, {bc6hB, 1, 4, 0},
+		{bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 5, 0},
+		{bc6hR, 3, 5, 0},
+	}},
+	0x16: {2, true, 8, [3]int{5, 6, 5}, []bc6hField{
+		{bc6hR, 0, 7, 0}, {bc6hB, 3, 0, 0}, {bc6hB, 2, 4, 4},
+		{bc6hG, 0, 7, 0}, {bc6hG, 2, 5, 5}, {bc6hG, 2, 4, 4},
+		{bc6hB, 0, 7, 0}, {bc6hG, 3, 5, 5}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 4, 0}, {bc6hG, 3, 4, 4}, {bc6hG, 2, 3, 0},
+		{bc6hG, 1, 5, 0}, {bc6hG, 3, 3, 0}, {bc6hB, 1, 4, 0},
+		{bc6hB, 3, 1, 1}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 4, 0},
+		{bc6hB, 3, 2, 2}, {bc6hR, 3, 4, 0}, {bc6hB, 3, 3, 3},
+	}},
+	0x1a: {2, true, 8, [3]int{5, 5, 6}, []bc6hField{
+		{bc6hR, 0, 7, 0}, {bc6hB, 3, 1, 1}, {bc6hB, 2, 4, 4},
+		{bc6hG, 0, 7, 0}, {bc6hB, 2, 5, 5}, {bc6hG, 2, 4, 4},
+		{bc6hB, 0, 7, 0}, {bc6hB, 3, 5, 5}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 4, 0}, {bc6hG, 3, 4, 4}, {bc6hG, 2, 3, 0},
+		{bc6hG, 1, 4, 0}, {bc6hB, 3, 0, 0}, {bc6hG, 3, 3, 0},
+		{bc6hB, 1, 5, 0}, {bc6hB, 2, 3, 0}, {bc6hR, 2, 4, 0},
+		{bc6hB, 3, 2, 2}, {bc6hR, 3, 4, 0}, {bc6hB, 3, 3, 3},
+	}},
+	0x1e: {2, false, 6, [3]int{6, 6, 6}, []bc6hField{
+		{bc6hR, 0, 5, 0}, {bc6hG, 3, 4, 4}, {bc6hB, 3, 0, 0},
+		{bc6hB, 3, 1, 1}, {bc6hB, 2, 4, 4}, {bc6hG, 0, 5, 0},
+		{bc6hG, 2, 5, 5}, {bc6hB, 2, 5, 5}, {bc6hB, 3, 2, 2},
+		{bc6hG, 2, 4, 4}, {bc6hB, 0, 5, 0}, {bc6hG, 3, 5, 5},
+		{bc6hB, 3, 3, 3}, {bc6hB, 3, 5, 5}, {bc6hB, 3, 4, 4},
+		{bc6hR, 1, 5, 0}, {bc6hG, 2, 3, 0}, {bc6hG, 1, 5, 0},
+		{bc6hG, 3, 3, 0}, {bc6hB, 1, 5, 0}, {bc6hB, 2, 3, 0},
+		{bc6hR, 2, 5, 0}, {bc6hR, 3, 5, 0},
+	}},
+	0x03: {1, false, 10, [3]int{10, 10, 10}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 9, 0}, {bc6hG, 1, 9, 0}, {bc6hB, 1, 9, 0},
+	}},
+	0x07: {1, true, 11, [3]int{9, 9, 9}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 8, 0}, {bc6hR, 0, 10, 10},
+		{bc6hG, 1, 8, 0}, {bc6hG, 0, 10, 10},
+		{bc6hB, 1, 8, 0}, {bc6hB, 0, 10, 10},
+	}},
+	0x0b: {1, true, 12, [3]int{8, 8, 8}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 7, 0}, {bc6hR, 0, 11, 11}, {bc6hR, 0, 10, 10},
+		{bc6hG, 1, 7, 0}, {bc6hG, 0, 11, 11}, {bc6hG, 0, 10, 10},
+		{bc6hB, 1, 7, 0}, {bc6hB, 0, 11, 11}, {bc6hB, 0, 10, 10},
+	}},
+	0x0f: {1, true, 16, [3]int{4, 4, 4}, []bc6hField{
+		{bc6hR, 0, 9, 0}, {bc6hG, 0, 9, 0}, {bc6hB, 0, 9, 0},
+		{bc6hR, 1, 3, 0}, {bc6hR, 0, 15, 15}, {bc6hR, 0, 14, 14}, {bc6hR, 0, 13, 13},
+		{bc6hR, 0, 12, 12}, {bc6hR, 0, 11, 11}, {bc6hR, 0, 10, 10},
+		{bc6hG, 1, 3, 0}, {bc6hG, 0, 15, 15}, {bc6hG, 0, 14, 14}, {bc6hG, 0, 13, 13},
+		{bc6hG, 0, 12, 12}, {bc6hG, 0, 11, 11}, {bc6hG, 0, 10, 10},
+		{bc6hB, 1, 3, 0}, {bc6hB, 0, 15, 15}, {bc6hB, 0, 14, 14}, {bc6hB, 0, 13, 13},
+		{bc6hB, 0, 12, 12}, {bc6hB, 0, 11, 11}, {bc6hB, 0, 10, 10},
+	}},
+}
+
+// decodeBC6HBlock decodes a single 16 byte BC6H block into dst.
+func decodeBC6HBlock(r binary.Reader, dst []rgbaF32, signed bool) {
+	b := readBPTCBits(r)
+
+	modeBits := b.read(2)
+	if modeBits > 1 {
+		modeBits |= b.read(3) << 2
+	}
+	m := bc6hModes[modeBits]
+	if m == nil {
+		// Reserved mode. Decodes to black.
+		for i := 0; i < 16; i++ {
+			dst[i] = rgbaF32{0, 0, 0, 1}
+		}
+		return
+	}
+
+	endpoints := [4][3]int{}
+	for _, f := range m.fields {
+		endpoints[f.ep][f.ch] |= b.read(f.hi-f.lo+1) << uint(f.lo)
+	}
+
+	numEndpoints := m.regions * 2
+	partition := 0
+	if m.regions == 2 {
+		partition = b.read(5)
+	}
+
+	for c := 0; c < 3; c++ {
+		if signed {
+			endpoints[0][c] = bc6hSignExtend(endpoints[0][c], m.bits)
+		}
+		for e := 1; e < numEndpoints; e++ {
+			if m.transformed {
+				d := bc6hSignExtend(endpoints[e][c], m.deltaBits[c])
+				endpoints[e][c] = (endpoints[0][c] + d) & (1<<uint(m.bits) - 1)
+			}
+			if signed {
+				endpoints[e][c] = bc6hSignExtend(endpoints[e][c], m.bits)
+			}
+		}
+		for e := 0; e < numEndpoints; e++ {
+			endpoints[e][c] = bc6hUnquantize(endpoints[e][c], m.bits, signed)
+		}
+	}
+
+	subsets := [16]int{}
+	anchor := 0
+	indexBits := 4
+	if m.regions == 2 {
+		subsets = bptcPartitions2[partition]
+		anchor = bptcAnchors2[partition]
+		indexBits = 3
+	}
+
+	// The anchor index of each region has an implicit 0 for its top bit.
+	for i := 0; i < 16; i++ {
+		var index int
+		if i == 0 || (m.regions == 2 && i == anchor) {
+			index = b.read(indexBits - 1)
+		} else {
+			index = b.read(indexBits)
+		}
+		w := bptcWeights(indexBits)[index]
+		e0, e1 := endpoints[subsets[i]*2], endpoints[subsets[i]*2+1]
+		dst[i] = rgbaF32{
+			bc6hToFloat(bptcInterpolate(e0[0], e1[0], w), signed),
+			bc6hToFloat(bptcInterpolate(e0[1], e1[1], w), signed),
+			bc6hToFloat(bptcInterpolate(e0[2], e1[2], w), signed),
+			1,
+		}
+	}
+}
+
+// bc6hSignExtend sign extends the bits-wide value v.
+func bc6hSignExtend(v, bits int) int {
+	shift := uint(64 - bits)
+	return int(int64(v) << shift >> shift)
+}
+
+// bc6hUnquantize scales the bits-wide endpoint value v to 16 bits.
+func bc6hUnquantize(v, bits int, signed bool) int {
+	if !signed {
+		switch {
+		case bits >= 15, v == 0:
+			return v
+		case v == 1<<uint(bits)-1:
+			return 0xffff
+		default:
+			return (v<<16 + 0x8000) >> uint(bits)
+		}
+	}
+	if bits >= 16 {
+		return v
+	}
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	switch {
+	case v == 0:
+	case v >= 1<<uint(bits-1)-1:
+		v = 0x7fff
+	default:
+		v = (v<<15 + 0x4000) >> uint(bits-1)
+	}
+	if neg {
+		v = -v
+	}
+	return v
+}
+
+// bc6hToFloat scales the interpolated value v to the half float range and
+// returns it as a float32.
+func bc6hToFloat(v int, signed bool) float32 {
+	if !signed {
+		return f16.Number(v * 31 >> 6).Float32()
+	}
+	if v < 0 {
+		return f16.Number(0x8000 | (-v*31)>>5).Float32()
+	}
+	return f16.Number(v * 31 >> 5).Float32()
+}
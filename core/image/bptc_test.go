@@ -0,0 +1,134 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/os/device"
+)
+
+func TestBPTCBlocks(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		fmt      *image.Format
+		block    []byte
+		first    [4]float32
+		last     [4]float32
+		u8       [4]byte
+		checkU8  bool
+		checkF32 bool
+	}{
+		{
+			name: "BC7 mode 6 solid",
+			fmt:  image.BC7_RGBA_U8_NORM,
+			block: []byte{
+				0xc0, 0xff, 0x1f, 0x00, 0x00, 0x02, 0xff, 0xff,
+				0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+			u8:      [4]byte{255, 1, 129, 255},
+			checkU8: true,
+		}, {
+			name:    "BC7 reserved mode",
+			fmt:     image.BC7_RGBA_U8_NORM,
+			block:   make([]byte, 16),
+			u8:      [4]byte{0, 0, 0, 0},
+			checkU8: true,
+		}, {
+			name: "BC6H unsigned mode 11",
+			fmt:  image.BC6H_RGB_UFLOAT,
+			block: []byte{
+				0x03, 0x00, 0x00, 0x00, 0xf8, 0xff, 0xff, 0xff,
+				0x11, 0x32, 0x54, 0x76, 0x98, 0xba, 0xdc, 0xfe,
+			},
+			first:    [4]float32{0, 0, 0, 1},
+			last:     [4]float32{65504, 65504, 65504, 1},
+			checkF32: true,
+		}, {
+			name: "BC6H signed mode 11",
+			fmt:  image.BC6H_RGB_SFLOAT,
+			block: []byte{
+				0x23, 0xc0, 0x00, 0x03, 0xfc, 0xef, 0xbf, 0xff,
+				0x10, 0x32, 0x54, 0x76, 0x98, 0xba, 0xdc, 0xfe,
+			},
+			first:    [4]float32{-65504, -65504, -65504, 1},
+			last:     [4]float32{65504, 65504, 65504, 1},
+			checkF32: true,
+		},
+	} {
+		if test.checkU8 {
+			got, err := image.Convert(test.block, 4, 4, 1, test.fmt, image.RGBA_U8_NORM)
+			if err != nil {
+				t.Errorf("%v: Convert returned error: %v", test.name, err)
+				continue
+			}
+			for i := 0; i < 16; i++ {
+				if texel := [4]byte{got[i*4], got[i*4+1], got[i*4+2], got[i*4+3]}; texel != test.u8 {
+					t.Errorf("%v: texel %d was not as expected. Expected %v, got %v", test.name, i, test.u8, texel)
+				}
+			}
+		}
+		if test.checkF32 {
+			got, err := image.Convert(test.block, 4, 4, 1, test.fmt, image.RGBA_F32)
+			if err != nil {
+				t.Errorf("%v: Convert returned error: %v", test.name, err)
+				continue
+			}
+			r := endian.Reader(bytes.NewReader(got), device.LittleEndian)
+			texels := make([][4]float32, 16)
+			for i := range texels {
+				texels[i] = [4]float32{r.Float32(), r.Float32(), r.Float32(), r.Float32()}
+			}
+			if texels[0] != test.first {
+				t.Errorf("%v: first texel was not as expected. Expected %v, got %v", test.name, test.first, texels[0])
+			}
+			if texels[15] != test.last {
+				t.Errorf("%v: last texel was not as expected. Expected %v, got %v", test.name, test.last, texels[15])
+			}
+		}
+	}
+}
+
+func TestBC6HDecompressor(t *testing.T) {
+	for _, f := range []*image.Format{image.BC6H_RGB_UFLOAT, image.BC6H_RGB_SFLOAT} {
+		inPath := filepath.Join("test_data", f.Name+".bin")
+		refPath := filepath.Join("test_data", f.Name+".f32")
+
+		in, err := ioutil.ReadFile(inPath)
+		if err != nil {
+			t.Errorf("Failed to read '%s': %v", inPath, err)
+			continue
+		}
+		ref, err := ioutil.ReadFile(refPath)
+		if err != nil {
+			t.Errorf("Failed to read '%s': %v", refPath, err)
+			continue
+		}
+
+		out, err := image.Convert(in, 32, 32, 1, f, image.RGBA_F32)
+		if err != nil {
+			t.Errorf("Failed to convert '%s' from %v to %v: %v", inPath, f.Name, image.RGBA_F32.Name, err)
+			continue
+		}
+		if !bytes.Equal(out, ref) {
+			t.Errorf("%v produced unexpected output when decompressing", f.Name)
+		}
+	}
+}
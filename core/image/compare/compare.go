@@ -0,0 +1,275 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compare provides metrics for the comparison of two images.
+package compare
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/os/device"
+)
+
+// The size and stride, in pixels, of the windows SSIM is computed over.
+const (
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+// The stabilizing constants of SSIM, for a dynamic range of 1.
+const (
+	ssimC1 = 0.01 * 0.01
+	ssimC2 = 0.03 * 0.03
+)
+
+// Result holds the metrics of the comparison of two images.
+// Channel values are normalized to [0, 1] before comparison.
+type Result struct {
+	Width, Height uint32
+	// MeanAbsError is the mean absolute difference of each of the red, green,
+	// blue and alpha channels.
+	MeanAbsError [4]float64
+	// MaxAbsError is the largest absolute difference of each of the red,
+	// green, blue and alpha channels.
+	MaxAbsError [4]float64
+	// MaxError is the largest absolute difference of any channel.
+	MaxError float64
+	// RMSE is the root mean square error of the red, green and blue channels.
+	RMSE float64
+	// PSNR is the peak signal-to-noise ratio in decibels of the red, green and
+	// blue channels. It is +Inf for identical images.
+	PSNR float64
+	// SSIM is the mean structural similarity index of the luminance of the
+	// images. It is 1 for identical images.
+	SSIM float64
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("RMSE: %.6f, PSNR: %.2fdB, SSIM: %.6f, max error: %.6f",
+		r.RMSE, r.PSNR, r.SSIM, r.MaxError)
+}
+
+// rgba is an image decoded to normalized RGBA floats.
+type rgba struct {
+	width, height int
+	pixels        [][4]float64
+}
+
+func decode(d *image.Data) (*rgba, error) {
+	d, err := d.Convert(image.RGBA_F32)
+	if err != nil {
+		return nil, err
+	}
+	out := &rgba{
+		width:  int(d.Width),
+		height: int(d.Height * d.Depth),
+		pixels: make([][4]float64, d.Width*d.Height*d.Depth),
+	}
+	r := endian.Reader(bytes.NewReader(d.Bytes), device.LittleEndian)
+	for i := range out.pixels {
+		for c := 0; c < 4; c++ {
+			out.pixels[i][c] = float64(r.Float32())
+		}
+	}
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodePair(a, b *image.Data) (*rgba, *rgba, error) {
+	if a.Width != b.Width || a.Height != b.Height || a.Depth != b.Depth {
+		return nil, nil, fmt.Errorf("Image dimensions are not identical. %dx%dx%d vs %dx%dx%d",
+			a.Width, a.Height, a.Depth, b.Width, b.Height, b.Depth)
+	}
+	x, err := decode(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	y, err := decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return x, y, nil
+}
+
+// Compare returns the metrics of the comparison of the images a and b, which
+// must have the same dimensions.
+func Compare(a, b *image.Data) (*Result, error) {
+	x, y, err := decodePair(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Width: a.Width, Height: a.Height}
+	if len(x.pixels) == 0 {
+		res.PSNR, res.SSIM = math.Inf(1), 1
+		return res, nil
+	}
+
+	sqrErr := 0.0
+	for i := range x.pixels {
+		for c := 0; c < 4; c++ {
+			d := math.Abs(x.pixels[i][c] - y.pixels[i][c])
+			res.MeanAbsError[c] += d
+			if d > res.MaxAbsError[c] {
+				res.MaxAbsError[c] = d
+			}
+			if d > res.MaxError {
+				res.MaxError = d
+			}
+			if c < 3 {
+				sqrErr += d * d
+			}
+		}
+	}
+	n := float64(len(x.pixels))
+	for c := range res.MeanAbsError {
+		res.MeanAbsError[c] /= n
+	}
+	res.RMSE = math.Sqrt(sqrErr / (n * 3))
+	if res.RMSE == 0 {
+		res.PSNR = math.Inf(1)
+	} else {
+		res.PSNR = 20 * math.Log10(1/res.RMSE)
+	}
+	res.SSIM = ssim(x, y)
+	return res, nil
+}
+
+func luminance(p [4]float64) float64 {
+	return 0.299*p[0] + 0.587*p[1] + 0.114*p[2]
+}
+
+// ssim returns the mean SSIM of the luminance of the images, over overlapping
+// windows. Images smaller than a window are compared as a single window.
+func ssim(x, y *rgba) float64 {
+	windowW, windowH := ssimWindow, ssimWindow
+	if x.width < windowW {
+		windowW = x.width
+	}
+	if x.height < windowH {
+		windowH = x.height
+	}
+
+	sum, count := 0.0, 0
+	for top := 0; top+windowH <= x.height; top += ssimStride {
+		for left := 0; left+windowW <= x.width; left += ssimStride {
+			var meanX, meanY, varX, varY, covar float64
+			for j := top; j < top+windowH; j++ {
+				for i := left; i < left+windowW; i++ {
+					meanX += luminance(x.pixels[j*x.width+i])
+					meanY += luminance(y.pixels[j*y.width+i])
+				}
+			}
+			n := float64(windowW * windowH)
+			meanX, meanY = meanX/n, meanY/n
+			for j := top; j < top+windowH; j++ {
+				for i := left; i < left+windowW; i++ {
+					dx := luminance(x.pixels[j*x.width+i]) - meanX
+					dy := luminance(y.pixels[j*y.width+i]) - meanY
+					varX += dx * dx
+					varY += dy * dy
+					covar += dx * dy
+				}
+			}
+			varX, varY, covar = varX/n, varY/n, covar/n
+			sum += ((2*meanX*meanY + ssimC1) * (2*covar + ssimC2)) /
+				((meanX*meanX + meanY*meanY + ssimC1) * (varX + varY + ssimC2))
+			count++
+		}
+	}
+	return sum / float64(count)
+}
+
+// Difference returns the per-channel absolute difference of the images a and
+// b, which must have the same dimensions, in the RGBA_F32 format.
+func Difference(a, b *image.Data) (*image.Data, error) {
+	x, y, err := decodePair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	w := endian.Writer(buf, device.LittleEndian)
+	for i := range x.pixels {
+		for c := 0; c < 4; c++ {
+			w.Float32(float32(math.Abs(x.pixels[i][c] - y.pixels[i][c])))
+		}
+	}
+	return &image.Data{
+		Format: image.RGBA_F32,
+		Width:  a.Width,
+		Height: a.Height,
+		Depth:  a.Depth,
+		Bytes:  buf.Bytes(),
+	}, nil
+}
+
+var heatGradient = [8][3]float64{
+	{0x00, 0x00, 0x48},
+	{0x00, 0x58, 0xbf},
+	{0x00, 0xd8, 0xfe},
+	{0x00, 0xed, 0x06},
+	{0xb0, 0xeb, 0x00},
+	{0xff, 0xb9, 0x19},
+	{0xff, 0x00, 0x00},
+	{0xff, 0xff, 0xff},
+}
+
+// Heat returns the heat-map color of the value v, which is clamped to [0, 1].
+func Heat(v float64) color.NRGBA {
+	v = math.Max(0, math.Min(1, v))
+	c := float64(len(heatGradient) - 1)
+	index := int(math.Min(v*c, c-1))
+	weight := v*c - float64(index)
+	lerp := func(i int) uint8 {
+		return uint8(heatGradient[index][i]*(1-weight) + heatGradient[index+1][i]*weight + 0.5)
+	}
+	return color.NRGBA{lerp(0), lerp(1), lerp(2), 0xff}
+}
+
+// HeatMap returns a heat-map of the largest per-channel absolute difference of
+// each pixel of the images a and b, which must have the same dimensions, in
+// the RGBA_U8_NORM format. Differences of max or more map to the hottest
+// color. If max is not positive, then 1 is used instead.
+func HeatMap(a, b *image.Data, max float64) (*image.Data, error) {
+	x, y, err := decodePair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if max <= 0 {
+		max = 1
+	}
+	out := make([]byte, 0, len(x.pixels)*4)
+	for i := range x.pixels {
+		d := 0.0
+		for c := 0; c < 4; c++ {
+			d = math.Max(d, math.Abs(x.pixels[i][c]-y.pixels[i][c]))
+		}
+		h := Heat(d / max)
+		out = append(out, h.R, h.G, h.B, h.A)
+	}
+	return &image.Data{
+		Format: image.RGBA_U8_NORM,
+		Width:  a.Width,
+		Height: a.Height,
+		Depth:  a.Depth,
+		Bytes:  out,
+	}, nil
+}
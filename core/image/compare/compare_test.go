@@ -0,0 +1,159 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compare_test
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/image/compare"
+)
+
+func fill(w, h uint32, r, g, b, a byte) *image.Data {
+	bytes := make([]byte, w*h*4)
+	for p := 0; p < len(bytes); p += 4 {
+		bytes[p+0] = r
+		bytes[p+1] = g
+		bytes[p+2] = b
+		bytes[p+3] = a
+	}
+	return &image.Data{
+		Width:  w,
+		Height: h,
+		Depth:  1,
+		Bytes:  bytes,
+		Format: image.RGBA_U8_NORM,
+	}
+}
+
+func TestCompare(t *testing.T) {
+	const eps = 0.000001
+	for _, test := range []struct {
+		name     string
+		a, b     *image.Data
+		rmse     float64
+		psnr     float64
+		maxError float64
+		maxAlpha float64
+		ssim     float64
+	}{
+		{
+			name:     "white vs black",
+			a:        fill(16, 16, 0xff, 0xff, 0xff, 0xff),
+			b:        fill(16, 16, 0x00, 0x00, 0x00, 0xff),
+			rmse:     1,
+			psnr:     0,
+			maxError: 1,
+			ssim:     0.0001 / 1.0001,
+		}, {
+			name:     "white vs cyan",
+			a:        fill(16, 16, 0xff, 0xff, 0xff, 0xff),
+			b:        fill(16, 16, 0x00, 0xff, 0xff, 0xff),
+			rmse:     math.Sqrt(1.0 / 3),
+			psnr:     20 * math.Log10(math.Sqrt(3)),
+			maxError: 1,
+			ssim:     (2*0.701 + 0.0001) / (1 + 0.701*0.701 + 0.0001),
+		}, {
+			name:     "opaque vs transparent",
+			a:        fill(4, 4, 0xff, 0x00, 0xff, 0xff),
+			b:        fill(4, 4, 0xff, 0x00, 0xff, 0x00),
+			rmse:     0,
+			psnr:     math.Inf(1),
+			maxError: 1,
+			maxAlpha: 1,
+			ssim:     1,
+		}, {
+			name: "identical",
+			a:    fill(3, 5, 0x12, 0x34, 0x56, 0x78),
+			b:    fill(3, 5, 0x12, 0x34, 0x56, 0x78),
+			psnr: math.Inf(1),
+			ssim: 1,
+		},
+	} {
+		res, err := compare.Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare of %v returned error: %v", test.name, err)
+			continue
+		}
+		check := func(metric string, got, expected float64) {
+			if math.IsInf(expected, 1) && math.IsInf(got, 1) {
+				return
+			}
+			if math.Abs(got-expected) > eps {
+				t.Errorf("Compare of %v gave %v: %v, expected: %v", test.name, metric, got, expected)
+			}
+		}
+		check("RMSE", res.RMSE, test.rmse)
+		check("PSNR", res.PSNR, test.psnr)
+		check("max error", res.MaxError, test.maxError)
+		check("max alpha error", res.MaxAbsError[3], test.maxAlpha)
+		check("SSIM", res.SSIM, test.ssim)
+	}
+}
+
+func TestCompareDimensionMismatch(t *testing.T) {
+	if _, err := compare.Compare(fill(4, 4, 0, 0, 0, 0), fill(4, 2, 0, 0, 0, 0)); err == nil {
+		t.Errorf("Compare of images with different dimensions did not return an error")
+	}
+}
+
+func TestHeatMap(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		a, b     *image.Data
+		max      float64
+		expected color.NRGBA
+	}{
+		{
+			name:     "identical",
+			a:        fill(2, 2, 0x80, 0x80, 0x80, 0xff),
+			b:        fill(2, 2, 0x80, 0x80, 0x80, 0xff),
+			max:      1,
+			expected: color.NRGBA{0x00, 0x00, 0x48, 0xff},
+		}, {
+			name:     "white vs black",
+			a:        fill(2, 2, 0xff, 0xff, 0xff, 0xff),
+			b:        fill(2, 2, 0x00, 0x00, 0x00, 0xff),
+			max:      1,
+			expected: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		}, {
+			name:     "clamped to max",
+			a:        fill(2, 2, 0x40, 0x00, 0x00, 0xff),
+			b:        fill(2, 2, 0x00, 0x00, 0x00, 0xff),
+			max:      0.1,
+			expected: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		},
+	} {
+		heat, err := compare.HeatMap(test.a, test.b, test.max)
+		if err != nil {
+			t.Errorf("HeatMap of %v returned error: %v", test.name, err)
+			continue
+		}
+		if heat.Format != image.RGBA_U8_NORM || heat.Width != test.a.Width || heat.Height != test.a.Height {
+			t.Errorf("HeatMap of %v gave a %vx%v %v image, expected a %vx%v %v image", test.name,
+				heat.Width, heat.Height, heat.Format.Name, test.a.Width, test.a.Height, image.RGBA_U8_NORM.Name)
+			continue
+		}
+		for p := 0; p < len(heat.Bytes); p += 4 {
+			got := color.NRGBA{heat.Bytes[p], heat.Bytes[p+1], heat.Bytes[p+2], heat.Bytes[p+3]}
+			if got != test.expected {
+				t.Errorf("HeatMap of %v gave pixel %v: %v, expected: %v", test.name, p/4, got, test.expected)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	ddsMagic      = "DDS "
+	ddsHeaderSize = 124
+	ddsPixelSize  = 32
+	ddsDX10Size   = 20
+
+	ddsdCaps        = 0x1
+	ddsdHeight      = 0x2
+	ddsdWidth       = 0x4
+	ddsdPitch       = 0x8
+	ddsdPixelFormat = 0x1000
+	ddsdMipMapCount = 0x20000
+	ddsdLinearSize  = 0x80000
+	ddsdDepth       = 0x800000
+
+	ddpfFourCC = 0x4
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipMap  = 0x400000
+
+	ddsCaps2Cubemap    = 0x200
+	ddsCaps2AllFaces   = 0xFC00
+	ddsCaps2Volume     = 0x200000
+	ddsDimension2D     = 3
+	ddsDimension3D     = 4
+	ddsMiscTextureCube = 0x4
+)
+
+// ddsLegacyFourCCs maps the FourCC codes of DDS files without a DX10 header
+// to the equivalent DXGI_FORMAT.
+var ddsLegacyFourCCs = map[string]uint32{
+	"DXT1": 71,
+	"DXT2": 74,
+	"DXT3": 74,
+	"DXT4": 77,
+	"DXT5": 77,
+	"ATI1": 80,
+	"BC4U": 80,
+	"BC4S": 81,
+	"ATI2": 83,
+	"BC5U": 83,
+	"BC5S": 84,
+}
+
+// DDS returns the texture encoded as a DDS file. DDS files can only hold
+// formats that have a DXGI_FORMAT, so ETC and ASTC textures cannot be
+// encoded.
+func (t *Texture) DDS() ([]byte, error) {
+	if err := t.Check(); err != nil {
+		return nil, err
+	}
+	c := containerFormatOf(t.Format)
+	if c == nil || c.dxgiFormat == 0 {
+		return nil, fmt.Errorf("Format %v cannot be written to a DDS file", t.Format.Name)
+	}
+	if t.Depth > 1 && (t.Layers > 0 || t.Faces > 1) {
+		return nil, fmt.Errorf("DDS files cannot hold 3D array or cube-map textures")
+	}
+
+	size := len(ddsMagic) + 4 + ddsHeaderSize + ddsDX10Size
+	for _, images := range t.Levels {
+		for _, image := range images {
+			size += len(image)
+		}
+	}
+	out := make([]byte, size)
+	w := out[copy(out, ddsMagic):]
+	put32 := func(v uint32) {
+		binary.LittleEndian.PutUint32(w, v)
+		w = w[4:]
+	}
+
+	flags := uint32(ddsdCaps | ddsdHeight | ddsdWidth | ddsdPixelFormat | ddsdMipMapCount)
+	pitch := uint32(0)
+	if c.blockWidth == 0 {
+		flags |= ddsdPitch
+		pitch = uint32(t.Format.Size(int(t.Width), 1, 1))
+	} else {
+		flags |= ddsdLinearSize
+		pitch = uint32(t.Format.Size(int(t.Width), int(t.Height), 1))
+	}
+	if t.Depth > 1 {
+		flags |= ddsdDepth
+	}
+	caps, caps2 := uint32(ddsCapsTexture), uint32(0)
+	if len(t.Levels) > 1 {
+		caps |= ddsCapsComplex | ddsCapsMipMap
+	}
+	if t.Faces == 6 {
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Cubemap | ddsCaps2AllFaces
+	}
+	if t.Depth > 1 {
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Volume
+	}
+
+	put32(ddsHeaderSize)
+	put32(flags)
+	put32(t.Height)
+	put32(t.Width)
+	put32(pitch)
+	put32(t.Depth)
+	put32(uint32(len(t.Levels)))
+	w = w[11*4:] // dwReserved1
+	put32(ddsPixelSize)
+	put32(ddpfFourCC)
+	w = w[copy(w, "DX10"):]
+	w = w[5*4:] // RGB bit count and masks
+	put32(caps)
+	put32(caps2)
+	w = w[3*4:] // dwCaps3, dwCaps4, dwReserved2
+
+	dimension := uint32(ddsDimension2D)
+	if t.Depth > 1 {
+		dimension = ddsDimension3D
+	}
+	misc := uint32(0)
+	if t.Faces == 6 {
+		misc = ddsMiscTextureCube
+	}
+	arraySize := t.Layers
+	if arraySize == 0 {
+		arraySize = 1
+	}
+	put32(c.dxgiFormat)
+	put32(dimension)
+	put32(misc)
+	put32(arraySize)
+	put32(0) // miscFlags2
+
+	// DDS files hold all the levels of each image together.
+	for i := 0; i < t.Images(); i++ {
+		for _, images := range t.Levels {
+			w = w[copy(w, images[i]):]
+		}
+	}
+	return out, nil
+}
+
+// DDSFrom decodes the texture held by the DDS file data.
+func DDSFrom(data []byte) (*Texture, error) {
+	if len(data) < len(ddsMagic)+4+ddsHeaderSize || string(data[:len(ddsMagic)]) != ddsMagic {
+		return nil, fmt.Errorf("Not a DDS file")
+	}
+	r := data[len(ddsMagic):]
+	get32 := func() uint32 {
+		v := binary.LittleEndian.Uint32(r)
+		r = r[4:]
+		return v
+	}
+	if size := get32(); size != ddsHeaderSize {
+		return nil, fmt.Errorf("Invalid DDS header size %d", size)
+	}
+	flags := get32()
+	height, width := get32(), get32()
+	get32() // dwPitchOrLinearSize
+	depth, levels := get32(), get32()
+	r = r[11*4:] // dwReserved1
+	get32()      // ddspf.dwSize
+	pfFlags := get32()
+	fourCC := string(r[:4])
+	r = r[4+5*4:]
+	get32() // dwCaps
+	caps2 := get32()
+	r = r[3*4:]
+
+	if flags&ddsdDepth == 0 || depth == 0 {
+		depth = 1
+	}
+	if flags&ddsdMipMapCount == 0 || levels == 0 {
+		levels = 1
+	}
+	faces := uint32(1)
+	if caps2&ddsCaps2Cubemap != 0 {
+		faces = 6
+	}
+	layers := uint32(0)
+
+	if pfFlags&ddpfFourCC == 0 {
+		return nil, fmt.Errorf("Unsupported DDS pixel format")
+	}
+	dxgiFormat, ok := ddsLegacyFourCCs[fourCC]
+	if fourCC == "DX10" {
+		if len(r) < ddsDX10Size {
+			return nil, fmt.Errorf("DDS DX10 header is truncated")
+		}
+		dxgiFormat = get32()
+		get32() // resourceDimension
+		if misc := get32(); misc&ddsMiscTextureCube != 0 {
+			faces = 6
+		}
+		if arraySize := get32(); arraySize > 1 {
+			layers = arraySize
+		}
+		get32() // miscFlags2
+	} else if !ok {
+		return nil, fmt.Errorf("Unsupported DDS FourCC '%v'", fourCC)
+	}
+	c := containerFormatWith(func(c *containerFormat) bool { return c.dxgiFormat == dxgiFormat })
+	if c == nil {
+		return nil, fmt.Errorf("Unsupported DXGI format %d", dxgiFormat)
+	}
+
+	t := &Texture{
+		Format: c.format,
+		Width:  width,
+		Height: height,
+		Depth:  depth,
+		Layers: layers,
+		Faces:  faces,
+		Levels: make([][][]byte, levels),
+	}
+	for l := range t.Levels {
+		t.Levels[l] = make([][]byte, t.Images())
+	}
+	for i := 0; i < t.Images(); i++ {
+		for l := range t.Levels {
+			w, h, d := t.LevelSize(l)
+			size := t.Format.Size(int(w), int(h), int(d))
+			if len(r) < size {
+				return nil, fmt.Errorf("DDS image data is truncated")
+			}
+			t.Levels[l][i], r = r[:size], r[size:]
+		}
+	}
+	return t, nil
+}
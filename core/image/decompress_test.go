@@ -146,6 +146,7 @@ func TestDecompressors(t *testing.T) {
 		{image.RGTC1_BC4_R_S8_NORM, ".bin"},
 		{image.RGTC2_BC5_RG_U8_NORM, ".bin"},
 		{image.RGTC2_BC5_RG_S8_NORM, ".bin"},
+		{image.BC7_RGBA_U8_NORM, ".bin"},
 	} {
 		name := test.fmt.Name
 		inPath := filepath.Join("test_data", name+test.ext)
@@ -68,6 +68,9 @@ var _ = []format{
 	&FmtRGTC1_BC4_R_S8_NORM{},
 	&FmtRGTC2_BC5_RG_U8_NORM{},
 	&FmtRGTC2_BC5_RG_S8_NORM{},
+	&FmtBC6H_RGB_UFLOAT{},
+	&FmtBC6H_RGB_SFLOAT{},
+	&FmtBC7_RGBA_U8_NORM{},
 	&FmtS3_DXT1_RGB{},
 	&FmtS3_DXT1_RGBA{},
 	&FmtS3_DXT3_RGBA{},
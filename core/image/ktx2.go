@@ -0,0 +1,366 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/stream"
+)
+
+// ktx2Identifier is the identifier at the start of every KTX2 file.
+var ktx2Identifier = []byte{0xAB, 0x4B, 0x54, 0x58, 0x20, 0x32, 0x30, 0xBB, 0x0D, 0x0A, 0x1A, 0x0A}
+
+const (
+	ktx2HeaderSize     = 80 // identifier, header and index.
+	ktx2LevelIndexSize = 24
+	ktx2Writer         = "GAPID"
+
+	dfdBasicHeaderSize = 24
+	dfdSampleSize      = 16
+	dfdPrimariesBT709  = 1
+	dfdTransferLinear  = 1
+	dfdTransferSRGB    = 2
+	dfdSampleLinear    = 0x10
+	dfdSampleSigned    = 0x40
+	dfdSampleFloat     = 0x80
+)
+
+// KTX2 returns the texture encoded as a KTX2 file.
+func (t *Texture) KTX2() ([]byte, error) {
+	if err := t.Check(); err != nil {
+		return nil, err
+	}
+	c := containerFormatOf(t.Format)
+	if c == nil {
+		return nil, fmt.Errorf("Format %v cannot be written to a KTX2 file", t.Format.Name)
+	}
+	dfd, blockSize, typeSize, err := c.ktx2DFD()
+	if err != nil {
+		return nil, err
+	}
+	kvd := ktx2KeyValue("KTXwriter", ktx2Writer)
+
+	levelCount := len(t.Levels)
+	dfdOffset := ktx2HeaderSize + levelCount*ktx2LevelIndexSize
+	kvdOffset := dfdOffset + len(dfd)
+	dataOffset := kvdOffset + len(kvd)
+
+	// The levels are stored smallest first, with each level aligned to the
+	// least common multiple of the block size and 4.
+	align := lcm(blockSize, 4)
+	offsets := make([]int, levelCount)
+	lengths := make([]int, levelCount)
+	end := dataOffset
+	for l := levelCount - 1; l >= 0; l-- {
+		end = (end + align - 1) / align * align
+		offsets[l] = end
+		for _, image := range t.Levels[l] {
+			lengths[l] += len(image)
+		}
+		end += lengths[l]
+	}
+
+	out := make([]byte, end)
+	w := out
+	put32 := func(v uint32) {
+		binary.LittleEndian.PutUint32(w, v)
+		w = w[4:]
+	}
+	put64 := func(v uint64) {
+		binary.LittleEndian.PutUint64(w, v)
+		w = w[8:]
+	}
+	w = w[copy(w, ktx2Identifier):]
+	put32(c.vkFormat)
+	put32(typeSize)
+	put32(t.Width)
+	put32(t.Height)
+	if t.Depth > 1 {
+		put32(t.Depth)
+	} else {
+		put32(0)
+	}
+	put32(t.Layers)
+	put32(t.Faces)
+	put32(uint32(levelCount))
+	put32(0) // No supercompression.
+	put32(uint32(dfdOffset))
+	put32(uint32(len(dfd)))
+	put32(uint32(kvdOffset))
+	put32(uint32(len(kvd)))
+	put64(0) // No supercompression global data.
+	put64(0)
+	for l := 0; l < levelCount; l++ {
+		put64(uint64(offsets[l]))
+		put64(uint64(lengths[l]))
+		put64(uint64(lengths[l]))
+	}
+	copy(out[dfdOffset:], dfd)
+	copy(out[kvdOffset:], kvd)
+	for l, images := range t.Levels {
+		o := offsets[l]
+		for _, image := range images {
+			o += copy(out[o:], image)
+		}
+	}
+	return out, nil
+}
+
+// KTX2From decodes the texture held by the KTX2 file data.
+func KTX2From(data []byte) (*Texture, error) {
+	if len(data) < ktx2HeaderSize || !bytes.Equal(data[:len(ktx2Identifier)], ktx2Identifier) {
+		return nil, fmt.Errorf("Not a KTX2 file")
+	}
+	r := data[len(ktx2Identifier):]
+	get32 := func() uint32 {
+		v := binary.LittleEndian.Uint32(r)
+		r = r[4:]
+		return v
+	}
+	get64 := func() uint64 {
+		v := binary.LittleEndian.Uint64(r)
+		r = r[8:]
+		return v
+	}
+	vkFormat := get32()
+	get32() // typeSize
+	width, height, depth := get32(), get32(), get32()
+	layers, faces, levelCount := get32(), get32(), get32()
+	if scheme := get32(); scheme != 0 {
+		return nil, fmt.Errorf("Unsupported KTX2 supercompression scheme %d", scheme)
+	}
+	dfdOffset, dfdLength := get32(), get32()
+	get32() // kvdByteOffset
+	get32() // kvdByteLength
+	get64() // sgdByteOffset
+	get64() // sgdByteLength
+
+	model := uint8(0)
+	if dfdLength >= 4+dfdBasicHeaderSize && uint64(dfdOffset)+uint64(dfdLength) <= uint64(len(data)) {
+		model = data[dfdOffset+4+8]
+	}
+	c := containerFormatWith(func(c *containerFormat) bool {
+		return c.vkFormat == vkFormat && c.model == model
+	})
+	if c == nil {
+		c = containerFormatWith(func(c *containerFormat) bool { return c.vkFormat == vkFormat })
+	}
+	if c == nil {
+		return nil, fmt.Errorf("Unsupported KTX2 VkFormat %d", vkFormat)
+	}
+
+	if height == 0 {
+		height = 1
+	}
+	if depth == 0 {
+		depth = 1
+	}
+	if levelCount == 0 {
+		levelCount = 1
+	}
+	t := &Texture{
+		Format: c.format,
+		Width:  width,
+		Height: height,
+		Depth:  depth,
+		Layers: layers,
+		Faces:  faces,
+	}
+	if faces != 1 && faces != 6 {
+		return nil, fmt.Errorf("Invalid number of KTX2 faces %d", faces)
+	}
+	if len(r) < int(levelCount)*ktx2LevelIndexSize {
+		return nil, fmt.Errorf("KTX2 level index is truncated")
+	}
+	t.Levels = make([][][]byte, levelCount)
+	for l := range t.Levels {
+		offset, length := get64(), get64()
+		get64() // uncompressedByteLength
+		if offset+length > uint64(len(data)) {
+			return nil, fmt.Errorf("KTX2 level %d is truncated", l)
+		}
+		level := data[offset : offset+length]
+		w, h, d := t.LevelSize(l)
+		size := t.Format.Size(int(w), int(h), int(d))
+		if size*t.Images() != len(level) {
+			return nil, fmt.Errorf("KTX2 level %d has %d bytes, expected %d", l, len(level), size*t.Images())
+		}
+		t.Levels[l] = make([][]byte, t.Images())
+		for i := range t.Levels[l] {
+			t.Levels[l][i] = level[i*size : (i+1)*size]
+		}
+	}
+	return t, nil
+}
+
+// ktx2DFD returns the KTX2 data format descriptor of the format, along with
+// the size in bytes of a texel block and the KTX2 type size.
+func (c *containerFormat) ktx2DFD() (dfd []byte, blockSize int, typeSize uint32, err error) {
+	type sample struct {
+		dfdSample
+		flags        uint8
+		lower, upper uint32
+	}
+	samples := []sample{}
+	blockW, blockH := 1, 1
+	transfer := uint8(dfdTransferLinear)
+
+	if c.blockWidth == 0 {
+		f := c.format.GetUncompressed().GetFormat()
+		offset := 0
+		typeSize = 1
+		for _, comp := range f.Components {
+			bits := int(comp.DataType.Bits())
+			s := sample{dfdSample: dfdSample{offset: offset, bits: bits}}
+			switch comp.Channel {
+			case stream.Channel_Red:
+				s.channel = dfdChannelRed
+			case stream.Channel_Green:
+				s.channel = dfdChannelGreen
+			case stream.Channel_Blue:
+				s.channel = dfdChannelBlue
+			case stream.Channel_Alpha:
+				s.channel = dfdChannelAlpha
+			case stream.Channel_Depth:
+				s.channel = dfdChannelDepth
+			case stream.Channel_Stencil:
+				s.channel = dfdChannelStencil
+			default:
+				return nil, 0, 0, fmt.Errorf("Unsupported channel %v", comp.Channel)
+			}
+			if comp.GetSampling().GetCurve() == stream.Curve_sRGB {
+				transfer = dfdTransferSRGB
+			}
+			signed := comp.DataType.Signed
+			if signed {
+				s.flags |= dfdSampleSigned
+			}
+			switch {
+			case comp.DataType.IsFloat():
+				s.flags |= dfdSampleFloat
+				s.lower, s.upper = math.Float32bits(0), math.Float32bits(1)
+				if signed {
+					s.lower = math.Float32bits(-1)
+				}
+			case comp.IsNormalized() && signed:
+				max := uint32(1)<<uint(bits-1) - 1
+				s.lower, s.upper = -max, max
+			case comp.IsNormalized():
+				s.lower, s.upper = 0, uint32(1)<<uint(bits)-1
+			case signed:
+				s.lower, s.upper = math.MaxUint32, 1
+			default:
+				s.lower, s.upper = 0, 1
+			}
+			if size := uint32(bits+7) / 8; size > typeSize {
+				typeSize = size
+			}
+			samples = append(samples, s)
+			offset += bits
+		}
+		blockSize = (offset + 7) / 8
+		if transfer == dfdTransferSRGB {
+			// Only the color channels use the sRGB transfer function.
+			for i := range samples {
+				if samples[i].channel == dfdChannelAlpha {
+					samples[i].flags |= dfdSampleLinear
+				}
+			}
+		}
+	} else {
+		typeSize = 1
+		blockW, blockH = c.blockWidth, c.blockHeight
+		blockSize = c.format.Size(blockW, blockH, 1)
+		if c.model == dfdModelBC6H {
+			transfer = dfdTransferLinear
+		} else if isSRGB(c.format) {
+			transfer = dfdTransferSRGB
+		}
+		for _, s := range c.samples {
+			ds := sample{dfdSample: s, lower: 0, upper: math.MaxUint32}
+			if c.format.GetBc6HRgbSfloat() != nil {
+				ds.flags = dfdSampleFloat | dfdSampleSigned
+				ds.lower, ds.upper = math.Float32bits(-1), math.Float32bits(1)
+			} else if c.format.GetBc6HRgbUfloat() != nil {
+				ds.flags = dfdSampleFloat
+				ds.lower, ds.upper = math.Float32bits(0), math.Float32bits(1)
+			}
+			samples = append(samples, ds)
+		}
+	}
+
+	blockLength := dfdBasicHeaderSize + dfdSampleSize*len(samples)
+	dfd = make([]byte, 4+blockLength)
+	binary.LittleEndian.PutUint32(dfd[0:], uint32(len(dfd)))
+	binary.LittleEndian.PutUint32(dfd[4:], 0) // Khronos vendor, basic descriptor type.
+	binary.LittleEndian.PutUint16(dfd[8:], 2) // Version.
+	binary.LittleEndian.PutUint16(dfd[10:], uint16(blockLength))
+	dfd[12] = c.model
+	dfd[13] = dfdPrimariesBT709
+	dfd[14] = transfer
+	dfd[15] = 0 // Flags: straight alpha.
+	dfd[16] = uint8(blockW - 1)
+	dfd[17] = uint8(blockH - 1)
+	dfd[20] = uint8(blockSize)
+	for i, s := range samples {
+		o := 4 + dfdBasicHeaderSize + i*dfdSampleSize
+		binary.LittleEndian.PutUint16(dfd[o:], uint16(s.offset))
+		dfd[o+2] = uint8(s.bits - 1)
+		dfd[o+3] = s.channel | s.flags
+		binary.LittleEndian.PutUint32(dfd[o+8:], s.lower)
+		binary.LittleEndian.PutUint32(dfd[o+12:], s.upper)
+	}
+	return dfd, blockSize, typeSize, nil
+}
+
+// isSRGB returns true if the compressed format f holds sRGB encoded colors.
+func isSRGB(f *Format) bool {
+	switch f := f.Format.(type) {
+	case *Format_Astc:
+		return f.Astc.Srgb
+	case *Format_Bc7RgbaU8Norm:
+		return f.Bc7RgbaU8Norm.Srgb
+	case *Format_Etc2RgbU8Norm:
+		return f.Etc2RgbU8Norm.Srgb
+	case *Format_Etc2RgbaU8Norm:
+		return f.Etc2RgbaU8Norm.Srgb
+	case *Format_Etc2RgbaU8U8U8U1Norm:
+		return f.Etc2RgbaU8U8U8U1Norm.Srgb
+	}
+	return false
+}
+
+// ktx2KeyValue returns the KTX2 key/value data entry for the given key and
+// value, padded to a multiple of 4 bytes.
+func ktx2KeyValue(key, value string) []byte {
+	length := len(key) + 1 + len(value) + 1
+	out := make([]byte, (4+length+3)/4*4)
+	binary.LittleEndian.PutUint32(out, uint32(length))
+	copy(out[4:], key)
+	copy(out[4+len(key)+1:], value)
+	return out
+}
+
+func lcm(a, b int) int {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
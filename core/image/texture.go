@@ -0,0 +1,271 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/protoutil"
+	"github.com/google/gapid/core/stream"
+	"github.com/google/gapid/core/stream/fmts"
+)
+
+// Texture holds the images of all the mip-levels, array layers and cube-map
+// faces of a texture, all of the same format. Textures can be written to and
+// read from the KTX2 and DDS container files.
+type Texture struct {
+	// Format is the format of all the images.
+	Format *Format
+	// Width, Height and Depth are the dimensions of the base level.
+	Width, Height, Depth uint32
+	// Layers is the number of array layers, or 0 if the texture is not an
+	// array texture.
+	Layers uint32
+	// Faces is 6 for cube-maps, otherwise 1.
+	Faces uint32
+	// Levels holds the image data for each of the mip-levels. Each level holds
+	// an image for each face of each layer, with the faces of a layer ordered
+	// +X, -X, +Y, -Y, +Z, -Z.
+	Levels [][][]byte
+}
+
+// Images returns the number of images in each mip-level of the texture.
+func (t *Texture) Images() int {
+	layers := t.Layers
+	if layers == 0 {
+		layers = 1
+	}
+	return int(layers * t.Faces)
+}
+
+// LevelSize returns the dimensions of the given mip-level.
+func (t *Texture) LevelSize(level int) (w, h, d uint32) {
+	size := func(v uint32) uint32 {
+		if v >>= uint(level); v == 0 {
+			return 1
+		}
+		return v
+	}
+	return size(t.Width), size(t.Height), size(t.Depth)
+}
+
+// Check returns an error if the number of images or the size of the image
+// data does not match the format and dimensions of the texture.
+func (t *Texture) Check() error {
+	if t.Format == nil {
+		return fmt.Errorf("Texture has no format")
+	}
+	if t.Width == 0 || t.Height == 0 || t.Depth == 0 {
+		return fmt.Errorf("Invalid texture size %dx%dx%d", t.Width, t.Height, t.Depth)
+	}
+	if t.Faces != 1 && t.Faces != 6 {
+		return fmt.Errorf("Invalid number of faces %d", t.Faces)
+	}
+	if len(t.Levels) == 0 {
+		return fmt.Errorf("Texture has no levels")
+	}
+	for l, images := range t.Levels {
+		if len(images) != t.Images() {
+			return fmt.Errorf("Level %d has %d images, expected %d", l, len(images), t.Images())
+		}
+		w, h, d := t.LevelSize(l)
+		for i, data := range images {
+			if err := t.Format.Check(data, int(w), int(h), int(d)); err != nil {
+				return fmt.Errorf("Level %d image %d: %v", l, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dfdSample is a sample of a KTX2 data format descriptor.
+type dfdSample struct {
+	offset, bits int
+	channel      uint8
+}
+
+// containerFormat describes how a Format is identified in the KTX2 and DDS
+// container files.
+type containerFormat struct {
+	format *Format
+	// vkFormat is the VkFormat used by KTX2 files.
+	vkFormat uint32
+	// dxgiFormat is the DXGI_FORMAT used by DDS files, or 0 if the format
+	// cannot be held by a DDS file.
+	dxgiFormat uint32
+	// model is the KTX2 data format descriptor color model.
+	model uint8
+	// blockWidth and blockHeight are the dimensions of a compressed block, or
+	// 0 for uncompressed formats.
+	blockWidth, blockHeight int
+	// samples are the KTX2 data format descriptor samples of a compressed
+	// block.
+	samples []dfdSample
+}
+
+// Data format descriptor color models.
+const (
+	dfdModelRGBSDA = 1
+	dfdModelBC1A   = 128
+	dfdModelBC2    = 129
+	dfdModelBC3    = 130
+	dfdModelBC4    = 131
+	dfdModelBC5    = 132
+	dfdModelBC6H   = 133
+	dfdModelBC7    = 134
+	dfdModelETC1   = 160
+	dfdModelETC2   = 161
+	dfdModelASTC   = 162
+)
+
+// Data format descriptor channels.
+const (
+	dfdChannelRed     = 0
+	dfdChannelGreen   = 1
+	dfdChannelBlue    = 2
+	dfdChannelColor   = 2 // ETC2 color
+	dfdChannelStencil = 13
+	dfdChannelDepth   = 14
+	dfdChannelAlpha   = 15
+)
+
+func compressedFormat(f *Format, vk, dxgi uint32, model uint8, bw, bh int, samples ...dfdSample) *containerFormat {
+	return &containerFormat{f, vk, dxgi, model, bw, bh, samples}
+}
+
+func uncompressedFormat(f *stream.Format, vk, dxgi uint32) *containerFormat {
+	return &containerFormat{newUncompressed(f), vk, dxgi, dfdModelRGBSDA, 0, 0, nil}
+}
+
+func astcFormat(vk uint32, bw, bh int, srgb bool) *containerFormat {
+	f := NewASTC(fmt.Sprintf("ASTC_%dx%d", bw, bh), uint32(bw), uint32(bh), srgb)
+	return compressedFormat(f, vk, 0, dfdModelASTC, bw, bh, dfdSample{0, 128, 0})
+}
+
+var (
+	dfdColor64   = dfdSample{0, 64, 0}
+	dfdColor128  = dfdSample{0, 128, 0}
+	dfdAlphaHigh = dfdSample{0, 64, dfdChannelAlpha}
+	dfdColorHigh = dfdSample{64, 64, 0}
+)
+
+// containerFormats lists the formats that can be written to KTX2 and DDS files.
+var containerFormats = []*containerFormat{
+	uncompressedFormat(fmts.R_U8_NORM, 9, 61),
+	uncompressedFormat(fmts.R_S8_NORM, 10, 63),
+	uncompressedFormat(fmts.R_U8, 13, 62),
+	uncompressedFormat(fmts.R_S8, 14, 64),
+	uncompressedFormat(fmts.R_U8_NORM_sRGB, 15, 0),
+	uncompressedFormat(fmts.RG_U8_NORM, 16, 49),
+	uncompressedFormat(fmts.RG_S8_NORM, 17, 51),
+	uncompressedFormat(fmts.RG_U8, 20, 50),
+	uncompressedFormat(fmts.RG_S8, 21, 52),
+	uncompressedFormat(fmts.RGB_U8_NORM, 23, 0),
+	uncompressedFormat(fmts.SRGB_U8_NORM, 29, 0),
+	uncompressedFormat(fmts.RGBA_U8_NORM, 37, 28),
+	uncompressedFormat(fmts.RGBA_S8_NORM, 38, 31),
+	uncompressedFormat(fmts.RGBA_U8, 41, 30),
+	uncompressedFormat(fmts.RGBA_S8, 42, 32),
+	uncompressedFormat(fmts.SRGBA_U8_NORM, 43, 29),
+	uncompressedFormat(fmts.BGRA_U8_NORM, 44, 87),
+	uncompressedFormat(fmts.BGRA_N_sRGBU8N_sRGBU8N_sRGBU8NU8, 50, 91),
+	uncompressedFormat(fmts.R_U16_NORM, 70, 56),
+	uncompressedFormat(fmts.R_S16_NORM, 71, 58),
+	uncompressedFormat(fmts.R_F16, 76, 54),
+	uncompressedFormat(fmts.RG_U16_NORM, 77, 35),
+	uncompressedFormat(fmts.RG_S16_NORM, 78, 37),
+	uncompressedFormat(fmts.RG_F16, 83, 34),
+	uncompressedFormat(fmts.RGBA_U16_NORM, 91, 11),
+	uncompressedFormat(fmts.RGBA_S16_NORM, 92, 13),
+	uncompressedFormat(fmts.RGBA_F16, 97, 10),
+	uncompressedFormat(fmts.R_U32, 98, 42),
+	uncompressedFormat(fmts.R_S32, 99, 43),
+	uncompressedFormat(fmts.R_F32, 100, 41),
+	uncompressedFormat(fmts.RG_U32, 101, 17),
+	uncompressedFormat(fmts.RG_S32, 102, 18),
+	uncompressedFormat(fmts.RG_F32, 103, 16),
+	uncompressedFormat(fmts.RGB_F32, 106, 6),
+	uncompressedFormat(fmts.RGBA_U32, 107, 3),
+	uncompressedFormat(fmts.RGBA_S32, 108, 4),
+	uncompressedFormat(fmts.RGBA_F32, 109, 2),
+	uncompressedFormat(fmts.D_U16_NORM, 124, 55),
+	uncompressedFormat(fmts.D_F32, 126, 40),
+
+	compressedFormat(S3_DXT1_RGBA, 133, 71, dfdModelBC1A, 4, 4, dfdColor64, dfdSample{0, 64, 1}),
+	compressedFormat(S3_DXT1_RGB, 131, 0, dfdModelBC1A, 4, 4, dfdColor64),
+	compressedFormat(S3_DXT3_RGBA, 135, 74, dfdModelBC2, 4, 4, dfdAlphaHigh, dfdColorHigh),
+	compressedFormat(S3_DXT5_RGBA, 137, 77, dfdModelBC3, 4, 4, dfdAlphaHigh, dfdColorHigh),
+	compressedFormat(RGTC1_BC4_R_U8_NORM, 139, 80, dfdModelBC4, 4, 4, dfdColor64),
+	compressedFormat(RGTC1_BC4_R_S8_NORM, 140, 81, dfdModelBC4, 4, 4, dfdColor64),
+	compressedFormat(RGTC2_BC5_RG_U8_NORM, 141, 83, dfdModelBC5, 4, 4, dfdSample{0, 64, dfdChannelRed}, dfdSample{64, 64, dfdChannelGreen}),
+	compressedFormat(RGTC2_BC5_RG_S8_NORM, 142, 84, dfdModelBC5, 4, 4, dfdSample{0, 64, dfdChannelRed}, dfdSample{64, 64, dfdChannelGreen}),
+	compressedFormat(BC6H_RGB_UFLOAT, 143, 95, dfdModelBC6H, 4, 4, dfdColor128),
+	compressedFormat(BC6H_RGB_SFLOAT, 144, 96, dfdModelBC6H, 4, 4, dfdColor128),
+	compressedFormat(BC7_RGBA_U8_NORM, 145, 98, dfdModelBC7, 4, 4, dfdColor128),
+	compressedFormat(BC7_SRGBA_U8_NORM, 146, 99, dfdModelBC7, 4, 4, dfdColor128),
+	compressedFormat(NewETC2_RGB_U8_NORM("ETC2_RGB_U8_NORM"), 147, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_SRGB_U8_NORM("ETC2_SRGB_U8_NORM"), 148, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_RGBA_U8U8U8U1_NORM("ETC2_RGBA_U8U8U8U1_NORM"), 149, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_SRGBA_U8U8U8U1_NORM("ETC2_SRGBA_U8U8U8U1_NORM"), 150, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_RGBA_U8_NORM("ETC2_RGBA_U8_NORM"), 151, 0, dfdModelETC2, 4, 4, dfdAlphaHigh, dfdSample{64, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_SRGBA_U8_NORM("ETC2_SRGBA_U8_NORM"), 152, 0, dfdModelETC2, 4, 4, dfdAlphaHigh, dfdSample{64, 64, dfdChannelColor}),
+	compressedFormat(NewETC2_R_U11_NORM("ETC2_R_U11_NORM"), 153, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelRed}),
+	compressedFormat(NewETC2_R_S11_NORM("ETC2_R_S11_NORM"), 154, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelRed}),
+	compressedFormat(NewETC2_RG_U11_NORM("ETC2_RG_U11_NORM"), 155, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelRed}, dfdSample{64, 64, dfdChannelGreen}),
+	compressedFormat(NewETC2_RG_S11_NORM("ETC2_RG_S11_NORM"), 156, 0, dfdModelETC2, 4, 4, dfdSample{0, 64, dfdChannelRed}, dfdSample{64, 64, dfdChannelGreen}),
+	compressedFormat(NewETC1_RGB_U8_NORM("ETC1_RGB_U8_NORM"), 147, 0, dfdModelETC1, 4, 4, dfdColor64),
+
+	astcFormat(157, 4, 4, false), astcFormat(158, 4, 4, true),
+	astcFormat(159, 5, 4, false), astcFormat(160, 5, 4, true),
+	astcFormat(161, 5, 5, false), astcFormat(162, 5, 5, true),
+	astcFormat(163, 6, 5, false), astcFormat(164, 6, 5, true),
+	astcFormat(165, 6, 6, false), astcFormat(166, 6, 6, true),
+	astcFormat(167, 8, 5, false), astcFormat(168, 8, 5, true),
+	astcFormat(169, 8, 6, false), astcFormat(170, 8, 6, true),
+	astcFormat(171, 8, 8, false), astcFormat(172, 8, 8, true),
+	astcFormat(173, 10, 5, false), astcFormat(174, 10, 5, true),
+	astcFormat(175, 10, 6, false), astcFormat(176, 10, 6, true),
+	astcFormat(177, 10, 8, false), astcFormat(178, 10, 8, true),
+	astcFormat(179, 10, 10, false), astcFormat(180, 10, 10, true),
+	astcFormat(181, 12, 10, false), astcFormat(182, 12, 10, true),
+	astcFormat(183, 12, 12, false), astcFormat(184, 12, 12, true),
+}
+
+// containerFormatOf returns the containerFormat that describes f, or nil if f
+// cannot be held in a container file.
+func containerFormatOf(f *Format) *containerFormat {
+	m, ok := protoutil.OneOf(f.Format).(proto.Message)
+	if !ok {
+		return nil
+	}
+	for _, c := range containerFormats {
+		if proto.Equal(m, protoutil.OneOf(c.format.Format).(proto.Message)) {
+			return c
+		}
+	}
+	return nil
+}
+
+// containerFormatWith returns the first containerFormat for which pred
+// returns true, or nil if there is none.
+func containerFormatWith(pred func(*containerFormat) bool) *containerFormat {
+	for _, c := range containerFormats {
+		if pred(c) {
+			return c
+		}
+	}
+	return nil
+}
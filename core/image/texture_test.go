@@ -0,0 +1,107 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/image"
+)
+
+// newTestTexture returns a texture with all the mip-levels down to 1x1x1,
+// filled with a different byte pattern for each image.
+func newTestTexture(f *image.Format, w, h, d, layers, faces uint32) *image.Texture {
+	t := &image.Texture{Format: f, Width: w, Height: h, Depth: d, Layers: layers, Faces: faces}
+	for l := 0; ; l++ {
+		lw, lh, ld := t.LevelSize(l)
+		images := make([][]byte, t.Images())
+		for i := range images {
+			images[i] = make([]byte, f.Size(int(lw), int(lh), int(ld)))
+			for j := range images[i] {
+				images[i][j] = byte(l*31 + i*7 + j)
+			}
+		}
+		t.Levels = append(t.Levels, images)
+		if lw == 1 && lh == 1 && ld == 1 {
+			return t
+		}
+	}
+}
+
+func TestTextureContainers(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		texture *image.Texture
+		dds     bool
+	}{
+		{"2D RGBA_U8_NORM", newTestTexture(image.RGBA_U8_NORM, 16, 8, 1, 0, 1), true},
+		{"2D array RGBA_F32", newTestTexture(image.RGBA_F32, 7, 5, 1, 3, 1), true},
+		{"3D SRGBA_U8_NORM", newTestTexture(image.SRGBA_U8_NORM, 4, 4, 4, 0, 1), true},
+		{"Cube DXT1", newTestTexture(image.S3_DXT1_RGBA, 8, 8, 1, 0, 6), true},
+		{"Cube array BC7", newTestTexture(image.BC7_SRGBA_U8_NORM, 8, 8, 1, 2, 6), true},
+		{"2D BC6H", newTestTexture(image.BC6H_RGB_SFLOAT, 12, 4, 1, 0, 1), true},
+		{"2D ETC2", newTestTexture(image.NewETC2_RGBA_U8_NORM("etc2"), 8, 8, 1, 0, 1), false},
+		{"2D ASTC", newTestTexture(image.NewASTC("astc", 6, 5, true), 13, 11, 1, 0, 1), false},
+	} {
+		check := func(container string, got *image.Texture, err error) {
+			if err != nil {
+				t.Errorf("%v %v read failed: %v", test.name, container, err)
+				return
+			}
+			want := test.texture
+			if got.Format.Key() != want.Format.Key() {
+				t.Errorf("%v %v format was %v, expected %v", test.name, container, got.Format.Key(), want.Format.Key())
+			}
+			if got.Width != want.Width || got.Height != want.Height || got.Depth != want.Depth ||
+				got.Layers != want.Layers || got.Faces != want.Faces {
+				t.Errorf("%v %v size was %dx%dx%d %d layers %d faces, expected %dx%dx%d %d layers %d faces",
+					test.name, container, got.Width, got.Height, got.Depth, got.Layers, got.Faces,
+					want.Width, want.Height, want.Depth, want.Layers, want.Faces)
+				return
+			}
+			if len(got.Levels) != len(want.Levels) {
+				t.Errorf("%v %v has %d levels, expected %d", test.name, container, len(got.Levels), len(want.Levels))
+				return
+			}
+			for l := range want.Levels {
+				for i := range want.Levels[l] {
+					if !bytes.Equal(got.Levels[l][i], want.Levels[l][i]) {
+						t.Errorf("%v %v level %d image %d data was not as expected", test.name, container, l, i)
+					}
+				}
+			}
+		}
+
+		data, err := test.texture.KTX2()
+		if err != nil {
+			t.Errorf("%v KTX2 write failed: %v", test.name, err)
+		} else {
+			got, err := image.KTX2From(data)
+			check("KTX2", got, err)
+		}
+
+		data, err = test.texture.DDS()
+		switch {
+		case !test.dds && err == nil:
+			t.Errorf("%v DDS write should have failed", test.name)
+		case test.dds && err != nil:
+			t.Errorf("%v DDS write failed: %v", test.name, err)
+		case test.dds:
+			got, err := image.DDSFrom(data)
+			check("DDS", got, err)
+		}
+	}
+}
@@ -1663,6 +1663,9 @@ public class Paths {
       if (path.getGroupByDrawCall()) sb.append('D');
       if (path.getGroupByUserMarkers()) sb.append('M');
       if (path.getGroupBySubmission()) sb.append('S');
+      if (path.getGroupByRenderPass()) sb.append('R');
+      if (path.getGroupByPipeline()) sb.append('P');
+      if (path.getGroupByCommandBuffer()) sb.append('C');
       if (path.getMaxChildren() != 0) {
         sb.append(",max=").append(path.getMaxChildren());
       }
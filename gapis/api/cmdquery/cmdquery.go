@@ -0,0 +1,114 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmdquery implements a small typed query language for matching
+// commands on their name, parameters and result.
+//
+// A query is an optional command name pattern followed by an optional where
+// clause:
+//
+//	vkCmdDrawIndexed where indexCount > 30000
+//	vkQueueSubmit where queue == 0x1234
+//	vkCmd* where $name ~ "Indirect$" || drawCount >= 2
+//	where format == "VK_FORMAT_R8G8B8A8_UNORM"
+//
+// The pattern matches the whole command name, where '*' matches any sequence
+// of characters.
+//
+// Expressions are made of literals, references, function calls, comparisons
+// and logical operators:
+//
+//	literals     123, -4, 0x1f, 1.5, "text", true, false, null
+//	references   parameter names, followed by any number of .member or
+//	             [index] accessors. $name is the command name, $result the
+//	             command result and $thread the command thread.
+//	comparisons  == != < <= > >=, ~ (regular expression match) and contains
+//	             (list membership or sub-string)
+//	logical      ! && ||, or the keywords not, and, or
+//	calls        len(x), lower(x) and the functions provided by the API of
+//	             the command, see FunctionProvider.
+//
+// Values are typed as booleans, integers, floats, strings or lists.
+// Enumerations compare equal to the string of their name, and pointers to
+// their address. Type errors between literals are reported when the query is
+// parsed, and type errors involving command values when the query is
+// evaluated. A command that does not have a referenced parameter does not
+// match the query.
+package cmdquery
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/google/gapid/gapis/api"
+)
+
+// Function is a function callable from a query. args holds the evaluated
+// arguments as nil, bool, int64, uint64, float64, string or []interface{}
+// values. s is the state after the command being matched.
+type Function func(ctx context.Context, s *api.GlobalState, args []interface{}) (interface{}, error)
+
+// FunctionProvider is the interface implemented by APIs that provide
+// functions to queries, for example to inspect the state referenced by
+// the command parameters.
+type FunctionProvider interface {
+	// QueryFunctions returns the functions callable from a query, by name.
+	QueryFunctions() map[string]Function
+}
+
+// Query is a parsed command query.
+type Query struct {
+	text    string
+	pattern *regexp.Regexp
+	where   expr
+	state   bool
+}
+
+// Parse parses the query text.
+func Parse(text string) (*Query, error) {
+	p, err := newParser(text)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseQuery()
+}
+
+// String returns the text of the query.
+func (q *Query) String() string { return q.text }
+
+// NeedsState returns true if the query calls functions that require the state
+// at the command to be evaluated.
+func (q *Query) NeedsState() bool { return q.state }
+
+// Match returns true if the command matches the query. s is the state after
+// the command, and can be nil if the query does not need state.
+func (q *Query) Match(ctx context.Context, cmd api.Cmd, s *api.GlobalState) (bool, error) {
+	if q.pattern != nil && !q.pattern.MatchString(cmd.CmdName()) {
+		return false, nil
+	}
+	if q.where == nil {
+		return true, nil
+	}
+	v, err := q.where.eval(&env{ctx, cmd, s})
+	switch {
+	case err == errNoParameter:
+		return false, nil
+	case err != nil:
+		return false, err
+	case v.kind != kindBool:
+		return false, fmt.Errorf("Query evaluates to %v, expected bool", v.kind)
+	}
+	return v.b, nil
+}
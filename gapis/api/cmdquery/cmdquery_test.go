@@ -0,0 +1,103 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdquery_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api/cmdquery"
+	"github.com/google/gapid/gapis/api/test"
+)
+
+func TestMatch(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, tc := range []struct {
+		query string
+		a, b  bool
+	}{
+		{"", true, true},
+		{"cmdTypeMix", true, true},
+		{"cmd*Mix", true, true},
+		{"cmdType", false, false},
+		{"where U32 == 50", true, false},
+		{"where u32 == 50", true, false},
+		{"where U8 > 5 && S8 < 100", true, false},
+		{"where U8 > 5 and S8 < 100", true, false},
+		{"where U8 < 5 && !Bool", false, true},
+		{"where not Bool", false, true},
+		{"where !(U16 >= 30)", false, true},
+		{"where F32 > 85.5", true, false},
+		{"where F64 == 10", false, true},
+		{"where S64 != 8", true, false},
+		{"where Ptr == 0x12345678", true, false},
+		{"where Ptr == null", false, false},
+		{"where $result == 200", false, true},
+		{"where $name == 'cmdTypeMix'", true, true},
+		{"where $name ~ 'Type.*'", true, true},
+		{"where lower($name) contains 'typemix'", true, true},
+		{"where len($name) == 10", true, true},
+		{"where Missing == 1", false, false},
+		{"cmdTypeMix where ID == 0 && $thread == 0", true, true},
+	} {
+		q, err := cmdquery.Parse(tc.query)
+		if !assert.For(ctx, "Parse(%q) err", tc.query).ThatError(err).Succeeded() {
+			continue
+		}
+		a, err := q.Match(ctx, test.Cmds.A, nil)
+		assert.For(ctx, "%q err", tc.query).ThatError(err).Succeeded()
+		assert.For(ctx, "%q matches A", tc.query).That(a).Equals(tc.a)
+		b, err := q.Match(ctx, test.Cmds.B, nil)
+		assert.For(ctx, "%q err", tc.query).ThatError(err).Succeeded()
+		assert.For(ctx, "%q matches B", tc.query).That(b).Equals(tc.b)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, query := range []string{
+		"where",
+		"where U8 ==",
+		"where (U8 == 1",
+		"where 'a' == 1",
+		"where 1 && true",
+		"where !'a'",
+		"where U8 ~ U16",
+		"where $name ~ '('",
+		"where 'unterminated",
+		"where U8 # 1",
+		"cmdTypeMix U8 == 1",
+	} {
+		_, err := cmdquery.Parse(query)
+		assert.For(ctx, "Parse(%q)", query).ThatError(err).Failed()
+	}
+}
+
+func TestNeedsState(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, tc := range []struct {
+		query string
+		state bool
+	}{
+		{"where len($name) > 0", false},
+		{"where shaderModules(pipeline) contains 0x10", true},
+	} {
+		q, err := cmdquery.Parse(tc.query)
+		if assert.For(ctx, "Parse(%q) err", tc.query).ThatError(err).Succeeded() {
+			assert.For(ctx, "%q needs state", tc.query).That(q.NeedsState()).Equals(tc.state)
+		}
+	}
+}
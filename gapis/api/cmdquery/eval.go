@@ -0,0 +1,428 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdquery
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/gapis/api"
+)
+
+// errNoParameter is returned when evaluating a reference to a parameter the
+// command does not have.
+const errNoParameter = fault.Const("No such parameter")
+
+// env is the environment in which expressions are evaluated.
+type env struct {
+	ctx   context.Context
+	cmd   api.Cmd
+	state *api.GlobalState
+}
+
+// expr is a node of the expression tree.
+type expr interface {
+	// kind returns the static kind of the expression, or kindUnknown if it is
+	// only known when evaluated.
+	kind() kind
+	eval(e *env) (value, error)
+}
+
+// operand is an expression whose evaluation may produce a Go object that is
+// not representable as a value, such as a struct, for further accessors.
+type operand interface {
+	expr
+	object(e *env) (interface{}, error)
+}
+
+type literal struct{ v value }
+
+func (l *literal) kind() kind                 { return l.v.kind }
+func (l *literal) eval(e *env) (value, error) { return l.v, nil }
+
+// reference is a reference to a command parameter, or to one of the $name,
+// $result or $thread command values.
+type reference struct{ name string }
+
+func (r *reference) kind() kind {
+	switch r.name {
+	case "$name":
+		return kindString
+	case "$thread":
+		return kindUint
+	}
+	return kindUnknown
+}
+
+func (r *reference) eval(e *env) (value, error) {
+	o, err := r.object(e)
+	if err != nil {
+		return value{}, err
+	}
+	return toValue(o)
+}
+
+func (r *reference) object(e *env) (interface{}, error) {
+	switch r.name {
+	case "$name":
+		return e.cmd.CmdName(), nil
+	case "$thread":
+		return e.cmd.Thread(), nil
+	case "$result":
+		if p := e.cmd.CmdResult(); p != nil {
+			return p.Get(), nil
+		}
+		return nil, errNoParameter
+	}
+	params := e.cmd.CmdParams()
+	for _, p := range params {
+		if p.Name == r.name {
+			return p.Get(), nil
+		}
+	}
+	for _, p := range params {
+		if strings.EqualFold(p.Name, r.name) {
+			return p.Get(), nil
+		}
+	}
+	return nil, errNoParameter
+}
+
+// accessor is a member or index access on an operand.
+type accessor struct {
+	x       expr
+	member  string
+	index   int64
+	isIndex bool
+}
+
+func (a *accessor) kind() kind { return kindUnknown }
+
+func (a *accessor) eval(e *env) (value, error) {
+	o, err := a.object(e)
+	if err != nil {
+		return value{}, err
+	}
+	return toValue(o)
+}
+
+func (a *accessor) object(e *env) (interface{}, error) {
+	var o interface{}
+	if x, ok := a.x.(operand); ok {
+		var err error
+		if o, err = x.object(e); err != nil {
+			return nil, err
+		}
+	} else {
+		v, err := a.x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		o = v.toGo()
+	}
+	if a.isIndex {
+		return index(o, a.index)
+	}
+	return member(o, a.member)
+}
+
+// builtins are the functions available to all queries.
+var builtins = map[string]func(args []value) (value, error){
+	"len": func(args []value) (value, error) {
+		if len(args) != 1 {
+			return value{}, fmt.Errorf("len expects 1 argument, got %d", len(args))
+		}
+		switch args[0].kind {
+		case kindString:
+			return value{kind: kindUint, u: uint64(len(args[0].s))}, nil
+		case kindList:
+			return value{kind: kindUint, u: uint64(len(args[0].list))}, nil
+		}
+		return value{}, fmt.Errorf("Cannot get the length of %v", args[0].kind)
+	},
+	"lower": func(args []value) (value, error) {
+		if len(args) != 1 {
+			return value{}, fmt.Errorf("lower expects 1 argument, got %d", len(args))
+		}
+		s, ok := args[0].str()
+		if !ok {
+			return value{}, fmt.Errorf("Cannot convert %v to lower case", args[0].kind)
+		}
+		return value{kind: kindString, s: strings.ToLower(s)}, nil
+	},
+}
+
+// call is a call to a builtin or API function.
+type call struct {
+	name string
+	args []expr
+}
+
+func (c *call) kind() kind { return kindUnknown }
+
+func (c *call) eval(e *env) (value, error) {
+	args := make([]value, len(c.args))
+	for i, a := range c.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return value{}, err
+		}
+		args[i] = v
+	}
+	if f, ok := builtins[c.name]; ok {
+		return f(args)
+	}
+
+	provider, ok := e.cmd.API().(FunctionProvider)
+	if !ok {
+		return value{}, fmt.Errorf("Unknown function '%v'", c.name)
+	}
+	f, ok := provider.QueryFunctions()[c.name]
+	if !ok {
+		return value{}, fmt.Errorf("Unknown function '%v' for %v", c.name, e.cmd.API().Name())
+	}
+	if e.state == nil {
+		return value{}, fmt.Errorf("Function '%v' requires the state", c.name)
+	}
+	goArgs := make([]interface{}, len(args))
+	for i, a := range args {
+		goArgs[i] = a.toGo()
+	}
+	res, err := f(e.ctx, e.state, goArgs)
+	if err != nil {
+		return value{}, err
+	}
+	return toValue(res)
+}
+
+type not struct{ x expr }
+
+func (n *not) kind() kind { return kindBool }
+
+func (n *not) eval(e *env) (value, error) {
+	v, err := n.x.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+	if v.kind != kindBool {
+		return value{}, fmt.Errorf("Cannot negate %v", v.kind)
+	}
+	return value{kind: kindBool, b: !v.b}, nil
+}
+
+// logical is a short-circuiting '&&' or '||' expression.
+type logical struct {
+	or       bool
+	lhs, rhs expr
+}
+
+func newLogical(or bool, lhs, rhs expr) (expr, error) {
+	for _, x := range []expr{lhs, rhs} {
+		if k := x.kind(); k != kindUnknown && k != kindBool {
+			return nil, fmt.Errorf("Logical operands must be bool, got %v", k)
+		}
+	}
+	return &logical{or, lhs, rhs}, nil
+}
+
+func (l *logical) kind() kind { return kindBool }
+
+func (l *logical) eval(e *env) (value, error) {
+	for _, x := range []expr{l.lhs, l.rhs} {
+		v, err := x.eval(e)
+		if err != nil {
+			return value{}, err
+		}
+		if v.kind != kindBool {
+			return value{}, fmt.Errorf("Logical operands must be bool, got %v", v.kind)
+		}
+		if v.b == l.or {
+			return v, nil
+		}
+	}
+	return value{kind: kindBool, b: !l.or}, nil
+}
+
+// comparison is a binary comparison expression.
+type comparison struct {
+	op       string
+	lhs, rhs expr
+	re       *regexp.Regexp
+}
+
+func newComparison(op string, lhs, rhs expr) (expr, error) {
+	c := &comparison{op: op, lhs: lhs, rhs: rhs}
+	if op == "~" {
+		l, ok := rhs.(*literal)
+		if !ok || l.v.kind != kindString {
+			return nil, fmt.Errorf("The right-hand side of '~' must be a string literal")
+		}
+		re, err := regexp.Compile(l.v.s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression %q: %v", l.v.s, err)
+		}
+		c.re = re
+	}
+	// Check the operand kinds of literals now.
+	l, r := lhs.kind(), rhs.kind()
+	if l != kindUnknown && r != kindUnknown {
+		if _, err := c.compare(value{kind: l}, value{kind: r}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *comparison) kind() kind { return kindBool }
+
+func (c *comparison) eval(e *env) (value, error) {
+	l, err := c.lhs.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+	r, err := c.rhs.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+	b, err := c.compare(l, r)
+	if err != nil {
+		return value{}, err
+	}
+	return value{kind: kindBool, b: b}, nil
+}
+
+func (c *comparison) compare(l, r value) (bool, error) {
+	switch c.op {
+	case "==", "!=":
+		eq, err := equal(l, r)
+		return eq == (c.op == "=="), err
+
+	case "<", "<=", ">", ">=":
+		var cmp int
+		switch {
+		case l.kind.isNumber() && r.kind.isNumber():
+			cmp = compareNumbers(l, r)
+		case l.kind == kindString && r.kind == kindString:
+			cmp = strings.Compare(l.s, r.s)
+		default:
+			return false, fmt.Errorf("Cannot order %v and %v", l.kind, r.kind)
+		}
+		switch c.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+
+	case "~":
+		s, ok := l.str()
+		if !ok {
+			return false, fmt.Errorf("Cannot match %v against a regular expression", l.kind)
+		}
+		return c.re == nil || c.re.MatchString(s), nil
+
+	case "contains":
+		switch l.kind {
+		case kindList:
+			for _, e := range l.list {
+				if eq, err := equal(e, r); err == nil && eq {
+					return true, nil
+				}
+			}
+			return false, nil
+		case kindString:
+			s, ok := r.str()
+			if !ok {
+				return false, fmt.Errorf("Cannot search a string for %v", r.kind)
+			}
+			return strings.Contains(l.s, s), nil
+		}
+		return false, fmt.Errorf("Cannot search %v", l.kind)
+	}
+	return false, fmt.Errorf("Unknown operator '%v'", c.op)
+}
+
+// equal returns true if the two values are equal. Enumeration values are
+// equal to the string of their name.
+func equal(l, r value) (bool, error) {
+	switch {
+	case l.kind == kindNull || r.kind == kindNull:
+		return l.kind == r.kind, nil
+	case l.kind.isNumber() && r.kind.isNumber():
+		return compareNumbers(l, r) == 0, nil
+	case l.kind == kindString || r.kind == kindString:
+		ls, lok := l.str()
+		rs, rok := r.str()
+		if lok && rok {
+			return ls == rs, nil
+		}
+	case l.kind == kindBool && r.kind == kindBool:
+		return l.b == r.b, nil
+	case l.kind == kindList && r.kind == kindList:
+		if len(l.list) != len(r.list) {
+			return false, nil
+		}
+		for i := range l.list {
+			if eq, err := equal(l.list[i], r.list[i]); err != nil || !eq {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("Cannot compare %v and %v", l.kind, r.kind)
+}
+
+// compareNumbers returns -1, 0 or 1 if l is less than, equal to, or greater
+// than r.
+func compareNumbers(l, r value) int {
+	sign := func(b bool) int {
+		if b {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case l.kind == kindFloat || r.kind == kindFloat:
+		lf, rf := l.float(), r.float()
+		if lf == rf {
+			return 0
+		}
+		return sign(lf < rf)
+	case l.kind == kindInt && r.kind == kindInt:
+		if l.i == r.i {
+			return 0
+		}
+		return sign(l.i < r.i)
+	case l.kind == kindUint && r.kind == kindUint:
+		if l.u == r.u {
+			return 0
+		}
+		return sign(l.u < r.u)
+	case l.kind == kindInt: // r is uint
+		if l.i < 0 {
+			return -1
+		}
+		return compareNumbers(value{kind: kindUint, u: uint64(l.i)}, r)
+	default: // l is uint, r is int
+		return -compareNumbers(r, l)
+	}
+}
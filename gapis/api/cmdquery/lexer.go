@@ -0,0 +1,124 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("'%v'", t.text)
+}
+
+// operators is the list of operators, longest first.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "~", "!", "(", ")", "[", "]", ",", "."}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || r == '*' || unicode.IsLetter(r)
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || r == '*' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lex splits the query text into tokens.
+func lex(text string) ([]token, error) {
+	out := []token{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case isIdentStart(r):
+			for i++; i < len(runes) && isIdent(runes[i]); i++ {
+			}
+			out = append(out, token{tokIdent, string(runes[start:i]), start})
+
+		case unicode.IsDigit(r), r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			for i++; i < len(runes); i++ {
+				c := runes[i]
+				exponentSign := (c == '-' || c == '+') && strings.ContainsRune("eE", runes[i-1]) &&
+					!strings.HasPrefix(strings.ToLower(string(runes[start:i])), "0x")
+				if !(unicode.IsDigit(c) || unicode.IsLetter(c) || c == '.' || exponentSign) {
+					break
+				}
+			}
+			out = append(out, token{tokNumber, string(runes[start:i]), start})
+
+		case r == '"' || r == '\'':
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string at offset %d", start)
+			}
+			i++
+			body := string(runes[start+1 : i-1])
+			if r == '\'' {
+				// Single quoted strings follow the double quoted escaping rules.
+				body = strings.Replace(body, `"`, `\"`, -1)
+				body = strings.Replace(body, `\'`, `'`, -1)
+			}
+			s, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid string at offset %d: %v", start, err)
+			}
+			out = append(out, token{tokString, s, start})
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("Unexpected character '%c' at offset %d", r, start)
+			}
+			i += len([]rune(op))
+			out = append(out, token{tokOp, op, start})
+		}
+	}
+	return append(out, token{tokEOF, "", len(runes)}), nil
+}
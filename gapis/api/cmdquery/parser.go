@@ -0,0 +1,287 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+	state  bool
+}
+
+func newParser(text string) (*parser, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{text: text, tokens: tokens}, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is returns true if the next token is the operator or keyword s.
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == s
+}
+
+// accept consumes the next token if it is one of the operators or keywords.
+func (p *parser) accept(s ...string) (string, bool) {
+	for _, o := range s {
+		if p.is(o) {
+			p.next()
+			return o, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(s string) error {
+	if _, ok := p.accept(s); !ok {
+		return p.errorf("Expected '%v', got %v", s, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) errorf(msg string, args ...interface{}) error {
+	return fmt.Errorf("%v at offset %d", fmt.Sprintf(msg, args...), p.peek().pos)
+}
+
+// parseQuery parses: [pattern] ['where' expr]
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{text: p.text}
+	if t := p.peek(); t.kind == tokIdent && t.text != "where" {
+		p.next()
+		parts := strings.Split(t.text, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		q.pattern = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	}
+	if _, ok := p.accept("where"); ok {
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if k := where.kind(); k != kindUnknown && k != kindBool {
+			return nil, fmt.Errorf("The where clause is %v, expected bool", k)
+		}
+		q.where = where
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf("Expected 'where' or end of query, got %v", t)
+	}
+	q.state = p.state
+	return q, nil
+}
+
+// parseOr parses: and (('||' | 'or') and)*
+func (p *parser) parseOr() (expr, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if lhs, err = newLogical(true, lhs, rhs); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseAnd parses: unary (('&&' | 'and') unary)*
+func (p *parser) parseAnd() (expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return lhs, nil
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if lhs, err = newLogical(false, lhs, rhs); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseUnary parses: ('!' | 'not') unary | comparison
+func (p *parser) parseUnary() (expr, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if k := x.kind(); k != kindUnknown && k != kindBool {
+			return nil, fmt.Errorf("Cannot negate %v", k)
+		}
+		return &not{x}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses: primary [op primary]
+func (p *parser) parseComparison() (expr, error) {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "~", "contains")
+	if !ok {
+		return lhs, nil
+	}
+	rhs, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return newComparison(op, lhs, rhs)
+}
+
+// parsePrimary parses: literal | '(' expr ')' | call | reference
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := parseNumber(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %v at offset %d", t, t.pos)
+		}
+		return &literal{v}, nil
+
+	case tokString:
+		return &literal{value{kind: kindString, s: t.text}}, nil
+
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{value{kind: kindBool, b: t.text == "true"}}, nil
+		case "null":
+			return &literal{value{kind: kindNull}}, nil
+		}
+		if strings.Contains(t.text, "*") {
+			return nil, fmt.Errorf("Unexpected pattern %v at offset %d", t, t.pos)
+		}
+		if p.is("(") {
+			return p.parseCall(t.text)
+		}
+		return p.parseAccessors(&reference{name: t.text})
+	}
+	return nil, fmt.Errorf("Unexpected %v at offset %d", t, t.pos)
+}
+
+// parseCall parses: '(' [expr (',' expr)*] ')'
+func (p *parser) parseCall(name string) (expr, error) {
+	p.next()
+	c := &call{name: name}
+	if _, ok := builtins[name]; !ok {
+		// Only builtins can be evaluated without state.
+		p.state = true
+	}
+	for !p.is(")") {
+		if len(c.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	p.next()
+	return p.parseAccessors(c)
+}
+
+// parseAccessors parses: ('.' ident | '[' number ']')*
+func (p *parser) parseAccessors(x expr) (expr, error) {
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent || strings.ContainsAny(t.text, "*$") {
+				return nil, fmt.Errorf("Expected a member name, got %v at offset %d", t, t.pos)
+			}
+			x = &accessor{x: x, member: t.text}
+		case p.is("["):
+			p.next()
+			t := p.next()
+			v, err := parseNumber(t.text)
+			if t.kind != tokNumber || err != nil || v.kind == kindFloat {
+				return nil, fmt.Errorf("Expected an integer index, got %v at offset %d", t, t.pos)
+			}
+			i := v.i
+			if v.kind == kindUint {
+				i = int64(v.u)
+			}
+			x = &accessor{x: x, index: i, isIndex: true}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseNumber parses an integer, in decimal or hexadecimal, or a float.
+func parseNumber(s string) (value, error) {
+	if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return value{kind: kindUint, u: u}, nil
+	}
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return value{kind: kindInt, i: i}, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return value{}, err
+	}
+	return value{kind: kindFloat, f: f}, nil
+}
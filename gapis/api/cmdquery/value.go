@@ -0,0 +1,263 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdquery
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/gapid/gapis/memory"
+)
+
+// maxListLength is the maximum number of elements of a list value.
+const maxListLength = 4096
+
+type kind int
+
+const (
+	// kindUnknown is the static kind of expressions whose kind is only known
+	// once evaluated.
+	kindUnknown kind = iota
+	kindNull
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindList
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindNull:
+		return "null"
+	case kindBool:
+		return "bool"
+	case kindInt, kindUint:
+		return "int"
+	case kindFloat:
+		return "float"
+	case kindString:
+		return "string"
+	case kindList:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+func (k kind) isNumber() bool { return k == kindInt || k == kindUint || k == kindFloat }
+
+// value is a typed query value.
+type value struct {
+	kind kind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	// s is the value of strings, and the name of enumeration values.
+	s    string
+	list []value
+}
+
+func (v value) String() string {
+	switch v.kind {
+	case kindNull:
+		return "null"
+	case kindBool:
+		return fmt.Sprint(v.b)
+	case kindInt:
+		return fmt.Sprint(v.i)
+	case kindUint:
+		return fmt.Sprint(v.u)
+	case kindFloat:
+		return fmt.Sprint(v.f)
+	case kindString:
+		return fmt.Sprintf("%q", v.s)
+	case kindList:
+		parts := make([]string, len(v.list))
+		for i, e := range v.list {
+			parts[i] = e.String()
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return "?"
+}
+
+// str returns the string of a string or enumeration value.
+func (v value) str() (string, bool) {
+	if v.kind == kindString || (v.kind.isNumber() && v.s != "") {
+		return v.s, true
+	}
+	return "", false
+}
+
+// float returns the numeric value as a float.
+func (v value) float() float64 {
+	switch v.kind {
+	case kindInt:
+		return float64(v.i)
+	case kindUint:
+		return float64(v.u)
+	}
+	return v.f
+}
+
+// toGo returns the value as a nil, bool, int64, uint64, float64, string or
+// []interface{}.
+func (v value) toGo() interface{} {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindInt:
+		return v.i
+	case kindUint:
+		return v.u
+	case kindFloat:
+		return v.f
+	case kindString:
+		return v.s
+	case kindList:
+		out := make([]interface{}, len(v.list))
+		for i, e := range v.list {
+			out[i] = e.toGo()
+		}
+		return out
+	}
+	return nil
+}
+
+// toValue converts a Go value to a query value.
+func toValue(o interface{}) (value, error) {
+	if o == nil {
+		return value{kind: kindNull}, nil
+	}
+	if p, ok := o.(memory.Pointer); ok {
+		return value{kind: kindUint, u: p.Address()}, nil
+	}
+
+	v := reflect.ValueOf(o)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return value{kind: kindNull}, nil
+		}
+		return toValue(v.Elem().Interface())
+	case reflect.Bool:
+		return value{kind: kindBool, b: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value{kind: kindInt, i: v.Int(), s: enumName(o)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value{kind: kindUint, u: v.Uint(), s: enumName(o)}, nil
+	case reflect.Float32, reflect.Float64:
+		return value{kind: kindFloat, f: v.Float()}, nil
+	case reflect.String:
+		return value{kind: kindString, s: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Len() > maxListLength {
+			return value{}, fmt.Errorf("List of %d elements is too long", v.Len())
+		}
+		out := value{kind: kindList, list: make([]value, v.Len())}
+		for i := range out.list {
+			e, err := toValue(v.Index(i).Interface())
+			if err != nil {
+				return value{}, err
+			}
+			out.list[i] = e
+		}
+		return out, nil
+	}
+	return value{}, fmt.Errorf("Values of type %T cannot be used in queries", o)
+}
+
+// enumName returns the name of the integer value o if its type is a named
+// type with a String method.
+func enumName(o interface{}) string {
+	if s, ok := o.(fmt.Stringer); ok && reflect.TypeOf(o).PkgPath() != "" {
+		return s.String()
+	}
+	return ""
+}
+
+// member returns the member called name of o. Members are looked up as
+// getter methods first, as used by the generated API types, then as struct
+// fields and string-keyed map entries. The capitalized name is also tried.
+func member(o interface{}, name string) (interface{}, error) {
+	names := []string{name}
+	if c := strings.ToUpper(name[:1]) + name[1:]; c != name {
+		names = append(names, c)
+	}
+
+	v := reflect.ValueOf(o)
+	for _, n := range names {
+		if !v.IsValid() {
+			break
+		}
+		if m := v.MethodByName(n); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			return m.Call(nil)[0].Interface(), nil
+		}
+	}
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, fmt.Errorf("Cannot get member '%v' of null", name)
+		}
+		v = v.Elem()
+	}
+	for _, n := range names {
+		switch {
+		case !v.IsValid():
+		case v.Kind() == reflect.Struct:
+			if f := v.FieldByName(n); f.IsValid() && f.CanInterface() {
+				return f.Interface(), nil
+			}
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			if e := v.MapIndex(reflect.ValueOf(n).Convert(v.Type().Key())); e.IsValid() {
+				return e.Interface(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%T has no member '%v'", o, name)
+}
+
+// index returns the element at index i of o, which can be a slice, an array
+// or an integer-keyed map.
+func index(o interface{}, i int64) (interface{}, error) {
+	v := reflect.ValueOf(o)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, fmt.Errorf("Cannot index null")
+		}
+		v = v.Elem()
+	}
+	switch {
+	case !v.IsValid():
+	case v.Kind() == reflect.Slice, v.Kind() == reflect.Array:
+		if i < 0 || i >= int64(v.Len()) {
+			return nil, fmt.Errorf("Index %d out of bounds [0, %d)", i, v.Len())
+		}
+		return v.Index(int(i)).Interface(), nil
+	case v.Kind() == reflect.Map:
+		switch v.Type().Key().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if e := v.MapIndex(reflect.ValueOf(i).Convert(v.Type().Key())); e.IsValid() {
+				return e.Interface(), nil
+			}
+			return nil, fmt.Errorf("Key %d not found", i)
+		}
+	}
+	return nil, fmt.Errorf("%T cannot be indexed", o)
+}
@@ -156,6 +156,23 @@ func CreateBitfieldDataValue(typeName string, val interface{}, index int32, a AP
 	}
 }
 
+// ConstantValue returns the value of the constant of the constant set at
+// index with the given name. The name is either the full name of the constant
+// or its truncated display name, as created for the type by
+// CreateEnumDataValue and CreateBitfieldDataValue.
+func ConstantValue(typeName string, name string, index int32, a API) (uint64, bool) {
+	cs := a.ConstantSets()
+	if index < 0 || int(index) >= len(cs.Sets) {
+		return 0, false
+	}
+	for _, e := range cs.Sets[index].Entries {
+		if s := cs.Symbols.Get(e); s == name || truncateEnumString(typeName, s) == name {
+			return e.V, true
+		}
+	}
+	return 0, false
+}
+
 func CreateLinkedDataValue(typeName string, p []*path.Any, val *DataValue) *DataValue {
 	return &DataValue{
 		TypeName: typeName,
@@ -0,0 +1,52 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// Linter is the type implemented by APIs that can statically check the
+// commands of a capture for performance anti-patterns, without replaying it.
+type Linter interface {
+	// LintRules returns the names of the lint rules of the API.
+	LintRules() []string
+	// NewLintPass returns a new lint pass checking the given rules, or all the
+	// rules of the API if rules is empty.
+	NewLintPass(ctx context.Context, rules []string) (LintPass, error)
+}
+
+// LintPass checks the commands of a capture, in order.
+type LintPass interface {
+	// PostCmd checks the command after it mutated the state, and returns the
+	// issues found.
+	PostCmd(ctx context.Context, id CmdID, cmd Cmd, s *GlobalState) []LintIssue
+	// Flush returns the issues that can only be found once all the commands
+	// have been checked.
+	Flush(ctx context.Context, s *GlobalState) []LintIssue
+}
+
+// LintIssue is an anti-pattern found by a lint rule.
+type LintIssue struct {
+	// Rule is the name of the rule that found the issue.
+	Rule string
+	// Command is the command the issue is about, or CmdNoID.
+	Command  CmdID
+	Severity log.Severity
+	Message  *stringtable.Msg
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import "context"
+
+// MemoryTimelineProvider is the type implemented by APIs that can report the
+// device memory events of their commands.
+type MemoryTimelineProvider interface {
+	// NewMemoryTimelineRecorder returns a recorder of the device memory events
+	// of the API's commands.
+	NewMemoryTimelineRecorder() MemoryTimelineRecorder
+}
+
+// MemoryTimelineRecorder records the device memory events of the commands of
+// a capture, in order. The recorder fills the events without their command,
+// frame and heap total, which are filled by the caller.
+type MemoryTimelineRecorder interface {
+	// Initial returns the allocations and bindings of the initial state.
+	Initial(ctx context.Context, s *GlobalState) []*MemoryEvent
+	// PostCmd returns the events of the command, after it mutated the state.
+	PostCmd(ctx context.Context, id CmdID, cmd Cmd, s *GlobalState) []*MemoryEvent
+	// Heaps returns the heaps of the allocations recorded so far.
+	Heaps() []*MemoryHeap
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meshexport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/vertex"
+)
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbVersion   = 2
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\0"
+
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+)
+
+var gltfTypes = []string{"", "SCALAR", "VEC2", "VEC3", "VEC4"}
+
+var gltfModes = map[api.DrawPrimitive]int{
+	api.DrawPrimitive_Points:        0,
+	api.DrawPrimitive_Lines:         1,
+	api.DrawPrimitive_LineLoop:      2,
+	api.DrawPrimitive_LineStrip:     3,
+	api.DrawPrimitive_Triangles:     4,
+	api.DrawPrimitive_TriangleStrip: 5,
+	api.DrawPrimitive_TriangleFan:   6,
+}
+
+type gltfFile struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name string `json:"name,omitempty"`
+	Mesh int    `json:"mesh"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Mode       int            `json:"mode"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+// GLB writes the mesh to w as a binary glTF 2.0 file. Every vertex stream of
+// the mesh is written as a vertex attribute. Streams that have no glTF
+// equivalent are written as application-specific attributes, named after the
+// stream.
+func GLB(w io.Writer, m *api.Mesh, name string) error {
+	mesh, err := newFloatMesh(m)
+	if err != nil {
+		return err
+	}
+	mode, ok := gltfModes[m.DrawPrimitive]
+	if !ok {
+		return fmt.Errorf("Unsupported draw primitive %v", m.DrawPrimitive)
+	}
+
+	file := gltfFile{
+		Asset:  gltfAsset{Version: "2.0", Generator: "GAPID"},
+		Scenes: []gltfScene{{Nodes: []int{0}}},
+		Nodes:  []gltfNode{{Name: name, Mesh: 0}},
+	}
+	bin := &bytes.Buffer{}
+	addAccessor := func(target, componentType, count int, ty string, data interface{}) (int, error) {
+		offset := bin.Len()
+		if err := binary.Write(bin, binary.LittleEndian, data); err != nil {
+			return 0, err
+		}
+		file.BufferViews = append(file.BufferViews, gltfBufferView{
+			ByteOffset: offset,
+			ByteLength: bin.Len() - offset,
+			Target:     target,
+		})
+		file.Accessors = append(file.Accessors, gltfAccessor{
+			BufferView:    len(file.BufferViews) - 1,
+			ComponentType: componentType,
+			Count:         count,
+			Type:          ty,
+		})
+		return len(file.Accessors) - 1, nil
+	}
+
+	primitive := gltfPrimitive{Attributes: map[string]int{}, Mode: mode}
+	sets := map[vertex.Semantic_Type]int{}
+	for _, s := range mesh.streams {
+		attr, n, pad := gltfAttribute(s, sets, mesh)
+		if _, dup := primitive.Attributes[attr]; dup {
+			attr = fmt.Sprintf("%v_%d", attr, len(primitive.Attributes))
+		}
+		data := make([]float32, 0, mesh.vertexCount*n)
+		for i := 0; i < mesh.vertexCount; i++ {
+			data = append(data, s.get(i, n, pad...)...)
+		}
+		a, err := addAccessor(gltfArrayBuffer, gltfFloat, mesh.vertexCount, gltfTypes[n], data)
+		if err != nil {
+			return err
+		}
+		if attr == "POSITION" {
+			// The bounds of the positions are required.
+			file.Accessors[a].Min, file.Accessors[a].Max = s.bounds(n)
+		}
+		primitive.Attributes[attr] = a
+	}
+	if primitive.Indices, err = addAccessor(gltfElementArray, gltfUnsignedInt, len(mesh.indices), "SCALAR", mesh.indices); err != nil {
+		return err
+	}
+	file.Meshes = []gltfMesh{{Name: name, Primitives: []gltfPrimitive{primitive}}}
+	file.Buffers = []gltfBuffer{{ByteLength: bin.Len()}}
+
+	js, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	// Both chunks must be 4-byte aligned, JSON is padded with spaces.
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	for bin.Len()%4 != 0 {
+		bin.WriteByte(0)
+	}
+
+	out := &bytes.Buffer{}
+	header := []uint32{glbMagic, glbVersion, uint32(12 + 8 + len(js) + 8 + bin.Len())}
+	binary.Write(out, binary.LittleEndian, header)
+	binary.Write(out, binary.LittleEndian, []uint32{uint32(len(js)), glbChunkJSON})
+	out.Write(js)
+	binary.Write(out, binary.LittleEndian, []uint32{uint32(bin.Len()), glbChunkBIN})
+	out.Write(bin.Bytes())
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// gltfAttribute returns the glTF attribute name for the stream, along with
+// the number of components and the padding values of the attribute.
+func gltfAttribute(s *floatStream, sets map[vertex.Semantic_Type]int, m *floatMesh) (string, int, []float32) {
+	primary := m.find(s.semantic) == s
+	switch {
+	case s.semantic == vertex.Semantic_Position && primary:
+		return "POSITION", 3, nil
+	case s.semantic == vertex.Semantic_Normal && primary:
+		return "NORMAL", 3, nil
+	case s.semantic == vertex.Semantic_Tangent && primary:
+		return "TANGENT", 4, []float32{0, 0, 0, 1}
+	case s.semantic == vertex.Semantic_Texcoord:
+		set := sets[s.semantic]
+		sets[s.semantic]++
+		return fmt.Sprintf("TEXCOORD_%d", set), 2, nil
+	case s.semantic == vertex.Semantic_Color:
+		set := sets[s.semantic]
+		sets[s.semantic]++
+		if s.components <= 3 {
+			return fmt.Sprintf("COLOR_%d", set), 3, nil
+		}
+		return fmt.Sprintf("COLOR_%d", set), 4, nil
+	}
+	n := s.components
+	if n > 4 {
+		n = 4
+	}
+	return "_" + gltfName(s), n, nil
+}
+
+// gltfName returns an upper-case name for the application-specific attribute
+// of the stream.
+func gltfName(s *floatStream) string {
+	name := s.name
+	if name == "" {
+		name = fmt.Sprintf("%v_%d", s.semantic, s.index)
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
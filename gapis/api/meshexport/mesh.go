@@ -0,0 +1,207 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meshexport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/stream"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/vertex"
+)
+
+// floatStream is a vertex stream with every component converted to a 32-bit
+// float.
+type floatStream struct {
+	name       string
+	semantic   vertex.Semantic_Type
+	index      uint32
+	components int
+	data       []float32
+}
+
+// get returns the first n components of vertex i, padding any missing
+// components with the values of pad.
+func (s *floatStream) get(i, n int, pad ...float32) []float32 {
+	out := make([]float32, n)
+	v := s.data[i*s.components : (i+1)*s.components]
+	for c := range out {
+		switch {
+		case c < len(v):
+			out[c] = v[c]
+		case c < len(pad):
+			out[c] = pad[c]
+		}
+	}
+	return out
+}
+
+// floatMesh is a mesh with all of its vertex streams converted to floats.
+type floatMesh struct {
+	mesh        *api.Mesh
+	indices     []uint32
+	vertexCount int
+	streams     []*floatStream
+}
+
+func newFloatMesh(m *api.Mesh) (*floatMesh, error) {
+	if m.VertexBuffer == nil {
+		return nil, fmt.Errorf("Mesh has no vertex buffer")
+	}
+	out := &floatMesh{mesh: m, vertexCount: -1}
+	for _, s := range m.VertexBuffer.Streams {
+		f, err := toFloatStream(s)
+		if err != nil {
+			return nil, err
+		}
+		count := len(f.data) / f.components
+		if out.vertexCount >= 0 && count != out.vertexCount {
+			return nil, fmt.Errorf("Vertex stream '%v' has %d vertices, expected %d", s.Name, count, out.vertexCount)
+		}
+		out.vertexCount = count
+		out.streams = append(out.streams, f)
+	}
+	if out.vertexCount <= 0 {
+		return nil, fmt.Errorf("Mesh has no vertices")
+	}
+	if m.IndexBuffer != nil && len(m.IndexBuffer.Indices) > 0 {
+		out.indices = m.IndexBuffer.Indices
+		for _, i := range out.indices {
+			if int(i) >= out.vertexCount {
+				return nil, fmt.Errorf("Index %d is out of range of the %d vertices", i, out.vertexCount)
+			}
+		}
+	} else {
+		out.indices = make([]uint32, out.vertexCount)
+		for i := range out.indices {
+			out.indices[i] = uint32(i)
+		}
+		out.mesh = &api.Mesh{
+			DrawPrimitive: m.DrawPrimitive,
+			VertexBuffer:  m.VertexBuffer,
+			IndexBuffer:   &api.IndexBuffer{Indices: out.indices},
+		}
+	}
+	return out, nil
+}
+
+// toFloatStream converts the vertex stream s to 32-bit floats, keeping all of
+// its channels.
+func toFloatStream(s *vertex.Stream) (*floatStream, error) {
+	if s.Format == nil || len(s.Format.Components) == 0 {
+		return nil, fmt.Errorf("Vertex stream '%v' has no format", s.Name)
+	}
+	format := &stream.Format{}
+	for _, c := range s.Format.Components {
+		format.Components = append(format.Components, &stream.Component{
+			DataType: &stream.F32,
+			Sampling: stream.Linear,
+			Channel:  c.Channel,
+		})
+	}
+	data, err := stream.Convert(format, s.Format, s.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't convert vertex stream '%v': %v", s.Name, err)
+	}
+	out := &floatStream{
+		name:       s.Name,
+		semantic:   s.GetSemantic().GetType(),
+		index:      s.GetSemantic().GetIndex(),
+		components: len(format.Components),
+		data:       make([]float32, len(data)/4),
+	}
+	for i := range out.data {
+		out.data[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return out, nil
+}
+
+// find returns the stream with the given semantic and the lowest semantic
+// index, or nil if there is none.
+func (m *floatMesh) find(ty vertex.Semantic_Type) *floatStream {
+	var out *floatStream
+	for _, s := range m.streams {
+		if s.semantic == ty && (out == nil || s.index < out.index) {
+			out = s
+		}
+	}
+	return out
+}
+
+// triangles returns the vertex indices of each of the mesh's triangles, or
+// nil if the mesh is not made of triangles.
+func (m *floatMesh) triangles() [][3]uint32 {
+	count := m.mesh.TriangleCount()
+	if count == 0 {
+		return nil
+	}
+	out := make([][3]uint32, count)
+	for i := range out {
+		a, b, c := m.mesh.Triangle(i)
+		out[i] = [3]uint32{a, b, c}
+	}
+	return out
+}
+
+// lines returns the vertex indices of each of the mesh's line segments, or
+// nil if the mesh is not made of lines.
+func (m *floatMesh) lines() [][2]uint32 {
+	idx := m.indices
+	out := [][2]uint32{}
+	switch m.mesh.DrawPrimitive {
+	case api.DrawPrimitive_Lines:
+		for i := 0; i+1 < len(idx); i += 2 {
+			out = append(out, [2]uint32{idx[i], idx[i+1]})
+		}
+	case api.DrawPrimitive_LineStrip, api.DrawPrimitive_LineLoop:
+		for i := 0; i+1 < len(idx); i++ {
+			out = append(out, [2]uint32{idx[i], idx[i+1]})
+		}
+		if m.mesh.DrawPrimitive == api.DrawPrimitive_LineLoop && len(idx) > 2 {
+			out = append(out, [2]uint32{idx[len(idx)-1], idx[0]})
+		}
+	default:
+		return nil
+	}
+	return out
+}
+
+// bounds returns the minimum and maximum of each of the first n components of
+// the stream.
+func (s *floatStream) bounds(n int) (min, max []float32) {
+	min, max = make([]float32, n), make([]float32, n)
+	for c := 0; c < n; c++ {
+		min[c], max[c] = float32(math.Inf(1)), float32(math.Inf(-1))
+	}
+	count := len(s.data) / s.components
+	for i := 0; i < count; i++ {
+		for c, v := range s.get(i, n) {
+			if v < min[c] {
+				min[c] = v
+			}
+			if v > max[c] {
+				max[c] = v
+			}
+		}
+	}
+	for c := 0; c < n; c++ {
+		if min[c] > max[c] { // No finite values.
+			min[c], max[c] = 0, 0
+		}
+	}
+	return min, max
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meshexport_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/stream/fmts"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/meshexport"
+	"github.com/google/gapid/gapis/vertex"
+)
+
+func floats(v ...float32) []byte {
+	out := make([]byte, len(v)*4)
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(f))
+	}
+	return out
+}
+
+// quad returns a unit quad drawn as a triangle strip.
+func quad() *api.Mesh {
+	return &api.Mesh{
+		DrawPrimitive: api.DrawPrimitive_TriangleStrip,
+		VertexBuffer: &vertex.Buffer{Streams: []*vertex.Stream{
+			{
+				Name:     "position",
+				Data:     floats(0, 0, 0, 0, 1, 0, 1, 0, 0, 1, 1, 0),
+				Format:   fmts.XYZ_F32,
+				Semantic: &vertex.Semantic{Type: vertex.Semantic_Position},
+			}, {
+				Name:     "uv",
+				Data:     floats(0, 0, 0, 1, 1, 0, 1, 1),
+				Format:   fmts.XY_F32,
+				Semantic: &vertex.Semantic{Type: vertex.Semantic_Texcoord},
+			}, {
+				Name:     "color",
+				Data:     []byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255},
+				Format:   fmts.RGBA_U8_NORM,
+				Semantic: &vertex.Semantic{Type: vertex.Semantic_Color},
+			}, {
+				Name:     "weight",
+				Data:     floats(0.5, 1, 1.5, 2),
+				Format:   fmts.X_F32,
+				Semantic: &vertex.Semantic{Type: vertex.Semantic_Unknown},
+			},
+		}},
+		IndexBuffer: &api.IndexBuffer{Indices: []uint32{0, 1, 2, 3}},
+	}
+}
+
+func TestOBJ(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	err := meshexport.OBJ(buf, quad(), "quad")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "obj").ThatString(buf.String()).Equals(`# Exported by GAPID
+o quad
+v 0 0 0 1 0 0
+v 0 1 0 0 1 0
+v 1 0 0 0 0 1
+v 1 1 0 1 1 1
+vt 0 1
+vt 0 0
+vt 1 1
+vt 1 0
+f 1/1 2/2 3/3
+f 4/4 3/3 2/2
+`)
+}
+
+func TestGLB(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	err := meshexport.GLB(buf, quad(), "quad")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	data := buf.Bytes()
+	header := make([]uint32, 5)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, header)
+	assert.For(ctx, "magic").That(header[0]).Equals(uint32(0x46546C67))
+	assert.For(ctx, "version").That(header[1]).Equals(uint32(2))
+	assert.For(ctx, "length").That(header[2]).Equals(uint32(len(data)))
+	assert.For(ctx, "chunk").That(header[4]).Equals(uint32(0x4E4F534A))
+
+	var file struct {
+		Meshes []struct {
+			Primitives []struct {
+				Attributes map[string]int
+				Indices    int
+				Mode       int
+			}
+		}
+		Accessors []struct {
+			Count int
+			Type  string
+			Min   []float32
+			Max   []float32
+		}
+	}
+	err = json.Unmarshal(data[20:20+header[3]], &file)
+	assert.For(ctx, "json").ThatError(err).Succeeded()
+	prim := file.Meshes[0].Primitives[0]
+	assert.For(ctx, "mode").That(prim.Mode).Equals(5)
+	assert.For(ctx, "attributes").That(len(prim.Attributes)).Equals(4)
+	pos := file.Accessors[prim.Attributes["POSITION"]]
+	assert.For(ctx, "position type").ThatString(pos.Type).Equals("VEC3")
+	assert.For(ctx, "position min").ThatSlice(pos.Min).Equals([]float32{0, 0, 0})
+	assert.For(ctx, "position max").ThatSlice(pos.Max).Equals([]float32{1, 1, 0})
+	assert.For(ctx, "texcoord type").ThatString(file.Accessors[prim.Attributes["TEXCOORD_0"]].Type).Equals("VEC2")
+	assert.For(ctx, "color type").ThatString(file.Accessors[prim.Attributes["COLOR_0"]].Type).Equals("VEC4")
+	assert.For(ctx, "weight type").ThatString(file.Accessors[prim.Attributes["_WEIGHT"]].Type).Equals("SCALAR")
+	assert.For(ctx, "indices").That(file.Accessors[prim.Indices].Count).Equals(4)
+}
+
+func TestPLY(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	err := meshexport.PLY(buf, quad(), "")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	header := `ply
+format binary_little_endian 1.0
+comment Exported by GAPID
+element vertex 4
+property float x
+property float y
+property float z
+property float s
+property float t
+property uchar red
+property uchar green
+property uchar blue
+property uchar alpha
+property float weight_0
+element face 2
+property list uchar uint vertex_indices
+end_header
+`
+	assert.For(ctx, "header").ThatString(buf.String()[:len(header)]).Equals(header)
+	vertexSize := 3*4 + 4 + 2*4 + 4
+	faceSize := 1 + 3*4
+	assert.For(ctx, "size").That(buf.Len()).Equals(len(header) + 4*vertexSize + 2*faceSize)
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meshexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/vertex"
+)
+
+// OBJ writes the mesh to w as a Wavefront OBJ file. OBJ files can only hold
+// positions, normals, a single set of texture coordinates and vertex colors,
+// so all other vertex streams are dropped. Strips and fans are written as
+// separate triangles.
+func OBJ(w io.Writer, m *api.Mesh, name string) error {
+	mesh, err := newFloatMesh(m)
+	if err != nil {
+		return err
+	}
+	pos := mesh.find(vertex.Semantic_Position)
+	if pos == nil {
+		return fmt.Errorf("Mesh has no position stream")
+	}
+	normal := mesh.find(vertex.Semantic_Normal)
+	texcoord := mesh.find(vertex.Semantic_Texcoord)
+	color := mesh.find(vertex.Semantic_Color)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "# Exported by GAPID")
+	if name != "" {
+		fmt.Fprintf(b, "o %v\n", name)
+	}
+	for i := 0; i < mesh.vertexCount; i++ {
+		p := pos.get(i, 3)
+		if color != nil {
+			// Vertex colors are a widely supported extension to the v statement.
+			c := color.get(i, 3)
+			fmt.Fprintf(b, "v %g %g %g %g %g %g\n", p[0], p[1], p[2], c[0], c[1], c[2])
+		} else {
+			fmt.Fprintf(b, "v %g %g %g\n", p[0], p[1], p[2])
+		}
+	}
+	if texcoord != nil {
+		for i := 0; i < mesh.vertexCount; i++ {
+			// OBJ texture coordinates have their origin at the bottom-left.
+			t := texcoord.get(i, 2)
+			fmt.Fprintf(b, "vt %g %g\n", t[0], 1-t[1])
+		}
+	}
+	if normal != nil {
+		for i := 0; i < mesh.vertexCount; i++ {
+			n := normal.get(i, 3)
+			fmt.Fprintf(b, "vn %g %g %g\n", n[0], n[1], n[2])
+		}
+	}
+
+	// OBJ indices are 1-based, and every stream shares the same index.
+	ref := func(i uint32) string {
+		switch {
+		case texcoord != nil && normal != nil:
+			return fmt.Sprintf("%d/%d/%d", i+1, i+1, i+1)
+		case texcoord != nil:
+			return fmt.Sprintf("%d/%d", i+1, i+1)
+		case normal != nil:
+			return fmt.Sprintf("%d//%d", i+1, i+1)
+		default:
+			return fmt.Sprint(i + 1)
+		}
+	}
+	switch m.DrawPrimitive {
+	case api.DrawPrimitive_Points:
+		refs := make([]string, len(mesh.indices))
+		for i, idx := range mesh.indices {
+			refs[i] = fmt.Sprint(idx + 1)
+		}
+		fmt.Fprintf(b, "p %v\n", strings.Join(refs, " "))
+	case api.DrawPrimitive_Lines, api.DrawPrimitive_LineStrip, api.DrawPrimitive_LineLoop:
+		for _, l := range mesh.lines() {
+			fmt.Fprintf(b, "l %d %d\n", l[0]+1, l[1]+1)
+		}
+	default:
+		for _, t := range mesh.triangles() {
+			fmt.Fprintf(b, "f %v %v %v\n", ref(t[0]), ref(t[1]), ref(t[2]))
+		}
+	}
+	return b.Flush()
+}
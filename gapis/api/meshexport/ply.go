@@ -0,0 +1,135 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meshexport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/vertex"
+)
+
+// PLY writes the mesh to w as a binary little-endian PLY file. The primary
+// position, normal, texture coordinate and color streams are written with the
+// conventional property names, all other streams are written as float
+// properties named after the stream. Triangles are written as faces and lines
+// as edges.
+func PLY(w io.Writer, m *api.Mesh, name string) error {
+	mesh, err := newFloatMesh(m)
+	if err != nil {
+		return err
+	}
+
+	type property struct {
+		stream *floatStream
+		names  []string
+		color  bool
+	}
+	props := []property{}
+	used := map[string]bool{}
+	for _, s := range mesh.streams {
+		primary := mesh.find(s.semantic) == s
+		p := property{stream: s}
+		switch {
+		case s.semantic == vertex.Semantic_Position && primary:
+			p.names = []string{"x", "y", "z"}
+		case s.semantic == vertex.Semantic_Normal && primary:
+			p.names = []string{"nx", "ny", "nz"}
+		case s.semantic == vertex.Semantic_Texcoord && primary:
+			p.names = []string{"s", "t"}
+		case s.semantic == vertex.Semantic_Color && primary:
+			p.names = []string{"red", "green", "blue", "alpha"}[:clamp(s.components, 3, 4)]
+			p.color = true
+		default:
+			base := strings.ToLower(gltfName(s))
+			for used[base+"_0"] {
+				base += "_"
+			}
+			for c := 0; c < s.components; c++ {
+				p.names = append(p.names, fmt.Sprintf("%v_%d", base, c))
+			}
+		}
+		for _, n := range p.names {
+			used[n] = true
+		}
+		props = append(props, p)
+	}
+
+	triangles, lines := mesh.triangles(), mesh.lines()
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "ply")
+	fmt.Fprintln(b, "format binary_little_endian 1.0")
+	fmt.Fprintln(b, "comment Exported by GAPID")
+	if name != "" {
+		fmt.Fprintf(b, "comment %v\n", name)
+	}
+	fmt.Fprintf(b, "element vertex %d\n", mesh.vertexCount)
+	for _, p := range props {
+		ty := "float"
+		if p.color {
+			ty = "uchar"
+		}
+		for _, n := range p.names {
+			fmt.Fprintf(b, "property %v %v\n", ty, n)
+		}
+	}
+	if triangles != nil {
+		fmt.Fprintf(b, "element face %d\n", len(triangles))
+		fmt.Fprintln(b, "property list uchar uint vertex_indices")
+	}
+	if lines != nil {
+		fmt.Fprintf(b, "element edge %d\n", len(lines))
+		fmt.Fprintln(b, "property uint vertex1")
+		fmt.Fprintln(b, "property uint vertex2")
+	}
+	fmt.Fprintln(b, "end_header")
+
+	for i := 0; i < mesh.vertexCount; i++ {
+		for _, p := range props {
+			v := p.stream.get(i, len(p.names), 0, 0, 0, 1)
+			if p.color {
+				for _, c := range v {
+					b.WriteByte(byte(clamp(int(c*255+0.5), 0, 255)))
+				}
+			} else {
+				binary.Write(b, binary.LittleEndian, v)
+			}
+		}
+	}
+	for _, t := range triangles {
+		b.WriteByte(3)
+		binary.Write(b, binary.LittleEndian, t)
+	}
+	for _, l := range lines {
+		binary.Write(b, binary.LittleEndian, l)
+	}
+	return b.Flush()
+}
+
+func clamp(v, min, max int) int {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	default:
+		return v
+	}
+}
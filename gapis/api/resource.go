@@ -59,6 +59,8 @@ type Resource interface {
 }
 
 // ReplaceCallback is called from SetResourceData to propagate changes to current command stream.
+// with is either the Cmd replacing the command at where, or a []Cmd of
+// commands to insert after the command at where.
 type ReplaceCallback func(where uint64, with interface{})
 
 // MutateInitialState is called from SetResourceData to get a mutable instance of the initial state.
@@ -104,6 +106,10 @@ func NewResourceData(data interface{}) *ResourceData {
 		return &ResourceData{Data: &ResourceData_Program{data}}
 	case *Pipeline:
 		return &ResourceData{Data: &ResourceData_Pipeline{data}}
+	case *Buffer:
+		return &ResourceData{Data: &ResourceData_Buffer{data}}
+	case *TextureData:
+		return &ResourceData{Data: &ResourceData_TextureData{data}}
 	default:
 		panic(fmt.Errorf("%T is not a ResourceData type", data))
 	}
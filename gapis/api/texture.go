@@ -275,3 +275,137 @@ func NewTexture(t interface{}) *Texture {
 		panic(fmt.Errorf("%T is not a Texture type", t))
 	}
 }
+
+// ImageTexture returns all the mip-levels, array layers and cube-map faces of
+// the texture as an image.Texture, which can be written to a KTX2 or DDS
+// file. get is called to fetch the data of each image.
+func (t *Texture) ImageTexture(ctx context.Context, get func(context.Context, *image.Info) ([]byte, error)) (*image.Texture, error) {
+	// layers holds the images of each layer, indexed by level then face.
+	layers := [][][]*image.Info{}
+	addLevels := func(levels []*image.Info) {
+		layer := make([][]*image.Info, len(levels))
+		for i, l := range levels {
+			layer[i] = []*image.Info{l}
+		}
+		layers = append(layers, layer)
+	}
+	addCubemap := func(c *Cubemap) {
+		layer := make([][]*image.Info, len(c.Levels))
+		for i, l := range c.Levels {
+			// Container files order the faces +X, -X, +Y, -Y, +Z, -Z.
+			layer[i] = []*image.Info{
+				l.PositiveX, l.NegativeX,
+				l.PositiveY, l.NegativeY,
+				l.PositiveZ, l.NegativeZ,
+			}
+		}
+		layers = append(layers, layer)
+	}
+
+	out := &image.Texture{Faces: 1}
+	switch t := protoutil.OneOf(t.Type).(type) {
+	case *Texture1D:
+		addLevels(t.Levels)
+	case *Texture1DArray:
+		for _, l := range t.Layers {
+			addLevels(l.Levels)
+		}
+		out.Layers = uint32(len(t.Layers))
+	case *Texture2D:
+		addLevels(t.Levels)
+	case *Texture2DArray:
+		for _, l := range t.Layers {
+			addLevels(l.Levels)
+		}
+		out.Layers = uint32(len(t.Layers))
+	case *Texture3D:
+		addLevels(t.Levels)
+	case *Cubemap:
+		addCubemap(t)
+		out.Faces = 6
+	case *CubemapArray:
+		for _, l := range t.Layers {
+			addCubemap(l)
+		}
+		out.Layers = uint32(len(t.Layers))
+		out.Faces = 6
+	default:
+		return nil, fmt.Errorf("Unsupported texture type %T", t)
+	}
+
+	if len(layers) == 0 || len(layers[0]) == 0 || layers[0][0][0] == nil {
+		return nil, fmt.Errorf("Texture has no images")
+	}
+	base := layers[0][0][0]
+	out.Format, out.Width, out.Height, out.Depth = base.Format, base.Width, base.Height, base.Depth
+	if out.Depth == 0 {
+		out.Depth = 1
+	}
+	out.Levels = make([][][]byte, len(layers[0]))
+	for l := range out.Levels {
+		w, h, d := out.LevelSize(l)
+		for i, layer := range layers {
+			if len(layer) != len(out.Levels) {
+				return nil, fmt.Errorf("Layer %d has %d levels, expected %d", i, len(layer), len(out.Levels))
+			}
+			for f, info := range layer[l] {
+				switch {
+				case info == nil:
+					return nil, fmt.Errorf("Layer %d level %d face %d is missing", i, l, f)
+				case info.Format.Key() != out.Format.Key():
+					return nil, fmt.Errorf("Layer %d level %d face %d has format %v, expected %v",
+						i, l, f, info.Format.Name, out.Format.Name)
+				case info.Width != w || info.Height != h || (info.Depth != d && d > 1):
+					return nil, fmt.Errorf("Layer %d level %d face %d has size %dx%dx%d, expected %dx%dx%d",
+						i, l, f, info.Width, info.Height, info.Depth, w, h, d)
+				}
+				data, err := get(ctx, info)
+				if err != nil {
+					return nil, err
+				}
+				out.Levels[l] = append(out.Levels[l], data)
+			}
+		}
+	}
+	if err := out.Check(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NewTextureData returns a TextureData holding the images of the texture.
+func NewTextureData(t *image.Texture) *TextureData {
+	out := &TextureData{
+		Format: t.Format,
+		Width:  t.Width,
+		Height: t.Height,
+		Depth:  t.Depth,
+		Layers: t.Layers,
+		Faces:  t.Faces,
+		Levels: make([]*TextureDataLevel, len(t.Levels)),
+	}
+	for i, images := range t.Levels {
+		out.Levels[i] = &TextureDataLevel{Images: images}
+	}
+	return out
+}
+
+// ImageTexture returns the texture held by the TextureData.
+func (t *TextureData) ImageTexture() (*image.Texture, error) {
+	out := &image.Texture{
+		Format: t.Format,
+		Width:  t.Width,
+		Height: t.Height,
+		Depth:  t.Depth,
+		Layers: t.Layers,
+		Faces:  t.Faces,
+		Levels: make([][][]byte, len(t.Levels)),
+	}
+	for i, l := range t.Levels {
+		out.Levels[i] = l.Images
+	}
+	if err := out.Check(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
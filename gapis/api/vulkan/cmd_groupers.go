@@ -0,0 +1,335 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve/cmdgrouper"
+)
+
+// Interface compliance test
+var (
+	_ = cmdgrouper.Provider(API{})
+	_ = cmdgrouper.Grouper(&renderPassGrouper{})
+	_ = cmdgrouper.Grouper(&pipelineGrouper{})
+	_ = cmdgrouper.Grouper(&commandBufferGrouper{})
+)
+
+// CmdGroupers returns the Vulkan groupers of the given kind.
+func (API) CmdGroupers(kind cmdgrouper.Kind) []cmdgrouper.Grouper {
+	switch kind {
+	case cmdgrouper.RenderPasses:
+		return []cmdgrouper.Grouper{&renderPassGrouper{}}
+	case cmdgrouper.Pipelines:
+		return []cmdgrouper.Grouper{&pipelineGrouper{}}
+	case cmdgrouper.CommandBuffers:
+		return []cmdgrouper.Grouper{&commandBufferGrouper{}}
+	default:
+		return nil
+	}
+}
+
+// recordingCmd is the interface implemented by the commands recorded in a
+// command buffer.
+type recordingCmd interface {
+	CommandBuffer() VkCommandBuffer
+}
+
+// debugName returns name followed by the debug name of the object, if any.
+func debugName(name string, info VulkanDebugMarkerInfoʳ) string {
+	if info.IsNil() || info.ObjectName() == "" {
+		return name
+	}
+	return fmt.Sprintf("%s \"%s\"", name, info.ObjectName())
+}
+
+// renderPassGrouper groups the recorded commands by render pass instance, and
+// by subpass for render passes with more than one subpass.
+type renderPassGrouper struct {
+	open map[VkCommandBuffer]*renderPassInstance
+	out  []cmdgrouper.Group
+}
+
+type renderPassInstance struct {
+	pass    cmdgrouper.Group
+	subpass cmdgrouper.Group
+	index   int
+}
+
+func (g *renderPassGrouper) Process(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) {
+	if g.open == nil {
+		g.open = map[VkCommandBuffer]*renderPassInstance{}
+	}
+	switch cmd := cmd.(type) {
+	case *VkCmdBeginRenderPass:
+		cb := cmd.CommandBuffer()
+		g.end(cb, id)
+		name := "Render Pass"
+		if info, err := cmd.PRenderPassBegin().Read(ctx, cmd, s, nil); err == nil {
+			name = renderPassName(GetState(s), info.RenderPass(), info.Framebuffer())
+		}
+		g.open[cb] = &renderPassInstance{
+			pass:    cmdgrouper.Group{Start: id, Name: name},
+			subpass: cmdgrouper.Group{Start: id, Name: "Subpass 0"},
+		}
+	case *VkCmdNextSubpass:
+		if r, ok := g.open[cmd.CommandBuffer()]; ok {
+			r.subpass.End = id
+			g.out = append(g.out, r.subpass)
+			r.index++
+			r.subpass = cmdgrouper.Group{Start: id, Name: fmt.Sprintf("Subpass %d", r.index)}
+		}
+	case *VkCmdEndRenderPass:
+		g.end(cmd.CommandBuffer(), id+1)
+	case *VkBeginCommandBuffer:
+		g.end(cmd.CommandBuffer(), id)
+	}
+}
+
+// end closes the render pass instance open in the command buffer.
+func (g *renderPassGrouper) end(cb VkCommandBuffer, end api.CmdID) {
+	r, ok := g.open[cb]
+	if !ok {
+		return
+	}
+	if r.index > 0 {
+		r.subpass.End = end
+		g.out = append(g.out, r.subpass)
+	}
+	r.pass.End = end
+	g.out = append(g.out, r.pass)
+	delete(g.open, cb)
+}
+
+func (g *renderPassGrouper) Build(end api.CmdID) []cmdgrouper.Group {
+	for cb := range g.open {
+		g.end(cb, end)
+	}
+	out := g.out
+	g.open, g.out = nil, nil
+	return out
+}
+
+func renderPassName(st *State, rp VkRenderPass, fb VkFramebuffer) string {
+	name := fmt.Sprintf("Render Pass: %v", rp)
+	if st.RenderPasses().Contains(rp) {
+		name = debugName(name, st.RenderPasses().Get(rp).DebugInfo())
+	}
+	if st.Framebuffers().Contains(fb) {
+		f := st.Framebuffers().Get(fb)
+		name = fmt.Sprintf("%s (%dx%d)", name, f.Width(), f.Height())
+	}
+	return name
+}
+
+// pipelineGrouper groups the recorded draw calls by bound graphics pipeline.
+// The groups do not cross render pass and subpass boundaries.
+type pipelineGrouper struct {
+	bound map[VkCommandBuffer]VkPipeline
+	open  map[VkCommandBuffer]*pipelineGroup
+	out   []cmdgrouper.Group
+}
+
+type pipelineGroup struct {
+	group cmdgrouper.Group
+	draws int
+}
+
+func (g *pipelineGrouper) Process(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) {
+	if g.bound == nil {
+		g.bound = map[VkCommandBuffer]VkPipeline{}
+		g.open = map[VkCommandBuffer]*pipelineGroup{}
+	}
+	switch cmd := cmd.(type) {
+	case *VkCmdBindPipeline:
+		if cmd.PipelineBindPoint() == VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS {
+			cb := cmd.CommandBuffer()
+			g.end(cb, id)
+			g.bound[cb] = cmd.Pipeline()
+			g.begin(GetState(s), cb, id)
+		}
+	case *VkCmdBeginRenderPass, *VkCmdNextSubpass, *VkCmdEndRenderPass:
+		cb := cmd.(recordingCmd).CommandBuffer()
+		g.end(cb, id)
+		g.begin(GetState(s), cb, id+1)
+	case *VkBeginCommandBuffer, *VkEndCommandBuffer:
+		cb := cmd.(recordingCmd).CommandBuffer()
+		g.end(cb, id)
+		delete(g.bound, cb)
+	default:
+		if r, ok := cmd.(recordingCmd); ok && cmd.CmdFlags().IsExecutedDraw() {
+			if p, ok := g.open[r.CommandBuffer()]; ok {
+				p.draws++
+			}
+		}
+	}
+}
+
+// begin opens a group for the pipeline bound to the command buffer, if any.
+func (g *pipelineGrouper) begin(st *State, cb VkCommandBuffer, start api.CmdID) {
+	p, ok := g.bound[cb]
+	if !ok {
+		return
+	}
+	name := fmt.Sprintf("Pipeline: %v", p)
+	if st.GraphicsPipelines().Contains(p) {
+		name = debugName(name, st.GraphicsPipelines().Get(p).DebugInfo())
+	}
+	g.open[cb] = &pipelineGroup{group: cmdgrouper.Group{Start: start, Name: name}}
+}
+
+// end closes the pipeline group open in the command buffer. Groups without
+// draw calls are dropped.
+func (g *pipelineGrouper) end(cb VkCommandBuffer, end api.CmdID) {
+	p, ok := g.open[cb]
+	if !ok {
+		return
+	}
+	if p.draws > 0 {
+		p.group.End = end
+		g.out = append(g.out, p.group)
+	}
+	delete(g.open, cb)
+}
+
+func (g *pipelineGrouper) Build(end api.CmdID) []cmdgrouper.Group {
+	for cb := range g.open {
+		g.end(cb, end)
+	}
+	out := g.out
+	g.bound, g.open, g.out = nil, nil, nil
+	return out
+}
+
+// commandBufferGrouper groups the commands recording each command buffer, and
+// each submission. When the submitted command buffers were recorded in the same
+// frame, their recordings are nested in the group of the submission. Groups
+// that would partially overlap the groups before them are not built.
+type commandBufferGrouper struct {
+	recording  map[VkCommandBuffer]cmdgrouper.Group
+	recorded   map[VkCommandBuffer]cmdgrouper.Group
+	frameStart api.CmdID
+	out        []cmdgrouper.Group // Ordered by end.
+}
+
+func (g *commandBufferGrouper) Process(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) {
+	if g.recording == nil {
+		g.recording = map[VkCommandBuffer]cmdgrouper.Group{}
+		g.recorded = map[VkCommandBuffer]cmdgrouper.Group{}
+	}
+	switch cmd := cmd.(type) {
+	case *VkBeginCommandBuffer:
+		cb := cmd.CommandBuffer()
+		name := fmt.Sprintf("Command Buffer: %v", cb)
+		if st := GetState(s); st.CommandBuffers().Contains(cb) {
+			name = debugName(name, st.CommandBuffers().Get(cb).DebugInfo())
+		}
+		g.recording[cb] = cmdgrouper.Group{Start: id, Name: name}
+	case *VkEndCommandBuffer:
+		cb := cmd.CommandBuffer()
+		if r, ok := g.recording[cb]; ok {
+			delete(g.recording, cb)
+			// Recordings interleaved with others are not grouped.
+			if r.End = id + 1; g.fits(r.Start, r.End) {
+				g.out = append(g.out, r)
+				g.recorded[cb] = r
+			}
+		}
+	case *VkQueueSubmit:
+		g.submit(ctx, id, cmd, s)
+	}
+	if cmd.CmdFlags().IsEndOfFrame() {
+		g.frameStart = id + 1
+	}
+}
+
+// submit adds the group of the submission. The group starts at the earliest
+// recording of the submitted command buffers that was made in the current frame
+// and that can be nested without overlapping other groups.
+func (g *commandBufferGrouper) submit(ctx context.Context, id api.CmdID, cmd *VkQueueSubmit, s *api.GlobalState) {
+	l := s.MemoryLayout
+	handles, nested := []string{}, []VkCommandBuffer{}
+	submits, err := cmd.PSubmits().Slice(0, uint64(cmd.SubmitCount()), l).Read(ctx, cmd, s, nil)
+	if err != nil {
+		log.W(ctx, "Couldn't read the submissions of %v: %v", cmd, err)
+	}
+	for _, info := range submits {
+		buffers, err := info.PCommandBuffers().Slice(0, uint64(info.CommandBufferCount()), l).Read(ctx, cmd, s, nil)
+		if err != nil {
+			log.W(ctx, "Couldn't read the command buffers submitted by %v: %v", cmd, err)
+			continue
+		}
+		for _, cb := range buffers {
+			handles = append(handles, fmt.Sprint(cb))
+			if r, ok := g.recorded[cb]; ok && r.Start >= g.frameStart {
+				nested = append(nested, cb)
+			}
+		}
+	}
+
+	// Nest the latest recordings first, so that an earlier recording that
+	// doesn't fit doesn't prevent the later ones from being nested.
+	sort.Slice(nested, func(i, j int) bool {
+		return g.recorded[nested[i]].Start > g.recorded[nested[j]].Start
+	})
+	start := id
+	for _, cb := range nested {
+		r, ok := g.recorded[cb]
+		if !ok {
+			continue // Submitted more than once.
+		}
+		if !g.fits(r.Start, id+1) {
+			break
+		}
+		start = r.Start
+		// Only the first submission nests the recording.
+		delete(g.recorded, cb)
+	}
+
+	name := "Submit"
+	if len(handles) > 0 {
+		name = fmt.Sprintf("Submit: %s", strings.Join(handles, ", "))
+	}
+	g.out = append(g.out, cmdgrouper.Group{Start: start, End: id + 1, Name: name})
+}
+
+// fits returns true if a group from start to end, ending after all the groups
+// built so far, would not partially overlap any of them, nor the recordings
+// still open.
+func (g *commandBufferGrouper) fits(start, end api.CmdID) bool {
+	for i := len(g.out) - 1; i >= 0 && g.out[i].End > start; i-- {
+		if g.out[i].Start < start {
+			return false
+		}
+	}
+	for _, r := range g.recording {
+		if r.Start >= start && r.Start < end {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *commandBufferGrouper) Build(end api.CmdID) []cmdgrouper.Group {
+	out := g.out
+	g.recording, g.recorded, g.frameStart, g.out = nil, nil, 0, nil
+	return out
+}
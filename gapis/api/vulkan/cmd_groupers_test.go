@@ -0,0 +1,219 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve/cmdgrouper"
+)
+
+// groupTest builds a stream of commands recording and submitting command
+// buffers.
+type groupTest struct {
+	ctx  context.Context
+	s    *api.GlobalState
+	cb   CommandBuilder
+	cmds []api.Cmd
+}
+
+func newGroupTest(t *testing.T) *groupTest {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	return &groupTest{ctx: ctx, s: api.NewStateWithEmptyAllocator(device.Little64)}
+}
+
+func (g *groupTest) add(cmds ...api.Cmd) {
+	g.cmds = append(g.cmds, cmds...)
+}
+
+func (g *groupTest) begin(cb VkCommandBuffer) {
+	info := g.s.AllocDataOrPanic(g.ctx, NewVkCommandBufferBeginInfo(
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO, // sType
+		0, // pNext
+		0, // flags
+		NewVkCommandBufferInheritanceInfoᶜᵖ(memory.Nullptr), // pInheritanceInfo
+	))
+	g.add(g.cb.VkBeginCommandBuffer(cb, info.Ptr(), VkResult_VK_SUCCESS).AddRead(info.Data()))
+}
+
+func (g *groupTest) end(cb VkCommandBuffer) {
+	g.add(g.cb.VkEndCommandBuffer(cb, VkResult_VK_SUCCESS))
+}
+
+func (g *groupTest) draw(cb VkCommandBuffer) {
+	g.add(g.cb.VkCmdDraw(cb, 3, 1, 0, 0))
+}
+
+func (g *groupTest) beginRenderPass(cb VkCommandBuffer, rp VkRenderPass, fb VkFramebuffer) {
+	info := g.s.AllocDataOrPanic(g.ctx, NewVkRenderPassBeginInfo(
+		VkStructureType_VK_STRUCTURE_TYPE_RENDER_PASS_BEGIN_INFO, // sType
+		0,  // pNext
+		rp, // renderPass
+		fb, // framebuffer
+		NewVkRect2D( // renderArea
+			NewVkOffset2D(0, 0),
+			NewVkExtent2D(64, 64),
+		),
+		0, // clearValueCount
+		0, // pClearValues
+	))
+	g.add(g.cb.VkCmdBeginRenderPass(cb, info.Ptr(), VkSubpassContents_VK_SUBPASS_CONTENTS_INLINE).AddRead(info.Data()))
+}
+
+func (g *groupTest) nextSubpass(cb VkCommandBuffer) {
+	g.add(g.cb.VkCmdNextSubpass(cb, VkSubpassContents_VK_SUBPASS_CONTENTS_INLINE))
+}
+
+func (g *groupTest) endRenderPass(cb VkCommandBuffer) {
+	g.add(g.cb.VkCmdEndRenderPass(cb))
+}
+
+func (g *groupTest) bindPipeline(cb VkCommandBuffer, p VkPipeline) {
+	g.add(g.cb.VkCmdBindPipeline(cb, VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS, p))
+}
+
+func (g *groupTest) submit(cbs ...VkCommandBuffer) {
+	if len(cbs) == 0 {
+		g.add(g.cb.VkQueueSubmit(1, 0, memory.Nullptr, 0, VkResult_VK_SUCCESS))
+		return
+	}
+	buffers := g.s.AllocDataOrPanic(g.ctx, cbs)
+	info := g.s.AllocDataOrPanic(g.ctx, NewVkSubmitInfo(
+		VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+		0,                                   // pNext
+		0,                                   // waitSemaphoreCount
+		0,                                   // pWaitSemaphores
+		0,                                   // pWaitDstStageMask
+		uint32(len(cbs)),                    // commandBufferCount
+		NewVkCommandBufferᶜᵖ(buffers.Ptr()), // pCommandBuffers
+		0,                                   // signalSemaphoreCount
+		0,                                   // pSignalSemaphores
+	))
+	g.add(g.cb.VkQueueSubmit(1, 1, info.Ptr(), 0, VkResult_VK_SUCCESS).
+		AddRead(info.Data()).
+		AddRead(buffers.Data()))
+}
+
+func (g *groupTest) present() {
+	g.add(g.cb.VkQueuePresentKHR(1, memory.Nullptr, VkResult_VK_SUCCESS))
+}
+
+// run processes the commands with the grouper and returns its groups. All
+// the groups must fit in a single tree.
+func (g *groupTest) run(grouper cmdgrouper.Grouper) []cmdgrouper.Group {
+	for i, cmd := range g.cmds {
+		cmd.Extras().Observations().ApplyReads(g.s.Memory.ApplicationPool())
+		grouper.Process(g.ctx, api.CmdID(i), cmd, g.s)
+	}
+	out := grouper.Build(api.CmdID(len(g.cmds)))
+	root := api.CmdIDGroup{Range: api.CmdIDRange{End: api.CmdID(len(g.cmds))}}
+	for _, l := range out {
+		_, err := root.AddGroup(l.Start, l.End, l.Name)
+		assert.For(g.ctx, "AddGroup %v", l.Name).ThatError(err).Succeeded()
+	}
+	return out
+}
+
+func TestRenderPassAndPipelineGroupers(t *testing.T) {
+	g := newGroupTest(t)
+	g.begin(1)                 // 0
+	g.bindPipeline(1, 5)       // 1
+	g.beginRenderPass(1, 8, 9) // 2
+	g.draw(1)                  // 3
+	g.nextSubpass(1)           // 4
+	g.draw(1)                  // 5
+	g.endRenderPass(1)         // 6
+	g.bindPipeline(1, 6)       // 7, without draws
+	g.bindPipeline(1, 7)       // 8
+	g.beginRenderPass(1, 8, 9) // 9
+	g.draw(1)                  // 10
+	g.endRenderPass(1)         // 11
+	g.end(1)                   // 12
+
+	pass := fmt.Sprintf("Render Pass: %v", VkRenderPass(8))
+	assert.For(g.ctx, "render passes").ThatSlice(g.run(&renderPassGrouper{})).Equals([]cmdgrouper.Group{
+		{Start: 2, End: 4, Name: "Subpass 0"},
+		{Start: 4, End: 7, Name: "Subpass 1"},
+		{Start: 2, End: 7, Name: pass},
+		{Start: 9, End: 12, Name: pass},
+	})
+
+	pipeline := func(p VkPipeline) string { return fmt.Sprintf("Pipeline: %v", p) }
+	assert.For(g.ctx, "pipelines").ThatSlice(g.run(&pipelineGrouper{})).Equals([]cmdgrouper.Group{
+		{Start: 3, End: 4, Name: pipeline(5)},
+		{Start: 5, End: 6, Name: pipeline(5)},
+		{Start: 10, End: 11, Name: pipeline(7)},
+	})
+}
+
+func TestCommandBufferGrouper(t *testing.T) {
+	g := newGroupTest(t)
+	// Recorded in a previous frame.
+	g.begin(1)  // 0
+	g.draw(1)   // 1
+	g.end(1)    // 2
+	g.present() // 3
+	g.submit(1) // 4
+	// Recorded in the same frame, then reused.
+	g.begin(2)  // 5
+	g.draw(2)   // 6
+	g.end(2)    // 7
+	g.submit(2) // 8
+	g.submit(2) // 9
+	// Interleaved recordings.
+	g.begin(3)  // 10
+	g.begin(4)  // 11
+	g.end(3)    // 12
+	g.submit(3) // 13
+	g.end(4)    // 14
+	g.submit(4) // 15
+	// Several command buffers.
+	g.begin(5)     // 16
+	g.end(5)       // 17
+	g.begin(6)     // 18
+	g.end(6)       // 19
+	g.submit(5, 6) // 20
+	// No command buffers.
+	g.submit() // 21
+	// Recorded in the initial state.
+	g.submit(7) // 22
+
+	buffer := func(cb VkCommandBuffer) string { return fmt.Sprintf("Command Buffer: %v", cb) }
+	submit := func(cb VkCommandBuffer) string { return fmt.Sprintf("Submit: %v", cb) }
+	assert.For(g.ctx, "groups").ThatSlice(g.run(&commandBufferGrouper{})).Equals([]cmdgrouper.Group{
+		{Start: 0, End: 3, Name: buffer(1)},
+		{Start: 4, End: 5, Name: submit(1)},
+		{Start: 5, End: 8, Name: buffer(2)},
+		{Start: 5, End: 9, Name: submit(2)},
+		{Start: 9, End: 10, Name: submit(2)},
+		{Start: 13, End: 14, Name: submit(3)},
+		{Start: 11, End: 15, Name: buffer(4)},
+		{Start: 11, End: 16, Name: submit(4)},
+		{Start: 16, End: 18, Name: buffer(5)},
+		{Start: 18, End: 20, Name: buffer(6)},
+		{Start: 16, End: 21, Name: fmt.Sprintf("Submit: %v, %v", VkCommandBuffer(5), VkCommandBuffer(6))},
+		{Start: 21, End: 22, Name: "Submit"},
+		{Start: 22, End: 23, Name: submit(7)},
+	})
+}
@@ -229,22 +229,18 @@ func storeOp2LoadStoreOp(storeOp VkAttachmentStoreOp) api.LoadStoreOp {
 }
 
 func newFramegraphAttachment(desc VkAttachmentDescription, state *State, imgView ImageViewObjectʳ, isDepthStencil bool) *api.FramegraphAttachment {
-	var loadOp VkAttachmentLoadOp
-	var storeOp VkAttachmentStoreOp
-	if isDepthStencil {
-		loadOp = desc.StencilLoadOp()
-		storeOp = desc.StencilStoreOp()
-	} else {
-		loadOp = desc.LoadOp()
-		storeOp = desc.StoreOp()
-	}
 	imgObj := imgView.Image()
-	return &api.FramegraphAttachment{
-		LoadOp:          loadOp2LoadStoreOp(loadOp),
-		StoreOp:         storeOp2LoadStoreOp(storeOp),
+	att := &api.FramegraphAttachment{
+		LoadOp:          loadOp2LoadStoreOp(desc.LoadOp()),
+		StoreOp:         storeOp2LoadStoreOp(desc.StoreOp()),
 		ImageViewHandle: uint64(imgView.VulkanHandle()),
 		Image:           newFramegraphImage(state, &imgObj),
 	}
+	if isDepthStencil {
+		att.StencilLoadOp = loadOp2LoadStoreOp(desc.StencilLoadOp())
+		att.StencilStoreOp = storeOp2LoadStoreOp(desc.StencilStoreOp())
+	}
+	return att
 }
 
 func newFramegraphSubpass(subpassDesc SubpassDescription, state *State, framebuffer FramebufferObjectʳ, renderpass RenderPassObjectʳ) *api.FramegraphSubpass {
@@ -335,6 +331,11 @@ type workloadInfo struct {
 	// deps stores the set of IDs of workloads this workload depends on
 	deps map[uint64]struct{}
 
+	// currSubpass and currSubpassDrawn are the index of the current subpass of
+	// a renderpass, and whether it has drawn yet.
+	currSubpass      int
+	currSubpassDrawn bool
+
 	// imageAccesses is a temporary set that is eventually sorted and stored in
 	// workload.ImageAccess list.
 	imageAccesses map[uint64]*api.FramegraphImageAccess
@@ -502,6 +503,42 @@ func (helpers *framegraphInfoHelpers) lookupBuffers(pool memory.PoolID, memRange
 	return buffers
 }
 
+// recordFullClears marks the attachments of the current subpass that are
+// cleared on the whole framebuffer by a vkCmdClearAttachments.
+func (helpers *framegraphInfoHelpers) recordFullClears(args VkCmdClearAttachmentsArgsʳ) {
+	renderpass := helpers.wlInfo.renderpass
+	if helpers.wlInfo.currSubpass >= len(renderpass.Subpass) {
+		return
+	}
+	fullRect := false
+	for _, rect := range args.Rects().All() {
+		if rect.Rect().Offset().X() <= 0 && rect.Rect().Offset().Y() <= 0 &&
+			int64(rect.Rect().Offset().X())+int64(rect.Rect().Extent().Width()) >= int64(renderpass.FramebufferWidth) &&
+			int64(rect.Rect().Offset().Y())+int64(rect.Rect().Extent().Height()) >= int64(renderpass.FramebufferHeight) &&
+			rect.BaseArrayLayer() == 0 && rect.LayerCount() >= renderpass.FramebufferLayers {
+			fullRect = true
+			break
+		}
+	}
+	if !fullRect {
+		return
+	}
+
+	subpass := renderpass.Subpass[helpers.wlInfo.currSubpass]
+	for _, clear := range args.Attachments().All() {
+		aspect := uint32(clear.AspectMask())
+		if aspect&uint32(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT) != 0 {
+			idx := int(clear.ColorAttachment())
+			if idx < len(subpass.Color) && subpass.Color[idx] != nil {
+				subpass.Color[idx].FullyCleared = true
+			}
+		}
+		if aspect&uint32(VkImageAspectFlagBits_VK_IMAGE_ASPECT_DEPTH_BIT) != 0 && subpass.DepthStencil != nil {
+			subpass.DepthStencil.FullyCleared = true
+		}
+	}
+}
+
 // processSubCommand records framegraph information upon each subcommand.
 func (helpers *framegraphInfoHelpers) processSubCommand(ctx context.Context, dependencyGraph dependencygraph2.DependencyGraph, state *api.GlobalState, subCmdIdx api.SubCmdIdx, cmd api.Cmd, i interface{}) {
 	vkState := GetState(state)
@@ -648,6 +685,23 @@ func (helpers *framegraphInfoHelpers) processSubCommand(ctx context.Context, dep
 		}
 	}
 
+	// Track full clears of attachments before draws, within renderpasses
+	if helpers.wlInfo != nil && helpers.wlInfo.renderpass != nil {
+		switch args := cmdArgs.(type) {
+		case VkCmdNextSubpassArgsʳ:
+			helpers.wlInfo.currSubpass++
+			helpers.wlInfo.currSubpassDrawn = false
+		case VkCmdClearAttachmentsArgsʳ:
+			if !helpers.wlInfo.currSubpassDrawn {
+				helpers.recordFullClears(args)
+			}
+		case VkCmdDrawArgsʳ, VkCmdDrawIndexedArgsʳ, VkCmdDrawIndirectArgsʳ, VkCmdDrawIndexedIndirectArgsʳ,
+			VkCmdDrawIndirectCountKHRArgsʳ, VkCmdDrawIndexedIndirectCountKHRArgsʳ,
+			VkCmdDrawIndirectCountAMDArgsʳ, VkCmdDrawIndexedIndirectCountAMDArgsʳ:
+			helpers.wlInfo.currSubpassDrawn = true
+		}
+	}
+
 	// Ending of a workload
 	switch cmdArgs.(type) {
 
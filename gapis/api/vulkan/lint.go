@@ -0,0 +1,268 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// Interface compliance test
+var (
+	_ = api.Linter(API{})
+)
+
+// The Vulkan lint rules.
+const (
+	lintRedundantBind         = "redundant-bind"
+	lintPerDrawDescriptorSets = "per-draw-descriptor-sets"
+	lintTinyAllocations       = "tiny-allocations"
+	lintQueueWaitIdle         = "queue-wait-idle"
+	lintFullPipelineBarrier   = "full-pipeline-barrier"
+	lintGeneralLayout         = "general-layout"
+)
+
+var lintRules = []string{
+	lintRedundantBind,
+	lintPerDrawDescriptorSets,
+	lintTinyAllocations,
+	lintQueueWaitIdle,
+	lintFullPipelineBarrier,
+	lintGeneralLayout,
+}
+
+const (
+	// tinyAllocationSize is the size under which a device memory allocation
+	// is considered tiny.
+	tinyAllocationSize = 256 * 1024
+	// tinyAllocationCount is the number of tiny allocations from which the
+	// tiny-allocations rule reports an issue.
+	tinyAllocationCount = 32
+)
+
+// LintRules implements the api.Linter interface.
+func (API) LintRules() []string {
+	return lintRules
+}
+
+// NewLintPass implements the api.Linter interface.
+func (API) NewLintPass(ctx context.Context, rules []string) (api.LintPass, error) {
+	l := &linter{
+		enabled:       map[string]bool{},
+		commandBuffer: map[VkCommandBuffer]*lintCommandBuffer{},
+	}
+	if len(rules) == 0 {
+		rules = lintRules
+	}
+	for _, rule := range rules {
+		known := false
+		for _, r := range lintRules {
+			known = known || r == rule
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown Vulkan lint rule '%v'", rule)
+		}
+		l.enabled[rule] = true
+	}
+	return l, nil
+}
+
+// boundDescriptorSet is a descriptor set bound to a command buffer.
+type boundDescriptorSet struct {
+	layout  VkPipelineLayout
+	set     VkDescriptorSet
+	offsets string
+}
+
+// lintCommandBuffer is the state of a command buffer tracked by the linter,
+// since the command buffer began recording.
+type lintCommandBuffer struct {
+	recording bool
+	draws     int
+	pipelines map[VkPipelineBindPoint]VkPipeline
+	sets      map[VkPipelineBindPoint]map[uint32]boundDescriptorSet
+}
+
+// linter implements api.LintPass for Vulkan.
+type linter struct {
+	enabled       map[string]bool
+	commandBuffer map[VkCommandBuffer]*lintCommandBuffer
+	// inFrame is true once the first frame has been presented.
+	inFrame bool
+	// tinyAllocations and firstTinyAllocation track the device memory
+	// allocations smaller than tinyAllocationSize.
+	tinyAllocations     uint64
+	firstTinyAllocation api.CmdID
+}
+
+func (l *linter) issue(rule string, id api.CmdID, issues []api.LintIssue, m *stringtable.Msg) []api.LintIssue {
+	if !l.enabled[rule] {
+		return issues
+	}
+	return append(issues, api.LintIssue{
+		Rule:     rule,
+		Command:  id,
+		Severity: log.Warning,
+		Message:  m,
+	})
+}
+
+func (l *linter) recordingCommandBuffer(cb VkCommandBuffer) *lintCommandBuffer {
+	b, ok := l.commandBuffer[cb]
+	if !ok {
+		b = &lintCommandBuffer{}
+		l.commandBuffer[cb] = b
+	}
+	return b
+}
+
+// PostCmd implements the api.LintPass interface.
+func (l *linter) PostCmd(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) []api.LintIssue {
+	issues := []api.LintIssue{}
+	st := GetState(s)
+
+	switch cmd := cmd.(type) {
+	case *VkBeginCommandBuffer:
+		l.commandBuffer[cmd.CommandBuffer()] = &lintCommandBuffer{
+			recording: true,
+			pipelines: map[VkPipelineBindPoint]VkPipeline{},
+			sets:      map[VkPipelineBindPoint]map[uint32]boundDescriptorSet{},
+		}
+
+	case *VkEndCommandBuffer:
+		l.recordingCommandBuffer(cmd.CommandBuffer()).recording = false
+
+	case *VkResetCommandBuffer:
+		delete(l.commandBuffer, cmd.CommandBuffer())
+
+	case *VkCmdBindPipeline:
+		b := l.recordingCommandBuffer(cmd.CommandBuffer())
+		if b.pipelines == nil {
+			break
+		}
+		if p, ok := b.pipelines[cmd.PipelineBindPoint()]; ok && p == cmd.Pipeline() {
+			issues = l.issue(lintRedundantBind, id, issues, messages.WarnLintRedundantPipelineBind())
+		}
+		b.pipelines[cmd.PipelineBindPoint()] = cmd.Pipeline()
+
+	case *VkCmdBindDescriptorSets:
+		b := l.recordingCommandBuffer(cmd.CommandBuffer())
+		args, ok := lastRecordedArgs(ctx, st, cmd.CommandBuffer()).(VkCmdBindDescriptorSetsArgsʳ)
+		if b.sets == nil || !ok {
+			break
+		}
+		bound, ok := b.sets[args.PipelineBindPoint()]
+		if !ok {
+			bound = map[uint32]boundDescriptorSet{}
+			b.sets[args.PipelineBindPoint()] = bound
+		}
+		// Dynamic offsets are consumed in order by the dynamic bindings of
+		// the sets, so compare all of them for each set.
+		offsets := fmt.Sprint(args.DynamicOffsets().All())
+		redundant := args.DescriptorSets().Len() > 0
+		for i, set := range args.DescriptorSets().All() {
+			d := boundDescriptorSet{args.Layout(), set, offsets}
+			if bound[args.FirstSet()+i] != d {
+				redundant = false
+			}
+			bound[args.FirstSet()+i] = d
+		}
+		if redundant {
+			issues = l.issue(lintRedundantBind, id, issues, messages.WarnLintRedundantDescriptorSetsBind())
+		}
+
+	case *VkCmdDraw, *VkCmdDrawIndexed, *VkCmdDrawIndirect, *VkCmdDrawIndexedIndirect:
+		cb := cmd.(recordingCmd).CommandBuffer()
+		l.recordingCommandBuffer(cb).draws++
+
+	case *VkAllocateDescriptorSets:
+		for _, b := range l.commandBuffer {
+			if b.recording && b.draws > 0 {
+				issues = l.issue(lintPerDrawDescriptorSets, id, issues, messages.WarnLintPerDrawDescriptorSets())
+				break
+			}
+		}
+
+	case *VkAllocateMemory:
+		mem, err := cmd.PMemory().Read(ctx, cmd, s, nil)
+		if err != nil || !st.DeviceMemories().Contains(mem) {
+			break
+		}
+		if st.DeviceMemories().Get(mem).AllocationSize() < tinyAllocationSize {
+			if l.tinyAllocations == 0 {
+				l.firstTinyAllocation = id
+			}
+			l.tinyAllocations++
+		}
+
+	case *VkQueuePresentKHR:
+		l.inFrame = true
+
+	case *VkQueueWaitIdle, *VkDeviceWaitIdle:
+		if l.inFrame {
+			issues = l.issue(lintQueueWaitIdle, id, issues, messages.WarnLintWaitIdleInFrame())
+		}
+
+	case *VkCmdPipelineBarrier:
+		all := VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT)
+		if cmd.SrcStageMask()&all != 0 && cmd.DstStageMask()&all != 0 {
+			issues = l.issue(lintFullPipelineBarrier, id, issues, messages.WarnLintFullPipelineBarrier())
+		}
+		args, ok := lastRecordedArgs(ctx, st, cmd.CommandBuffer()).(VkCmdPipelineBarrierArgsʳ)
+		if !ok {
+			break
+		}
+		storage := VkImageUsageFlags(VkImageUsageFlagBits_VK_IMAGE_USAGE_STORAGE_BIT)
+		for _, barrier := range args.ImageMemoryBarriers().All() {
+			if barrier.NewLayout() != VkImageLayout_VK_IMAGE_LAYOUT_GENERAL || !st.Images().Contains(barrier.Image()) {
+				continue
+			}
+			if st.Images().Get(barrier.Image()).Info().Usage()&storage == 0 {
+				issues = l.issue(lintGeneralLayout, id, issues, messages.WarnLintGeneralLayout())
+				break
+			}
+		}
+	}
+
+	return issues
+}
+
+// Flush implements the api.LintPass interface.
+func (l *linter) Flush(ctx context.Context, s *api.GlobalState) []api.LintIssue {
+	issues := []api.LintIssue{}
+	if l.tinyAllocations >= tinyAllocationCount {
+		issues = l.issue(lintTinyAllocations, l.firstTinyAllocation, issues,
+			messages.WarnLintTinyAllocations(l.tinyAllocations, tinyAllocationSize))
+	}
+	return issues
+}
+
+// lastRecordedArgs returns the arguments of the last command recorded in the
+// command buffer, or nil if there is none.
+func lastRecordedArgs(ctx context.Context, s *State, cb VkCommandBuffer) interface{} {
+	if !s.CommandBuffers().Contains(cb) {
+		return nil
+	}
+	refs := s.CommandBuffers().Get(cb).CommandReferences()
+	if refs.Len() == 0 {
+		return nil
+	}
+	return GetCommandArgs(ctx, refs.Get(uint32(refs.Len()-1)), s)
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+)
+
+type lintResult struct {
+	rule string
+	cmd  api.CmdID
+}
+
+// lintTest runs a lint pass over the commands built by the test. The state
+// the lint pass reads is set up by the test, in place of the mutation of the
+// commands.
+type lintTest struct {
+	ctx  context.Context
+	s    *api.GlobalState
+	cb   CommandBuilder
+	pass api.LintPass
+	id   api.CmdID
+	out  []lintResult
+}
+
+func newLintTest(ctx context.Context, rules ...string) *lintTest {
+	pass, err := API{}.NewLintPass(ctx, rules)
+	assert.For(ctx, "NewLintPass").ThatError(err).Succeeded()
+	return &lintTest{ctx: ctx, s: api.NewStateWithEmptyAllocator(device.Little64), pass: pass}
+}
+
+func (l *lintTest) add(issues []api.LintIssue) {
+	for _, i := range issues {
+		l.out = append(l.out, lintResult{i.Rule, i.Command})
+	}
+}
+
+func (l *lintTest) run(cmd api.Cmd) {
+	cmd.Extras().Observations().ApplyReads(l.s.Memory.ApplicationPool())
+	cmd.Extras().Observations().ApplyWrites(l.s.Memory.ApplicationPool())
+	l.add(l.pass.PostCmd(l.ctx, l.id, cmd, l.s))
+	l.id++
+}
+
+func (l *lintTest) flush() []lintResult {
+	l.add(l.pass.Flush(l.ctx, l.s))
+	return l.out
+}
+
+func (l *lintTest) commandBuffer(cb VkCommandBuffer) CommandBufferObjectʳ {
+	st := GetState(l.s)
+	if !st.CommandBuffers().Contains(cb) {
+		o := MakeCommandBufferObjectʳ()
+		o.SetVulkanHandle(cb)
+		st.CommandBuffers().Add(cb, o)
+	}
+	return st.CommandBuffers().Get(cb)
+}
+
+// record adds the reference to a command recorded in the command buffer.
+func (l *lintTest) record(cb VkCommandBuffer, ty CommandType, index uint32) {
+	refs := l.commandBuffer(cb).CommandReferences()
+	ref := MakeCommandReferenceʳ()
+	ref.SetBuffer(cb)
+	ref.SetType(ty)
+	ref.SetMapIndex(index)
+	refs.Add(uint32(refs.Len()), ref)
+}
+
+func (l *lintTest) bindDescriptorSet(cb VkCommandBuffer, set VkDescriptorSet) {
+	bindPoint := VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS
+	args := MakeVkCmdBindDescriptorSetsArgsʳ()
+	args.SetPipelineBindPoint(bindPoint)
+	args.SetLayout(1)
+	args.DescriptorSets().Add(0, set)
+	recorded := l.commandBuffer(cb).BufferCommands().VkCmdBindDescriptorSets()
+	index := uint32(recorded.Len())
+	recorded.Add(index, args)
+	l.record(cb, CommandType_cmd_vkCmdBindDescriptorSets, index)
+	l.run(l.cb.VkCmdBindDescriptorSets(cb, bindPoint, 1, 0, 1, memory.Nullptr, 0, memory.Nullptr))
+}
+
+func (l *lintTest) barrier(cb VkCommandBuffer, stages VkPipelineStageFlagBits, image VkImage) {
+	args := MakeVkCmdPipelineBarrierArgsʳ()
+	args.SetSrcStageMask(VkPipelineStageFlags(stages))
+	args.SetDstStageMask(VkPipelineStageFlags(stages))
+	if image != 0 {
+		b := MakeVkImageMemoryBarrier()
+		b.SetNewLayout(VkImageLayout_VK_IMAGE_LAYOUT_GENERAL)
+		b.SetImage(image)
+		args.ImageMemoryBarriers().Add(0, b)
+	}
+	recorded := l.commandBuffer(cb).BufferCommands().VkCmdPipelineBarrier()
+	index := uint32(recorded.Len())
+	recorded.Add(index, args)
+	l.record(cb, CommandType_cmd_vkCmdPipelineBarrier, index)
+	count := uint32(args.ImageMemoryBarriers().Len())
+	l.run(l.cb.VkCmdPipelineBarrier(cb, VkPipelineStageFlags(stages), VkPipelineStageFlags(stages), 0,
+		0, memory.Nullptr, // memoryBarriers
+		0, memory.Nullptr, // bufferMemoryBarriers
+		count, memory.Nullptr, // imageMemoryBarriers
+	))
+}
+
+func (l *lintTest) image(image VkImage, usage VkImageUsageFlagBits) {
+	o := MakeImageObjectʳ()
+	o.SetVulkanHandle(image)
+	info := o.Info()
+	info.SetUsage(VkImageUsageFlags(usage))
+	o.SetInfo(info)
+	GetState(l.s).Images().Add(image, o)
+}
+
+func (l *lintTest) allocateMemory(mem VkDeviceMemory, size VkDeviceSize) {
+	o := MakeDeviceMemoryObjectʳ()
+	o.SetVulkanHandle(mem)
+	o.SetAllocationSize(size)
+	GetState(l.s).DeviceMemories().Add(mem, o)
+	out := l.s.AllocDataOrPanic(l.ctx, mem)
+	l.run(l.cb.VkAllocateMemory(1, memory.Nullptr, memory.Nullptr, out.Ptr(), VkResult_VK_SUCCESS).AddWrite(out.Data()))
+}
+
+// lintCommands builds commands triggering each of the Vulkan lint rules.
+func lintCommands(l *lintTest) []lintResult {
+	var (
+		graphics       = VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS
+		allCommands    = VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT
+		fragmentShader = VkPipelineStageFlagBits_VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT
+		success        = VkResult_VK_SUCCESS
+	)
+	l.image(3, VkImageUsageFlagBits_VK_IMAGE_USAGE_SAMPLED_BIT)
+
+	l.run(l.cb.VkBeginCommandBuffer(1, memory.Nullptr, success))                     // 0
+	l.run(l.cb.VkCmdBindPipeline(1, graphics, 5))                                    // 1
+	l.run(l.cb.VkCmdBindPipeline(1, graphics, 5))                                    // 2
+	l.bindDescriptorSet(1, 7)                                                        // 3
+	l.bindDescriptorSet(1, 7)                                                        // 4
+	l.run(l.cb.VkCmdDraw(1, 3, 1, 0, 0))                                             // 5
+	l.run(l.cb.VkAllocateDescriptorSets(1, memory.Nullptr, memory.Nullptr, success)) // 6
+	l.barrier(1, allCommands, 0)                                                     // 7
+	l.barrier(1, fragmentShader, 3)                                                  // 8
+	l.run(l.cb.VkEndCommandBuffer(1, success))                                       // 9
+	l.run(l.cb.VkQueuePresentKHR(1, memory.Nullptr, success))                        // 10
+	l.run(l.cb.VkQueueWaitIdle(1, success))                                          // 11
+	for i := 0; i < tinyAllocationCount; i++ {
+		l.allocateMemory(VkDeviceMemory(100+i), 4096) // 12 onwards
+	}
+	return l.flush()
+}
+
+func TestLintRules(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	assert.For(ctx, "issues").ThatSlice(lintCommands(newLintTest(ctx))).Equals([]lintResult{
+		{lintRedundantBind, 2},
+		{lintRedundantBind, 4},
+		{lintPerDrawDescriptorSets, 6},
+		{lintFullPipelineBarrier, 7},
+		{lintGeneralLayout, 8},
+		{lintQueueWaitIdle, 11},
+		{lintTinyAllocations, 12},
+	})
+}
+
+func TestLintDisabledRules(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	l := newLintTest(ctx, lintQueueWaitIdle, lintGeneralLayout)
+	assert.For(ctx, "issues").ThatSlice(lintCommands(l)).Equals([]lintResult{
+		{lintGeneralLayout, 8},
+		{lintQueueWaitIdle, 11},
+	})
+}
+
+func TestLintUnknownRule(t *testing.T) {
+	ctx := log.Testing(t)
+	_, err := API{}.NewLintPass(ctx, []string{lintRedundantBind, "unknown-rule"})
+	assert.For(ctx, "NewLintPass").ThatError(err).Failed()
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+)
+
+// Interface compliance test
+var (
+	_ = api.MemoryTimelineProvider(API{})
+)
+
+type memoryHeapKey struct {
+	device VkDevice
+	index  uint32
+}
+
+// memoryTimelineRecorder implements api.MemoryTimelineRecorder for Vulkan.
+type memoryTimelineRecorder struct {
+	// allocations are the live allocations, with the event that allocated
+	// them.
+	allocations map[VkDeviceMemory]*api.MemoryEvent
+	// bound are the objects bound to the live allocations.
+	bound map[VkDeviceMemory]map[uint64]VkDeviceSize
+	heaps map[memoryHeapKey]*api.MemoryHeap
+}
+
+// NewMemoryTimelineRecorder implements the api.MemoryTimelineProvider
+// interface.
+func (API) NewMemoryTimelineRecorder() api.MemoryTimelineRecorder {
+	return &memoryTimelineRecorder{
+		allocations: map[VkDeviceMemory]*api.MemoryEvent{},
+		bound:       map[VkDeviceMemory]map[uint64]VkDeviceSize{},
+		heaps:       map[memoryHeapKey]*api.MemoryHeap{},
+	}
+}
+
+// Initial implements the api.MemoryTimelineRecorder interface.
+func (r *memoryTimelineRecorder) Initial(ctx context.Context, s *api.GlobalState) []*api.MemoryEvent {
+	st := GetState(s)
+	handles := []VkDeviceMemory{}
+	for handle := range st.DeviceMemories().All() {
+		handles = append(handles, handle)
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+
+	events := []*api.MemoryEvent{}
+	for _, handle := range handles {
+		if e := r.allocate(st, handle); e != nil {
+			events = append(events, e)
+			events = append(events, r.bind(ctx, s, handle)...)
+		}
+	}
+	return events
+}
+
+// PostCmd implements the api.MemoryTimelineRecorder interface.
+func (r *memoryTimelineRecorder) PostCmd(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) []*api.MemoryEvent {
+	st := GetState(s)
+	switch cmd := cmd.(type) {
+	case *VkAllocateMemory:
+		handle, err := cmd.PMemory().Read(ctx, cmd, s, nil)
+		if err != nil {
+			return nil
+		}
+		if e := r.allocate(st, handle); e != nil {
+			return []*api.MemoryEvent{e}
+		}
+
+	case *VkFreeMemory:
+		alloc, ok := r.allocations[cmd.Memory()]
+		if !ok {
+			return nil
+		}
+		delete(r.allocations, cmd.Memory())
+		delete(r.bound, cmd.Memory())
+		return []*api.MemoryEvent{{
+			Kind:       api.MemoryEvent_FREE,
+			Device:     alloc.Device,
+			Heap:       alloc.Heap,
+			MemoryType: alloc.MemoryType,
+			Allocation: alloc.Allocation,
+			Size:       alloc.Size,
+		}}
+
+	case *VkBindBufferMemory:
+		return r.bind(ctx, s, cmd.Memory())
+
+	case *VkBindImageMemory:
+		return r.bind(ctx, s, cmd.Memory())
+
+	case *VkBindBufferMemory2, *VkBindBufferMemory2KHR, *VkBindImageMemory2, *VkBindImageMemory2KHR:
+		events := []*api.MemoryEvent{}
+		for _, handle := range boundMemories(ctx, cmd, s) {
+			events = append(events, r.bind(ctx, s, handle)...)
+		}
+		return events
+	}
+	return nil
+}
+
+// Heaps implements the api.MemoryTimelineRecorder interface.
+func (r *memoryTimelineRecorder) Heaps() []*api.MemoryHeap {
+	heaps := make([]*api.MemoryHeap, 0, len(r.heaps))
+	for _, heap := range r.heaps {
+		heaps = append(heaps, heap)
+	}
+	sort.Slice(heaps, func(i, j int) bool {
+		if heaps[i].Device != heaps[j].Device {
+			return heaps[i].Device < heaps[j].Device
+		}
+		return heaps[i].Index < heaps[j].Index
+	})
+	return heaps
+}
+
+// allocate records the allocation of the device memory, and returns its
+// event, or nil if the allocation does not exist.
+func (r *memoryTimelineRecorder) allocate(st *State, handle VkDeviceMemory) *api.MemoryEvent {
+	mem, ok := st.DeviceMemories().Lookup(handle)
+	if !ok {
+		return nil
+	}
+	heapIndex := uint32(0)
+	if dev, ok := st.Devices().Lookup(mem.Device()); ok {
+		if phyDev, ok := st.PhysicalDevices().Lookup(dev.PhysicalDevice()); ok {
+			props := phyDev.MemoryProperties()
+			if mem.MemoryTypeIndex() < props.MemoryTypeCount() {
+				heapIndex = props.MemoryTypes().Get(int(mem.MemoryTypeIndex())).HeapIndex()
+			}
+			key := memoryHeapKey{mem.Device(), heapIndex}
+			if _, ok := r.heaps[key]; !ok && heapIndex < props.MemoryHeapCount() {
+				heap := props.MemoryHeaps().Get(int(heapIndex))
+				r.heaps[key] = &api.MemoryHeap{
+					Device: uint64(mem.Device()),
+					Index:  heapIndex,
+					Size:   uint64(heap.Size()),
+					Flags:  uint32(heap.Flags()),
+				}
+			}
+		}
+	}
+
+	e := &api.MemoryEvent{
+		Kind:       api.MemoryEvent_ALLOCATE,
+		Device:     uint64(mem.Device()),
+		Heap:       heapIndex,
+		MemoryType: mem.MemoryTypeIndex(),
+		Allocation: uint64(handle),
+		Size:       uint64(mem.AllocationSize()),
+	}
+	r.allocations[handle] = e
+	r.bound[handle] = map[uint64]VkDeviceSize{}
+	return e
+}
+
+// bind returns the events of the objects newly bound to the device memory.
+func (r *memoryTimelineRecorder) bind(ctx context.Context, s *api.GlobalState, handle VkDeviceMemory) []*api.MemoryEvent {
+	st := GetState(s)
+	alloc, ok := r.allocations[handle]
+	mem, found := st.DeviceMemories().Lookup(handle)
+	if !ok || !found {
+		return nil
+	}
+	objects := []uint64{}
+	for object := range mem.BoundObjects().All() {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i] < objects[j] })
+
+	events := []*api.MemoryEvent{}
+	for _, object := range objects {
+		offset := mem.BoundObjects().Get(object)
+		if prev, ok := r.bound[handle][object]; ok && prev == offset {
+			continue
+		}
+		r.bound[handle][object] = offset
+		e := &api.MemoryEvent{
+			Kind:       api.MemoryEvent_BIND,
+			Device:     alloc.Device,
+			Heap:       alloc.Heap,
+			MemoryType: alloc.MemoryType,
+			Allocation: alloc.Allocation,
+			Resource:   object,
+			Offset:     uint64(offset),
+		}
+		if buffer, ok := st.Buffers().Lookup(VkBuffer(object)); ok {
+			e.Size = uint64(buffer.Info().Size())
+		} else if image, ok := st.Images().Lookup(VkImage(object)); ok {
+			memInfo, _ := subGetImagePlaneMemoryInfo(ctx, nil, api.CmdNoID, nil, s, st, 0, nil, nil, image, VkImageAspectFlagBits(0))
+			e.Size = uint64(memInfo.MemoryRequirements().Size())
+			e.Image = true
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// boundMemories returns the device memories of the bind infos of a
+// vkBind*Memory2 command.
+func boundMemories(ctx context.Context, cmd api.Cmd, s *api.GlobalState) []VkDeviceMemory {
+	handles := []VkDeviceMemory{}
+	switch cmd := cmd.(type) {
+	case *VkBindBufferMemory2:
+		infos, _ := cmd.PBindInfos().Slice(0, uint64(cmd.BindInfoCount()), s.MemoryLayout).Read(ctx, cmd, s, nil)
+		for _, info := range infos {
+			handles = append(handles, info.Memory())
+		}
+	case *VkBindBufferMemory2KHR:
+		infos, _ := cmd.PBindInfos().Slice(0, uint64(cmd.BindInfoCount()), s.MemoryLayout).Read(ctx, cmd, s, nil)
+		for _, info := range infos {
+			handles = append(handles, info.Memory())
+		}
+	case *VkBindImageMemory2:
+		infos, _ := cmd.PBindInfos().Slice(0, uint64(cmd.BindInfoCount()), s.MemoryLayout).Read(ctx, cmd, s, nil)
+		for _, info := range infos {
+			handles = append(handles, info.Memory())
+		}
+	case *VkBindImageMemory2KHR:
+		infos, _ := cmd.PBindInfos().Slice(0, uint64(cmd.BindInfoCount()), s.MemoryLayout).Read(ctx, cmd, s, nil)
+		for _, info := range infos {
+			handles = append(handles, info.Memory())
+		}
+	}
+	return handles
+}
@@ -0,0 +1,1092 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// pipelineSetting is a setting of the pipeline state, as presented by the
+// data groups of the pipeline resource.
+type pipelineSetting struct {
+	stage string
+	group string
+	name  string
+	// row is the index of the table row of the setting, or -1 for a setting
+	// of a key-value group.
+	row int
+	// current is the current table row of the setting.
+	current *api.Row
+	headers []string
+	value   *api.DataValue
+}
+
+func (s pipelineSetting) String() string {
+	if s.row >= 0 {
+		return fmt.Sprintf("%v/%v[%d]/%v", s.stage, s.group, s.row, s.name)
+	}
+	return fmt.Sprintf("%v/%v/%v", s.stage, s.group, s.name)
+}
+
+// errNotEditable returns the error for a changed setting which cannot be set
+// through the pipeline create info.
+func (s pipelineSetting) errNotEditable() error {
+	return fmt.Errorf("%v cannot be edited", s)
+}
+
+// changedPipelineSettings returns the settings of the edited pipeline whose
+// value differs from the current pipeline.
+func changedPipelineSettings(current, edited *api.Pipeline) ([]pipelineSetting, error) {
+	stages := map[string]*api.Stage{}
+	for _, stage := range current.Stages {
+		stages[stage.StageName] = stage
+	}
+
+	changed := []pipelineSetting{}
+	for _, stage := range edited.Stages {
+		currentStage, ok := stages[stage.StageName]
+		if !ok {
+			return nil, fmt.Errorf("The pipeline has no %v stage", stage.StageName)
+		}
+		groups := map[string]*api.DataGroup{}
+		for _, group := range currentStage.Groups {
+			groups[group.GroupName] = group
+		}
+
+		for _, group := range stage.Groups {
+			currentGroup, ok := groups[group.GroupName]
+			if !ok {
+				return nil, fmt.Errorf("The %v stage has no %v group", stage.StageName, group.GroupName)
+			}
+			switch data := group.Data.(type) {
+			case *api.DataGroup_KeyValues:
+				currentData, ok := currentGroup.Data.(*api.DataGroup_KeyValues)
+				if !ok {
+					return nil, fmt.Errorf("%v/%v is not a list of values", stage.StageName, group.GroupName)
+				}
+				pairs := map[string]*api.KeyValuePair{}
+				for _, pair := range currentData.KeyValues.KeyValues {
+					pairs[pair.Name] = pair
+				}
+				for _, pair := range data.KeyValues.KeyValues {
+					setting := pipelineSetting{stage: stage.StageName, group: group.GroupName, name: pair.Name, row: -1, value: pair.Value}
+					currentPair, ok := pairs[pair.Name]
+					if !ok {
+						return nil, fmt.Errorf("Unknown pipeline setting %v", setting)
+					}
+					if proto.Equal(pair.Value, currentPair.Value) {
+						continue
+					}
+					if currentPair.Dynamic {
+						return nil, fmt.Errorf("%v is dynamic state, set by commands rather than by the pipeline", setting)
+					}
+					changed = append(changed, setting)
+				}
+
+			case *api.DataGroup_Table:
+				currentData, ok := currentGroup.Data.(*api.DataGroup_Table)
+				if !ok {
+					return nil, fmt.Errorf("%v/%v is not a table", stage.StageName, group.GroupName)
+				}
+				currentTable := currentData.Table
+				if len(data.Table.Rows) > len(currentTable.Rows) {
+					return nil, fmt.Errorf("%v/%v has %v rows, got %v", stage.StageName, group.GroupName,
+						len(currentTable.Rows), len(data.Table.Rows))
+				}
+				for i, row := range data.Table.Rows {
+					currentRow := currentTable.Rows[i]
+					if len(row.RowValues) > len(currentRow.RowValues) {
+						return nil, fmt.Errorf("%v/%v has %v columns, got %v", stage.StageName, group.GroupName,
+							len(currentRow.RowValues), len(row.RowValues))
+					}
+					for j, value := range row.RowValues {
+						if proto.Equal(value, currentRow.RowValues[j]) {
+							continue
+						}
+						setting := pipelineSetting{
+							stage:   stage.StageName,
+							group:   group.GroupName,
+							name:    currentTable.Headers[j],
+							row:     i,
+							current: currentRow,
+							headers: currentTable.Headers,
+							value:   value,
+						}
+						if currentTable.Dynamic {
+							return nil, fmt.Errorf("%v is dynamic state, set by commands rather than by the pipeline", setting)
+						}
+						changed = append(changed, setting)
+					}
+				}
+
+			case *api.DataGroup_Shader:
+				currentData, ok := currentGroup.Data.(*api.DataGroup_Shader)
+				if !ok || !proto.Equal(data.Shader, currentData.Shader) {
+					return nil, fmt.Errorf("The code of the %v is set through its shader module resource, not the pipeline", stage.StageName)
+				}
+			}
+		}
+	}
+	return changed, nil
+}
+
+// pod returns the plain value of the setting.
+func (s pipelineSetting) pod() (interface{}, error) {
+	v, ok := s.value.Val.(*api.DataValue_Value)
+	if !ok {
+		return nil, fmt.Errorf("%v expects a plain value, got %v", s, s.value)
+	}
+	return v.Value.Get(), nil
+}
+
+// podNumber returns the value of a numeric plain value.
+func podNumber(v interface{}) (float64, bool) {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(r.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return r.Float(), true
+	}
+	return 0, false
+}
+
+func (s pipelineSetting) bool32() (VkBool32, error) {
+	v, err := s.pod()
+	if err != nil {
+		return 0, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return 0, fmt.Errorf("%v expects a boolean, got %v", s, v)
+	}
+	if b {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (s pipelineSetting) f32() (float32, error) {
+	v, err := s.pod()
+	if err != nil {
+		return 0, err
+	}
+	f, ok := podNumber(v)
+	if !ok {
+		return 0, fmt.Errorf("%v expects a number, got %v", s, v)
+	}
+	return float32(f), nil
+}
+
+// f32s returns the value of an array setting of n floats.
+func (s pipelineSetting) f32s(n int) ([]float32, error) {
+	v, err := s.pod()
+	if err != nil {
+		return nil, err
+	}
+	r := reflect.ValueOf(v)
+	if r.Kind() != reflect.Slice || r.Len() != n {
+		return nil, fmt.Errorf("%v expects %v numbers, got %v", s, n, v)
+	}
+	out := make([]float32, n)
+	for i := range out {
+		f, ok := podNumber(r.Index(i).Interface())
+		if !ok {
+			return nil, fmt.Errorf("%v expects %v numbers, got %v", s, n, v)
+		}
+		out[i] = float32(f)
+	}
+	return out, nil
+}
+
+// u32 returns the value of an unsigned integer setting. Strings are parsed as
+// hexadecimal numbers, as masks are presented.
+func (s pipelineSetting) u32() (uint32, error) {
+	v, err := s.pod()
+	if err != nil {
+		return 0, err
+	}
+	if str, ok := v.(string); ok {
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(str), "0x"), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%v expects a hexadecimal mask: %v", s, err)
+		}
+		return uint32(n), nil
+	}
+	f, ok := podNumber(v)
+	if !ok || f < 0 || f > math.MaxUint32 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%v expects an unsigned 32-bit integer, got %v", s, v)
+	}
+	return uint32(f), nil
+}
+
+// constant returns the value of the named constant of the constant set.
+func (s pipelineSetting) constant(typeName, name string, constants int32) (uint32, error) {
+	v, ok := api.ConstantValue(typeName, strings.TrimSpace(name), constants, API{})
+	if !ok {
+		return 0, fmt.Errorf("%v: unknown %v value %v", s, typeName, name)
+	}
+	return uint32(v), nil
+}
+
+// enum returns the value of an enum setting, given either by name or by value.
+func (s pipelineSetting) enum(typeName string, constants int32) (uint32, error) {
+	switch v := s.value.Val.(type) {
+	case *api.DataValue_EnumVal:
+		if v.EnumVal.StringValue == "" {
+			return uint32(v.EnumVal.Value), nil
+		}
+		return s.constant(typeName, v.EnumVal.StringValue, constants)
+	case *api.DataValue_Value:
+		if name, ok := v.Value.Get().(string); ok {
+			return s.constant(typeName, name, constants)
+		}
+		if f, ok := podNumber(v.Value.Get()); ok {
+			return uint32(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%v expects a %v value, got %v", s, typeName, s.value)
+}
+
+// bits returns the value of a bitfield setting, given either by the names of
+// its bits or by value.
+func (s pipelineSetting) bits(typeName string, constants int32) (uint32, error) {
+	names := []string{}
+	bits := uint32(0)
+	switch v := s.value.Val.(type) {
+	case *api.DataValue_Bitfield:
+		if len(v.Bitfield.SetBitnames) == 0 {
+			for _, b := range v.Bitfield.SetBits {
+				bits |= uint32(b)
+			}
+			return bits, nil
+		}
+		names = v.Bitfield.SetBitnames
+	case *api.DataValue_Value:
+		if str, ok := v.Value.Get().(string); ok {
+			names = strings.Split(str, "|")
+		} else if f, ok := podNumber(v.Value.Get()); ok {
+			return uint32(f), nil
+		} else {
+			return 0, fmt.Errorf("%v expects a %v value, got %v", s, typeName, s.value)
+		}
+	default:
+		return 0, fmt.Errorf("%v expects a %v value, got %v", s, typeName, s.value)
+	}
+	for _, name := range names {
+		b, err := s.constant(typeName, name, constants)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// currentU32 returns the current value of the column of the table row of the
+// setting.
+func (s pipelineSetting) currentU32(header string) (uint32, error) {
+	for i, h := range s.headers {
+		if h == header && i < len(s.current.RowValues) {
+			if v, ok := s.current.RowValues[i].Val.(*api.DataValue_Value); ok {
+				if f, ok := podNumber(v.Value.Get()); ok {
+					return uint32(f), nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("%v has no %v", s, header)
+}
+
+// pipelineShaderStage returns the shader stage presented as the pipeline stage
+// with the given name.
+func pipelineShaderStage(stages map[uint32]StageData, name string) (StageData, bool) {
+	for _, stage := range stages {
+		if t, err := stageType(stage.Stage()); err == nil && t+" Shader" == name {
+			return stage, true
+		}
+	}
+	return NilStageData, false
+}
+
+// specializationEdit is an edit of the specialization info of a shader stage.
+type specializationEdit struct {
+	entries []VkSpecializationMapEntry
+	data    []uint8
+}
+
+// pipelineInfoEdit is an edit of the create info of a pipeline in the command
+// creating it.
+type pipelineInfoEdit struct {
+	ctx context.Context
+	cmd api.Cmd
+	// state holds the memory observed by the command.
+	state *api.GlobalState
+	// current is the state at the command the pipeline is edited at.
+	current *api.GlobalState
+	stages  map[uint32]StageData
+	specs   map[VkShaderStageFlagBits]*specializationEdit
+	allocs  []api.AllocResult
+}
+
+func newPipelineInfoEdit(ctx context.Context, c *capture.GraphicsCapture, cmd api.Cmd, current *api.GlobalState, stages map[uint32]StageData) *pipelineInfoEdit {
+	state := c.NewState(ctx)
+	cmd.Extras().Observations().ApplyReads(state.Memory.ApplicationPool())
+	return &pipelineInfoEdit{
+		ctx:     ctx,
+		cmd:     cmd,
+		state:   state,
+		current: current,
+		stages:  stages,
+		specs:   map[VkShaderStageFlagBits]*specializationEdit{},
+	}
+}
+
+// alloc allocates the data read by the edited command.
+func (e *pipelineInfoEdit) alloc(v ...interface{}) api.AllocResult {
+	res := e.state.AllocDataOrPanic(e.ctx, v...)
+	e.allocs = append(e.allocs, res)
+	return res
+}
+
+// setSpecializationConstant sets the value of a specialization constant of
+// the shader stage of the setting.
+func (e *pipelineInfoEdit) setSpecializationConstant(s pipelineSetting, info VkPipelineShaderStageCreateInfo) error {
+	if s.name != "Value" {
+		return s.errNotEditable()
+	}
+	stage, ok := pipelineShaderStage(e.stages, s.stage)
+	if !ok {
+		return fmt.Errorf("The pipeline has no %v stage", s.stage)
+	}
+	specID, err := s.currentU32("Constant ID")
+	if err != nil {
+		return err
+	}
+	words, err := stage.Module().Words().Read(e.ctx, nil, e.current, nil)
+	if err != nil {
+		return err
+	}
+	constants, err := shadertools.ParseSpecializationConstants(words)
+	if err != nil {
+		return err
+	}
+	var constant *shadertools.SpecializationConstant
+	for i := range constants {
+		if constants[i].SpecID == specID {
+			constant = &constants[i]
+		}
+	}
+	if constant == nil {
+		return fmt.Errorf("%v: the shader has no specialization constant %v", s, specID)
+	}
+	v, err := s.pod()
+	if err != nil {
+		return err
+	}
+	literal, err := constant.ParseValue(fmt.Sprint(v))
+	if err != nil {
+		return fmt.Errorf("%v: %v", s, err)
+	}
+	value := make([]uint8, len(literal)*4)
+	for i, w := range literal {
+		binary.LittleEndian.PutUint32(value[i*4:], w)
+	}
+	if constant.Type != "bool" && constant.Width < 32 {
+		value = value[:constant.Width/8]
+	}
+
+	spec, err := e.specialization(info)
+	if err != nil {
+		return err
+	}
+	for _, entry := range spec.entries {
+		start, end := uint64(entry.Offset()), uint64(entry.Offset())+uint64(entry.Size())
+		if entry.ConstantID() == specID && int(entry.Size()) == len(value) && end <= uint64(len(spec.data)) {
+			copy(spec.data[start:end], value)
+			return nil
+		}
+	}
+	spec.entries = append(spec.entries, NewVkSpecializationMapEntry(specID, uint32(len(spec.data)), memory.Size(len(value))))
+	spec.data = append(spec.data, value...)
+	return nil
+}
+
+// specialization returns the edit of the specialization info of the shader
+// stage.
+func (e *pipelineInfoEdit) specialization(info VkPipelineShaderStageCreateInfo) (*specializationEdit, error) {
+	if spec, ok := e.specs[info.Stage()]; ok {
+		return spec, nil
+	}
+	spec := &specializationEdit{}
+	if !info.PSpecializationInfo().IsNullptr() {
+		specInfo, err := info.PSpecializationInfo().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		l := e.state.MemoryLayout
+		if spec.entries, err = specInfo.PMapEntries().Slice(0, uint64(specInfo.MapEntryCount()), l).Read(e.ctx, e.cmd, e.state, nil); err != nil {
+			return nil, err
+		}
+		if spec.data, err = U8ᵖ(specInfo.PData()).Slice(0, uint64(specInfo.DataSize()), l).Read(e.ctx, e.cmd, e.state, nil); err != nil {
+			return nil, err
+		}
+	}
+	e.specs[info.Stage()] = spec
+	return spec, nil
+}
+
+// withSpecialization returns the shader stage create info with the edited
+// specialization info of the stage.
+func (e *pipelineInfoEdit) withSpecialization(info VkPipelineShaderStageCreateInfo) VkPipelineShaderStageCreateInfo {
+	spec, ok := e.specs[info.Stage()]
+	if !ok {
+		return info
+	}
+	entries := e.alloc(spec.entries)
+	data := e.alloc(spec.data)
+	specInfo := e.alloc(NewVkSpecializationInfo(
+		uint32(len(spec.entries)),                    // mapEntryCount
+		NewVkSpecializationMapEntryᶜᵖ(entries.Ptr()), // pMapEntries
+		memory.Size(len(spec.data)),                  // dataSize
+		NewVoidᶜᵖ(data.Ptr()),                        // pData
+	))
+	info.SetPSpecializationInfo(NewVkSpecializationInfoᶜᵖ(specInfo.Ptr()))
+	return info
+}
+
+// rewrite returns newCmd, the rewrite of the command reading the newly
+// allocated data, with the extras and observations of the command carried
+// through.
+func (e *pipelineInfoEdit) rewrite(newCmd api.Cmd) api.Cmd {
+	for _, extra := range e.cmd.Extras().All() {
+		if _, ok := extra.(*api.CmdObservations); !ok {
+			newCmd.Extras().Add(extra)
+		}
+	}
+	observations := newCmd.Extras().GetOrAppendObservations()
+	// The original create infos are still read for the unedited states.
+	for _, r := range e.cmd.Extras().Observations().Reads {
+		observations.AddRead(r.Range, r.ID)
+	}
+	for _, a := range e.allocs {
+		observations.AddRead(a.Data())
+	}
+	for _, w := range e.cmd.Extras().Observations().Writes {
+		observations.AddWrite(w.Range, w.ID)
+	}
+	return newCmd
+}
+
+// graphicsPipelineEdit is an edit of the create info of a graphics pipeline.
+type graphicsPipelineEdit struct {
+	*pipelineInfoEdit
+	cmd           *VkCreateGraphicsPipelines
+	info          VkGraphicsPipelineCreateInfo
+	inputAssembly *VkPipelineInputAssemblyStateCreateInfo
+	raster        *VkPipelineRasterizationStateCreateInfo
+	multisample   *VkPipelineMultisampleStateCreateInfo
+	sampleMask    []VkSampleMask
+	depthStencil  *VkPipelineDepthStencilStateCreateInfo
+	colorBlend    *VkPipelineColorBlendStateCreateInfo
+	attachments   []VkPipelineColorBlendAttachmentState
+}
+
+func (e *graphicsPipelineEdit) inputAssemblyState() (*VkPipelineInputAssemblyStateCreateInfo, error) {
+	if e.inputAssembly == nil {
+		if e.info.PInputAssemblyState().IsNullptr() {
+			return nil, fmt.Errorf("The pipeline has no input assembly state")
+		}
+		s, err := e.info.PInputAssemblyState().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.inputAssembly = &s
+	}
+	return e.inputAssembly, nil
+}
+
+func (e *graphicsPipelineEdit) rasterState() (*VkPipelineRasterizationStateCreateInfo, error) {
+	if e.raster == nil {
+		if e.info.PRasterizationState().IsNullptr() {
+			return nil, fmt.Errorf("The pipeline has no rasterization state")
+		}
+		s, err := e.info.PRasterizationState().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.raster = &s
+	}
+	return e.raster, nil
+}
+
+func (e *graphicsPipelineEdit) multisampleState() (*VkPipelineMultisampleStateCreateInfo, error) {
+	if e.multisample == nil {
+		if e.info.PMultisampleState().IsNullptr() {
+			return nil, fmt.Errorf("The pipeline has no multisample state")
+		}
+		s, err := e.info.PMultisampleState().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.multisample = &s
+	}
+	return e.multisample, nil
+}
+
+func (e *graphicsPipelineEdit) depthStencilState() (*VkPipelineDepthStencilStateCreateInfo, error) {
+	if e.depthStencil == nil {
+		if e.info.PDepthStencilState().IsNullptr() {
+			return nil, fmt.Errorf("The pipeline has no depth stencil state")
+		}
+		s, err := e.info.PDepthStencilState().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.depthStencil = &s
+	}
+	return e.depthStencil, nil
+}
+
+func (e *graphicsPipelineEdit) colorBlendState() (*VkPipelineColorBlendStateCreateInfo, error) {
+	if e.colorBlend == nil {
+		if e.info.PColorBlendState().IsNullptr() {
+			return nil, fmt.Errorf("The pipeline has no color blend state")
+		}
+		s, err := e.info.PColorBlendState().Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.colorBlend = &s
+	}
+	return e.colorBlend, nil
+}
+
+// attachment returns the color blend state of the attachment at the row of
+// the target blends table, which presents the attachments in order.
+func (e *graphicsPipelineEdit) attachment(row int) (*VkPipelineColorBlendAttachmentState, error) {
+	if e.attachments == nil {
+		s, err := e.colorBlendState()
+		if err != nil {
+			return nil, err
+		}
+		l := e.state.MemoryLayout
+		e.attachments, err = s.PAttachments().Slice(0, uint64(s.AttachmentCount()), l).Read(e.ctx, e.cmd, e.state, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if row < 0 || row >= len(e.attachments) {
+		return nil, fmt.Errorf("The pipeline has %v color blend attachments", len(e.attachments))
+	}
+	return &e.attachments[row], nil
+}
+
+// stencilOpState returns the stencil state of the face of the row of the
+// stencil state table, which presents the front face first.
+func (e *graphicsPipelineEdit) stencilOpState(row int) (VkStencilOpState, func(VkStencilOpState), error) {
+	s, err := e.depthStencilState()
+	if err != nil {
+		return NilVkStencilOpState, nil, err
+	}
+	if row == 0 {
+		return s.Front(), func(o VkStencilOpState) { s.SetFront(o) }, nil
+	}
+	return s.Back(), func(o VkStencilOpState) { s.SetBack(o) }, nil
+}
+
+// set sets the setting in the create info.
+func (e *graphicsPipelineEdit) set(s pipelineSetting) error {
+	switch s.stage + "/" + s.group {
+	case "Input Assembly/Input Assembly State":
+		state, err := e.inputAssemblyState()
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Topology":
+			v, err := s.enum("VkPrimitiveTopology", VkPrimitiveTopologyConstants())
+			state.SetTopology(VkPrimitiveTopology(v))
+			return err
+		case "Primitive Restart Enabled":
+			v, err := s.bool32()
+			state.SetPrimitiveRestartEnable(v)
+			return err
+		}
+
+	case "Rasterizer/Rasterization State":
+		state, err := e.rasterState()
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Depth Clamp Enabled":
+			v, err := s.bool32()
+			state.SetDepthClampEnable(v)
+			return err
+		case "Rasterizer Discard":
+			v, err := s.bool32()
+			state.SetRasterizerDiscardEnable(v)
+			return err
+		case "Polygon Mode":
+			v, err := s.enum("VkPolygonMode", VkPolygonModeConstants())
+			state.SetPolygonMode(VkPolygonMode(v))
+			return err
+		case "Cull Mode":
+			v, err := s.bits("VkCullModeFlags", VkCullModeFlagBitsConstants())
+			state.SetCullMode(VkCullModeFlags(v))
+			return err
+		case "Front Face":
+			v, err := s.enum("VkFrontFace", VkFrontFaceConstants())
+			state.SetFrontFace(VkFrontFace(v))
+			return err
+		case "Depth Bias Enabled":
+			v, err := s.bool32()
+			state.SetDepthBiasEnable(v)
+			return err
+		case "Depth Bias Constant Factor":
+			v, err := s.f32()
+			state.SetDepthBiasConstantFactor(v)
+			return err
+		case "Depth Bias Clamp":
+			v, err := s.f32()
+			state.SetDepthBiasClamp(v)
+			return err
+		case "Depth Bias Slope Factor":
+			v, err := s.f32()
+			state.SetDepthBiasSlopeFactor(v)
+			return err
+		case "Line Width":
+			v, err := s.f32()
+			state.SetLineWidth(v)
+			return err
+		}
+
+	case "Rasterizer/Multisample State":
+		state, err := e.multisampleState()
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Sample Count":
+			v, err := s.bits("VkSampleCountFlagBits", VkSampleCountFlagBitsConstants())
+			state.SetRasterizationSamples(VkSampleCountFlagBits(v))
+			return err
+		case "Sample Mask":
+			v, err := s.u32()
+			if err != nil {
+				return err
+			}
+			if e.sampleMask == nil {
+				// The mask has a bit per sample, and only its first word is
+				// presented.
+				count := (uint64(state.RasterizationSamples()) + 31) / 32
+				if state.PSampleMask().IsNullptr() {
+					e.sampleMask = make([]VkSampleMask, count)
+					for i := range e.sampleMask {
+						e.sampleMask[i] = 0xFFFFFFFF
+					}
+				} else if e.sampleMask, err = state.PSampleMask().Slice(0, count, e.state.MemoryLayout).Read(e.ctx, e.cmd, e.state, nil); err != nil {
+					return err
+				}
+			}
+			e.sampleMask[0] = VkSampleMask(v)
+			return nil
+		case "Sample Shading Enabled":
+			v, err := s.bool32()
+			state.SetSampleShadingEnable(v)
+			return err
+		case "Min Sample Shading":
+			v, err := s.f32()
+			state.SetMinSampleShading(v)
+			return err
+		case "Alpha to Coverage":
+			v, err := s.bool32()
+			state.SetAlphaToCoverageEnable(v)
+			return err
+		case "Alpha to One":
+			v, err := s.bool32()
+			state.SetAlphaToOneEnable(v)
+			return err
+		}
+
+	case "Color Blending/Depth State":
+		state, err := e.depthStencilState()
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Test Enabled":
+			v, err := s.bool32()
+			state.SetDepthTestEnable(v)
+			return err
+		case "Write Enabled":
+			v, err := s.bool32()
+			state.SetDepthWriteEnable(v)
+			return err
+		case "Function":
+			v, err := s.enum("VkCompareOp", VkCompareOpConstants())
+			state.SetDepthCompareOp(VkCompareOp(v))
+			return err
+		case "Bounds Test Enabled":
+			v, err := s.bool32()
+			state.SetDepthBoundsTestEnable(v)
+			return err
+		case "Min Depth Bounds":
+			v, err := s.f32()
+			state.SetMinDepthBounds(v)
+			return err
+		case "Max Depth Bounds":
+			v, err := s.f32()
+			state.SetMaxDepthBounds(v)
+			return err
+		}
+
+	case "Color Blending/Stencil State":
+		op, setOp, err := e.stencilOpState(s.row)
+		if err != nil {
+			return err
+		}
+		defer func() { setOp(op) }()
+		switch s.name {
+		case "Fail Op":
+			v, err := s.enum("VkStencilOp", VkStencilOpConstants())
+			op.SetFailOp(VkStencilOp(v))
+			return err
+		case "Pass Op":
+			v, err := s.enum("VkStencilOp", VkStencilOpConstants())
+			op.SetPassOp(VkStencilOp(v))
+			return err
+		case "Depth Fail Op":
+			v, err := s.enum("VkStencilOp", VkStencilOpConstants())
+			op.SetDepthFailOp(VkStencilOp(v))
+			return err
+		case "Func":
+			v, err := s.enum("VkCompareOp", VkCompareOpConstants())
+			op.SetCompareOp(VkCompareOp(v))
+			return err
+		case "Compare Mask":
+			v, err := s.u32()
+			op.SetCompareMask(v)
+			return err
+		case "Write Mask":
+			v, err := s.u32()
+			op.SetWriteMask(v)
+			return err
+		case "Ref":
+			v, err := s.u32()
+			op.SetReference(v)
+			return err
+		}
+
+	case "Color Blending/Blend State":
+		state, err := e.colorBlendState()
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Logic Op Enabled":
+			v, err := s.bool32()
+			state.SetLogicOpEnable(v)
+			return err
+		case "Logic Op":
+			v, err := s.enum("VkLogicOp", VkLogicOpConstants())
+			state.SetLogicOp(VkLogicOp(v))
+			return err
+		case "Blend Constants":
+			v, err := s.f32s(4)
+			if err != nil {
+				return err
+			}
+			state.SetBlendConstants(NewF32ː4ᵃ(v[0], v[1], v[2], v[3]))
+			return nil
+		}
+
+	case "Color Blending/Target Blends":
+		target, err := e.attachment(s.row)
+		if err != nil {
+			return err
+		}
+		switch s.name {
+		case "Enabled":
+			v, err := s.bool32()
+			target.SetBlendEnable(v)
+			return err
+		case "Color Src":
+			v, err := s.enum("VkBlendFactor", VkBlendFactorConstants())
+			target.SetSrcColorBlendFactor(VkBlendFactor(v))
+			return err
+		case "Color Dst":
+			v, err := s.enum("VkBlendFactor", VkBlendFactorConstants())
+			target.SetDstColorBlendFactor(VkBlendFactor(v))
+			return err
+		case "Color Op":
+			v, err := s.enum("VkBlendOp", VkBlendOpConstants())
+			target.SetColorBlendOp(VkBlendOp(v))
+			return err
+		case "Alpha Src":
+			v, err := s.enum("VkBlendFactor", VkBlendFactorConstants())
+			target.SetSrcAlphaBlendFactor(VkBlendFactor(v))
+			return err
+		case "Alpha Dst":
+			v, err := s.enum("VkBlendFactor", VkBlendFactorConstants())
+			target.SetDstAlphaBlendFactor(VkBlendFactor(v))
+			return err
+		case "Alpha Op":
+			v, err := s.enum("VkBlendOp", VkBlendOpConstants())
+			target.SetAlphaBlendOp(VkBlendOp(v))
+			return err
+		case "Color Write Mask":
+			v, err := s.bits("VkColorComponentFlagBits", VkColorComponentFlagBitsConstants())
+			target.SetColorWriteMask(VkColorComponentFlags(v))
+			return err
+		}
+
+	default:
+		if s.group == "Specialization Constants" {
+			stage, ok := pipelineShaderStage(e.stages, s.stage)
+			if !ok {
+				return fmt.Errorf("The pipeline has no %v stage", s.stage)
+			}
+			infos, err := e.shaderStages()
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if info.Stage() == stage.Stage() {
+					return e.setSpecializationConstant(s, info)
+				}
+			}
+		}
+	}
+	return s.errNotEditable()
+}
+
+func (e *graphicsPipelineEdit) shaderStages() ([]VkPipelineShaderStageCreateInfo, error) {
+	return e.info.PStages().Slice(0, uint64(e.info.StageCount()), e.state.MemoryLayout).Read(e.ctx, e.cmd, e.state, nil)
+}
+
+// finish returns the create info with the edited states.
+func (e *graphicsPipelineEdit) finish() (VkGraphicsPipelineCreateInfo, error) {
+	info := e.info
+	if e.inputAssembly != nil {
+		info.SetPInputAssemblyState(NewVkPipelineInputAssemblyStateCreateInfoᶜᵖ(e.alloc(*e.inputAssembly).Ptr()))
+	}
+	if e.raster != nil {
+		info.SetPRasterizationState(NewVkPipelineRasterizationStateCreateInfoᶜᵖ(e.alloc(*e.raster).Ptr()))
+	}
+	if e.multisample != nil {
+		if e.sampleMask != nil {
+			e.multisample.SetPSampleMask(NewVkSampleMaskᶜᵖ(e.alloc(e.sampleMask).Ptr()))
+		}
+		info.SetPMultisampleState(NewVkPipelineMultisampleStateCreateInfoᶜᵖ(e.alloc(*e.multisample).Ptr()))
+	}
+	if e.depthStencil != nil {
+		info.SetPDepthStencilState(NewVkPipelineDepthStencilStateCreateInfoᶜᵖ(e.alloc(*e.depthStencil).Ptr()))
+	}
+	if e.colorBlend != nil {
+		if e.attachments != nil {
+			e.colorBlend.SetPAttachments(NewVkPipelineColorBlendAttachmentStateᶜᵖ(e.alloc(e.attachments).Ptr()))
+		}
+		info.SetPColorBlendState(NewVkPipelineColorBlendStateCreateInfoᶜᵖ(e.alloc(*e.colorBlend).Ptr()))
+	}
+	if len(e.specs) > 0 {
+		stages, err := e.shaderStages()
+		if err != nil {
+			return info, err
+		}
+		for i := range stages {
+			stages[i] = e.withSpecialization(stages[i])
+		}
+		info.SetPStages(NewVkPipelineShaderStageCreateInfoᶜᵖ(e.alloc(stages).Ptr()))
+	}
+	return info, nil
+}
+
+// editedPipelineSettings returns the settings of the pipeline data which
+// differ from the current settings of the pipeline at the command, and the
+// state at the command.
+func editedPipelineSettings(ctx context.Context, p api.Resource, at *path.Command, data *api.ResourceData, r *path.ResolveConfig) ([]pipelineSetting, *api.GlobalState, error) {
+	edited := data.GetPipeline()
+	if edited == nil {
+		return nil, nil, fmt.Errorf("Expected pipeline data, got %T", data.Data)
+	}
+	s, err := resolve.GlobalState(ctx, at.GlobalStateAfter(), r)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := p.ResourceData(ctx, s, at, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := changedPipelineSettings(current.GetPipeline(), edited)
+	if err != nil {
+		return nil, nil, err
+	}
+	return settings, s, nil
+}
+
+// pipelineCreateCommand returns the index of the command which created the
+// pipeline, and the index of the pipeline in the pipelines it created.
+func pipelineCreateCommand(ctx context.Context, c *capture.GraphicsCapture, p api.Resource, handle VkPipeline, at *path.Command, resourceIDs api.ResourceMap, r *path.ResolveConfig) (uint64, uint64, error) {
+	resources, err := resolve.Resources(ctx, at.Capture, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	resource, err := resources.Find(p.ResourceType(ctx), resourceIDs[p.ResourceHandle()])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for j := len(resource.Accesses) - 1; j >= 0; j-- {
+		i := resource.Accesses[j].Indices[0] // TODO: Subcommands
+		if i > at.Indices[0] {
+			continue
+		}
+		var pPipelines VkPipelineᵖ
+		var count uint32
+		switch cmd := c.Commands[i].(type) {
+		case *VkCreateGraphicsPipelines:
+			pPipelines, count = cmd.PPipelines(), cmd.CreateInfoCount()
+		case *VkCreateComputePipelines:
+			pPipelines, count = cmd.PPipelines(), cmd.CreateInfoCount()
+		default:
+			continue
+		}
+		s := c.NewState(ctx)
+		c.Commands[i].Extras().Observations().ApplyWrites(s.Memory.ApplicationPool())
+		pipelines, err := pPipelines.Slice(0, uint64(count), s.MemoryLayout).Read(ctx, c.Commands[i], s, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		for k, h := range pipelines {
+			if h == handle {
+				return i, uint64(k), nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("No command creating pipeline %v to set data in", handle)
+}
+
+// setGraphicsPipelineData rewrites the create info of the graphics pipeline
+// with the settings of the pipeline data which differ from its current
+// settings.
+func setGraphicsPipelineData(ctx context.Context, p GraphicsPipelineObjectʳ, at *path.Command, data *api.ResourceData, resourceIDs api.ResourceMap, edits api.ReplaceCallback, r *path.ResolveConfig) error {
+	settings, s, err := editedPipelineSettings(ctx, p, at, data, r)
+	if err != nil {
+		return err
+	}
+	c, err := capture.ResolveGraphicsFromPath(ctx, at.Capture)
+	if err != nil {
+		return err
+	}
+	cmdIdx, index, err := pipelineCreateCommand(ctx, c, p, p.VulkanHandle(), at, resourceIDs, r)
+	if err != nil {
+		return err
+	}
+	cmd, ok := c.Commands[cmdIdx].(*VkCreateGraphicsPipelines)
+	if !ok {
+		return fmt.Errorf("Pipeline %v is not created by %v", p.VulkanHandle(), c.Commands[cmdIdx])
+	}
+
+	e := &graphicsPipelineEdit{
+		pipelineInfoEdit: newPipelineInfoEdit(ctx, c, cmd, s, p.Stages().All()),
+		cmd:              cmd,
+	}
+	l := e.state.MemoryLayout
+	infos, err := cmd.PCreateInfos().Slice(0, uint64(cmd.CreateInfoCount()), l).Read(ctx, cmd, e.state, nil)
+	if err != nil {
+		return err
+	}
+	e.info = infos[index]
+	for _, setting := range settings {
+		if err := e.set(setting); err != nil {
+			return err
+		}
+	}
+	if infos[index], err = e.finish(); err != nil {
+		return err
+	}
+	newInfos := e.alloc(infos)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateGraphicsPipelines(cmd.Device(), cmd.PipelineCache(), cmd.CreateInfoCount(),
+		newInfos.Ptr(), cmd.PAllocator(), cmd.PPipelines(), cmd.Result())
+	edits(cmdIdx, e.rewrite(newCmd))
+	return nil
+}
+
+// setComputePipelineData rewrites the create info of the compute pipeline
+// with the settings of the pipeline data which differ from its current
+// settings.
+func setComputePipelineData(ctx context.Context, p ComputePipelineObjectʳ, at *path.Command, data *api.ResourceData, resourceIDs api.ResourceMap, edits api.ReplaceCallback, r *path.ResolveConfig) error {
+	settings, s, err := editedPipelineSettings(ctx, p, at, data, r)
+	if err != nil {
+		return err
+	}
+	c, err := capture.ResolveGraphicsFromPath(ctx, at.Capture)
+	if err != nil {
+		return err
+	}
+	cmdIdx, index, err := pipelineCreateCommand(ctx, c, p, p.VulkanHandle(), at, resourceIDs, r)
+	if err != nil {
+		return err
+	}
+	cmd, ok := c.Commands[cmdIdx].(*VkCreateComputePipelines)
+	if !ok {
+		return fmt.Errorf("Pipeline %v is not created by %v", p.VulkanHandle(), c.Commands[cmdIdx])
+	}
+
+	e := newPipelineInfoEdit(ctx, c, cmd, s, map[uint32]StageData{0: p.Stage()})
+	l := e.state.MemoryLayout
+	infos, err := cmd.PCreateInfos().Slice(0, uint64(cmd.CreateInfoCount()), l).Read(ctx, cmd, e.state, nil)
+	if err != nil {
+		return err
+	}
+	info := infos[index]
+	for _, setting := range settings {
+		if setting.stage != "Compute Shader" || setting.group != "Specialization Constants" {
+			return setting.errNotEditable()
+		}
+		if err := e.setSpecializationConstant(setting, info.Stage()); err != nil {
+			return err
+		}
+	}
+	info.SetStage(e.withSpecialization(info.Stage()))
+	infos[index] = info
+	newInfos := e.alloc(infos)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateComputePipelines(cmd.Device(), cmd.PipelineCache(), cmd.CreateInfoCount(),
+		newInfos.Ptr(), cmd.PAllocator(), cmd.PPipelines(), cmd.Result())
+	edits(cmdIdx, e.rewrite(newCmd))
+	return nil
+}
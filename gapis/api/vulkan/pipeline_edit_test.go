@@ -0,0 +1,77 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func rasterizerPipeline(cullMode VkCullModeFlags, polygonMode VkPolygonMode, lineWidth float32) *api.Pipeline {
+	list := &api.KeyValuePairList{}
+	list = list.AppendKeyValuePair("Polygon Mode", api.CreateEnumDataValue("VkPolygonMode", polygonMode), false)
+	list = list.AppendKeyValuePair("Cull Mode", api.CreateBitfieldDataValue("VkCullModeFlags", cullMode, VkCullModeFlagBitsConstants(), API{}), false)
+	list = list.AppendKeyValuePair("Line Width", api.CreatePoDDataValue("f32", lineWidth), true)
+	return &api.Pipeline{
+		Stages: []*api.Stage{
+			&api.Stage{
+				StageName: "Rasterizer",
+				Groups: []*api.DataGroup{
+					&api.DataGroup{
+						GroupName: "Rasterization State",
+						Data:      &api.DataGroup_KeyValues{list},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestChangedPipelineSettings(t *testing.T) {
+	ctx := log.Testing(t)
+	current := rasterizerPipeline(VkCullModeFlags(VkCullModeFlagBits_VK_CULL_MODE_BACK_BIT), VkPolygonMode_VK_POLYGON_MODE_FILL, 1)
+
+	settings, err := changedPipelineSettings(current, current)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "unchanged").ThatSlice(settings).IsEmpty()
+
+	edited := rasterizerPipeline(VkCullModeFlags(VkCullModeFlagBits_VK_CULL_MODE_BACK_BIT), VkPolygonMode_VK_POLYGON_MODE_FILL, 1)
+	pairs := edited.Stages[0].Groups[0].GetKeyValues().KeyValues
+	pairs[0].Value = &api.DataValue{Val: &api.DataValue_EnumVal{&api.EnumValue{StringValue: "LINE"}}}
+	pairs[1].Value = &api.DataValue{Val: &api.DataValue_Bitfield{&api.BitfieldValue{SetBitnames: []string{"FRONT", "VK_CULL_MODE_BACK_BIT"}}}}
+	settings, err = changedPipelineSettings(current, edited)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() || !assert.For(ctx, "changed").ThatSlice(settings).IsLength(2) {
+		return
+	}
+	polygonMode, err := settings[0].enum("VkPolygonMode", VkPolygonModeConstants())
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "polygon mode").That(VkPolygonMode(polygonMode)).Equals(VkPolygonMode_VK_POLYGON_MODE_LINE)
+	cullMode, err := settings[1].bits("VkCullModeFlags", VkCullModeFlagBitsConstants())
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "cull mode").That(VkCullModeFlagBits(cullMode)).Equals(VkCullModeFlagBits_VK_CULL_MODE_FRONT_AND_BACK)
+
+	pairs[0].Value = &api.DataValue{Val: &api.DataValue_EnumVal{&api.EnumValue{StringValue: "WIREFRAME"}}}
+	settings, err = changedPipelineSettings(current, edited)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	_, err = settings[0].enum("VkPolygonMode", VkPolygonModeConstants())
+	assert.For(ctx, "unknown polygon mode").ThatError(err).Failed()
+
+	dynamic := rasterizerPipeline(VkCullModeFlags(VkCullModeFlagBits_VK_CULL_MODE_BACK_BIT), VkPolygonMode_VK_POLYGON_MODE_FILL, 2)
+	_, err = changedPipelineSettings(current, dynamic)
+	assert.For(ctx, "dynamic line width").ThatError(err).Failed()
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/cmdquery"
+)
+
+// Interface compliance test
+var (
+	_ = cmdquery.FunctionProvider(API{})
+)
+
+// QueryFunctions returns the Vulkan functions callable from command queries.
+func (API) QueryFunctions() map[string]cmdquery.Function {
+	return map[string]cmdquery.Function{
+		"shaderModules": queryShaderModules,
+	}
+}
+
+// queryShaderModules returns the handles of the shader modules used by the
+// graphics or compute pipeline handle passed as argument. Pipelines that do
+// not exist use no shader modules.
+//
+// For example: vkCmdBindPipeline where shaderModules(pipeline) contains 0x10
+func queryShaderModules(ctx context.Context, s *api.GlobalState, args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("shaderModules expects 1 argument, got %d", len(args))
+	}
+	handle, ok := args[0].(uint64)
+	if !ok {
+		return nil, fmt.Errorf("shaderModules expects a pipeline handle, got %v", args[0])
+	}
+
+	st := GetState(s)
+	modules := []uint64{}
+	p := VkPipeline(handle)
+	if st.GraphicsPipelines().Contains(p) {
+		for _, stage := range st.GraphicsPipelines().Get(p).Stages().All() {
+			modules = append(modules, uint64(stage.Module().VulkanHandle()))
+		}
+	} else if st.ComputePipelines().Contains(p) {
+		modules = append(modules, uint64(st.ComputePipelines().Get(p).Stage().Module().VulkanHandle()))
+	}
+	return modules, nil
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/replay/interpreter"
+)
+
+// Interface compliance test
+var (
+	_ = interpreter.FunctionProvider(API{})
+)
+
+// replayStubs are the stubs of the functions whose side effects are needed
+// by the rest of the payload. Other functions only have their calls recorded.
+var replayStubs = map[string]interpreter.Stub{
+	"vkMapMemory": stubVkMapMemory,
+}
+
+// ReplayFunctions returns the Vulkan functions callable by replay payloads,
+// for the replay interpreter.
+func (API) ReplayFunctions() []interpreter.Function {
+	out := make([]interpreter.Function, 0, len(builderFunctionInfos))
+	for name, info := range builderFunctionInfos {
+		out = append(out, interpreter.Function{Name: name, Info: info, Stub: replayStubs[name]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Info.ID < out[j].Info.ID })
+	return out
+}
+
+// stubVkMapMemory writes a pointer to newly allocated host memory to ppData,
+// as the payload writes the mapped memory through it.
+func stubVkMapMemory(ctx context.Context, m *interpreter.Memory, c *interpreter.Call) (uint64, error) {
+	if len(c.Args) != 6 {
+		return 0, fmt.Errorf("Expected 6 arguments, got %d", len(c.Args))
+	}
+	size, ppData := c.Args[3].Value, c.Args[5]
+	if size == ^uint64(0) { // VK_WHOLE_SIZE
+		// The simulated memory is sparse, so large mappings are cheap.
+		size = 1 << 32
+	}
+	addr, err := m.Pointer(ppData)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(VkResult_VK_SUCCESS), m.WritePointer(addr, m.Alloc(size))
+}
@@ -0,0 +1,203 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/protoutil"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// resourceEditOutput is a stateBuilderOutput which mutates the commands on the
+// state of a capture after a command, and collects them to be inserted after
+// that command.
+type resourceEditOutput struct {
+	state *api.GlobalState
+	cmds  []api.Cmd
+}
+
+func (o *resourceEditOutput) write(ctx context.Context, cmd api.Cmd, id api.CmdID) {
+	if err := cmd.Mutate(ctx, id, o.state, nil, nil); err != nil {
+		log.W(ctx, "Resource edit cmd %v: %v - %v", len(o.cmds), cmd, err)
+	}
+	o.cmds = append(o.cmds, cmd)
+}
+
+func (o *resourceEditOutput) getOldState() *api.GlobalState {
+	return o.state
+}
+
+func (o *resourceEditOutput) getNewState() *api.GlobalState {
+	return o.state
+}
+
+// editResourceAfter calls f with a state builder on a new state of the capture
+// after the command at, and inserts the commands written by f after that
+// command.
+func editResourceAfter(ctx context.Context, at *path.Command, edits api.ReplaceCallback, f func(sb *stateBuilder) error) error {
+	c, err := capture.ResolveGraphicsFromPath(ctx, at.Capture)
+	if err != nil {
+		return err
+	}
+	cmdIdx := at.Indices[0]
+	if count := uint64(len(c.Commands)); cmdIdx >= count {
+		return fmt.Errorf("Command %v is out of bounds, the capture has %v commands", cmdIdx, count)
+	}
+
+	s := c.NewState(ctx)
+	err = api.ForeachCmd(ctx, c.Commands[:cmdIdx+1], true, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
+			return fmt.Errorf("Fail to mutate command %v: %v", cmd, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	st := GetState(s)
+	if st == nil {
+		return fmt.Errorf("No Vulkan state after command %v", cmdIdx)
+	}
+
+	out := &resourceEditOutput{state: s}
+	sb := st.newStateBuilder(ctx, out)
+	// Write the commands on the thread of the command they follow.
+	sb.cb.Thread = c.Commands[cmdIdx].Thread()
+	if err := f(sb); err != nil {
+		return err
+	}
+	sb.scratchRes.Free(sb)
+	edits(cmdIdx, out.cmds)
+	return nil
+}
+
+// replacementTexture returns the texture held by the resource data.
+func replacementTexture(ctx context.Context, data *api.ResourceData) (*image.Texture, error) {
+	switch d := protoutil.OneOf(data.Data).(type) {
+	case *api.TextureData:
+		return d.ImageTexture()
+	case *api.Texture:
+		return d.ImageTexture(ctx, func(ctx context.Context, i *image.Info) ([]byte, error) {
+			data, err := i.Data(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return data.Bytes, nil
+		})
+	default:
+		return nil, fmt.Errorf("Expected texture data, got %T", d)
+	}
+}
+
+// replacementLevelData returns the image of the texture for the array layer
+// and mip-level, converted to the format and resized to the dimensions of the
+// image level. Mip-levels missing from the texture are generated from its
+// base level.
+func replacementLevelData(src *image.Texture, layer, level int, f *image.Format, w, h, d uint32) ([]byte, error) {
+	srcLevel := level
+	if srcLevel >= len(src.Levels) {
+		srcLevel = 0
+	}
+	data, format := src.Levels[srcLevel][layer], src.Format
+	sw, sh, sd := src.LevelSize(srcLevel)
+	if sw != w || sh != h || sd != d {
+		rgba, err := image.Convert(data, int(sw), int(sh), int(sd), format, image.RGBA_F32)
+		if err != nil {
+			return nil, err
+		}
+		data, err = image.RGBA_F32.Resize(rgba, int(sw), int(sh), int(sd), int(w), int(h), int(d))
+		if err != nil {
+			return nil, err
+		}
+		format = image.RGBA_F32
+	}
+	return image.Convert(data, int(w), int(h), int(d), format, f)
+}
+
+// addBufferTransferDstUsage replaces the command creating the buffer with one
+// that adds the VK_BUFFER_USAGE_TRANSFER_DST_BIT usage.
+func addBufferTransferDstUsage(ctx context.Context, b BufferObjectʳ, at *path.Command, resourceIDs api.ResourceMap, edits api.ReplaceCallback, r *path.ResolveConfig) error {
+	resources, err := resolve.Resources(ctx, at.Capture, r)
+	if err != nil {
+		return err
+	}
+	resource, err := resources.Find(b.ResourceType(ctx), resourceIDs[b.ResourceHandle()])
+	if err != nil {
+		return err
+	}
+	c, err := capture.ResolveGraphicsFromPath(ctx, at.Capture)
+	if err != nil {
+		return err
+	}
+
+	for j := len(resource.Accesses) - 1; j >= 0; j-- {
+		i := resource.Accesses[j].Indices[0] // TODO: Subcommands
+		if i > at.Indices[0] {
+			continue
+		}
+		if cmd, ok := c.Commands[i].(*VkCreateBuffer); ok {
+			newCmd, err := cmd.withTransferDstUsage(ctx, c)
+			if err != nil {
+				return err
+			}
+			edits(i, newCmd)
+			return nil
+		}
+	}
+	// The buffer is created by the initial state, which the state rebuilder
+	// creates with the TRANSFER_DST usage.
+	return nil
+}
+
+// withTransferDstUsage returns a copy of the command which creates the buffer
+// with the VK_BUFFER_USAGE_TRANSFER_DST_BIT usage added.
+func (cmd *VkCreateBuffer) withTransferDstUsage(ctx context.Context, c *capture.GraphicsCapture) (api.Cmd, error) {
+	state := c.NewState(ctx)
+	cmd.Extras().Observations().ApplyReads(state.Memory.ApplicationPool())
+	createInfo, err := cmd.PCreateInfo().Read(ctx, cmd, state, nil)
+	if err != nil {
+		return nil, err
+	}
+	createInfo.SetUsage(createInfo.Usage() | VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT))
+	newCreateInfo := state.AllocDataOrPanic(ctx, createInfo)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateBuffer(cmd.Device(), newCreateInfo.Ptr(),
+		memory.Pointer(cmd.PAllocator()), memory.Pointer(cmd.PBuffer()), cmd.Result())
+
+	// Carry all non-observation extras through.
+	for _, e := range cmd.Extras().All() {
+		if _, ok := e.(*api.CmdObservations); !ok {
+			newCmd.Extras().Add(e)
+		}
+	}
+	// The original create info is still read for its pNext chain.
+	for _, r := range cmd.Extras().Observations().Reads {
+		newCmd.AddRead(r.Range, r.ID)
+	}
+	newCmd.AddRead(newCreateInfo.Data())
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
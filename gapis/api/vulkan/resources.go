@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/protoutil"
 	"github.com/google/gapid/core/image"
 	"github.com/google/gapid/core/image/astc"
 	"github.com/google/gapid/core/log"
@@ -356,13 +357,13 @@ func getImageFormatFromVulkanFormat(vkfmt VkFormat) (*image.Format, error) {
 	case VkFormat_VK_FORMAT_BC5_SNORM_BLOCK:
 		return image.NewRGTC2_BC5_RG_S8_NORM("VK_FORMAT_BC5_SNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC6H_UFLOAT_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC6H_RGB_UFLOAT("VK_FORMAT_BC6H_UFLOAT_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC6H_SFLOAT_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC6H_RGB_SFLOAT("VK_FORMAT_BC6H_SFLOAT_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC7_UNORM_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC7_RGBA_U8_NORM("VK_FORMAT_BC7_UNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC7_SRGB_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC7_SRGBA_U8_NORM("VK_FORMAT_BC7_SRGB_BLOCK"), nil
 	case VkFormat_VK_FORMAT_ETC2_R8G8B8_UNORM_BLOCK:
 		return image.NewETC2_RGB_U8_NORM("VK_FORMAT_ETC2_R8G8B8_UNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_ETC2_R8G8B8_SRGB_BLOCK:
@@ -794,7 +795,200 @@ func (t ImageObjectʳ) SetResourceData(
 	mutate api.MutateInitialState,
 	r *path.ResolveConfig) error {
 
-	return fmt.Errorf("SetResourceData is not supported for ImageObject")
+	ctx = log.Enter(ctx, "ImageObject.SetResourceData()")
+
+	src, err := replacementTexture(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return editResourceAfter(ctx, at, edits, func(sb *stateBuilder) error {
+		img := GetState(sb.newState).Images().Get(t.VulkanHandle())
+		if img.IsNil() {
+			return fmt.Errorf("%v does not exist after command %v", t.ResourceHandle(), at.Indices)
+		}
+		writableUsage := VkImageUsageFlags(VkImageUsageFlagBits_VK_IMAGE_USAGE_TRANSFER_DST_BIT |
+			VkImageUsageFlagBits_VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT |
+			VkImageUsageFlagBits_VK_IMAGE_USAGE_STORAGE_BIT)
+		switch {
+		case img.IsSwapchainImage():
+			return fmt.Errorf("Replacing the data of swapchain images is not supported")
+		case img.Info().Samples() != VkSampleCountFlagBits_VK_SAMPLE_COUNT_1_BIT:
+			return fmt.Errorf("Replacing the data of multisampled images is not supported")
+		case img.Aspects().Len() != 1 || !img.Aspects().Contains(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT):
+			return fmt.Errorf("Replacing the data of depth, stencil or multi-planar images is not supported")
+		case img.Info().Usage()&writableUsage == 0:
+			return fmt.Errorf("%v cannot be written, its usage is %v", t.ResourceHandle(), img.Info().Usage())
+		}
+		if images, layers := uint32(src.Images()), img.Info().ArrayLayers(); images != layers {
+			return fmt.Errorf("The texture has %d images per level, %v has %d array layers", images, t.ResourceHandle(), layers)
+		}
+
+		format, err := getImageFormatFromVulkanFormat(img.Info().Fmt())
+		if err != nil {
+			return err
+		}
+		aspect := img.Aspects().Get(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT)
+		for layer := uint32(0); layer < img.Info().ArrayLayers(); layer++ {
+			for level := uint32(0); level < img.Info().MipLevels(); level++ {
+				l := aspect.Layers().Get(layer).Levels().Get(level)
+				bytes, err := replacementLevelData(src, int(layer), int(level), format, l.Width(), l.Height(), l.Depth())
+				if err != nil {
+					return err
+				}
+				if uint64(len(bytes)) != l.Data().Count() {
+					return fmt.Errorf("Layer %d level %d has %d bytes of data, expected %d", layer, level, len(bytes), l.Data().Count())
+				}
+				if _, err := l.Data().Write(sb.ctx, bytes, nil, sb.newState, nil); err != nil {
+					return err
+				}
+			}
+		}
+
+		primer := newImagePrimer(sb)
+		defer primer.Free()
+		primeable, err := primer.newPrimeableImageDataFromHost(img.VulkanHandle(),
+			[]VkImageSubresourceRange{sb.imageWholeSubresourceRange(img)})
+		if err != nil {
+			return err
+		}
+		// The image keeps the layouts it has after the command.
+		err = primeable.prime(sb, sameLayoutsOfImage(img), sameLayoutsOfImage(img))
+		primeable.free(sb)
+		// Submit the priming commands before the primer frees its resources.
+		sb.scratchRes.Free(sb)
+		return err
+	})
+}
+
+var _ api.Resource = BufferObjectʳ{}
+
+// IsResource returns true if this instance should be considered as a resource.
+func (b BufferObjectʳ) IsResource() bool {
+	return b.VulkanHandle() != 0
+}
+
+// ResourceHandle returns the UI identity for the resource.
+func (b BufferObjectʳ) ResourceHandle() string {
+	return fmt.Sprintf("Buffer<%d>", b.VulkanHandle())
+}
+
+// ResourceLabel returns an optional debug label for the resource.
+func (b BufferObjectʳ) ResourceLabel() string {
+	if b.DebugInfo().IsNil() {
+		return ""
+	}
+	if b.DebugInfo().ObjectName() != "" {
+		return b.DebugInfo().ObjectName()
+	}
+	return fmt.Sprintf("<%d:%v>", b.DebugInfo().TagName(), b.DebugInfo().Tag())
+}
+
+// Order returns an integer used to sort the resources for presentation.
+func (b BufferObjectʳ) Order() uint64 {
+	return uint64(b.VulkanHandle())
+}
+
+// ResourceType returns the type of this resource.
+func (b BufferObjectʳ) ResourceType(ctx context.Context) path.ResourceType {
+	return path.ResourceType_Buffer
+}
+
+// ResourceData returns the resource data given the current state.
+func (b BufferObjectʳ) ResourceData(ctx context.Context, s *api.GlobalState, cmd *path.Command, r *path.ResolveConfig) (*api.ResourceData, error) {
+	ctx = log.Enter(ctx, "BufferObject.ResourceData()")
+	pieces, err := subGetBufferBoundMemoryPiecesInRange(
+		ctx, nil, api.CmdNoID, nil, s, nil, 0, nil, nil, b, 0, b.Info().Size())
+	if err != nil {
+		return nil, err
+	}
+	if pieces.Len() == 0 {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrNoBufferData(b.ResourceHandle())}
+	}
+	data := make([]byte, b.Info().Size())
+	for _, offset := range pieces.Keys() {
+		piece := pieces.Get(offset)
+		bytes, err := piece.DeviceMemory().Data().Slice(
+			uint64(piece.MemoryOffset()),
+			uint64(piece.MemoryOffset()+piece.Size())).Read(ctx, nil, s, nil)
+		if err != nil {
+			return nil, err
+		}
+		copy(data[piece.ResourceOffset():], bytes)
+	}
+	return api.NewResourceData(&api.Buffer{Data: data}), nil
+}
+
+// SetResourceData sets resource data in a new capture.
+func (b BufferObjectʳ) SetResourceData(
+	ctx context.Context,
+	at *path.Command,
+	data *api.ResourceData,
+	resourceIDs api.ResourceMap,
+	edits api.ReplaceCallback,
+	mutate api.MutateInitialState,
+	r *path.ResolveConfig) error {
+
+	ctx = log.Enter(ctx, "BufferObject.SetResourceData()")
+
+	contents := data.GetBuffer()
+	if contents == nil {
+		return fmt.Errorf("Expected buffer data, got %T", protoutil.OneOf(data.Data))
+	}
+	if size := uint64(b.Info().Size()); uint64(len(contents.Data)) != size {
+		return fmt.Errorf("The data has %d bytes, %v has %d", len(contents.Data), b.ResourceHandle(), size)
+	}
+
+	// The contents are written with a copy, which needs the buffer to be
+	// created with the TRANSFER_DST usage. The state rebuilder adds it to
+	// the buffers of the initial state.
+	transferDst := VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT)
+	if b.Info().Usage()&transferDst == 0 {
+		if err := addBufferTransferDstUsage(ctx, b, at, resourceIDs, edits, r); err != nil {
+			return err
+		}
+	}
+
+	return editResourceAfter(ctx, at, edits, func(sb *stateBuilder) error {
+		buf := GetState(sb.newState).Buffers().Get(b.VulkanHandle())
+		if buf.IsNil() {
+			return fmt.Errorf("%v does not exist after command %v", b.ResourceHandle(), at.Indices)
+		}
+		pieces, err := subGetBufferBoundMemoryPiecesInRange(
+			sb.ctx, nil, api.CmdNoID, nil, sb.newState, nil, 0, nil, nil, buf, 0, buf.Info().Size())
+		if err != nil {
+			return err
+		}
+		if pieces.Len() == 0 {
+			return fmt.Errorf("%v has no bound memory", b.ResourceHandle())
+		}
+		for _, offset := range pieces.Keys() {
+			piece := pieces.Get(offset)
+			start := uint64(piece.ResourceOffset())
+			if _, err := piece.DeviceMemory().Data().Slice(
+				uint64(piece.MemoryOffset()),
+				uint64(piece.MemoryOffset()+piece.Size())).Write(
+				sb.ctx, contents.Data[start:start+uint64(piece.Size())], nil, sb.newState, nil); err != nil {
+				return err
+			}
+		}
+
+		queue := sb.getQueueFor(
+			VkQueueFlagBits_VK_QUEUE_GRAPHICS_BIT|VkQueueFlagBits_VK_QUEUE_COMPUTE_BIT|VkQueueFlagBits_VK_QUEUE_TRANSFER_BIT,
+			queueFamilyIndicesToU32Slice(buf.Info().QueueFamilyIndices()),
+			buf.Device(),
+			buf.LastBoundQueue())
+		if queue.IsNil() {
+			return fmt.Errorf("No queue to copy the data of %v", b.ResourceHandle())
+		}
+		tsk := newQueueCommandBatch(fmt.Sprintf("Replace buffer: %v's data", buf.VulkanHandle()))
+		staging, err := sb.loadHostDatatoStagingBuffer(buf, tsk)
+		if err != nil {
+			return err
+		}
+		sb.copyBuffer(staging, buf.VulkanHandle(), queue, tsk)
+		return tsk.Commit(sb, sb.scratchRes.GetQueueCommandHandler(sb, queue.VulkanHandle()))
+	})
 }
 
 // IsResource returns true if this instance should be considered as a resource.
@@ -1081,6 +1275,7 @@ func commonShaderDataGroups(ctx context.Context,
 	usedSets map[uint32]DescriptorUsage,
 	vkStage VkShaderStageFlagBits,
 	stages map[uint32]StageData,
+	layout PipelineLayoutObjectʳ,
 ) []*api.DataGroup {
 	vkState := GetState(s)
 
@@ -1297,7 +1492,7 @@ func commonShaderDataGroups(ctx context.Context,
 			counterList = counterList.AppendKeyValuePair("Branch Instructions", api.CreatePoDDataValue("u32", counters.BranchInstructions), false)
 			counterList = counterList.AppendKeyValuePair("Temporary Registers", api.CreatePoDDataValue("u32", counters.TempRegisters), false)
 
-			return []*api.DataGroup{
+			dataGroups := []*api.DataGroup{
 				&api.DataGroup{
 					GroupName: "Shader Code",
 					Data:      &api.DataGroup_Shader{shader},
@@ -1313,6 +1508,7 @@ func commonShaderDataGroups(ctx context.Context,
 					Data:      &api.DataGroup_KeyValues{counterList},
 				},
 			}
+			return append(dataGroups, shaderReflectionDataGroups(ctx, s, stage, words, layout)...)
 		}
 	}
 
@@ -1481,7 +1677,7 @@ func (p GraphicsPipelineObjectʳ) vertexShader(
 	fb FramebufferObjectʳ) *api.Stage {
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, fb,
-		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_VERTEX_BIT, p.Stages().All())
+		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_VERTEX_BIT, p.Stages().All(), p.Layout())
 	if dataGroups != nil {
 		return &api.Stage{
 			StageName: "Vertex Shader",
@@ -1509,7 +1705,7 @@ func (p GraphicsPipelineObjectʳ) tessellationControlShader(
 	fb FramebufferObjectʳ) *api.Stage {
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, fb,
-		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_CONTROL_BIT, p.Stages().All())
+		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_CONTROL_BIT, p.Stages().All(), p.Layout())
 	if dataGroups != nil {
 		tessState := p.TessellationState()
 		if !tessState.IsNil() {
@@ -1552,7 +1748,7 @@ func (p GraphicsPipelineObjectʳ) tessellationEvulationShader(
 	fb FramebufferObjectʳ) *api.Stage {
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, fb,
-		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_EVALUATION_BIT, p.Stages().All())
+		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_EVALUATION_BIT, p.Stages().All(), p.Layout())
 	if dataGroups != nil {
 		return &api.Stage{
 			StageName: "Tessellation Evaluation Shader",
@@ -1579,7 +1775,7 @@ func (p GraphicsPipelineObjectʳ) geometryShader(
 	fb FramebufferObjectʳ) *api.Stage {
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, fb,
-		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_GEOMETRY_BIT, p.Stages().All())
+		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_GEOMETRY_BIT, p.Stages().All(), p.Layout())
 	if dataGroups != nil {
 		return &api.Stage{
 			StageName: "Geometry Shader",
@@ -1757,7 +1953,7 @@ func (p GraphicsPipelineObjectʳ) fragmentShader(
 	fb FramebufferObjectʳ) *api.Stage {
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, fb,
-		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT, p.Stages().All())
+		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT, p.Stages().All(), p.Layout())
 	if dataGroups != nil {
 		return &api.Stage{
 			StageName: "Fragment Shader",
@@ -1997,14 +2193,16 @@ func (p GraphicsPipelineObjectʳ) colorBlending(ctx context.Context, s *api.Glob
 
 // SetResourceData sets resource data in a new capture.
 func (p GraphicsPipelineObjectʳ) SetResourceData(
-	context.Context,
-	*path.Command,
-	*api.ResourceData,
-	api.ResourceMap,
-	api.ReplaceCallback,
-	api.MutateInitialState,
-	*path.ResolveConfig) error {
-	return fmt.Errorf("SetResourceData is not supported on GraphicsPipeline")
+	ctx context.Context,
+	at *path.Command,
+	data *api.ResourceData,
+	resourceIDs api.ResourceMap,
+	edits api.ReplaceCallback,
+	mutate api.MutateInitialState,
+	r *path.ResolveConfig) error {
+
+	ctx = log.Enter(ctx, "GraphicsPipelineObject.SetResourceData()")
+	return setGraphicsPipelineData(ctx, p, at, data, resourceIDs, edits, r)
 }
 
 var _ api.Resource = ComputePipelineObjectʳ{}
@@ -2072,7 +2270,7 @@ func (p ComputePipelineObjectʳ) ResourceData(ctx context.Context, s *api.Global
 
 	dataGroups := commonShaderDataGroups(ctx, s, cmd, resources, boundDsets, dynamicOffsets, framebuffer,
 		p.UsedDescriptors().All(), VkShaderStageFlagBits_VK_SHADER_STAGE_COMPUTE_BIT,
-		map[uint32]StageData{0: p.Stage()})
+		map[uint32]StageData{0: p.Stage()}, p.PipelineLayout())
 
 	dispatchList := &api.KeyValuePairList{}
 
@@ -2116,14 +2314,16 @@ func (p ComputePipelineObjectʳ) ResourceData(ctx context.Context, s *api.Global
 
 // SetResourceData sets resource data in a new capture.
 func (p ComputePipelineObjectʳ) SetResourceData(
-	context.Context,
-	*path.Command,
-	*api.ResourceData,
-	api.ResourceMap,
-	api.ReplaceCallback,
-	api.MutateInitialState,
-	*path.ResolveConfig) error {
-	return fmt.Errorf("SetResourceData is not supported on ComputePipeline")
+	ctx context.Context,
+	at *path.Command,
+	data *api.ResourceData,
+	resourceIDs api.ResourceMap,
+	edits api.ReplaceCallback,
+	mutate api.MutateInitialState,
+	r *path.ResolveConfig) error {
+
+	ctx = log.Enter(ctx, "ComputePipelineObject.SetResourceData()")
+	return setComputePipelineData(ctx, p, at, data, resourceIDs, edits, r)
 }
 
 func stageType(vkStage VkShaderStageFlagBits) (string, error) {
@@ -0,0 +1,292 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// shaderReflectionDataGroups returns the data groups of the SPIR-V reflection
+// of the shader of the stage, and of its cross-check against the pipeline
+// layout.
+func shaderReflectionDataGroups(ctx context.Context, s *api.GlobalState, stage StageData, words []uint32, layout PipelineLayoutObjectʳ) []*api.DataGroup {
+	reflection, err := shadertools.Reflect(words, stage.EntryPoint())
+	if err != nil {
+		log.E(ctx, "Error reflecting shader: %v", err)
+		return nil
+	}
+
+	entryPointList := &api.KeyValuePairList{}
+	entryPointList = entryPointList.AppendKeyValuePair("Name", api.CreatePoDDataValue("string", reflection.EntryPoint), false)
+	entryPointList = entryPointList.AppendKeyValuePair("Stage", api.CreateEnumDataValue("VkShaderStageFlagBits", VkShaderStageFlagBits(reflection.ShaderStage)), false)
+
+	interfaceTable := func(vars []shadertools.InterfaceVariable) *api.Table {
+		rows := []*api.Row{}
+		for _, v := range vars {
+			location := api.CreatePoDDataValue("u32", v.Location)
+			format := api.CreateEnumDataValue("VkFormat", VkFormat(v.Format))
+			if v.BuiltIn {
+				location = api.CreatePoDDataValue("", "-")
+				format = api.CreatePoDDataValue("", "-")
+			}
+			rows = append(rows, &api.Row{
+				RowValues: []*api.DataValue{
+					location,
+					api.CreatePoDDataValue("string", v.Name),
+					format,
+					api.CreatePoDDataValue("bool", v.BuiltIn),
+				},
+			})
+		}
+		return &api.Table{
+			Headers: []string{"Location", "Name", "Format", "Built-in"},
+			Rows:    rows,
+			Dynamic: false,
+			Active:  true,
+		}
+	}
+
+	bindingRows := []*api.Row{}
+	for _, set := range sortedDescriptorSets(reflection.DescriptorSets) {
+		for _, binding := range set {
+			bindingRows = append(bindingRows, &api.Row{
+				RowValues: []*api.DataValue{
+					api.CreatePoDDataValue("u32", binding.Set),
+					api.CreatePoDDataValue("u32", binding.Binding),
+					api.CreateEnumDataValue("VkDescriptorType", VkDescriptorType(binding.DescriptorType)),
+					api.CreatePoDDataValue("u32", binding.DescriptorCount),
+				},
+			})
+		}
+	}
+
+	pushConstantRows := []*api.Row{}
+	for _, block := range reflection.PushConstants {
+		pushConstantRows = append(pushConstantRows, &api.Row{
+			RowValues: []*api.DataValue{
+				api.CreatePoDDataValue("string", block.Name),
+				api.CreatePoDDataValue("u32", block.Offset),
+				api.CreatePoDDataValue("u32", block.Size),
+			},
+		})
+	}
+
+	specializations := map[uint32][]uint32{}
+	if spec := stage.Specialization(); !spec.IsNil() {
+		data, _ := spec.Data().Read(ctx, nil, s, nil)
+		for _, entry := range spec.Specializations().All() {
+			start, end := uint64(entry.Offset()), uint64(entry.Offset())+uint64(entry.Size())
+			if end > uint64(len(data)) {
+				continue
+			}
+			specializations[entry.ConstantID()] = specializationWords(data[start:end])
+		}
+	}
+
+	specRows := []*api.Row{}
+	for _, c := range reflection.SpecializationConstants {
+		value := "-"
+		if words, ok := specializations[c.SpecID]; ok {
+			value = c.FormatValue(words)
+		}
+		specRows = append(specRows, &api.Row{
+			RowValues: []*api.DataValue{
+				api.CreatePoDDataValue("u32", c.SpecID),
+				api.CreatePoDDataValue("string", c.Name),
+				api.CreatePoDDataValue("string", fmt.Sprintf("%v%v", c.Type, c.Width)),
+				api.CreatePoDDataValue("string", c.FormatValue(c.Default)),
+				api.CreatePoDDataValue("string", value),
+			},
+		})
+	}
+
+	mismatchRows := []*api.Row{}
+	for _, m := range layoutMismatches(reflection, layout) {
+		set, binding := api.CreatePoDDataValue("", "-"), api.CreatePoDDataValue("", "-")
+		if !m.pushConstant {
+			set, binding = api.CreatePoDDataValue("u32", m.set), api.CreatePoDDataValue("u32", m.binding)
+		}
+		mismatchRows = append(mismatchRows, &api.Row{
+			RowValues: []*api.DataValue{set, binding, api.CreatePoDDataValue("string", m.issue)},
+		})
+	}
+
+	return []*api.DataGroup{
+		&api.DataGroup{
+			GroupName: "Entry Point",
+			Data:      &api.DataGroup_KeyValues{entryPointList},
+		},
+
+		&api.DataGroup{
+			GroupName: "Inputs",
+			Data:      &api.DataGroup_Table{interfaceTable(reflection.Inputs)},
+		},
+
+		&api.DataGroup{
+			GroupName: "Outputs",
+			Data:      &api.DataGroup_Table{interfaceTable(reflection.Outputs)},
+		},
+
+		&api.DataGroup{
+			GroupName: "Shader Descriptor Bindings",
+			Data: &api.DataGroup_Table{&api.Table{
+				Headers: []string{"Set", "Binding", "Type", "Count"},
+				Rows:    bindingRows,
+				Dynamic: false,
+				Active:  true,
+			}},
+		},
+
+		&api.DataGroup{
+			GroupName: "Push Constants",
+			Data: &api.DataGroup_Table{&api.Table{
+				Headers: []string{"Name", "Offset", "Size"},
+				Rows:    pushConstantRows,
+				Dynamic: false,
+				Active:  true,
+			}},
+		},
+
+		&api.DataGroup{
+			GroupName: "Specialization Constants",
+			Data: &api.DataGroup_Table{&api.Table{
+				Headers: []string{"Constant ID", "Name", "Type", "Default", "Value"},
+				Rows:    specRows,
+				Dynamic: false,
+				Active:  true,
+			}},
+		},
+
+		&api.DataGroup{
+			GroupName: "Layout Mismatches",
+			Data: &api.DataGroup_Table{&api.Table{
+				Headers: []string{"Set", "Binding", "Issue"},
+				Rows:    mismatchRows,
+				Dynamic: false,
+				Active:  true,
+			}},
+		},
+	}
+}
+
+// specializationWords returns the specialization data as SPIR-V literal
+// words.
+func specializationWords(data []uint8) []uint32 {
+	words := make([]uint32, (len(data)+3)/4)
+	for i, b := range data {
+		words[i/4] |= uint32(b) << (8 * uint(i%4))
+	}
+	return words
+}
+
+// sortedDescriptorSets returns the descriptor sets ordered by set number.
+func sortedDescriptorSets(sets shadertools.DescriptorSets) []shadertools.DescriptorSet {
+	keys := make([]uint32, 0, len(sets))
+	for set := range sets {
+		keys = append(keys, set)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	out := make([]shadertools.DescriptorSet, len(keys))
+	for i, set := range keys {
+		out[i] = sets[set]
+	}
+	return out
+}
+
+// layoutMismatch is a mismatch between the resources declared by a shader and
+// the pipeline layout.
+type layoutMismatch struct {
+	pushConstant bool
+	set          uint32
+	binding      uint32
+	issue        string
+}
+
+// staticDescriptorType returns the non-dynamic descriptor type of the dynamic
+// descriptor types, as shaders do not distinguish them.
+func staticDescriptorType(t VkDescriptorType) VkDescriptorType {
+	switch t {
+	case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC:
+		return VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER
+	case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC:
+		return VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER
+	}
+	return t
+}
+
+// layoutMismatches returns the descriptor bindings and push constant blocks of
+// the shader that do not match the pipeline layout.
+func layoutMismatches(reflection shadertools.ShaderReflection, layout PipelineLayoutObjectʳ) []layoutMismatch {
+	if layout.IsNil() {
+		return nil
+	}
+	stage := VkShaderStageFlags(reflection.ShaderStage)
+	mismatches := []layoutMismatch{}
+
+	for _, set := range sortedDescriptorSets(reflection.DescriptorSets) {
+		for _, binding := range set {
+			m := layoutMismatch{set: binding.Set, binding: binding.Binding}
+			setLayout, ok := layout.SetLayouts().Lookup(binding.Set)
+			if !ok || setLayout.IsNil() {
+				m.issue = "Descriptor set is not in the pipeline layout"
+				mismatches = append(mismatches, m)
+				continue
+			}
+			layoutBinding, ok := setLayout.Bindings().Lookup(binding.Binding)
+			if !ok {
+				m.issue = "Binding is not in the descriptor set layout"
+				mismatches = append(mismatches, m)
+				continue
+			}
+			shaderType := VkDescriptorType(binding.DescriptorType)
+			if staticDescriptorType(layoutBinding.Type()) != shaderType {
+				m.issue = fmt.Sprintf("Shader declares %v, layout declares %v", shaderType, layoutBinding.Type())
+				mismatches = append(mismatches, m)
+			}
+			if binding.DescriptorCount > layoutBinding.Count() {
+				m.issue = fmt.Sprintf("Shader uses %v descriptors, layout declares %v", binding.DescriptorCount, layoutBinding.Count())
+				mismatches = append(mismatches, m)
+			}
+			if layoutBinding.Stages()&stage == 0 {
+				m.issue = fmt.Sprintf("Binding is not visible to the %v stage", VkShaderStageFlagBits(reflection.ShaderStage))
+				mismatches = append(mismatches, m)
+			}
+		}
+	}
+
+	for _, block := range reflection.PushConstants {
+		covered := false
+		for _, r := range layout.PushConstantRanges().All() {
+			if r.StageFlags()&stage != 0 && r.Offset() <= block.Offset && block.Offset+block.Size <= r.Offset()+r.Size() {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			mismatches = append(mismatches, layoutMismatch{
+				pushConstant: true,
+				issue: fmt.Sprintf("Push constant block %v [%v, %v) is not in a push constant range of the pipeline layout",
+					block.Name, block.Offset, block.Offset+block.Size),
+			})
+		}
+	}
+	return mismatches
+}
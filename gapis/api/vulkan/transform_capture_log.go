@@ -86,7 +86,7 @@ func (logTransform *captureLog) EndTransform(ctx context.Context, inputState *ap
 		log.E(ctx, "Failed to create replay storage capture: %v", err)
 		return nil, err
 	}
-	if err := c.Export(ctx, logTransform.file); err != nil {
+	if err := c.Export(ctx, logTransform.file, capture.ExportOptions{}); err != nil {
 		log.E(ctx, "Failed to write capture to file %v: %v", logTransform.file, err)
 		return nil, err
 	}
@@ -48,7 +48,16 @@ type Capture interface {
 	// Service returns the service.Capture description for this capture.
 	Service(ctx context.Context, p *path.Capture) *service.Capture
 	// Export exports the capture in binary format to the given writer.
-	Export(ctx context.Context, w io.Writer) error
+	Export(ctx context.Context, w io.Writer, opts ExportOptions) error
+}
+
+// ExportOptions controls the format of exported captures.
+type ExportOptions struct {
+	// PackVersion is the major version of the pack format of graphics
+	// captures: 3 for compressed, indexed files, or 2 for files that can be
+	// read by versions prior to the introduction of version 3. 0 writes the
+	// latest version.
+	PackVersion int
 }
 
 func init() {
@@ -154,12 +163,12 @@ func Import(ctx context.Context, name string, key string, src Source) (*path.Cap
 // Export encodes the given capture and associated resources
 // and writes it to the supplied io.Writer in the pack file format,
 // producing output suitable for use with Import or opening in the trace editor.
-func Export(ctx context.Context, p *path.Capture, w io.Writer) error {
+func Export(ctx context.Context, p *path.Capture, w io.Writer, opts ExportOptions) error {
 	c, err := ResolveFromPath(ctx, p)
 	if err != nil {
 		return err
 	}
-	return c.Export(ctx, w)
+	return c.Export(ctx, w, opts)
 }
 
 // Source represents the source of capture data.
@@ -212,7 +221,9 @@ func (f *File) Size() (uint64, error) {
 
 func toProto(ctx context.Context, c Capture) (*Record, error) {
 	buf := bytes.Buffer{}
-	if err := c.Export(ctx, &buf); err != nil {
+	// The data is only held by the database, where the resources are already
+	// deduplicated, so it isn't worth compressing.
+	if err := c.Export(ctx, &buf, ExportOptions{PackVersion: 2}); err != nil {
 		return nil, err
 	}
 	id, err := database.Store(ctx, buf.Bytes())
@@ -281,7 +292,7 @@ func fromProto(ctx context.Context, r *Record) (Capture, error) {
 
 	switch {
 	case isGFXTraceFormat(in):
-		return deserializeGFXTrace(ctx, r, in)
+		return deserializeGFXTrace(ctx, r, src, in)
 	case isPerfettoTraceFormat(in):
 		return deserializePerfettoTrace(ctx, r, in)
 	default:
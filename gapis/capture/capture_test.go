@@ -16,15 +16,19 @@ package capture_test
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/pack"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/api/test"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
 )
 
 func TestCaptureExportImport(t *testing.T) {
@@ -42,22 +46,93 @@ func TestCaptureExportImport(t *testing.T) {
 	}
 	ctx = capture.Put(ctx, p)
 
+	for _, version := range []int{0, 2, 3} {
+		buf := &bytes.Buffer{}
+		opts := capture.ExportOptions{PackVersion: version}
+		err = capture.Export(capture.Put(ctx, p), p, buf, opts)
+		if !assert.For(ctx, "capture.Export v%v", version).ThatError(err).Succeeded() {
+			return
+		}
+
+		src := &capture.Blob{Data: buf.Bytes()}
+		ip, err := capture.Import(ctx, fmt.Sprintf("key-%v", version), "imported", src)
+		if !assert.For(ctx, "capture.Import v%v", version).ThatError(err).Succeeded() {
+			return
+		}
+
+		ic, err := capture.Resolve(capture.Put(ctx, ip))
+		if !assert.For(ctx, "capture.Resolve v%v", version).ThatError(err).Succeeded() {
+			return
+		}
+
+		assert.For(ctx, "got v%v", version).That(ic.(*capture.GraphicsCapture).Commands).CustomDeepEquals(cmds, test.Cmds.IgnoreArena)
+	}
+
+	err = capture.Export(capture.Put(ctx, p), p, &bytes.Buffer{}, capture.ExportOptions{PackVersion: 1})
+	assert.For(ctx, "capture.Export v1").ThatError(err).Failed()
+}
+
+func TestCaptureExportImportResources(t *testing.T) {
+	base := log.Testing(t)
+	ctx := database.Put(base, database.NewInMemory(base))
+	// The first resource fills the objects block holding the header, so the
+	// second is in a block of its own and is loaded lazily.
+	large := make([]byte, pack.DefaultBlockSize)
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	ids := []id.ID{}
+	for _, d := range [][]byte{large, data} {
+		dataID, err := database.Store(ctx, d)
+		if !assert.For(ctx, "database.Store").ThatError(err).Succeeded() {
+			return
+		}
+		ids = append(ids, dataID)
+	}
+	cb := test.CommandBuilder{}
+	cmd := cb.CmdTypeMix(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, false, test.Voidᵖ(0x1000), 100)
+	observations := cmd.Extras().GetOrAppendObservations()
+	observations.AddRead(memory.Range{Base: 0x1000, Size: uint64(len(large))}, ids[0])
+	observations.AddRead(memory.Range{Base: 0x1000, Size: uint64(len(data))}, ids[1])
+
+	header := &capture.Header{ABI: device.WindowsX86_64}
+	c, err := capture.NewGraphicsCapture(ctx, "test", header, nil, []api.Cmd{cmd})
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	p, err := c.Path(ctx)
+	if !assert.For(ctx, "capture.Path").ThatError(err).Succeeded() {
+		return
+	}
+
 	buf := &bytes.Buffer{}
-	err = capture.Export(capture.Put(ctx, p), p, buf)
+	err = capture.Export(capture.Put(ctx, p), p, buf, capture.ExportOptions{})
 	if !assert.For(ctx, "capture.Export").ThatError(err).Succeeded() {
 		return
 	}
 
+	// Import into a new database, which doesn't hold the resources yet.
+	ctx = database.Put(base, database.NewInMemory(base))
 	src := &capture.Blob{Data: buf.Bytes()}
 	ip, err := capture.Import(ctx, "key", "imported", src)
 	if !assert.For(ctx, "capture.Import").ThatError(err).Succeeded() {
 		return
 	}
-
-	ic, err := capture.Resolve(capture.Put(ctx, ip))
+	ic, err := capture.ResolveGraphicsFromPath(ctx, ip)
 	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() {
 		return
 	}
 
-	assert.For(ctx, "got").That(ic.(*capture.GraphicsCapture).Commands).CustomDeepEquals(cmds, test.Cmds.IgnoreArena)
+	assert.For(ctx, "commands").ThatSlice(ic.Commands).IsLength(1)
+	reads := ic.Commands[0].Extras().Observations().Reads
+	if !assert.For(ctx, "reads").ThatSlice(reads).IsLength(2) {
+		return
+	}
+	// The resources are stored under their content identifier, whether they
+	// are loaded lazily or not.
+	assert.For(ctx, "large id").That(reads[0].ID).Equals(ids[0])
+	assert.For(ctx, "id").That(reads[1].ID).Equals(ids[1])
+	got, err := database.Resolve(ctx, reads[1].ID)
+	if !assert.For(ctx, "database.Resolve").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "data").ThatSlice(got).Equals(data)
 }
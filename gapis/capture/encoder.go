@@ -194,7 +194,10 @@ func (e *encoder) RemapID(ctx context.Context, id id.ID) (int64, error) {
 			return 0, err
 		}
 		res := &Resource{Index: index, Data: data.([]uint8)}
-		if err := e.w.Object(ctx, res); err != nil {
+		// The content identifier of the data is stored as the key of the
+		// resource, so that readers can load it lazily under the identifier
+		// they would give it.
+		if err := e.w.KeyedObject(ctx, res, id[:]); err != nil {
 			return 0, err
 		}
 	}
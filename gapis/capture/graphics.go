@@ -205,8 +205,17 @@ func (c *GraphicsCapture) Service(ctx context.Context, p *path.Capture) *service
 
 // Export encodes the given capture and associated resources
 // and writes it to the supplied io.Writer in the .gfxtrace format.
-func (c *GraphicsCapture) Export(ctx context.Context, w io.Writer) error {
-	writer, err := pack.NewWriter(w)
+func (c *GraphicsCapture) Export(ctx context.Context, w io.Writer, opts ExportOptions) error {
+	var writer *pack.Writer
+	var err error
+	switch opts.PackVersion {
+	case 0, 3:
+		writer, err = pack.NewBlockWriter(w, 0)
+	case 2:
+		writer, err = pack.NewWriter(w)
+	default:
+		return fmt.Errorf("Unsupported pack version: %v", opts.PackVersion)
+	}
 	if err != nil {
 		return err
 	}
@@ -216,14 +225,17 @@ func (c *GraphicsCapture) Export(ctx context.Context, w io.Writer) error {
 	// which protoconv functions need to handle resources.
 	ctx = id.PutRemapper(ctx, e)
 
-	return e.encode(ctx)
+	if err := e.encode(ctx); err != nil {
+		return err
+	}
+	return writer.Close(ctx)
 }
 
 func isGFXTraceFormat(in *bufio.Reader) bool {
 	return pack.CheckMagic(in)
 }
 
-func deserializeGFXTrace(ctx context.Context, r *Record, in io.Reader) (out *GraphicsCapture, err error) {
+func deserializeGFXTrace(ctx context.Context, r *Record, src Source, in *bufio.Reader) (out *GraphicsCapture, err error) {
 	stopTiming := analytics.SendTiming("capture", "deserialize")
 	defer func() {
 		size := len(r.Data)
@@ -240,7 +252,7 @@ func deserializeGFXTrace(ctx context.Context, r *Record, in io.Reader) (out *Gra
 	// which protoconv functions need to handle resources.
 	ctx = id.PutRemapper(ctx, d)
 
-	if err := pack.Read(ctx, in, d, false); err != nil {
+	if err := readGFXTrace(ctx, r, src, in, d); err != nil {
 		switch err := errors.Cause(err).(type) {
 		case pack.ErrUnsupportedVersion:
 			log.E(ctx, "%v", err)
@@ -293,6 +305,49 @@ func deserializeGFXTrace(ctx context.Context, r *Record, in io.Reader) (out *Gra
 	return d.builder.build(r.Name, d.header), nil
 }
 
+// readGFXTrace reads the pack file from in, calling the events of d.
+// The resources of indexed pack files are not read, but stored in the
+// database under their content identifier as lazyResources, which are only
+// read from src when first resolved.
+func readGFXTrace(ctx context.Context, r *Record, src Source, in *bufio.Reader, d *decoder) error {
+	if version, err := pack.PeekVersion(in); err != nil || version.Major < 3 {
+		return pack.Read(ctx, in, d, false)
+	}
+
+	rc, err := src.ReadCloser()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	var sourceID id.ID
+	copy(sourceID[:], r.Data)
+	index, err := openIndex(sourceID, src, rc)
+	switch {
+	case err == pack.ErrMissingIndex:
+		// The capture was truncated before the index was written.
+		log.W(ctx, "Capture is missing its index. Reading it sequentially.")
+		fallthrough
+	case err == nil && index == nil:
+		return pack.Read(ctx, in, d, false)
+	case err != nil:
+		return err
+	}
+
+	size, _ := src.Size()
+	for i, b := range index.Blocks {
+		if b.Kind == pack.ObjectsBlock {
+			err = readObjectsBlock(ctx, sourceID, index, i, d)
+		} else {
+			err = index.ReadBlock(ctx, i, d)
+		}
+		if err != nil {
+			return err
+		}
+		status.UpdateProgress(ctx, uint64(b.Offset+b.Size), size)
+	}
+	return nil
+}
+
 type builder struct {
 	apis         []api.API
 	seenAPIs     map[api.ID]struct{}
@@ -361,6 +416,16 @@ func (b *builder) addRes(ctx context.Context, expectedIndex int64, data []byte)
 	return nil
 }
 
+// addLazyRes adds the resource with the given content identifier, whose data
+// is only resolved from res when first needed.
+func (b *builder) addLazyRes(ctx context.Context, dID id.ID, res database.Resolvable) error {
+	if err := database.StoreLazy(ctx, dID, res); err != nil {
+		return err
+	}
+	b.resIDs = append(b.resIDs, dID)
+	return nil
+}
+
 func (b *builder) addInitialState(ctx context.Context, state api.State) error {
 	if _, ok := b.initialState.APIs[state.API()]; ok {
 		return fmt.Errorf("We have more than one set of initial state for API %v", state.API())
@@ -0,0 +1,240 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/pack"
+	"github.com/google/gapid/gapis/database"
+)
+
+// lazyBlockCacheSize is the number of decoded resource blocks kept in memory.
+// Resources are usually resolved in capture order, so a few blocks are enough
+// to avoid decoding a block once per resource.
+const lazyBlockCacheSize = 4
+
+type lazyBlockKey struct {
+	source id.ID
+	block  int
+}
+
+var lazyBlocks = struct {
+	sync.Mutex
+	resources map[lazyBlockKey][][]byte
+	order     []lazyBlockKey
+}{resources: map[lazyBlockKey][][]byte{}}
+
+// indexKey identifies the file of a capture source. The size guards against
+// the file being replaced.
+type indexKey struct {
+	source id.ID
+	size   uint64
+}
+
+// lazyIndexCacheSize is the number of parsed capture file indices kept in
+// memory. An index is read when its capture is loaded, and then each time a
+// block of the capture is decoded.
+const lazyIndexCacheSize = 4
+
+// lazyIndices holds the parsed index of the most recently opened indexed
+// capture files, so that the index isn't read once per decoded block.
+var lazyIndices = struct {
+	sync.Mutex
+	indices map[indexKey]*pack.IndexedReader
+	order   []indexKey
+}{indices: map[indexKey]*pack.IndexedReader{}}
+
+// lazyResource is the database.Resolvable of a resource of an indexed capture
+// file, which is only read from the capture file when first resolved. It is
+// stored in the database under the content identifier of the resource.
+type lazyResource struct {
+	source id.ID // The database identifier of the capture Source.
+	block  int   // The index of the pack block holding the resource.
+	object int   // The index of the resource in the objects of the block.
+}
+
+// Resolve implements the database.Resolvable interface.
+// It reads the resource data from the capture file.
+func (r *lazyResource) Resolve(ctx context.Context) (interface{}, error) {
+	resources, err := loadResourceBlock(ctx, lazyBlockKey{r.source, r.block})
+	if err != nil {
+		return nil, err
+	}
+	if r.object >= len(resources) {
+		return nil, fmt.Errorf("Resource %v not found in block %v of the capture", r.object, r.block)
+	}
+	return resources[r.object], nil
+}
+
+// loadResourceBlock returns the data of the resources of the capture block,
+// decoding the block if it is not cached.
+func loadResourceBlock(ctx context.Context, key lazyBlockKey) ([][]byte, error) {
+	lazyBlocks.Lock()
+	resources, ok := lazyBlocks.resources[key]
+	lazyBlocks.Unlock()
+	if ok {
+		return resources, nil
+	}
+
+	data, err := database.Resolve(ctx, key.source)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load capture data source: %v", err)
+	}
+	src, ok := data.(Source)
+	if !ok {
+		return nil, fmt.Errorf("Unable to load capture data source: Failed to resolve capture.Source")
+	}
+	in, err := src.ReadCloser()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	index, err := openIndex(key.source, src, in)
+	switch {
+	case err != nil:
+		return nil, err
+	case index == nil:
+		return nil, fmt.Errorf("Capture data source does not support random access")
+	}
+
+	c := &resourceCollector{}
+	if err := index.ReadBlock(ctx, key.block, c); err != nil {
+		return nil, err
+	}
+
+	lazyBlocks.Lock()
+	defer lazyBlocks.Unlock()
+	if _, ok := lazyBlocks.resources[key]; !ok {
+		if len(lazyBlocks.order) == lazyBlockCacheSize {
+			delete(lazyBlocks.resources, lazyBlocks.order[0])
+			lazyBlocks.order = lazyBlocks.order[1:]
+		}
+		lazyBlocks.resources[key] = c.data
+		lazyBlocks.order = append(lazyBlocks.order, key)
+	}
+	return c.data, nil
+}
+
+// openIndex returns the index of the capture file held by the source with
+// the given database identifier, reading the blocks from in. It returns nil
+// if in does not support random access. The parsed indices of the last opened
+// files are cached.
+func openIndex(sourceID id.ID, src Source, in io.ReadCloser) (*pack.IndexedReader, error) {
+	ra, ok := in.(io.ReaderAt)
+	if !ok {
+		return nil, nil
+	}
+	size, err := src.Size()
+	if err != nil {
+		return nil, err
+	}
+	key := indexKey{sourceID, size}
+
+	lazyIndices.Lock()
+	index, ok := lazyIndices.indices[key]
+	lazyIndices.Unlock()
+	if ok {
+		return index.WithReader(ra), nil
+	}
+
+	index, err = pack.NewIndexedReader(ra, int64(size), false)
+	if err != nil {
+		return nil, err
+	}
+	lazyIndices.Lock()
+	defer lazyIndices.Unlock()
+	if _, ok := lazyIndices.indices[key]; !ok {
+		if len(lazyIndices.order) == lazyIndexCacheSize {
+			delete(lazyIndices.indices, lazyIndices.order[0])
+			lazyIndices.order = lazyIndices.order[1:]
+		}
+		// Don't keep a reference to in, which is closed by the caller.
+		lazyIndices.indices[key] = index.WithReader(nil)
+		lazyIndices.order = append(lazyIndices.order, key)
+	}
+	return index, nil
+}
+
+// readObjectsBlock reads the objects block of the capture with the given
+// index, calling the events of d. The resources of blocks that only hold
+// resources with a content identifier in the index are not read, but stored
+// as lazyResources, which are only read when first resolved.
+func readObjectsBlock(ctx context.Context, sourceID id.ID, index *pack.IndexedReader, block int, d *decoder) error {
+	ids, ok := resourceIDs(index, index.Blocks[block])
+	if !ok {
+		return index.ReadBlock(ctx, block, d)
+	}
+	for i, id := range ids {
+		res := &lazyResource{source: sourceID, block: block, object: i}
+		if err := d.builder.addLazyRes(ctx, id, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceIDs returns the content identifiers of the resources of the block,
+// if the block only holds resources written with their identifier as key.
+func resourceIDs(index *pack.IndexedReader, b pack.Block) ([]id.ID, bool) {
+	if b.Kind != pack.ObjectsBlock || len(b.Objects) == 0 || len(b.Keys) != len(b.Objects) {
+		return nil, false
+	}
+	name := proto.MessageName(&Resource{})
+	ids := make([]id.ID, len(b.Objects))
+	for i, ty := range b.Objects {
+		if index.TypeName(ty) != name || len(b.Keys[i]) != len(ids[i]) {
+			return nil, false
+		}
+		copy(ids[i][:], b.Keys[i])
+	}
+	return ids, true
+}
+
+// resourceCollector is the pack.Events collecting the data of the resources
+// of a resource block.
+type resourceCollector struct {
+	data [][]byte
+}
+
+func (c *resourceCollector) BeginGroup(ctx context.Context, msg proto.Message, id uint64) error {
+	return fmt.Errorf("Unexpected group in resource block")
+}
+
+func (c *resourceCollector) BeginChildGroup(ctx context.Context, msg proto.Message, id, parentID uint64) error {
+	return fmt.Errorf("Unexpected group in resource block")
+}
+
+func (c *resourceCollector) EndGroup(ctx context.Context, id uint64) error {
+	return fmt.Errorf("Unexpected group in resource block")
+}
+
+func (c *resourceCollector) Object(ctx context.Context, msg proto.Message) error {
+	res, ok := msg.(*Resource)
+	if !ok {
+		return fmt.Errorf("Unexpected %T in resource block", msg)
+	}
+	c.data = append(c.data, res.Data)
+	return nil
+}
+
+func (c *resourceCollector) ChildObject(ctx context.Context, msg proto.Message, parentID uint64) error {
+	return fmt.Errorf("Unexpected child object in resource block")
+}
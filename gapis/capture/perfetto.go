@@ -55,7 +55,7 @@ func (c *PerfettoCapture) Service(ctx context.Context, p *path.Capture) *service
 	}
 }
 
-func (c *PerfettoCapture) Export(ctx context.Context, w io.Writer) error {
+func (c *PerfettoCapture) Export(ctx context.Context, w io.Writer, opts ExportOptions) error {
 	return errors.New("export not supported")
 }
 
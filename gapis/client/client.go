@@ -492,6 +492,20 @@ func (c *client) DCECapture(ctx context.Context, capture *path.Capture, commands
 	return res.GetCapture(), nil
 }
 
+func (c *client) ExplainLiveness(ctx context.Context, requested, kept *path.Command) (*service.LivenessChain, error) {
+	res, err := c.client.ExplainLiveness(ctx, &service.ExplainLivenessRequest{
+		Requested: requested,
+		Kept:      kept,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetChain(), nil
+}
+
 func (c *client) SplitCapture(ctx context.Context, rng *path.Commands) (*path.Capture, error) {
 	res, err := c.client.SplitCapture(ctx, &service.SplitCaptureRequest{
 		Commands: rng,
@@ -536,10 +550,11 @@ func (c *client) GetTimestamps(ctx context.Context, req *service.GetTimestampsRe
 	return event.Feed(ctx, event.AsHandler(ctx, h), grpcutil.ToProducer(stream))
 }
 
-func (c *client) GetGraphVisualization(ctx context.Context, capture *path.Capture, format service.GraphFormat) ([]byte, error) {
+func (c *client) GetGraphVisualization(ctx context.Context, capture *path.Capture, format service.GraphFormat, opts *service.GraphVisualizationOptions) ([]byte, error) {
 	res, err := c.client.GetGraphVisualization(ctx, &service.GraphVisualizationRequest{
 		Capture: capture,
 		Format:  format,
+		Options: opts,
 	})
 	if err != nil {
 		return []byte{}, err
@@ -550,6 +565,21 @@ func (c *client) GetGraphVisualization(ctx context.Context, capture *path.Captur
 	return res.GetGraphVisualization(), nil
 }
 
+func (c *client) DiffCaptures(ctx context.Context, reference, value *path.Capture, opts *service.DiffCapturesOptions) (*service.CaptureDiff, error) {
+	res, err := c.client.DiffCaptures(ctx, &service.DiffCapturesRequest{
+		Reference: reference,
+		Value:     value,
+		Options:   opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDiff(), nil
+}
+
 func (c *client) PerfettoQuery(ctx context.Context, capture *path.Capture, query string) (*perfetto.QueryResult, error) {
 	res, err := c.client.PerfettoQuery(ctx, &service.PerfettoQueryRequest{
 		Capture: capture,
@@ -17,6 +17,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/context/keys"
@@ -81,6 +82,58 @@ func GetOrBuild(ctx context.Context, r Resolvable) (interface{}, error) {
 	return nil, nil
 }
 
+// StoreLazy adds the blob with the given identifier to the database held by
+// the context, without its data. The data is only resolved from source when
+// the blob is first resolved, and may be resolved again if it is evicted. id
+// must be the identifier Store would return for the data, which is checked
+// when it is resolved. Nothing is stored if the database already holds the
+// blob.
+func StoreLazy(ctx context.Context, id id.ID, source Resolvable) error {
+	m, ok := Get(ctx).(*memory)
+	if !ok {
+		return fmt.Errorf("Database does not support lazy blobs")
+	}
+	m.storeLazy(ctx, id, source)
+	return nil
+}
+
+// RecordStats holds the statistics of the records of a single type held by a
+// database.
+type RecordStats struct {
+	// Type is the name of the record type.
+	Type string
+	// Count is the number of records held.
+	Count uint64
+	// Resolved is the number of records holding a resolved object.
+	Resolved uint64
+	// Evicted is the number of times a record has been evicted.
+	Evicted uint64
+	// DataBytes is the number of bytes of encoded record data.
+	DataBytes uint64
+	// ObjectBytes is the estimated number of bytes of resolved objects.
+	ObjectBytes uint64
+}
+
+// Stats returns the statistics of the records held by the database attached
+// to the given context, by record type. Stats returns nil if the database
+// does not support statistics.
+func Stats(ctx context.Context) []RecordStats {
+	if m, ok := Get(ctx).(*memory); ok {
+		return m.stats()
+	}
+	return nil
+}
+
+// SetMemoryLimit sets the estimated number of bytes that the records of the
+// database attached to the given context can use before the least recently
+// used resolved objects are evicted. Evicted objects are resolved again when
+// they are next needed. A limit of 0 disables eviction.
+func SetMemoryLimit(ctx context.Context, limit uint64) {
+	if m, ok := Get(ctx).(*memory); ok {
+		m.setLimit(ctx, limit)
+	}
+}
+
 type databaseKeyTy string
 
 const databaseKey = databaseKeyTy("database")
@@ -0,0 +1,392 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+)
+
+const (
+	// recordExt is the file extension of an encoded record.
+	recordExt = ".rec"
+	// resultExt is the file extension of an encoded resolved object.
+	resultExt = ".res"
+	// versionPrefix is the prefix of the per-version cache directories.
+	versionPrefix = "v-"
+	// evictFraction is the fraction of the maximum size that the cache is
+	// shrunk to when it is evicting files.
+	evictFraction = 0.9
+	// objectPrefix is the prefix of the record type of resolved objects that
+	// were written as the proto form of a Go object.
+	objectPrefix = "<object>"
+	// touchInterval is the minimum interval between updates of the
+	// modification time of a file, which is only used to rebuild the LRU
+	// order when the directory is next opened.
+	touchInterval = time.Minute
+)
+
+// NewOnDisk builds a new database that holds its records in memory, like the
+// database returned by NewInMemory, but which also persists the encoded
+// records and the resolved objects to the directory dir. Resolved objects are
+// only persisted if they are blobs, protos, or have a converter registered
+// with protoconv; all other objects are rebuilt by each instance. Records and
+// resolved objects found in dir are reused instead of being recomputed, so a
+// later gapis instance using the same directory does not need to repeat the
+// work of an earlier one.
+//
+// Files are kept in a subdirectory specific to version, and the directories of
+// all other versions are deleted. The least recently used files are evicted
+// to keep the total size of the files under maxSize bytes.
+func NewOnDisk(ctx context.Context, dir, version string, maxSize uint64) (Database, error) {
+	disk, err := openDisk(ctx, dir, version, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	m := &memory{}
+	m.records = map[id.ID]*record{}
+	m.disk = disk
+	m.resolveCtx = Put(ctx, m)
+	return m, nil
+}
+
+// disk is a size-bounded store of encoded records and resolved objects held
+// in a directory.
+type disk struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize uint64
+	size    uint64
+	files   map[string]*list.Element // file name -> element holding a *diskFile
+	lru     *list.List               // least recently used at the front
+}
+
+type diskFile struct {
+	name    string
+	size    uint64
+	touched time.Time // the last modification time written to the file
+}
+
+func openDisk(ctx context.Context, dir, version string, maxSize uint64) (*disk, error) {
+	versionDir := versionPrefix + id.OfString(version).String()
+	if err := os.MkdirAll(filepath.Join(dir, versionDir), 0755); err != nil {
+		return nil, log.Errf(ctx, err, "Couldn't create the database directory")
+	}
+
+	// Remove the files of any other version, as they can never be used.
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Couldn't read the database directory")
+	}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != versionDir && strings.HasPrefix(e.Name(), versionPrefix) {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				log.W(ctx, "Couldn't remove stale database directory %v: %v", e.Name(), err)
+			}
+		}
+	}
+
+	d := &disk{
+		dir:     filepath.Join(dir, versionDir),
+		maxSize: maxSize,
+		files:   map[string]*list.Element{},
+		lru:     list.New(),
+	}
+
+	// Rebuild the LRU order from the modification times, which are updated
+	// each time a file is used.
+	entries, err = ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Couldn't read the database directory")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, e := range entries {
+		switch {
+		case e.IsDir():
+		case filepath.Ext(e.Name()) == recordExt, filepath.Ext(e.Name()) == resultExt:
+			f := &diskFile{e.Name(), uint64(e.Size()), e.ModTime()}
+			d.files[f.name] = d.lru.PushBack(f)
+			d.size += f.size
+		default:
+			// Most likely a temporary file left over from a crash.
+			os.Remove(filepath.Join(d.dir, e.Name()))
+		}
+	}
+
+	d.mutex.Lock()
+	d.evictLocked(ctx)
+	d.mutex.Unlock()
+
+	log.I(ctx, "Database directory '%v' holds %d files (%v bytes)", d.dir, len(d.files), d.size)
+	return d, nil
+}
+
+// loadRecord returns the record with the given identifier, or nil if the
+// record is not held on disk.
+func (d *disk) loadRecord(ctx context.Context, id id.ID) *record {
+	ty, data, ok := d.read(ctx, id.String()+recordExt)
+	if !ok {
+		return nil
+	}
+	return &record{data: data, ty: ty}
+}
+
+// hasRecord returns true if the record with the given identifier is held on
+// disk.
+func (d *disk) hasRecord(id id.ID) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, got := d.files[id.String()+recordExt]
+	return got
+}
+
+// storeRecord writes the encoded record with the given identifier, unless
+// it is already held on disk.
+func (d *disk) storeRecord(ctx context.Context, id id.ID, ty recordType, data []byte) {
+	if ty == blobFunc {
+		ty = blob
+	}
+	d.write(ctx, id.String()+recordExt, ty, data)
+}
+
+// loadResult returns the resolved object for the record with the given
+// identifier, or false if no resolved object is held on disk.
+func (d *disk) loadResult(ctx context.Context, id id.ID) (interface{}, bool) {
+	ty, data, ok := d.read(ctx, id.String()+resultExt)
+	if !ok {
+		return nil, false
+	}
+	isObject := strings.HasPrefix(string(ty), objectPrefix)
+	ty = recordType(strings.TrimPrefix(string(ty), objectPrefix))
+	obj, err := (&record{data: data, ty: ty}).decode(ctx)
+	if err == nil && isObject {
+		obj, err = protoconv.ToObject(ctx, obj.(proto.Message))
+	}
+	if err != nil {
+		log.W(ctx, "Couldn't decode the resolved object for %v: %v", id, err)
+		d.remove(id.String() + resultExt)
+		return nil, false
+	}
+	return obj, true
+}
+
+// storeResult writes the resolved object obj for the record with the given
+// identifier. Blobs and protos are written as they are, and other objects are
+// written as their proto form if they have a converter registered with
+// protoconv. All other objects are ignored as they cannot be rebuilt.
+func (d *disk) storeResult(ctx context.Context, id id.ID, obj interface{}) {
+	var ty recordType
+	var data []byte
+	switch obj := obj.(type) {
+	case []byte:
+		ty, data = blob, obj
+	case proto.Message:
+		var err error
+		if data, err = proto.Marshal(obj); err != nil {
+			return
+		}
+		ty = recordType(proto.MessageName(obj))
+	default:
+		msg, err := protoconv.ToProto(ctx, obj)
+		if err != nil {
+			return
+		}
+		if data, err = proto.Marshal(msg); err != nil {
+			return
+		}
+		ty = recordType(objectPrefix + proto.MessageName(msg))
+	}
+	d.write(ctx, id.String()+resultExt, ty, data)
+}
+
+// read returns the record type and data of the named file, and marks the
+// file as the most recently used.
+func (d *disk) read(ctx context.Context, name string) (recordType, []byte, bool) {
+	if !d.touch(name) {
+		return "", nil, false
+	}
+	f, err := os.Open(filepath.Join(d.dir, name))
+	if err != nil {
+		d.remove(name)
+		return "", nil, false
+	}
+	ty, data, err := decodeDiskFile(bufio.NewReader(f))
+	f.Close()
+	if err == nil && ty != blob && proto.MessageType(strings.TrimPrefix(string(ty), objectPrefix)) == nil {
+		err = fmt.Errorf("Unknown record type '%v'", ty)
+	}
+	if err != nil {
+		log.W(ctx, "Couldn't read database file %v: %v", name, err)
+		d.remove(name)
+		return "", nil, false
+	}
+	return ty, data, true
+}
+
+// write writes the record type and data to the named file, and evicts the
+// least recently used files if the store is now too large.
+func (d *disk) write(ctx context.Context, name string, ty recordType, data []byte) {
+	if d.touch(name) {
+		return // Already stored.
+	}
+
+	tmp, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		log.W(ctx, "Couldn't create database file: %v", err)
+		return
+	}
+	w := bufio.NewWriter(tmp)
+	err = encodeDiskFile(w, ty, data)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(d.dir, name))
+	}
+	if err != nil {
+		log.W(ctx, "Couldn't write database file %v: %v", name, err)
+		os.Remove(tmp.Name())
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, got := d.files[name]; got {
+		return // Written concurrently.
+	}
+	f := &diskFile{name, diskFileSize(ty, data), time.Now()}
+	d.files[name] = d.lru.PushBack(f)
+	d.size += f.size
+	d.evictLocked(ctx)
+}
+
+// touch marks the named file as the most recently used, returning false if
+// the file is not held on disk. The modification time of the file is updated
+// at most once every touchInterval.
+func (d *disk) touch(name string) bool {
+	now := time.Now()
+	d.mutex.Lock()
+	e, got := d.files[name]
+	if !got {
+		d.mutex.Unlock()
+		return false
+	}
+	d.lru.MoveToBack(e)
+	f := e.Value.(*diskFile)
+	stale := now.Sub(f.touched) >= touchInterval
+	if stale {
+		f.touched = now
+	}
+	d.mutex.Unlock()
+
+	if stale {
+		os.Chtimes(filepath.Join(d.dir, name), now, now)
+	}
+	return true
+}
+
+// remove deletes the named file.
+func (d *disk) remove(name string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if e, got := d.files[name]; got {
+		d.removeLocked(e)
+	}
+}
+
+func (d *disk) removeLocked(e *list.Element) {
+	f := d.lru.Remove(e).(*diskFile)
+	delete(d.files, f.name)
+	d.size -= f.size
+	os.Remove(filepath.Join(d.dir, f.name))
+}
+
+// evictLocked removes the least recently used files until the total size is
+// below the eviction threshold, if the maximum size has been exceeded.
+func (d *disk) evictLocked(ctx context.Context) {
+	if d.size <= d.maxSize {
+		return
+	}
+	target := uint64(float64(d.maxSize) * evictFraction)
+	count := 0
+	for d.size > target && d.lru.Len() > 0 {
+		d.removeLocked(d.lru.Front())
+		count++
+	}
+	log.D(ctx, "Evicted %d database files", count)
+}
+
+// The database files are encoded as:
+//
+//	uvarint  length of the record type
+//	[]byte   record type
+//	[]byte   data, up to the end of the file
+func encodeDiskFile(w io.Writer, ty recordType, data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(ty)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(ty)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func decodeDiskFile(r *bufio.Reader) (recordType, []byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", nil, err
+	}
+	ty := make([]byte, n)
+	if _, err := io.ReadFull(r, ty); err != nil {
+		return "", nil, err
+	}
+	if len(ty) == 0 {
+		return "", nil, fmt.Errorf("Missing record type")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return recordType(ty), data, nil
+}
+
+func diskFileSize(ty recordType, data []byte) uint64 {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return uint64(binary.PutUvarint(buf, uint64(len(ty))) + len(ty) + len(data))
+}
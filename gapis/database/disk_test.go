@@ -0,0 +1,205 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/pod"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+)
+
+// testResult is a resolved object that is persisted through its proto form.
+type testResult []uint64
+
+// testUnconvertible is a resolved object without a proto form.
+type testUnconvertible struct{ value int }
+
+func init() {
+	protoconv.Register(
+		func(ctx context.Context, r testResult) (*pod.Uint64Array, error) {
+			return &pod.Uint64Array{Val: r}, nil
+		},
+		func(ctx context.Context, a *pod.Uint64Array) (testResult, error) {
+			return testResult(a.Val), nil
+		},
+	)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "database-test")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary directory: %v", err)
+	}
+	return dir
+}
+
+func TestDiskRoundTrip(t *testing.T) {
+	ctx := log.Testing(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	db, err := NewOnDisk(ctx, dir, "1", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	blobID, err := db.Store(ctx, []byte("a blob"))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	protoID, err := db.Store(ctx, &pod.StringArray{Val: []string{"a", "record"}})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	results := map[id.ID]interface{}{
+		id.OfString("blob"):          []byte("a resolved blob"),
+		id.OfString("proto"):         &pod.StringArray{Val: []string{"a", "proto"}},
+		id.OfString("object"):        testResult{1, 2, 3},
+		id.OfString("unconvertible"): testUnconvertible{4},
+	}
+	for id, obj := range results {
+		db.(*memory).disk.storeResult(ctx, id, obj)
+	}
+
+	// A new database using the same directory finds what the first stored.
+	db, err = NewOnDisk(ctx, dir, "1", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "contains").ThatBoolean(db.Contains(ctx, blobID)).IsTrue()
+	got, err := db.Resolve(ctx, blobID)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "blob").That(got).DeepEquals([]byte("a blob"))
+	got, err = db.Resolve(ctx, protoID)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "proto").ThatSlice(got.(*pod.StringArray).Val).Equals([]string{"a", "record"})
+
+	disk := db.(*memory).disk
+	for id, obj := range results {
+		got, ok := disk.loadResult(ctx, id)
+		if _, unconvertible := obj.(testUnconvertible); unconvertible {
+			assert.For(ctx, "loaded %T", obj).ThatBoolean(ok).IsFalse()
+			continue
+		}
+		assert.For(ctx, "loaded %T", obj).ThatBoolean(ok).IsTrue()
+		if msg, ok := obj.(proto.Message); ok {
+			assert.For(ctx, "result %T", obj).ThatBoolean(proto.Equal(got.(proto.Message), msg)).IsTrue()
+		} else {
+			assert.For(ctx, "result %T", obj).That(got).DeepEquals(obj)
+		}
+	}
+}
+
+func TestDiskEviction(t *testing.T) {
+	ctx := log.Testing(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Each blob takes 1 + len("<blob>") + 20 = 27 bytes.
+	d, err := openDisk(ctx, dir, "1", 100)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	data := []byte("01234567890123456789")
+	a, b, c, e := id.OfString("a"), id.OfString("b"), id.OfString("c"), id.OfString("e")
+	d.storeRecord(ctx, a, blob, data)
+	d.storeRecord(ctx, b, blob, data)
+	d.storeRecord(ctx, c, blob, data)
+	assert.For(ctx, "size").That(d.size).Equals(uint64(81))
+
+	// Using a makes b the least recently used, so b is evicted to make space
+	// for e.
+	assert.For(ctx, "loaded a").That(d.loadRecord(ctx, a)).IsNotNil()
+	d.storeRecord(ctx, e, blob, data)
+	assert.For(ctx, "size").That(d.size).Equals(uint64(81))
+	for _, test := range []struct {
+		name     string
+		id       id.ID
+		expected bool
+	}{{"a", a, true}, {"b", b, false}, {"c", c, true}, {"e", e, true}} {
+		assert.For(ctx, "has %v", test.name).ThatBoolean(d.hasRecord(test.id)).Equals(test.expected)
+		_, err := os.Stat(filepath.Join(d.dir, test.id.String()+recordExt))
+		assert.For(ctx, "%v on disk", test.name).ThatBoolean(err == nil).Equals(test.expected)
+	}
+
+	// Reopening with a smaller bound evicts the least recently used files,
+	// using the order recorded in the modification times.
+	for i, id := range []id.ID{c, e, a} {
+		ts := time.Now().Add(time.Duration(i-10) * time.Hour)
+		os.Chtimes(filepath.Join(d.dir, id.String()+recordExt), ts, ts)
+	}
+	d, err = openDisk(ctx, dir, "1", 60)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "size").That(d.size).Equals(uint64(54))
+	assert.For(ctx, "has c").ThatBoolean(d.hasRecord(c)).IsFalse()
+	assert.For(ctx, "has e").ThatBoolean(d.hasRecord(e)).IsTrue()
+	assert.For(ctx, "has a").ThatBoolean(d.hasRecord(a)).IsTrue()
+}
+
+func TestDiskTouchIsThrottled(t *testing.T) {
+	ctx := log.Testing(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := openDisk(ctx, dir, "1", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	a := id.OfString("a")
+	d.storeRecord(ctx, a, blob, []byte("data"))
+	name := filepath.Join(d.dir, a.String()+recordExt)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(name, old, old)
+	modTime := func() time.Time {
+		info, err := os.Stat(name)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		return info.ModTime()
+	}
+
+	// The file was just written, so reading it doesn't update the time.
+	d.loadRecord(ctx, a)
+	assert.For(ctx, "mod time").ThatBoolean(modTime().Equal(old)).IsTrue()
+
+	d.files[a.String()+recordExt].Value.(*diskFile).touched = old
+	d.loadRecord(ctx, a)
+	assert.For(ctx, "mod time").ThatBoolean(modTime().After(old)).IsTrue()
+}
+
+func TestDiskRemovesOtherVersions(t *testing.T) {
+	ctx := log.Testing(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := openDisk(ctx, dir, "1", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	a := id.OfString("a")
+	d.storeRecord(ctx, a, blob, []byte("data"))
+	oldDir := d.dir
+	// Unrelated directories and leftover temporary files.
+	os.Mkdir(filepath.Join(dir, "unrelated"), 0755)
+	ioutil.WriteFile(filepath.Join(oldDir, "tmp-123"), []byte("partial"), 0644)
+
+	d, err = openDisk(ctx, dir, "1", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "same version has a").ThatBoolean(d.hasRecord(a)).IsTrue()
+	_, err = os.Stat(filepath.Join(oldDir, "tmp-123"))
+	assert.For(ctx, "temporary file removed").ThatBoolean(os.IsNotExist(err)).IsTrue()
+
+	d, err = openDisk(ctx, dir, "2", 1<<20)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "new version has a").ThatBoolean(d.hasRecord(a)).IsFalse()
+	_, err = os.Stat(oldDir)
+	assert.For(ctx, "old version removed").ThatBoolean(os.IsNotExist(err)).IsTrue()
+	_, err = os.Stat(filepath.Join(dir, "unrelated"))
+	assert.For(ctx, "unrelated kept").ThatError(err).Succeeded()
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"sync"
+)
+
+// mapEntryOverhead is the estimated number of bytes used by a map for each
+// entry, in addition to the key and value.
+const mapEntryOverhead = 8
+
+// estimateSize returns the estimated number of bytes of memory used by v,
+// including all the memory reachable from v. Memory reachable through any of
+// the pointers for which skip returns true is not included.
+func estimateSize(v interface{}, skip func(uintptr) bool) uint64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return uint64(cap(v))
+	}
+	e := sizeEstimator{seen: map[uintptr]struct{}{}, skip: skip}
+	rv := reflect.ValueOf(v)
+	return uint64(rv.Type().Size()) + e.indirect(rv)
+}
+
+type sizeEstimator struct {
+	seen map[uintptr]struct{}
+	skip func(uintptr) bool
+}
+
+// visit returns true if the memory at p has not been seen before and should
+// be included in the estimate.
+func (e *sizeEstimator) visit(p uintptr) bool {
+	if _, seen := e.seen[p]; seen {
+		return false
+	}
+	e.seen[p] = struct{}{}
+	return e.skip == nil || !e.skip(p)
+}
+
+// indirect returns the estimated number of bytes referenced by v, not
+// including the bytes of v itself.
+func (e *sizeEstimator) indirect(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !e.visit(v.Pointer()) {
+			return 0
+		}
+		el := v.Elem()
+		return uint64(el.Type().Size()) + e.indirect(el)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		el := v.Elem()
+		size := e.indirect(el)
+		if el.Kind() != reflect.Ptr {
+			// Non-pointer values are boxed by the interface.
+			size += uint64(el.Type().Size())
+		}
+		return size
+
+	case reflect.String:
+		return uint64(v.Len())
+
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() == 0 || !e.visit(v.Pointer()) {
+			return 0
+		}
+		elTy := v.Type().Elem()
+		size := uint64(v.Cap()) * uint64(elTy.Size())
+		if hasPointers(elTy) {
+			for i, c := 0, v.Len(); i < c; i++ {
+				size += e.indirect(v.Index(i))
+			}
+		}
+		return size
+
+	case reflect.Array:
+		size := uint64(0)
+		if hasPointers(v.Type().Elem()) {
+			for i, c := 0, v.Len(); i < c; i++ {
+				size += e.indirect(v.Index(i))
+			}
+		}
+		return size
+
+	case reflect.Map:
+		if v.IsNil() || !e.visit(v.Pointer()) {
+			return 0
+		}
+		t := v.Type()
+		entrySize := uint64(t.Key().Size()) + uint64(t.Elem().Size()) + mapEntryOverhead
+		size := uint64(v.Len()) * entrySize
+		if hasPointers(t.Key()) || hasPointers(t.Elem()) {
+			for it := v.MapRange(); it.Next(); {
+				size += e.indirect(it.Key()) + e.indirect(it.Value())
+			}
+		}
+		return size
+
+	case reflect.Struct:
+		size := uint64(0)
+		if hasPointers(v.Type()) {
+			for i, c := 0, v.NumField(); i < c; i++ {
+				size += e.indirect(v.Field(i))
+			}
+		}
+		return size
+
+	default:
+		return 0
+	}
+}
+
+var hasPointersCache sync.Map // reflect.Type -> bool
+
+// hasPointers returns true if values of type t can reference other memory
+// that needs to be included in size estimates.
+func hasPointers(t reflect.Type) bool {
+	if v, ok := hasPointersCache.Load(t); ok {
+		return v.(bool)
+	}
+	out := false
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.String, reflect.Slice, reflect.Map:
+		out = true
+	case reflect.Array:
+		out = hasPointers(t.Elem())
+	case reflect.Struct:
+		for i, c := 0, t.NumField(); i < c; i++ {
+			if hasPointers(t.Field(i).Type) {
+				out = true
+				break
+			}
+		}
+	}
+	hasPointersCache.Store(t, out)
+	return out
+}
+
+// rootPointers returns the pointers that can be reached from v without
+// following any pointers, maps or slices. These are used to identify the
+// objects owned by each record.
+func rootPointers(v interface{}) []uintptr {
+	out := []uintptr{}
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice:
+			if !v.IsNil() {
+				out = append(out, v.Pointer())
+			}
+		case reflect.Interface:
+			if !v.IsNil() {
+				visit(v.Elem())
+			}
+		case reflect.Struct:
+			for i, c := 0, v.NumField(); i < c; i++ {
+				visit(v.Field(i))
+			}
+		}
+	}
+	if v != nil {
+		visit(reflect.ValueOf(v))
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+type estimateNode struct {
+	name  string
+	next  *estimateNode
+	data  []uint32
+	value interface{}
+}
+
+func TestEstimateSize(t *testing.T) {
+	ctx := log.Testing(t)
+	const (
+		nodeSize = uint64(unsafe.Sizeof(estimateNode{}))
+		ptrSize  = uint64(unsafe.Sizeof(uintptr(0)))
+	)
+	shared := []uint32{1, 2, 3, 4}
+	cycle := &estimateNode{name: "abc"}
+	cycle.next = cycle
+	m := map[int32]int64{1: 1, 2: 2, 3: 3}
+
+	for _, test := range []struct {
+		name     string
+		value    interface{}
+		skip     func(uintptr) bool
+		expected uint64
+	}{
+		{"nil", nil, nil, 0},
+		{"blob", make([]byte, 10, 32), nil, 32},
+		{"string", "hello", nil, uint64(unsafe.Sizeof("")) + 5},
+		{"slice", make([]uint32, 2, 10), nil, uint64(unsafe.Sizeof([]uint32{})) + 40},
+		{"map", m, nil, ptrSize + 3*(4+8+mapEntryOverhead)},
+		{
+			"node",
+			&estimateNode{name: "hello", data: shared},
+			nil,
+			ptrSize + nodeSize + 5 + 16,
+		},
+		{
+			"shared slice counted once",
+			&estimateNode{data: shared, next: &estimateNode{data: shared}},
+			nil,
+			ptrSize + 2*nodeSize + 16,
+		},
+		{
+			"cycle",
+			cycle,
+			nil,
+			ptrSize + nodeSize + 3,
+		},
+		{
+			"boxed value",
+			&estimateNode{value: uint64(1)},
+			nil,
+			ptrSize + nodeSize + 8,
+		},
+		{
+			"skipped slice",
+			&estimateNode{name: "hello", data: shared},
+			func(p uintptr) bool { return p == reflect.ValueOf(shared).Pointer() },
+			ptrSize + nodeSize + 5,
+		},
+	} {
+		got := estimateSize(test.value, test.skip)
+		assert.For(ctx, test.name).That(got).Equals(test.expected)
+	}
+}
+
+func TestRootPointers(t *testing.T) {
+	ctx := log.Testing(t)
+	node := &estimateNode{data: []uint32{1}}
+	inner := &estimateNode{}
+	value := struct {
+		a *estimateNode
+		b interface{}
+		c int
+		d []uint32
+	}{a: node, b: inner, d: node.data}
+	expected := []uintptr{
+		reflect.ValueOf(node).Pointer(),
+		reflect.ValueOf(inner).Pointer(),
+		reflect.ValueOf(node.data).Pointer(),
+	}
+	assert.For(ctx, "roots").ThatSlice(rootPointers(value)).Equals(expected)
+	assert.For(ctx, "nil roots").ThatSlice(rootPointers(nil)).IsEmpty()
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"hash"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
@@ -28,6 +29,7 @@ import (
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/data/protoconv"
 	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
 )
 
 // NewInMemory builds a new in memory database.
@@ -70,8 +72,13 @@ type record struct {
 	data         []byte      // data is the encoded object
 	ty           recordType  // ty is the type of the encoded object
 	object       interface{} // object is the deserialized object
+	source       Resolvable  // source resolves to the data of a lazily loaded blob
 	resolveState *resolveState
 	created      callstack
+	rebuildable  bool      // true if object can be dropped and resolved again from data
+	objectSize   uint64    // estimated size of the resolved object in bytes
+	roots        []uintptr // root pointers of the resolved object
+	lastUsed     uint64    // the database tick of the last use of the record
 }
 
 type resolveState struct {
@@ -88,8 +95,9 @@ func (r *record) decode(ctx context.Context) (interface{}, error) {
 	case blob:
 		return r.data, nil
 	default:
+		// MessageType returns the pointer type of the message.
 		ty := proto.MessageType(string(r.ty))
-		msg := reflect.New(ty).Interface().(proto.Message)
+		msg := reflect.New(ty.Elem()).Interface().(proto.Message)
 		if err := proto.Unmarshal(r.data, msg); err != nil {
 			return nil, err
 		}
@@ -97,7 +105,20 @@ func (r *record) decode(ctx context.Context) (interface{}, error) {
 	}
 }
 
-func (r *record) resolve(ctx context.Context) error {
+// sized returns true if the resolved object of the record uses memory that is
+// not accounted for by the record's data.
+func (r *record) sized() bool {
+	return r.ty != blob || r.source != nil
+}
+
+// resolve decodes and resolves the record's object. If disk is not nil then
+// the resolved object is loaded from disk if it has been resolved before, and
+// is written to disk once it has been resolved.
+func (r *record) resolve(ctx context.Context, id id.ID, disk *disk) error {
+	if r.object == nil && r.source != nil {
+		return r.resolveSource(ctx, id, disk)
+	}
+
 	// Decode the object if we don't have the object already.
 	if r.object == nil {
 		obj, err := r.decode(ctx)
@@ -125,13 +146,25 @@ func (r *record) resolve(ctx context.Context) error {
 	}
 
 	// Keep on resolving until the type no longer implements Resolvable.
-	for {
+	for i := 0; ; i++ {
 		// If the object implements resolvable, then we need to resolve it.
 		// Is the database value resolvable?
 		resolvable, isResolvable := r.object.(Resolvable)
 		if !isResolvable {
+			if i > 0 && disk != nil {
+				disk.storeResult(ctx, id, r.object)
+			}
 			return nil
 		}
+		if i == 0 {
+			r.rebuildable = r.data != nil
+		}
+		if i == 0 && disk != nil {
+			if obj, ok := disk.loadResult(ctx, id); ok {
+				r.object = obj
+				return nil
+			}
+		}
 		ctx = status.Start(ctx, "DB Resolve<%T> %p", resolvable, r.resolveState)
 		defer status.Finish(ctx)
 		resolved, err := resolvable.Resolve(ctx)
@@ -142,10 +175,49 @@ func (r *record) resolve(ctx context.Context) error {
 	}
 }
 
+// resolveSource resolves the data of a lazily loaded blob from its source, or
+// from disk if it has been resolved before. The data is checked against the
+// identifier of the blob.
+func (r *record) resolveSource(ctx context.Context, id id.ID, disk *disk) error {
+	r.rebuildable = true
+	if disk != nil {
+		if loaded := disk.loadRecord(ctx, id); loaded != nil && loaded.ty == blob {
+			r.object = loaded.data
+			return nil
+		}
+	}
+	ctx = status.Start(ctx, "DB Resolve<%T> %p", r.source, r.resolveState)
+	defer status.Finish(ctx)
+	obj, err := r.source.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	data, ok := obj.([]byte)
+	if !ok {
+		return fmt.Errorf("Lazy blob '%v' resolved to a %T", id, obj)
+	}
+	if generateID(blob, data) != id {
+		return fmt.Errorf("Lazy blob '%v' does not match its data", id)
+	}
+	r.object = data
+	if disk != nil {
+		disk.storeRecord(ctx, id, blob, data)
+	}
+	return nil
+}
+
 type memory struct {
 	mutex      sync.Mutex
 	records    map[id.ID]*record
 	resolveCtx context.Context
+	disk       *disk // Optional persistent store of records and results.
+
+	tick       uint64                // incremented on each use of a record
+	bytes      uint64                // estimated bytes used by all records
+	limit      uint64                // bytes before eviction starts, 0 for no limit
+	evictFloor uint64                // bytes before eviction is attempted again
+	evicted    map[recordType]uint64 // number of evictions by record type
+	roots      sync.Map              // root pointer of a resolved object -> owning record id.ID
 }
 
 // Implements Database
@@ -181,18 +253,46 @@ func (d *memory) Store(ctx context.Context, val interface{}) (id.ID, error) {
 	id := generateID(ty, data)
 
 	d.mutex.Lock()
-	defer d.mutex.Unlock()
-	if _, got := d.records[id]; !got {
+	d.tick++
+	r, got := d.records[id]
+	if !got {
 		if dontStoreData {
-			d.records[id] = &record{data: nil, ty: ty, object: val, created: getCallstack(4)}
+			r = &record{data: nil, ty: ty, object: val, created: getCallstack(4)}
 		} else {
-			d.records[id] = &record{data: data, ty: ty, object: val, created: getCallstack(4)}
+			r = &record{data: data, ty: ty, object: val, created: getCallstack(4)}
 		}
+		d.records[id] = r
+		d.bytes += uint64(len(r.data))
+		d.evictLocked(ctx)
+	}
+	r.lastUsed = d.tick
+	d.mutex.Unlock()
+
+	if !got && d.disk != nil {
+		d.disk.storeRecord(ctx, id, ty, data)
 	}
 
 	return id, nil
 }
 
+// storeLazy adds a blob record with the given identifier, whose data is
+// resolved from source when the record is first resolved. Nothing is stored
+// if the record is already held in memory or on disk.
+func (d *memory) storeLazy(ctx context.Context, id id.ID, source Resolvable) {
+	if d.disk != nil && d.disk.hasRecord(id) {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.tick++
+	r, got := d.records[id]
+	if !got {
+		r = &record{ty: blob, source: source, created: getCallstack(4)}
+		d.records[id] = r
+	}
+	r.lastUsed = d.tick
+}
+
 // Implements Database
 func (d *memory) Resolve(ctx context.Context, id id.ID) (interface{}, error) {
 	d.mutex.Lock()
@@ -205,11 +305,26 @@ func (d *memory) Resolve(ctx context.Context, id id.ID) (interface{}, error) {
 func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, error) {
 	// Look up the record with the provided identifier.
 	r, got := d.records[id]
+	if !got && d.disk != nil {
+		// The record may have been stored by an earlier instance.
+		d.mutex.Unlock()
+		loaded := d.disk.loadRecord(ctx, id)
+		d.mutex.Lock()
+		if r, got = d.records[id]; !got && loaded != nil {
+			loaded.created = getCallstack(4)
+			r, got = loaded, true
+			d.records[id] = r
+			d.bytes += uint64(len(r.data))
+		}
+	}
 	if !got {
 		// Database doesn't recognise this identifier.
 		return nil, fmt.Errorf("Resource '%v' not found", id)
 	}
 
+	d.tick++
+	r.lastUsed = d.tick
+
 	rs := r.resolveState
 	build := rs == nil
 	if build {
@@ -238,12 +353,27 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 			ctx := status.PutTask(rs.ctx, status.GetTask(ctx))
 
 			defer d.resolvePanicHandler(ctx)
-			err := r.resolve(ctx)
+			err := r.resolve(ctx, id, d.disk)
+
+			// Estimate the size of the resolved object before taking the lock.
+			// The estimate is only needed if the memory use is bounded.
+			var size uint64
+			var roots []uintptr
+			sized := err == nil && r.sized() && d.bounded()
+			if sized {
+				size, roots = d.estimate(id, r.object)
+			}
 
 			// Signal that the resolvable has finished.
 			d.mutex.Lock()
 			close(rs.finished)
 			rs.err, rs.finished = err, nil
+			if err == nil && r.resolveState == rs {
+				if sized {
+					d.setSizeLocked(id, r, size, roots)
+				}
+				d.evictLocked(ctx)
+			}
 			d.mutex.Unlock()
 		})
 	}
@@ -306,8 +436,11 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 // Implements Database
 func (d *memory) Contains(ctx context.Context, id id.ID) (res bool) {
 	d.mutex.Lock()
-	defer d.mutex.Unlock()
 	_, got := d.records[id]
+	d.mutex.Unlock()
+	if !got && d.disk != nil {
+		got = d.disk.hasRecord(id)
+	}
 	return got
 }
 
@@ -320,8 +453,191 @@ func (d *memory) IsResolved(ctx context.Context, id id.ID) (res bool) {
 		return false
 	}
 	rs := r.resolveState
-	if rs.finished == nil {
-		return true
+	return rs != nil && rs.finished == nil
+}
+
+// bounded returns true if the memory used by the records is bounded, in which
+// case the sizes of the resolved objects are estimated.
+func (d *memory) bounded() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.limit != 0
+}
+
+// estimate returns the estimated size and the root pointers of the resolved
+// object obj of the record with the given identifier. Memory owned by the
+// objects of other records is not included in the size.
+func (d *memory) estimate(id id.ID, obj interface{}) (uint64, []uintptr) {
+	roots := rootPointers(obj)
+	size := estimateSize(obj, func(p uintptr) bool {
+		owner, ok := d.roots.Load(p)
+		return ok && owner != id
+	})
+	return size, roots
+}
+
+// setSizeLocked records the estimated size and root pointers of the resolved
+// object of the record r. setSizeLocked must be called with a locked mutex.
+func (d *memory) setSizeLocked(id id.ID, r *record, size uint64, roots []uintptr) {
+	for _, p := range roots {
+		d.roots.Store(p, id)
 	}
-	return false
+	d.bytes = d.bytes - r.objectSize + size
+	r.objectSize, r.roots = size, roots
+}
+
+// setLimit sets the memory limit and evicts records if it is exceeded. The
+// objects resolved while the memory use was not bounded have not been sized,
+// so they are estimated before evicting.
+func (d *memory) setLimit(ctx context.Context, limit uint64) {
+	type unsized struct {
+		id  id.ID
+		r   *record
+		rs  *resolveState
+		obj interface{}
+	}
+	pending := []unsized{}
+	d.mutex.Lock()
+	d.limit, d.evictFloor = limit, 0
+	if limit != 0 {
+		for id, r := range d.records {
+			rs := r.resolveState
+			if rs != nil && rs.finished == nil && rs.err == nil && r.sized() && r.objectSize == 0 {
+				pending = append(pending, unsized{id, r, rs, r.object})
+			}
+		}
+	}
+	d.mutex.Unlock()
+
+	type sized struct {
+		unsized
+		size  uint64
+		roots []uintptr
+	}
+	estimates := make([]sized, len(pending))
+	for i, u := range pending {
+		size, roots := d.estimate(u.id, u.obj)
+		estimates[i] = sized{u, size, roots}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, e := range estimates {
+		// Skip the records evicted or sized since they were listed.
+		if e.r.resolveState == e.rs && e.r.objectSize == 0 {
+			d.setSizeLocked(e.id, e.r, e.size, e.roots)
+		}
+	}
+	d.evictLocked(ctx)
+}
+
+// evictLocked drops the least recently used resolved objects that can be
+// rebuilt, until the estimated memory used by the records is back under the
+// limit. evictLocked must be called with a locked mutex.
+func (d *memory) evictLocked(ctx context.Context) {
+	if d.limit == 0 || d.bytes <= d.limit || d.bytes <= d.evictFloor {
+		return
+	}
+
+	type candidate struct {
+		id id.ID
+		r  *record
+	}
+	candidates := []candidate{}
+	for id, r := range d.records {
+		if d.canEvictLocked(id, r) {
+			candidates = append(candidates, candidate{id, r})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].r.lastUsed < candidates[j].r.lastUsed
+	})
+
+	target := uint64(float64(d.limit) * evictFraction)
+	before, count := d.bytes, 0
+	for _, c := range candidates {
+		if d.bytes <= target {
+			break
+		}
+		d.evictRecordLocked(c.id, c.r)
+		count++
+	}
+
+	// If not enough could be evicted, don't try again until the records have
+	// grown by as much as an eviction would normally free.
+	d.evictFloor = d.bytes + d.limit - target
+
+	log.D(ctx, "Evicted %d database records (%v -> %v bytes)", count, before, d.bytes)
+}
+
+// canEvictLocked returns true if the record r can be evicted. Resolved
+// objects can be evicted if they can be rebuilt from the record's data, and
+// blobs can be evicted if they are also held on disk.
+func (d *memory) canEvictLocked(id id.ID, r *record) bool {
+	rs := r.resolveState
+	switch {
+	case rs != nil && (rs.finished != nil || rs.waiting > 0 || rs.err != nil):
+		return false // Still resolving, or the error needs to be kept.
+	case r.rebuildable:
+		return rs != nil && r.objectSize > 0
+	case r.ty == blob:
+		return d.disk != nil && d.disk.hasRecord(id)
+	default:
+		return false
+	}
+}
+
+func (d *memory) evictRecordLocked(id id.ID, r *record) {
+	if rs := r.resolveState; rs != nil {
+		rs.cancel()
+	}
+	for _, p := range r.roots {
+		d.roots.Delete(p)
+	}
+	if r.rebuildable {
+		d.bytes -= r.objectSize
+		r.object, r.objectSize, r.roots, r.resolveState = nil, 0, nil, nil
+	} else {
+		d.bytes -= uint64(len(r.data))
+		delete(d.records, id)
+	}
+	if d.evicted == nil {
+		d.evicted = map[recordType]uint64{}
+	}
+	d.evicted[r.ty]++
+}
+
+// stats returns the statistics of the records, by record type.
+func (d *memory) stats() []RecordStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	byType := map[recordType]*RecordStats{}
+	get := func(ty recordType) *RecordStats {
+		s, ok := byType[ty]
+		if !ok {
+			s = &RecordStats{Type: string(ty)}
+			byType[ty] = s
+		}
+		return s
+	}
+	for _, r := range d.records {
+		s := get(r.ty)
+		s.Count++
+		if rs := r.resolveState; rs != nil && rs.finished == nil && rs.err == nil {
+			s.Resolved++
+		}
+		s.DataBytes += uint64(len(r.data))
+		s.ObjectBytes += r.objectSize
+	}
+	for ty, count := range d.evicted {
+		get(ty).Evicted = count
+	}
+
+	out := make([]RecordStats, 0, len(byType))
+	for _, s := range byType {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
 }
@@ -0,0 +1,205 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/pod"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+)
+
+// testResolvable resolves to a slice of count values, all set to value.
+type testResolvable struct {
+	value int64
+	count int64
+}
+
+var (
+	testResolvesMutex sync.Mutex
+	testResolves      = map[testResolvable]int{}
+)
+
+func (r testResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	testResolvesMutex.Lock()
+	testResolves[r]++
+	testResolvesMutex.Unlock()
+	out := make([]int64, r.count)
+	for i := range out {
+		out[i] = r.value
+	}
+	return out, nil
+}
+
+// resetResolves clears the resolve counts, so that tests can be run more
+// than once.
+func resetResolves() {
+	testResolvesMutex.Lock()
+	defer testResolvesMutex.Unlock()
+	testResolves = map[testResolvable]int{}
+}
+
+func resolves(r testResolvable) int {
+	testResolvesMutex.Lock()
+	defer testResolvesMutex.Unlock()
+	return testResolves[r]
+}
+
+func init() {
+	protoconv.Register(
+		func(ctx context.Context, r testResolvable) (*pod.Sint64Array, error) {
+			return &pod.Sint64Array{Val: []int64{r.value, r.count}}, nil
+		},
+		func(ctx context.Context, a *pod.Sint64Array) (testResolvable, error) {
+			return testResolvable{a.Val[0], a.Val[1]}, nil
+		},
+	)
+}
+
+var testResolvableType = proto.MessageName(&pod.Sint64Array{})
+
+func statsOf(ctx context.Context, ty string) RecordStats {
+	for _, s := range Stats(ctx) {
+		if s.Type == ty {
+			return s
+		}
+	}
+	return RecordStats{Type: ty}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	ctx := log.Testing(t)
+	resetResolves()
+	ctx = Put(ctx, NewInMemory(ctx))
+
+	// Each resolved object takes a little over 8000 bytes, so only two fit.
+	SetMemoryLimit(ctx, 20000)
+	resolvables := []testResolvable{{1, 1000}, {2, 1000}, {3, 1000}}
+	ids := make([]id.ID, len(resolvables))
+	for i, r := range resolvables {
+		var err error
+		ids[i], err = Store(ctx, r)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		_, err = Resolve(ctx, ids[i])
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+	}
+
+	stats := statsOf(ctx, testResolvableType)
+	assert.For(ctx, "count").That(stats.Count).Equals(uint64(3))
+	assert.For(ctx, "resolved").That(stats.Resolved).Equals(uint64(2))
+	assert.For(ctx, "evicted").That(stats.Evicted).Equals(uint64(1))
+	assert.For(ctx, "object bytes").ThatInteger(int(stats.ObjectBytes)).IsBetween(16000, 20000)
+	assert.For(ctx, "resolved 0").ThatBoolean(Get(ctx).IsResolved(ctx, ids[0])).IsFalse()
+
+	// The evicted record is resolved again from its data, which evicts the
+	// least recently used of the others.
+	got, err := Resolve(ctx, ids[0])
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "count").ThatInteger(len(got.([]int64))).Equals(1000)
+	assert.For(ctx, "value").That(got.([]int64)[0]).Equals(int64(1))
+	assert.For(ctx, "resolves of 0").ThatInteger(resolves(resolvables[0])).Equals(2)
+	assert.For(ctx, "resolved 1").ThatBoolean(Get(ctx).IsResolved(ctx, ids[1])).IsFalse()
+	assert.For(ctx, "resolved 2").ThatBoolean(Get(ctx).IsResolved(ctx, ids[2])).IsTrue()
+	assert.For(ctx, "evicted").That(statsOf(ctx, testResolvableType).Evicted).Equals(uint64(2))
+
+	// Without a limit, nothing is evicted.
+	SetMemoryLimit(ctx, 0)
+	for _, id := range ids {
+		_, err := Resolve(ctx, id)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "resolved").That(statsOf(ctx, testResolvableType).Resolved).Equals(uint64(3))
+}
+
+func TestMemorySizesOnlyWhenBounded(t *testing.T) {
+	ctx := log.Testing(t)
+	resetResolves()
+	ctx = Put(ctx, NewInMemory(ctx))
+
+	r := testResolvable{4, 1000}
+	_, err := Build(ctx, r)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "unbounded bytes").That(statsOf(ctx, testResolvableType).ObjectBytes).Equals(uint64(0))
+
+	// Setting a limit estimates the objects resolved before it was set.
+	SetMemoryLimit(ctx, 1<<20)
+	assert.For(ctx, "bounded bytes").ThatInteger(int(statsOf(ctx, testResolvableType).ObjectBytes)).IsBetween(8000, 8100)
+
+	// A limit below the size of the object evicts it.
+	SetMemoryLimit(ctx, 1000)
+	stats := statsOf(ctx, testResolvableType)
+	assert.For(ctx, "evicted").That(stats.Evicted).Equals(uint64(1))
+	assert.For(ctx, "evicted bytes").That(stats.ObjectBytes).Equals(uint64(0))
+	_, err = Build(ctx, r)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "resolves").ThatInteger(resolves(r)).Equals(2)
+}
+
+// testBlobSource is the source of a lazily loaded blob.
+type testBlobSource struct {
+	data     []byte
+	resolves int
+}
+
+func (s *testBlobSource) Resolve(ctx context.Context) (interface{}, error) {
+	s.resolves++
+	return s.data, nil
+}
+
+func TestMemoryLazyBlob(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = Put(ctx, NewInMemory(ctx))
+
+	data := make([]byte, 10000)
+	data[0] = 1
+	blobID := generateID(blob, data)
+	source := &testBlobSource{data: data}
+	assert.For(ctx, "err").ThatError(StoreLazy(ctx, blobID, source)).Succeeded()
+	assert.For(ctx, "contains").ThatBoolean(Get(ctx).Contains(ctx, blobID)).IsTrue()
+	assert.For(ctx, "resolves").ThatInteger(source.resolves).Equals(0)
+
+	got, err := Resolve(ctx, blobID)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "data").ThatSlice(got).Equals(data)
+	assert.For(ctx, "resolves").ThatInteger(source.resolves).Equals(1)
+
+	// Storing the same data keeps the lazy blob, and storing it lazily again
+	// keeps the first source.
+	stored, err := Store(ctx, data)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "id").That(stored).Equals(blobID)
+	assert.For(ctx, "err").ThatError(StoreLazy(ctx, blobID, &testBlobSource{})).Succeeded()
+
+	// Lazy blobs are sized, so they can be evicted, and are then resolved
+	// again from their source.
+	SetMemoryLimit(ctx, 1000)
+	assert.For(ctx, "evicted").That(statsOf(ctx, string(blob)).Evicted).Equals(uint64(1))
+	got, err = Resolve(ctx, blobID)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "data").ThatSlice(got).Equals(data)
+	assert.For(ctx, "resolves").ThatInteger(source.resolves).Equals(2)
+
+	// The data is checked against the identifier.
+	badID := id.OfString("bad")
+	assert.For(ctx, "err").ThatError(StoreLazy(ctx, badID, &testBlobSource{data: data})).Succeeded()
+	_, err = Resolve(ctx, badID)
+	assert.For(ctx, "err").ThatError(err).Failed()
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
 	"github.com/google/gapid/gapir"
 	"github.com/google/gapid/gapis/capture"
@@ -35,6 +36,9 @@ type Exporter interface {
 	// it then compiles the instructions for replay and triggers
 	// all postback with builder.ErrReplayNotExecuted .
 	Export(ctx context.Context, waitRequests int) (*gapir.Payload, error)
+	// MemoryLayout returns the memory layout of the replay device of the last
+	// exported payload.
+	MemoryLayout() *device.MemoryLayout
 }
 
 // NewExporter creates a new Exporter.
@@ -47,6 +51,11 @@ func NewExporter() Exporter {
 type exportManager struct {
 	key      *batchKey
 	requests chan RequestAndResult
+	layout   *device.MemoryLayout
+}
+
+func (m *exportManager) MemoryLayout() *device.MemoryLayout {
+	return m.layout
 }
 
 func (m *exportManager) Export(ctx context.Context, waitRequests int) (*gapir.Payload, error) {
@@ -87,6 +96,7 @@ func (m *exportManager) Export(ctx context.Context, waitRequests int) (*gapir.Pa
 	}
 	ctx = log.V{"replay target ABI": replayABI}.Bind(ctx)
 
+	m.layout = replayABI.MemoryLayout
 	b := builder.New(replayABI.MemoryLayout, nil)
 
 	_, ranges, err := initialcmds.InitialCommands(ctx, capturePath)
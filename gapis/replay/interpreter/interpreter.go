@@ -0,0 +1,507 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapir"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/opcode"
+)
+
+// The identifiers of the builtin functions of the global API, as registered by
+// gapir.
+const (
+	globalAPI          = 0
+	postFunction       = 0xff00
+	resourceFunction   = 0xff01
+	notifyFunction     = 0xff02
+	waitFunction       = 0xff03
+	printStackFunction = 0xff80
+)
+
+// Stub is the function called by the interpreter in place of an API function.
+// It can read and write the memory, and returns the function's return value.
+type Stub func(ctx context.Context, m *Memory, c *Call) (uint64, error)
+
+// Function is an API function that can be called by the interpreted payload.
+type Function struct {
+	// Name is the name of the function.
+	Name string
+	// Info identifies the function and its signature.
+	Info builder.FunctionInfo
+	// Stub is called in place of the function. If nil, the function does
+	// nothing and returns 0.
+	Stub Stub
+}
+
+// FunctionProvider is the interface implemented by APIs that list the
+// functions their replay payloads call.
+type FunctionProvider interface {
+	// ReplayFunctions returns the functions of the API callable by payloads.
+	ReplayFunctions() []Function
+}
+
+// ResourceLoader returns the data of the resource with the given identifier
+// and expected size.
+type ResourceLoader func(ctx context.Context, id string, size uint32) ([]byte, error)
+
+// Config holds the configuration of the interpreter.
+type Config struct {
+	// MemoryLayout is the memory layout of the replay device.
+	MemoryLayout *device.MemoryLayout
+	// Functions are the API functions callable by the payload.
+	Functions []Function
+	// Resources loads the payload resources. If nil, resources are zeros.
+	Resources ResourceLoader
+	// MaxInstructions is the maximum number of opcodes to execute before
+	// failing, or 0 for no limit.
+	MaxInstructions uint64
+}
+
+// Call is a call to an API function made by the payload.
+type Call struct {
+	// Label is the label of the command making the call.
+	Label uint32
+	// Thread is the index of the thread making the call.
+	Thread uint32
+	// Function is the called function.
+	Function *Function
+	// Args are the arguments of the call, in parameter order.
+	Args []Value
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("[%d] %s%v", c.Label, c.Function.Name, c.Args)
+}
+
+// Notification is a notification sent by the payload.
+type Notification struct {
+	// Label is the label of the command sending the notification.
+	Label uint32
+	// ID is the notification identifier.
+	ID uint32
+	// Data is the notification data.
+	Data []byte
+}
+
+// Result is the outcome of the interpretation of a payload.
+type Result struct {
+	// Instructions is the number of executed opcodes.
+	Instructions uint64
+	// Calls are the API function calls, in order.
+	Calls []Call
+	// Posts are the data posted back by the payload, in order.
+	Posts [][]byte
+	// Notifications are the notifications sent by the payload, in order.
+	Notifications []Notification
+	// Waits are the identifiers of the fences waited on, in order.
+	Waits []uint32
+	// Resources is the number of loaded resources.
+	Resources int
+	// ThreadSwitches is the number of thread switches.
+	ThreadSwitches int
+	// Stack holds the values left on the stack at the end of the payload.
+	Stack []Value
+}
+
+// Error is an error raised by an opcode of the payload.
+type Error struct {
+	// Index is the index of the failing opcode.
+	Index int
+	// Label is the label of the command of the failing opcode.
+	Label uint32
+	// Opcode is the failing opcode.
+	Opcode opcode.Opcode
+	// Err is the cause of the failure.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Opcode %d (%v) of command %d: %v", e.Index, e.Opcode, e.Label, e.Err)
+}
+
+// Run interprets the payload, returning the calls, postbacks and
+// notifications it made. The result is also returned on error.
+func Run(ctx context.Context, payload *gapir.Payload, cfg Config) (*Result, error) {
+	ops, err := opcode.Disassemble(bytes.NewReader(payload.Opcodes), cfg.MemoryLayout.GetEndian())
+	if err != nil {
+		return nil, err
+	}
+	vm := newVM(payload, cfg, ops)
+	err = vm.run(ctx)
+	vm.result.Stack = vm.stack
+	return &vm.result, err
+}
+
+// Verify interprets the payload like Run, and also fails if values are left
+// on the stack at the end of the payload.
+func Verify(ctx context.Context, payload *gapir.Payload, cfg Config) (*Result, error) {
+	res, err := Run(ctx, payload, cfg)
+	if err == nil && len(res.Stack) > 0 {
+		err = fmt.Errorf("Stack is unbalanced: %d values left at the end of the payload: %v", len(res.Stack), res.Stack)
+	}
+	return res, err
+}
+
+type functionKey struct {
+	api uint8
+	id  uint16
+}
+
+type vm struct {
+	payload   *gapir.Payload
+	cfg       Config
+	ops       []opcode.Opcode
+	functions map[functionKey]*Function
+	jumps     map[uint32]int // Jump label to opcode index.
+	memory    *Memory
+	stack     []Value
+	label     uint32
+	thread    uint32
+	result    Result
+}
+
+func newVM(payload *gapir.Payload, cfg Config, ops []opcode.Opcode) *vm {
+	v := &vm{
+		payload:   payload,
+		cfg:       cfg,
+		ops:       ops,
+		functions: map[functionKey]*Function{},
+		jumps:     map[uint32]int{},
+		memory:    newMemory(cfg.MemoryLayout, payload.Constants, uint64(payload.VolatileMemorySize)),
+		stack:     make([]Value, 0, payload.StackSize),
+	}
+	for i := range cfg.Functions {
+		f := &cfg.Functions[i]
+		v.functions[functionKey{f.Info.ApiIndex, f.Info.ID}] = f
+	}
+	for i, op := range ops {
+		if l, ok := op.(opcode.JumpLabel); ok {
+			v.jumps[l.Label] = i
+		}
+	}
+	return v
+}
+
+func (v *vm) run(ctx context.Context) error {
+	for pc := 0; pc < len(v.ops); pc++ {
+		if task.Stopped(ctx) {
+			return task.StopReason(ctx)
+		}
+		if max := v.cfg.MaxInstructions; max > 0 && v.result.Instructions >= max {
+			return fmt.Errorf("Instruction limit of %d reached at opcode %d", max, pc)
+		}
+		v.result.Instructions++
+		next, err := v.exec(ctx, v.ops[pc], pc)
+		if err != nil {
+			return &Error{Index: pc, Label: v.label, Opcode: v.ops[pc], Err: err}
+		}
+		pc = next
+	}
+	return nil
+}
+
+// exec executes the opcode at index pc, returning the index of the last
+// executed opcode.
+func (v *vm) exec(ctx context.Context, op opcode.Opcode, pc int) (int, error) {
+	switch op := op.(type) {
+	case opcode.Call:
+		return pc, v.call(ctx, op)
+	case opcode.PushI:
+		return pc, v.pushI(op)
+	case opcode.LoadC:
+		return pc, v.load(op.DataType, v.memory.Constant(uint64(op.Address)))
+	case opcode.LoadV:
+		return pc, v.load(op.DataType, v.memory.Volatile(uint64(op.Address)))
+	case opcode.Load:
+		addr, err := v.popPointer()
+		if err != nil {
+			return pc, err
+		}
+		return pc, v.load(op.DataType, addr)
+	case opcode.Pop:
+		if int(op.Count) > len(v.stack) {
+			return pc, fmt.Errorf("Popping %d values from a stack of %d values", op.Count, len(v.stack))
+		}
+		v.stack = v.stack[:len(v.stack)-int(op.Count)]
+		return pc, nil
+	case opcode.StoreV:
+		return pc, v.store(v.memory.Volatile(uint64(op.Address)))
+	case opcode.Store:
+		addr, err := v.popPointer()
+		if err != nil {
+			return pc, err
+		}
+		return pc, v.store(addr)
+	case opcode.Resource:
+		return pc, v.resource(ctx, op.ID)
+	case opcode.InlineResource:
+		return pc, v.inlineResource(op)
+	case opcode.Post:
+		return pc, v.post()
+	case opcode.Copy:
+		return pc, v.copy(op.Count)
+	case opcode.Clone:
+		if int(op.Index) >= len(v.stack) {
+			return pc, fmt.Errorf("Cloning value %d of a stack of %d values", op.Index, len(v.stack))
+		}
+		return pc, v.push(v.stack[len(v.stack)-1-int(op.Index)])
+	case opcode.Strcpy:
+		return pc, v.strcpy(op.MaxSize)
+	case opcode.Extend:
+		return pc, v.extend(op.Value)
+	case opcode.Add:
+		return pc, v.add(op.Count)
+	case opcode.Label:
+		v.label = op.Value
+		return pc, nil
+	case opcode.SwitchThread:
+		v.thread = op.Index
+		v.result.ThreadSwitches++
+		return pc, nil
+	case opcode.JumpLabel:
+		return pc, nil
+	case opcode.JumpNZ:
+		return v.jump(pc, op.Label, func(c int32) bool { return c != 0 })
+	case opcode.JumpZ:
+		return v.jump(pc, op.Label, func(c int32) bool { return c == 0 })
+	case opcode.Notification:
+		return pc, v.notification()
+	case opcode.Wait:
+		v.result.Waits = append(v.result.Waits, op.ID)
+		return pc, nil
+	default:
+		return pc, fmt.Errorf("Unsupported opcode %T", op)
+	}
+}
+
+func (v *vm) call(ctx context.Context, op opcode.Call) error {
+	if op.ApiIndex == globalAPI {
+		switch op.FunctionID {
+		case postFunction:
+			return v.post()
+		case resourceFunction:
+			id, err := v.popUint32()
+			if err != nil {
+				return err
+			}
+			return v.resource(ctx, id)
+		case notifyFunction:
+			return v.notification()
+		case waitFunction:
+			id, err := v.popUint32()
+			if err != nil {
+				return err
+			}
+			v.result.Waits = append(v.result.Waits, id)
+			return nil
+		case printStackFunction:
+			return nil
+		}
+	}
+
+	f, ok := v.functions[functionKey{op.ApiIndex, op.FunctionID}]
+	if !ok {
+		return fmt.Errorf("Unknown function %d of API %d", op.FunctionID, op.ApiIndex)
+	}
+	count := f.Info.Parameters
+	if count > len(v.stack) {
+		return fmt.Errorf("%s expects %d parameters, but the stack has %d values", f.Name, count, len(v.stack))
+	}
+	c := Call{
+		Label:    v.label,
+		Thread:   v.thread,
+		Function: f,
+		Args:     append([]Value{}, v.stack[len(v.stack)-count:]...),
+	}
+	v.stack = v.stack[:len(v.stack)-count]
+	v.result.Calls = append(v.result.Calls, c)
+
+	ret := uint64(0)
+	if f.Stub != nil {
+		var err error
+		if ret, err = f.Stub(ctx, v.memory, &c); err != nil {
+			return fmt.Errorf("%s failed: %v", f.Name, err)
+		}
+	}
+	if op.PushReturn && isValid(f.Info.ReturnType) {
+		return v.push(Value{f.Info.ReturnType, ret})
+	}
+	return nil
+}
+
+func (v *vm) resource(ctx context.Context, index uint32) error {
+	addr, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	if int(index) >= len(v.payload.Resources) {
+		return fmt.Errorf("Missing resource %d, the payload has %d resources", index, len(v.payload.Resources))
+	}
+	info := v.payload.Resources[index]
+	data := make([]byte, info.Size)
+	if v.cfg.Resources != nil {
+		if data, err = v.cfg.Resources(ctx, info.Id, info.Size); err != nil {
+			return fmt.Errorf("Missing resource %d (%v): %v", index, info.Id, err)
+		}
+		if len(data) != int(info.Size) {
+			return fmt.Errorf("Resource %d (%v) has %d bytes, expected %d", index, info.Id, len(data), info.Size)
+		}
+	}
+	v.result.Resources++
+	return v.memory.Write(addr, data)
+}
+
+func (v *vm) inlineResource(op opcode.InlineResource) error {
+	addr, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, len(op.Data)*4)
+	for _, w := range op.Data {
+		data = append(data, byte(w), byte(w>>8), byte(w>>16), byte(w>>24))
+	}
+	if err := v.memory.Write(addr, data[:op.DataSize]); err != nil {
+		return err
+	}
+
+	size := v.memory.PointerSize()
+	for _, p := range op.ValuePatchUps {
+		dst := v.memory.Volatile(uint64(p.Destination.(opcode.TrivialPointer).Value))
+		val := v.memory.Volatile(uint64(p.Value.(opcode.TrivialValue).Value))
+		if err := v.memory.WritePointer(dst, val); err != nil {
+			return err
+		}
+	}
+	for _, p := range op.PointerPatchUps {
+		dst := v.memory.Volatile(uint64(p.Destination.(opcode.TrivialPointer).Value))
+		src := v.memory.Volatile(uint64(p.Source.(opcode.TrivialPointer).Value))
+		ptr, err := v.memory.ReadUint(src, size)
+		if err != nil {
+			return err
+		}
+		if err := v.memory.WritePointer(dst, ptr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vm) post() error {
+	count, err := v.popUint32()
+	if err != nil {
+		return err
+	}
+	addr, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	data, err := v.memory.Read(addr, uint64(count))
+	if err != nil {
+		return err
+	}
+	v.result.Posts = append(v.result.Posts, data)
+	return nil
+}
+
+func (v *vm) notification() error {
+	count, err := v.popUint32()
+	if err != nil {
+		return err
+	}
+	id, err := v.popUint32()
+	if err != nil {
+		return err
+	}
+	addr, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	data, err := v.memory.Read(addr, uint64(count))
+	if err != nil {
+		return err
+	}
+	v.result.Notifications = append(v.result.Notifications, Notification{v.label, id, data})
+	return nil
+}
+
+func (v *vm) copy(count uint32) error {
+	dst, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	src, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	data, err := v.memory.Read(src, uint64(count))
+	if err != nil {
+		return err
+	}
+	return v.memory.Write(dst, data)
+}
+
+func (v *vm) strcpy(max uint32) error {
+	dst, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	src, err := v.popPointer()
+	if err != nil {
+		return err
+	}
+	if max == 0 {
+		return nil
+	}
+	out := make([]byte, max)
+	for i := uint64(0); i < uint64(max-1); i++ {
+		c, err := v.memory.Read(src+i, 1)
+		if err != nil {
+			return err
+		}
+		if c[0] == 0 {
+			break
+		}
+		out[i] = c[0]
+	}
+	return v.memory.Write(dst, out)
+}
+
+func (v *vm) jump(pc int, label uint32, taken func(int32) bool) (int, error) {
+	c, err := v.pop()
+	if err != nil {
+		return pc, err
+	}
+	if c.Type != typeInt32 {
+		return pc, fmt.Errorf("Jump condition must be an Int32, got %v", c)
+	}
+	if len(v.stack) != 0 {
+		return pc, fmt.Errorf("Stack is not empty before jumping to label %d: %v", label, v.stack)
+	}
+	if !taken(int32(c.Value)) {
+		return pc, nil
+	}
+	target, ok := v.jumps[label]
+	if !ok {
+		return pc, fmt.Errorf("Unknown jump label %d", label)
+	}
+	return target, nil
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapir"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+var (
+	funcA = builder.FunctionInfo{ApiIndex: 1, ID: 10, ReturnType: protocol.Type_Void, Parameters: 2}
+	funcB = builder.FunctionInfo{ApiIndex: 1, ID: 11, ReturnType: protocol.Type_Uint32, Parameters: 0}
+
+	functions = []Function{
+		{Name: "funcA", Info: funcA},
+		{Name: "funcB", Info: funcB, Stub: func(context.Context, *Memory, *Call) (uint64, error) {
+			return 42, nil
+		}},
+	}
+)
+
+// encode returns the opcode stream of the given instructions.
+func encode(ops ...uint32) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, ops)
+	return buf.Bytes()
+}
+
+func op(code protocol.Opcode, data uint32) uint32 {
+	return uint32(code)<<26 | data
+}
+
+func pushI(ty protocol.Type, v uint32) uint32 {
+	return op(protocol.OpPushI, uint32(ty)<<20|v)
+}
+
+func TestRunBuilderPayload(t *testing.T) {
+	ctx := log.Testing(t)
+	b := builder.New(device.Little64, nil)
+	ptr := b.AllocateMemory(4)
+
+	b.BeginCommand(1, 0)
+	b.Push(value.U32(7))
+	b.Push(value.S32(-3))
+	b.Call(funcA)
+	b.CommitCommand(ctx, false)
+
+	b.BeginCommand(2, 0)
+	b.Call(funcB)
+	b.Store(ptr)
+	b.Post(ptr, 4, nil)
+	b.CommitCommand(ctx, false)
+
+	payload, _, _, _, err := b.Build(ctx)
+	if !assert.For(ctx, "Build").ThatError(err).Succeeded() {
+		return
+	}
+
+	res, err := Verify(ctx, &payload, Config{MemoryLayout: device.Little64, Functions: functions})
+	if !assert.For(ctx, "Verify").ThatError(err).Succeeded() {
+		return
+	}
+	if assert.For(ctx, "Calls").ThatSlice(res.Calls).IsLength(2) {
+		c := res.Calls[0]
+		assert.For(ctx, "Label").That(c.Label).Equals(uint32(1))
+		assert.For(ctx, "Function").That(c.Function.Name).Equals("funcA")
+		assert.For(ctx, "Args").ThatSlice(c.Args).Equals([]Value{
+			{protocol.Type_Uint32, 7},
+			{protocol.Type_Int32, 0xfffffffd},
+		})
+		assert.For(ctx, "Label").That(res.Calls[1].Label).Equals(uint32(2))
+	}
+	assert.For(ctx, "Posts").ThatSlice(res.Posts).DeepEquals([][]byte{{42, 0, 0, 0}})
+}
+
+func TestRunErrors(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		name      string
+		payload   gapir.Payload
+		resources ResourceLoader
+		expected  string
+	}{
+		{
+			"Stack underflow",
+			gapir.Payload{StackSize: 4, Opcodes: encode(op(protocol.OpPop, 1))},
+			nil,
+			"Opcode 0 (Pop(Count: 1)) of command 0: Popping 1 values from a stack of 0 values",
+		},
+		{
+			"Stack overflow",
+			gapir.Payload{StackSize: 1, Opcodes: encode(
+				pushI(protocol.Type_Uint32, 1),
+				pushI(protocol.Type_Uint32, 2),
+			)},
+			nil,
+			"Opcode 1 (PushI(Type: Uint32, Address: 0x2)) of command 0: Stack overflow (size: 1)",
+		},
+		{
+			"Out of bounds store",
+			gapir.Payload{StackSize: 4, VolatileMemorySize: 4, Opcodes: encode(
+				op(protocol.OpLabel, 3),
+				pushI(protocol.Type_Uint64, 1),
+				op(protocol.OpStoreV, 2),
+			)},
+			nil,
+			"Opcode 2 (StoreV(Address: 0x2)) of command 3: Access of 0x8 bytes at volatile offset 0x2 is out of bounds (size: 0x4)",
+		},
+		{
+			"Missing resource",
+			gapir.Payload{StackSize: 4, VolatileMemorySize: 4, Resources: []*gapir.ResourceInfo{{Id: "abc", Size: 4}}, Opcodes: encode(
+				pushI(protocol.Type_VolatilePointer, 0),
+				op(protocol.OpResource, 0),
+			)},
+			func(context.Context, string, uint32) ([]byte, error) { return nil, fault.Const("not found") },
+			"Opcode 1 (Resource(ID: 0x0)) of command 0: Missing resource 0 (abc): not found",
+		},
+		{
+			"Unknown function",
+			gapir.Payload{StackSize: 4, Opcodes: encode(op(protocol.OpCall, 1<<16|12))},
+			nil,
+			"Opcode 0 (Call(PushReturn: false, API: 1, Func: 12)) of command 0: Unknown function 12 of API 1",
+		},
+		{
+			"Unbalanced stack",
+			gapir.Payload{StackSize: 4, Opcodes: encode(pushI(protocol.Type_Bool, 1))},
+			nil,
+			"Stack is unbalanced: 1 values left at the end of the payload: [Bool<1>]",
+		},
+	} {
+		cfg := Config{MemoryLayout: device.Little64, Functions: functions, Resources: test.resources}
+		_, err := Verify(ctx, &test.payload, cfg)
+		assert.For(ctx, test.name).ThatError(err).HasMessage(test.expected)
+	}
+}
+
+func TestRunJumps(t *testing.T) {
+	ctx := log.Testing(t)
+	// Counts down from 3 in volatile memory, calling funcB at each iteration.
+	payload := gapir.Payload{StackSize: 4, VolatileMemorySize: 4, Opcodes: encode(
+		pushI(protocol.Type_Int32, 3),
+		op(protocol.OpStoreV, 0),
+		op(protocol.OpJumpLabel, 1),
+		op(protocol.OpCall, 1<<16|11),
+		op(protocol.OpLoadV, uint32(protocol.Type_Int32)<<20),
+		pushI(protocol.Type_Int32, 0xfffff), // -1
+		op(protocol.OpAdd, 2),
+		op(protocol.OpClone, 0),
+		op(protocol.OpStoreV, 0),
+		op(protocol.OpJumpNZ, 1),
+	)}
+	res, err := Verify(ctx, &payload, Config{MemoryLayout: device.Little64, Functions: functions})
+	if assert.For(ctx, "Verify").ThatError(err).Succeeded() {
+		assert.For(ctx, "Calls").ThatSlice(res.Calls).IsLength(3)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+const (
+	// pageSize is the size of the pages of the simulated memory.
+	pageSize = 0x1000
+	// nullSize is the size of the memory at address 0 that is never valid.
+	nullSize = 0x1000
+	// constantBase is the absolute address of the constant memory.
+	constantBase = 0x10000
+	// regionAlignment is the alignment of the memory regions.
+	regionAlignment = 0x10000
+)
+
+// region is a range of the absolute address space.
+type region struct {
+	base, size uint64
+}
+
+func (r region) contains(addr uint64) bool { return addr >= r.base && addr-r.base < r.size }
+func (r region) end() uint64               { return r.base + r.size }
+
+// Memory is the simulated memory of the replay virtual machine.
+//
+// The constant and volatile memory of the payload are placed in the absolute
+// address space after a null page. Any other address is host memory, such as
+// the memory returned by API functions, which can be read and written freely.
+// Accesses to the null page, writes to the constant memory and accesses that
+// cross the end of the constant or volatile memory are errors.
+type Memory struct {
+	layout    *device.MemoryLayout
+	order     binary.ByteOrder
+	pages     map[uint64][]byte
+	constant  region
+	volatile  region
+	reserved  region // The span of the constant and volatile memory.
+	allocated uint64 // The end of the host memory allocated by Alloc.
+}
+
+func newMemory(layout *device.MemoryLayout, constants []byte, volatileSize uint64) *Memory {
+	m := &Memory{
+		layout:   layout,
+		order:    binary.LittleEndian,
+		pages:    map[uint64][]byte{},
+		constant: region{constantBase, uint64(len(constants))},
+	}
+	if layout.GetEndian() == device.BigEndian {
+		m.order = binary.BigEndian
+	}
+	m.volatile = region{align(m.constant.end()), volatileSize}
+	m.reserved = region{constantBase, m.volatile.end() - constantBase}
+	m.allocated = align(m.volatile.end())
+	m.write(m.constant.base, constants)
+	return m
+}
+
+func align(addr uint64) uint64 {
+	return (addr + regionAlignment - 1) &^ (regionAlignment - 1)
+}
+
+// PointerSize returns the size in bytes of a pointer.
+func (m *Memory) PointerSize() uint64 {
+	return uint64(m.layout.GetPointer().GetSize())
+}
+
+// Constant returns the absolute address of the given constant memory offset.
+func (m *Memory) Constant(offset uint64) uint64 { return m.constant.base + offset }
+
+// Volatile returns the absolute address of the given volatile memory offset.
+func (m *Memory) Volatile(offset uint64) uint64 { return m.volatile.base + offset }
+
+// Pointer returns the absolute address of the pointer value v.
+func (m *Memory) Pointer(v Value) (uint64, error) {
+	switch v.Type {
+	case protocol.Type_AbsolutePointer:
+		return v.Value, nil
+	case protocol.Type_ConstantPointer:
+		if v.Value >= m.constant.size {
+			return 0, fmt.Errorf("Invalid constant pointer 0x%x (size: 0x%x)", v.Value, m.constant.size)
+		}
+		return m.Constant(v.Value), nil
+	case protocol.Type_VolatilePointer:
+		if v.Value >= m.volatile.size {
+			return 0, fmt.Errorf("Invalid volatile pointer 0x%x (size: 0x%x)", v.Value, m.volatile.size)
+		}
+		return m.Volatile(v.Value), nil
+	default:
+		return 0, fmt.Errorf("Expected a pointer, got %v", v)
+	}
+}
+
+// Alloc allocates size bytes of host memory, returning its absolute address.
+// It is used by function stubs that return memory, like mapping functions.
+func (m *Memory) Alloc(size uint64) uint64 {
+	addr := m.allocated
+	m.allocated = align(m.allocated + size)
+	return addr
+}
+
+// check returns an error if size bytes at addr can not be accessed.
+func (m *Memory) check(addr, size uint64, write bool) error {
+	if size == 0 {
+		return nil
+	}
+	end := addr + size
+	switch {
+	case end < addr:
+		return fmt.Errorf("Access of 0x%x bytes at 0x%x overflows the address space", size, addr)
+	case addr < nullSize:
+		return fmt.Errorf("Null pointer access of 0x%x bytes at 0x%x", size, addr)
+	case m.constant.contains(addr):
+		if write {
+			return fmt.Errorf("Write of 0x%x bytes to constant memory at offset 0x%x", size, addr-m.constant.base)
+		}
+		if end > m.constant.end() {
+			return fmt.Errorf("Read of 0x%x bytes at constant offset 0x%x is out of bounds (size: 0x%x)",
+				size, addr-m.constant.base, m.constant.size)
+		}
+	case m.volatile.contains(addr):
+		if end > m.volatile.end() {
+			return fmt.Errorf("Access of 0x%x bytes at volatile offset 0x%x is out of bounds (size: 0x%x)",
+				size, addr-m.volatile.base, m.volatile.size)
+		}
+	case m.reserved.contains(addr) || (addr < m.reserved.base && end > m.reserved.base):
+		return fmt.Errorf("Access of 0x%x bytes at 0x%x is outside of the constant and volatile memory", size, addr)
+	}
+	return nil
+}
+
+// Read returns size bytes of memory at addr.
+func (m *Memory) Read(addr, size uint64) ([]byte, error) {
+	if err := m.check(addr, size, false); err != nil {
+		return nil, err
+	}
+	return m.read(addr, size), nil
+}
+
+// Write writes data to the memory at addr.
+func (m *Memory) Write(addr uint64, data []byte) error {
+	if err := m.check(addr, uint64(len(data)), true); err != nil {
+		return err
+	}
+	m.write(addr, data)
+	return nil
+}
+
+// ReadUint reads the size byte unsigned integer at addr.
+func (m *Memory) ReadUint(addr, size uint64) (uint64, error) {
+	data, err := m.Read(addr, size)
+	if err != nil {
+		return 0, err
+	}
+	return m.decode(data), nil
+}
+
+// WriteUint writes the lower size bytes of v to addr.
+func (m *Memory) WriteUint(addr, size, v uint64) error {
+	return m.Write(addr, m.encode(v, size))
+}
+
+// WritePointer writes the pointer p to addr.
+func (m *Memory) WritePointer(addr, p uint64) error {
+	return m.WriteUint(addr, m.PointerSize(), p)
+}
+
+func (m *Memory) read(addr, size uint64) []byte {
+	out := make([]byte, size)
+	for i := uint64(0); i < size; {
+		a := addr + i
+		offset := a % pageSize
+		n := min(pageSize-offset, size-i)
+		if page, ok := m.pages[a-offset]; ok {
+			copy(out[i:i+n], page[offset:])
+		}
+		i += n
+	}
+	return out
+}
+
+func (m *Memory) write(addr uint64, data []byte) {
+	size := uint64(len(data))
+	for i := uint64(0); i < size; {
+		a := addr + i
+		offset := a % pageSize
+		n := min(pageSize-offset, size-i)
+		page, ok := m.pages[a-offset]
+		if !ok {
+			page = make([]byte, pageSize)
+			m.pages[a-offset] = page
+		}
+		copy(page[offset:], data[i:i+n])
+		i += n
+	}
+}
+
+// decode decodes the unsigned integer of len(data) bytes.
+func (m *Memory) decode(data []byte) uint64 {
+	var buf [8]byte
+	if m.order == binary.BigEndian {
+		copy(buf[8-len(data):], data)
+		return binary.BigEndian.Uint64(buf[:])
+	}
+	copy(buf[:], data)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// encode encodes the lower size bytes of v.
+func (m *Memory) encode(v, size uint64) []byte {
+	var buf [8]byte
+	if m.order == binary.BigEndian {
+		binary.BigEndian.PutUint64(buf[:], v)
+		return buf[8-size:]
+	}
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return buf[:size]
+}
+
+func min(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/gapis/replay/opcode"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+const typeInt32 = protocol.Type_Int32
+
+// Value is a typed value of the stack of the replay virtual machine.
+// Constant and volatile pointers hold offsets in their memory.
+type Value struct {
+	Type  protocol.Type
+	Value uint64
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case protocol.Type_Float:
+		return fmt.Sprintf("%v<%v>", v.Type, math.Float32frombits(uint32(v.Value)))
+	case protocol.Type_Double:
+		return fmt.Sprintf("%v<%v>", v.Type, math.Float64frombits(v.Value))
+	case protocol.Type_AbsolutePointer, protocol.Type_ConstantPointer, protocol.Type_VolatilePointer:
+		return fmt.Sprintf("%v<0x%x>", v.Type, v.Value)
+	default:
+		return fmt.Sprintf("%v<%d>", v.Type, v.Value)
+	}
+}
+
+// isValid returns true if values of type t can be pushed on the stack.
+func isValid(t protocol.Type) bool {
+	return t >= protocol.Type_Bool && t <= protocol.Type_VolatilePointer
+}
+
+func isPointer(t protocol.Type) bool {
+	switch t {
+	case protocol.Type_AbsolutePointer, protocol.Type_ConstantPointer, protocol.Type_VolatilePointer:
+		return true
+	default:
+		return false
+	}
+}
+
+// size returns the size in bytes of the values of type t.
+func (v *vm) size(t protocol.Type) uint64 {
+	return uint64(t.Size(int32(v.memory.PointerSize())))
+}
+
+// truncate returns the value v truncated to the size of type t.
+func (v *vm) truncate(t protocol.Type, val uint64) uint64 {
+	if s := v.size(t); s < 8 {
+		return val & (1<<(s*8) - 1)
+	}
+	return val
+}
+
+func (v *vm) push(val Value) error {
+	if !isValid(val.Type) {
+		return fmt.Errorf("Invalid value type %v", val.Type)
+	}
+	if len(v.stack) >= int(v.payload.StackSize) {
+		return fmt.Errorf("Stack overflow (size: %d)", v.payload.StackSize)
+	}
+	// Like gapir, check constant and volatile pointers when pushed.
+	if val.Type == protocol.Type_ConstantPointer || val.Type == protocol.Type_VolatilePointer {
+		if _, err := v.pointer(val); err != nil {
+			return err
+		}
+	}
+	v.stack = append(v.stack, Value{val.Type, v.truncate(val.Type, val.Value)})
+	return nil
+}
+
+func (v *vm) pop() (Value, error) {
+	if len(v.stack) == 0 {
+		return Value{}, fmt.Errorf("Stack underflow")
+	}
+	val := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	return val, nil
+}
+
+func (v *vm) popUint32() (uint32, error) {
+	val, err := v.pop()
+	if err != nil {
+		return 0, err
+	}
+	if val.Type != protocol.Type_Uint32 {
+		return 0, fmt.Errorf("Expected a Uint32, got %v", val)
+	}
+	return uint32(val.Value), nil
+}
+
+// pointer returns the absolute address of the pointer value.
+func (v *vm) pointer(val Value) (uint64, error) {
+	return v.memory.Pointer(val)
+}
+
+func (v *vm) popPointer() (uint64, error) {
+	val, err := v.pop()
+	if err != nil {
+		return 0, err
+	}
+	return v.pointer(val)
+}
+
+func (v *vm) pushI(op opcode.PushI) error {
+	val := uint64(op.Value)
+	switch op.DataType {
+	case protocol.Type_Int8, protocol.Type_Int16, protocol.Type_Int32, protocol.Type_Int64:
+		// Sign extension of the 20 bit value.
+		if val&0x80000 != 0 {
+			val |= 0xfffffffffff00000
+		}
+	case protocol.Type_Float:
+		// The value is the exponent and the top of the mantissa.
+		val <<= 23
+	case protocol.Type_Double:
+		val <<= 52
+	}
+	return v.push(Value{op.DataType, val})
+}
+
+func (v *vm) extend(data uint32) error {
+	val, err := v.pop()
+	if err != nil {
+		return err
+	}
+	switch val.Type {
+	case protocol.Type_Float:
+		val.Value |= uint64(data) & 0x007fffff
+	case protocol.Type_Double:
+		exponent := val.Value & 0xfff0000000000000
+		val.Value = (val.Value<<26 | uint64(data)) & 0x000fffffffffffff
+		val.Value |= exponent
+	default:
+		val.Value = val.Value<<26 | uint64(data)
+	}
+	return v.push(val)
+}
+
+func (v *vm) add(count uint32) error {
+	if count < 2 {
+		return nil
+	}
+	if int(count) > len(v.stack) {
+		return fmt.Errorf("Adding %d values of a stack of %d values", count, len(v.stack))
+	}
+	ty := v.stack[len(v.stack)-1].Type
+	values := v.stack[len(v.stack)-int(count):]
+	v.stack = v.stack[:len(v.stack)-int(count)]
+
+	switch ty {
+	case protocol.Type_Float:
+		sum := float32(0)
+		for _, val := range values {
+			if val.Type != ty {
+				return fmt.Errorf("Cannot add %v to a %v", val, ty)
+			}
+			sum += math.Float32frombits(uint32(val.Value))
+		}
+		return v.push(Value{ty, uint64(math.Float32bits(sum))})
+	case protocol.Type_Double:
+		sum := float64(0)
+		for _, val := range values {
+			if val.Type != ty {
+				return fmt.Errorf("Cannot add %v to a %v", val, ty)
+			}
+			sum += math.Float64frombits(val.Value)
+		}
+		return v.push(Value{ty, math.Float64bits(sum)})
+	case protocol.Type_AbsolutePointer, protocol.Type_ConstantPointer:
+		// Pointers are summed as absolute addresses.
+		sum := uint64(0)
+		for _, val := range values {
+			addr, err := v.pointer(val)
+			if err != nil {
+				return err
+			}
+			sum += addr
+		}
+		return v.push(Value{protocol.Type_AbsolutePointer, sum})
+	case protocol.Type_Int8, protocol.Type_Int16, protocol.Type_Int32, protocol.Type_Int64,
+		protocol.Type_Uint8, protocol.Type_Uint16, protocol.Type_Uint32, protocol.Type_Uint64:
+		sum := uint64(0)
+		for _, val := range values {
+			if val.Type != ty {
+				return fmt.Errorf("Cannot add %v to a %v", val, ty)
+			}
+			sum += val.Value
+		}
+		return v.push(Value{ty, sum})
+	default:
+		return fmt.Errorf("Cannot add values of type %v", ty)
+	}
+}
+
+// load pushes the value of type t read at the absolute address addr.
+func (v *vm) load(t protocol.Type, addr uint64) error {
+	if !isValid(t) {
+		return fmt.Errorf("Invalid value type %v", t)
+	}
+	val, err := v.memory.ReadUint(addr, v.size(t))
+	if err != nil {
+		return err
+	}
+	if isPointer(t) {
+		// Pointers are stored in memory as absolute addresses.
+		t = protocol.Type_AbsolutePointer
+	}
+	return v.push(Value{t, val})
+}
+
+// store pops the value on the top of the stack and writes it to the absolute
+// address addr. Constant and volatile pointers are written as absolute
+// addresses.
+func (v *vm) store(addr uint64) error {
+	val, err := v.pop()
+	if err != nil {
+		return err
+	}
+	if isPointer(val.Type) {
+		ptr, err := v.pointer(val)
+		if err != nil {
+			return err
+		}
+		return v.memory.WritePointer(addr, ptr)
+	}
+	return v.memory.WriteUint(addr, v.size(val.Type), val.Value)
+}
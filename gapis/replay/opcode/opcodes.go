@@ -521,10 +521,11 @@ func DecodeInlineResource(opcode uint32, reader binary.Reader) InlineResource {
 	numValuePatchUps := unpackY(opcode)
 	dataSize := unpackZ(opcode)
 
-	data := make([]uint32, dataSize)
+	// dataSize is in bytes, and the data is padded to whole 32 bit words.
+	data := make([]uint32, (dataSize+3)/4)
 	valuePatchUps := make([]InlineResourceValuePatchUp, numValuePatchUps)
 
-	for i := 0; i < int(dataSize); i++ {
+	for i := range data {
 		data[i] = reader.Uint32()
 	}
 
@@ -592,11 +593,11 @@ func Decode(r binary.Reader) (Opcode, error) {
 	case protocol.OpSwitchThread:
 		return SwitchThread{Index: unpackX(i)}, nil
 	case protocol.OpJumpLabel:
-		return Label{Value: unpackX(i)}, nil
+		return JumpLabel{Label: unpackX(i)}, nil
 	case protocol.OpJumpNZ:
-		return Label{Value: unpackX(i)}, nil
+		return JumpNZ{Label: unpackX(i)}, nil
 	case protocol.OpJumpZ:
-		return Label{Value: unpackX(i)}, nil
+		return JumpZ{Label: unpackX(i)}, nil
 	case protocol.OpNotification:
 		return Notification{}, nil
 	case protocol.OpWait:
@@ -625,6 +626,9 @@ func (Extend) isOpcode()         {}
 func (Add) isOpcode()            {}
 func (Label) isOpcode()          {}
 func (SwitchThread) isOpcode()   {}
+func (JumpLabel) isOpcode()      {}
+func (JumpNZ) isOpcode()         {}
+func (JumpZ) isOpcode()          {}
 func (Notification) isOpcode()   {}
 func (Wait) isOpcode()           {}
 func (InlineResource) isOpcode() {}
@@ -0,0 +1,120 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+// maxAlignCells is the maximum size of the table used to find the longest
+// common subsequence of two sequences. Larger sequences are aligned by
+// position.
+const maxAlignCells = 1 << 22
+
+// match is a pair of aligned indices of the reference and value sequences.
+// ref is -1 for elements only in the value sequence, and val is -1 for
+// elements only in the reference sequence.
+type match struct {
+	ref, val int
+}
+
+// align returns the alignment of the ref and val sequences, in sequence order.
+// Elements with equal keys are matched so that the number of matched elements
+// is maximized.
+func align(ref, val []string) []match {
+	out := make([]match, 0, len(ref)+len(val))
+
+	// Matching prefixes and suffixes are common, and cheap to align.
+	prefix := 0
+	for prefix < len(ref) && prefix < len(val) && ref[prefix] == val[prefix] {
+		out = append(out, match{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ref)-prefix && suffix < len(val)-prefix &&
+		ref[len(ref)-1-suffix] == val[len(val)-1-suffix] {
+		suffix++
+	}
+
+	a, b := ref[prefix:len(ref)-suffix], val[prefix:len(val)-suffix]
+	if (len(a)+1)*(len(b)+1) <= maxAlignCells {
+		out = appendLCS(out, a, b, prefix)
+	} else {
+		out = appendByPosition(out, a, b, prefix)
+	}
+
+	for i := suffix; i > 0; i-- {
+		out = append(out, match{len(ref) - i, len(val) - i})
+	}
+	return out
+}
+
+// appendLCS appends the alignment of a and b given by their longest common
+// subsequence to out. offset is added to all the indices.
+func appendLCS(out []match, a, b []string, offset int) []match {
+	// lcs[i*w+j] holds the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	w := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*w)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+				lcs[i*w+j] = lcs[(i+1)*w+j]
+			default:
+				lcs[i*w+j] = lcs[i*w+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, match{offset + i, offset + j})
+			i, j = i+1, j+1
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			out = append(out, match{offset + i, -1})
+			i++
+		default:
+			out = append(out, match{-1, offset + j})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, match{offset + i, -1})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, match{-1, offset + j})
+	}
+	return out
+}
+
+// appendByPosition appends the alignment of a and b by position to out,
+// matching the elements at the same index if their keys are equal. offset is
+// added to all the indices.
+func appendByPosition(out []match, a, b []string, offset int) []match {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(a):
+			out = append(out, match{-1, offset + i})
+		case i >= len(b):
+			out = append(out, match{offset + i, -1})
+		case a[i] == b[i]:
+			out = append(out, match{offset + i, offset + i})
+		default:
+			out = append(out, match{offset + i, -1}, match{-1, offset + i})
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestAlign(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		name     string
+		ref, val string
+		expected []match
+	}{
+		{"equal", "abc", "abc", []match{{0, 0}, {1, 1}, {2, 2}}},
+		{"empty ref", "", "ab", []match{{-1, 0}, {-1, 1}}},
+		{"empty val", "ab", "", []match{{0, -1}, {1, -1}}},
+		{"inserted", "abd", "abcd", []match{{0, 0}, {1, 1}, {-1, 2}, {2, 3}}},
+		{"removed", "abcd", "acd", []match{{0, 0}, {1, -1}, {2, 1}, {3, 2}}},
+		{"replaced", "axc", "ayc", []match{{0, 0}, {1, -1}, {-1, 1}, {2, 2}}},
+		{"moved", "xabc", "abcx", []match{{0, -1}, {1, 0}, {2, 1}, {3, 2}, {-1, 3}}},
+	} {
+		got := align(strings.Split(test.ref, ""), strings.Split(test.val, ""))
+		assert.For(ctx, test.name).ThatSlice(got).Equals(test.expected)
+	}
+}
+
+func TestAlignByPosition(t *testing.T) {
+	ctx := log.Testing(t)
+	got := appendByPosition(nil, []string{"a", "b", "c"}, []string{"a", "x"}, 2)
+	assert.For(ctx, "matches").ThatSlice(got).Equals([]match{{2, 2}, {3, -1}, {-1, 3}, {4, -1}})
+}
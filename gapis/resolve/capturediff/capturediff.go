@@ -0,0 +1,177 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capturediff compares two graphics captures.
+//
+// The commands of the two captures are first aligned by frame, then by
+// submission, and finally command by command. Commands are matched when they
+// have the same name and are enclosed by the same debug markers, and matched
+// commands are reported as changed when their parameters differ. Resources
+// are optionally compared at the end of each aligned frame.
+package capturediff
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Captures compares the value capture against the reference capture.
+func Captures(ctx context.Context, reference, value *path.Capture, opts *service.DiffCapturesOptions) (*service.CaptureDiff, error) {
+	if opts == nil {
+		opts = &service.DiffCapturesOptions{}
+	}
+
+	refFrames, err := frames(ctx, reference)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to split the reference capture into frames")
+	}
+	valFrames, err := frames(ctx, value)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to split the value capture into frames")
+	}
+
+	d := &differ{
+		reference: reference,
+		value:     value,
+		opts:      opts,
+		out:       &service.CaptureDiff{},
+	}
+	if opts.Resources {
+		if d.refResources, err = newCaptureResources(resolve.SetupContext(ctx, reference, nil), reference); err != nil {
+			return nil, err
+		}
+		if d.valResources, err = newCaptureResources(resolve.SetupContext(ctx, value, nil), value); err != nil {
+			return nil, err
+		}
+	}
+
+	count := len(refFrames)
+	if len(valFrames) > count {
+		count = len(valFrames)
+	}
+	for i := 0; i < count && !d.full(); i++ {
+		status.UpdateProgress(ctx, uint64(i), uint64(count))
+
+		fd := &service.FrameDiff{Frame: uint32(i + 1)}
+		var ref, val frame
+		if i < len(refFrames) {
+			ref = refFrames[i]
+			fd.ReferenceEnd = reference.Command(uint64(ref.end))
+		}
+		if i < len(valFrames) {
+			val = valFrames[i]
+			fd.ValueEnd = value.Command(uint64(val.end))
+		}
+
+		d.diffFrame(fd, ref, val)
+		if opts.Resources && fd.ReferenceEnd != nil && fd.ValueEnd != nil {
+			if err := d.diffResources(ctx, fd, ref.end, val.end); err != nil {
+				return nil, log.Errf(ctx, err, "Failed to compare the resources of frame %d", fd.Frame)
+			}
+		}
+
+		if len(fd.Commands) > 0 || len(fd.Resources) > 0 {
+			d.out.Frames = append(d.out.Frames, fd)
+		}
+	}
+	return d.out, nil
+}
+
+type differ struct {
+	reference, value           *path.Capture
+	opts                       *service.DiffCapturesOptions
+	refResources, valResources *captureResources
+	out                        *service.CaptureDiff
+	count                      uint32
+}
+
+// full returns true, and marks the diff as truncated, if the maximum number
+// of differences has been reached.
+func (d *differ) full() bool {
+	if max := d.opts.MaxDifferences; max > 0 && d.count >= max {
+		d.out.Truncated = true
+		return true
+	}
+	return false
+}
+
+// diffFrame aligns the segments of the two frames, then the commands of the
+// aligned segments. Either frame may be empty.
+func (d *differ) diffFrame(fd *service.FrameDiff, ref, val frame) {
+	for _, m := range align(segmentKeys(ref.segments), segmentKeys(val.segments)) {
+		var refSeg, valSeg segment
+		if m.ref >= 0 {
+			refSeg = ref.segments[m.ref]
+		}
+		if m.val >= 0 {
+			valSeg = val.segments[m.val]
+		}
+		d.diffSegment(fd, refSeg, valSeg)
+	}
+}
+
+func (d *differ) diffSegment(fd *service.FrameDiff, ref, val segment) {
+	for _, m := range align(commandKeys(ref), commandKeys(val)) {
+		if d.full() {
+			return
+		}
+		cd := &service.CommandDiff{}
+		var c command
+		if m.ref >= 0 {
+			c = ref[m.ref]
+			cd.Reference = d.reference.Command(uint64(c.id))
+		}
+		if m.val >= 0 {
+			c = val[m.val]
+			cd.Value = d.value.Command(uint64(c.id))
+		}
+		cd.Name, cd.Marker = c.cmd.CmdName(), c.marker
+
+		switch {
+		case m.val < 0:
+			cd.Kind = service.DiffKind_DiffRemoved
+		case m.ref < 0:
+			cd.Kind = service.DiffKind_DiffInserted
+		default:
+			cd.Kind = service.DiffKind_DiffChanged
+			cd.Parameters = diffCommands(ref[m.ref].cmd, val[m.val].cmd, d.opts.ComparePointers)
+			if len(cd.Parameters) == 0 {
+				continue
+			}
+		}
+		fd.Commands = append(fd.Commands, cd)
+		d.count++
+	}
+}
+
+func segmentKeys(segments []segment) []string {
+	out := make([]string, len(segments))
+	for i, s := range segments {
+		out[i] = s.key()
+	}
+	return out
+}
+
+func commandKeys(cmds segment) []string {
+	out := make([]string, len(cmds))
+	for i, c := range cmds {
+		out[i] = c.key()
+	}
+	return out
+}
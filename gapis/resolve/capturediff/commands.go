@@ -0,0 +1,143 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// command is a single command of a capture, along with the debug markers
+// enclosing it.
+type command struct {
+	id     api.CmdID
+	cmd    api.Cmd
+	marker string
+}
+
+// key returns the key used to align the command with the commands of the
+// other capture.
+func (c command) key() string {
+	return c.marker + "/" + c.cmd.CmdName()
+}
+
+// segment is a run of commands ending with a submission, or with the end of
+// the frame.
+type segment []command
+
+// key returns the key used to align the segment with the segments of the
+// other capture.
+func (s segment) key() string {
+	return s[len(s)-1].key()
+}
+
+// frame is the list of segments of a single frame.
+type frame struct {
+	segments []segment
+	// The last command of the frame.
+	end api.CmdID
+}
+
+// frames splits the commands of the capture into frames and segments.
+// Commands following the last end of frame form a final frame.
+func frames(ctx context.Context, p *path.Capture) ([]frame, error) {
+	ctx = resolve.SetupContext(ctx, p, nil)
+
+	c, err := capture.ResolveGraphicsFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []frame{}
+	current, seg := frame{}, segment{}
+	markers := []string{}
+	s := c.NewState(ctx)
+	err = api.ForeachCmd(ctx, c.Commands, false, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
+			return fmt.Errorf("Fail to mutate command %v: %v", cmd, err)
+		}
+
+		flags := cmd.CmdFlags()
+		if flags.IsPushUserMarker() {
+			name := "Marker"
+			if l, ok := cmd.(api.Labeled); ok {
+				if label := l.Label(ctx, s); label != "" {
+					name = label
+				}
+			}
+			markers = append(markers, name)
+		}
+		seg = append(seg, command{id, cmd, strings.Join(markers, "/")})
+		if flags.IsPopUserMarker() && len(markers) > 0 {
+			markers = markers[:len(markers)-1]
+		}
+
+		if flags.IsSubmission() || flags.IsEndOfFrame() {
+			current.segments = append(current.segments, seg)
+			seg = segment{}
+		}
+		if flags.IsEndOfFrame() {
+			current.end = id
+			out = append(out, current)
+			current = frame{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(seg) > 0 {
+		current.segments = append(current.segments, seg)
+	}
+	if len(current.segments) > 0 {
+		last := current.segments[len(current.segments)-1]
+		current.end = last[len(last)-1].id
+		out = append(out, current)
+	}
+	return out, nil
+}
+
+// diffCommands compares two commands with the same name, returning the
+// differences of their parameters and results.
+func diffCommands(ref, val api.Cmd, comparePointers bool) []*service.ValueDiff {
+	out := []*service.ValueDiff{}
+	add := func(r, v *api.Property) {
+		rv, vv := r.Get(), v.Get()
+		if _, isPtr := rv.(memory.Pointer); isPtr && !comparePointers {
+			return
+		}
+		out = append(out, valueDiffs(r.Name, rv, vv)...)
+	}
+
+	refParams, valParams := ref.CmdParams(), val.CmdParams()
+	for i := range refParams {
+		if i < len(valParams) {
+			add(refParams[i], valParams[i])
+		}
+	}
+	if r, v := ref.CmdResult(), val.CmdResult(); r != nil && v != nil {
+		add(r, v)
+	}
+	return out
+}
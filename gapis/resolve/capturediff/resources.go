@@ -0,0 +1,169 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// captureResources holds the resources of a capture, by type.
+type captureResources struct {
+	capture *path.Capture
+	byType  map[path.ResourceType][]*service.Resource
+}
+
+func newCaptureResources(ctx context.Context, p *path.Capture) (*captureResources, error) {
+	resources, err := resolve.Resources(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := &captureResources{p, map[path.ResourceType][]*service.Resource{}}
+	for _, t := range resources.Types {
+		out.byType[t.Type] = t.Resources
+	}
+	return out, nil
+}
+
+// types returns the resource types of both sets of resources, sorted.
+func (r *captureResources) types(other *captureResources) []path.ResourceType {
+	seen := map[path.ResourceType]bool{}
+	out := []path.ResourceType{}
+	for _, m := range []map[path.ResourceType][]*service.Resource{r.byType, other.byType} {
+		for t := range m {
+			if !seen[t] {
+				seen[t] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// live returns the resources of type t that exist after the command at.
+func (r *captureResources) live(t path.ResourceType, at api.CmdID) []*service.Resource {
+	out := []*service.Resource{}
+	for _, res := range r.byType[t] {
+		if res.Created != nil && api.CmdID(res.Created.Indices[0]) > at {
+			continue
+		}
+		if res.Deleted != nil && api.CmdID(res.Deleted.Indices[0]) <= at {
+			continue
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// data returns the data of the resources of type t after the command at.
+func (r *captureResources) data(ctx context.Context, t path.ResourceType, at api.CmdID) (*service.MultiResourceData, error) {
+	data, err := resolve.ResourceDatas(ctx, &path.MultiResourceData{
+		After: r.capture.Command(uint64(at)),
+		Type:  t,
+		All:   true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return data.(*service.MultiResourceData), nil
+}
+
+// diffResources compares the resources of the reference capture after the
+// command refAt against the resources of the value capture after the command
+// valAt. Resources are matched by type, then by label, then by order of
+// creation.
+func (d *differ) diffResources(ctx context.Context, fd *service.FrameDiff, refAt, valAt api.CmdID) error {
+	for _, t := range d.refResources.types(d.valResources) {
+		refs, vals := d.refResources.live(t, refAt), d.valResources.live(t, valAt)
+		if len(refs) == 0 && len(vals) == 0 {
+			continue
+		}
+		refData, err := d.refResources.data(ctx, t, refAt)
+		if err != nil {
+			return err
+		}
+		valData, err := d.valResources.data(ctx, t, valAt)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range align(resourceKeys(refs), resourceKeys(vals)) {
+			if d.full() {
+				return nil
+			}
+			rd := &service.ResourceDiff{Type: t}
+			if m.ref >= 0 {
+				rd.Label, rd.ReferenceHandle = refs[m.ref].Label, refs[m.ref].Handle
+			}
+			if m.val >= 0 {
+				rd.Label, rd.ValueHandle = vals[m.val].Label, vals[m.val].Handle
+			}
+			switch {
+			case m.val < 0:
+				rd.Kind = service.DiffKind_DiffRemoved
+			case m.ref < 0:
+				rd.Kind = service.DiffKind_DiffInserted
+			default:
+				rd.Kind = service.DiffKind_DiffChanged
+				rd.Fields = diffResourceData(
+					refData.Resources[refs[m.ref].ID.ID().String()],
+					valData.Resources[vals[m.val].ID.ID().String()])
+				if len(rd.Fields) == 0 {
+					continue
+				}
+			}
+			fd.Resources = append(fd.Resources, rd)
+			d.count++
+		}
+	}
+	return nil
+}
+
+func resourceKeys(resources []*service.Resource) []string {
+	out := make([]string, len(resources))
+	for i, r := range resources {
+		out[i] = r.Label
+	}
+	return out
+}
+
+// diffResourceData compares the data of two resources. Failures to resolve
+// the data are reported as differences of the "error" field.
+func diffResourceData(ref, val *service.MultiResourceData_ResourceOrError) []*service.ValueDiff {
+	refErr, valErr := resourceError(ref), resourceError(val)
+	if refErr != "" || valErr != "" {
+		if refErr == valErr {
+			return nil
+		}
+		return []*service.ValueDiff{{Path: "error", Reference: refErr, Value: valErr}}
+	}
+	return valueDiffs("", ref.GetResource(), val.GetResource())
+}
+
+func resourceError(r *service.MultiResourceData_ResourceOrError) string {
+	switch {
+	case r == nil:
+		return "Resource data not found"
+	case r.GetError() != nil:
+		return r.GetError().Get().Error()
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/compare"
+	"github.com/google/gapid/gapis/service"
+)
+
+// maxValueDiffs is the maximum number of differences reported for a single
+// parameter or resource.
+const maxValueDiffs = 32
+
+// valueDiffs returns the differences between the reference and value, with
+// paths starting with root.
+func valueDiffs(root string, reference, value interface{}) []*service.ValueDiff {
+	out := []*service.ValueDiff{}
+	var diff func(root string, reference, value interface{})
+	diff = func(root string, reference, value interface{}) {
+		compare.Compare(reference, value, func(p compare.Path) {
+			if len(out) >= maxValueDiffs {
+				panic(compare.LimitReached)
+			}
+			// Proto messages are compared as a whole, compare their fields to
+			// find which ones differ.
+			last := p[len(p)-1]
+			if r, ok := last.Reference.(proto.Message); ok && last.Operation == nil &&
+				!compare.IsNil(r) && !compare.IsNil(last.Value) &&
+				reflect.TypeOf(r) == reflect.TypeOf(last.Value) {
+				rv, vv := reflect.ValueOf(r).Elem(), reflect.ValueOf(last.Value).Elem()
+				path := formatPath(root, p)
+				for i, n := 0, rv.NumField(); i < n; i++ {
+					f := rv.Type().Field(i)
+					if f.PkgPath != "" || strings.HasPrefix(f.Name, "XXX_") {
+						continue // Unexported or proto bookkeeping field.
+					}
+					diff(path+"."+f.Name, rv.Field(i).Interface(), vv.Field(i).Interface())
+				}
+				return
+			}
+			out = append(out, &service.ValueDiff{
+				Path:      formatPath(root, p),
+				Reference: formatValue(last.Reference),
+				Value:     formatValue(last.Value),
+			})
+		})
+	}
+	diff(root, reference, value)
+	return out
+}
+
+// formatPath returns root followed by the member, index and map entry
+// operations of p.
+func formatPath(root string, p compare.Path) string {
+	sb := strings.Builder{}
+	sb.WriteString(root)
+	for _, f := range p {
+		switch op := f.Operation.(type) {
+		case compare.MemberOp, compare.IndexOp, compare.EntryOp:
+			fmt.Fprint(&sb, op)
+		case compare.LengthOp:
+			sb.WriteString(".length")
+		case compare.TypeOp:
+			sb.WriteString(".type")
+		}
+	}
+	return sb.String()
+}
+
+func formatValue(v interface{}) string {
+	switch {
+	case v == compare.Missing:
+		return "<missing>"
+	case compare.IsNil(v):
+		return "<nil>"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capturediff
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestValueDiffs(t *testing.T) {
+	ctx := log.Testing(t)
+
+	type extent struct{ Width, Height uint32 }
+	type info struct {
+		Extent extent
+		Layers []uint32
+	}
+	ref := &info{Extent: extent{64, 64}, Layers: []uint32{0, 1}}
+	val := &info{Extent: extent{64, 32}, Layers: []uint32{0}}
+
+	assert.For(ctx, "equal").That(len(valueDiffs("pInfo", ref, ref))).Equals(0)
+	assert.For(ctx, "diffs").ThatSlice(valueDiffs("pInfo", ref, val)).Equals([]*service.ValueDiff{
+		{Path: "pInfo.Extent.Height", Reference: "64", Value: "32"},
+		{Path: "pInfo.Layers[1]", Reference: "1", Value: "<missing>"},
+		{Path: "pInfo.Layers.length", Reference: "2", Value: "1"},
+	})
+
+	zeros, ones := make([]uint32, 2*maxValueDiffs), make([]uint32, 2*maxValueDiffs)
+	for i := range ones {
+		ones[i] = 1
+	}
+	assert.For(ctx, "limit").That(len(valueDiffs("v", zeros, ones))).Equals(maxValueDiffs)
+}
@@ -130,3 +130,24 @@ func (g *marker) pop(id api.CmdID) {
 	g.out = append(g.out, m)
 	g.stack = g.stack[:len(g.stack)-1]
 }
+
+// Kind is a kind of API specific grouping of commands.
+type Kind int
+
+const (
+	// RenderPasses groups the commands by render pass instance and subpass.
+	RenderPasses Kind = iota
+	// Pipelines groups the commands by bound graphics pipeline.
+	Pipelines
+	// CommandBuffers groups the commands by command buffer recording, with
+	// the recordings nested under the submission of the command buffers.
+	CommandBuffers
+)
+
+// Provider is the interface implemented by APIs that provide API specific
+// groupers.
+type Provider interface {
+	// CmdGroupers returns the groupers of the given kind, or nil if the API
+	// does not support the grouping.
+	CmdGroupers(kind Kind) []Grouper
+}
@@ -229,6 +229,14 @@ func (r *CommandTreeResolvable) Resolve(ctx context.Context) (interface{}, error
 		groupers = append(groupers, cmdgrouper.Marker())
 	}
 
+	for _, kind := range apiGroupings(p) {
+		for _, a := range c.APIs {
+			if provider, ok := a.(cmdgrouper.Provider); ok {
+				groupers = append(groupers, provider.CmdGroupers(kind)...)
+			}
+		}
+	}
+
 	// Walk the list of unfiltered commands to build the groups.
 	s := c.NewState(ctx)
 	err = api.ForeachCmd(ctx, c.Commands, false, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
@@ -257,9 +265,12 @@ func (r *CommandTreeResolvable) Resolve(ctx context.Context) (interface{}, error
 	}
 	for _, g := range groupers {
 		for _, l := range g.Build(api.CmdID(len(c.Commands))) {
-			if group, err := out.root.AddGroup(l.Start, l.End, l.Name); err == nil {
-				group.UserData = l.UserData
+			group, err := out.root.AddGroup(l.Start, l.End, l.Name)
+			if err != nil {
+				log.W(ctx, "Dropped group '%v' [%v, %v): %v", l.Name, l.Start, l.End, err)
+				continue
 			}
+			group.UserData = l.UserData
 		}
 	}
 
@@ -360,6 +371,21 @@ func (r *CommandTreeResolvable) Resolve(ctx context.Context) (interface{}, error
 	return out, nil
 }
 
+// apiGroupings returns the kinds of API specific groupings requested by p.
+func apiGroupings(p *path.CommandTree) []cmdgrouper.Kind {
+	out := []cmdgrouper.Kind{}
+	if p.GroupByCommandBuffer {
+		out = append(out, cmdgrouper.CommandBuffers)
+	}
+	if p.GroupByRenderPass {
+		out = append(out, cmdgrouper.RenderPasses)
+	}
+	if p.GroupByPipeline {
+		out = append(out, cmdgrouper.Pipelines)
+	}
+	return out
+}
+
 func addFrameEventGroups(
 	ctx context.Context,
 	events *service.Events,
@@ -164,6 +164,11 @@ type DependencyGraph interface {
 
 	GetNodeAccesses(NodeID) NodeAccesses
 
+	// GetStateRef returns the owner of the given state reference, and the
+	// fragment of the owner holding the reference. The owner of the roots of
+	// the state is api.NilRefID. This requires Config().SaveNodeAccesses.
+	GetStateRef(api.RefID) (RefFrag, bool)
+
 	// Config returns the config used to create this graph
 	Config() DependencyGraphConfig
 }
@@ -362,6 +367,11 @@ func (g *dependencyGraph) GetNodeAccesses(nodeID NodeID) NodeAccesses {
 	}
 }
 
+func (g *dependencyGraph) GetStateRef(ref api.RefID) (RefFrag, bool) {
+	r, ok := g.stateRefs[ref]
+	return r, ok
+}
+
 // Config returns the config used to create this graph
 func (g *dependencyGraph) Config() DependencyGraphConfig {
 	return g.config
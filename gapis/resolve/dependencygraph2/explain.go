@@ -0,0 +1,198 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// LivenessStep is a node of a chain of dependencies keeping a command alive.
+type LivenessStep struct {
+	ID   NodeID
+	Node Node
+	// Accesses describe the accesses that made this node depend on the next
+	// node of the chain. They are empty for the last node of the chain.
+	Accesses []string
+}
+
+// ExplainLiveness returns the shortest chain of dependencies from the
+// requested (sub)command to the kept (sub)command, which explains why DCECapture
+// keeps the kept command when the requested command is requested.
+func ExplainLiveness(ctx context.Context, p *path.Capture, requested, kept api.SubCmdIdx) ([]LivenessStep, error) {
+	ctx = log.Enter(ctx, "ExplainLiveness")
+	cfg := DependencyGraphConfig{
+		MergeSubCmdNodes:       !config.DeadSubCmdElimination,
+		IncludeInitialCommands: false,
+		SaveNodeAccesses:       true,
+	}
+	graph, err := GetDependencyGraph(ctx, p, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Could not build dependency graph: %v", err)
+	}
+	src := graph.GetCmdNodeID(api.CmdID(requested[0]), requested[1:])
+	if src == NodeNoID {
+		return nil, fmt.Errorf("Requested cmd not in graph: %v", requested)
+	}
+	tgt := graph.GetCmdNodeID(api.CmdID(kept[0]), kept[1:])
+	if tgt == NodeNoID {
+		return nil, fmt.Errorf("Kept cmd not in graph: %v", kept)
+	}
+
+	chain, err := FindDependencyChain(graph, src, tgt)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		if cmd := graph.GetCommand(api.CmdID(kept[0])); cmd != nil && cmd.Alive() {
+			return nil, fmt.Errorf("Cmd %v is not a dependency of cmd %v, but is always kept alive", kept, requested)
+		}
+		return nil, fmt.Errorf("Cmd %v is not a dependency of cmd %v", kept, requested)
+	}
+
+	steps := make([]LivenessStep, len(chain))
+	for i, id := range chain {
+		steps[i] = LivenessStep{ID: id, Node: graph.GetNode(id)}
+		if i+1 < len(chain) {
+			steps[i].Accesses = DescribeDependency(graph, id, chain[i+1])
+		}
+	}
+	return steps, nil
+}
+
+// FindDependencyChain returns the shortest chain of nodes from src to tgt,
+// where each node depends on the next node, or nil if tgt is not a transitive
+// dependency of src.
+func FindDependencyChain(graph DependencyGraph, src, tgt NodeID) ([]NodeID, error) {
+	// This is the BFS of DCEBuilder.markDependencies, recording the node from
+	// which each node was first reached.
+	parents := map[NodeID]NodeID{src: NodeNoID}
+	queue := []NodeID{src}
+	for len(queue) > 0 && tgt != src {
+		n := queue[0]
+		queue = queue[1:]
+		err := graph.ForeachDependencyFrom(n, func(d NodeID) error {
+			if _, ok := parents[d]; !ok {
+				parents[d] = n
+				queue = append(queue, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := parents[tgt]; ok {
+			break
+		}
+	}
+	if _, ok := parents[tgt]; !ok {
+		return nil, nil
+	}
+
+	chain := []NodeID{}
+	for n := tgt; n != NodeNoID; n = parents[n] {
+		chain = append(chain, n)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// DescribeDependency returns the descriptions of the state, memory and
+// forward accesses that made src depend on tgt. The graph must have been
+// built with SaveNodeAccesses.
+func DescribeDependency(graph DependencyGraph, src, tgt NodeID) []string {
+	out := []string{}
+	acc := graph.GetNodeAccesses(src)
+	for _, a := range acc.FragmentAccesses {
+		if containsNode(a.Deps, tgt) {
+			out = append(out, fmt.Sprintf("%s of state %s", accessModeName(a.Mode), statePath(graph, a.Ref, a.Fragment)))
+		}
+	}
+	for _, a := range acc.MemoryAccesses {
+		if containsNode(a.Deps, tgt) {
+			out = append(out, fmt.Sprintf("%s of memory [0x%x-0x%x] of pool %v",
+				accessModeName(a.Mode), a.Span.Start, a.Span.End-1, a.Pool))
+		}
+	}
+	for _, a := range acc.ForwardAccesses {
+		if a.Mode == FORWARD_OPEN && a.Nodes.Close == tgt {
+			out = append(out, fmt.Sprintf("forward dependency %v", a.DependencyID))
+		}
+	}
+	for _, a := range graph.GetNodeAccesses(tgt).ForwardAccesses {
+		if a.Mode == FORWARD_CLOSE && a.Nodes.Open == src && a.Nodes.Open < a.Nodes.Close {
+			out = append(out, fmt.Sprintf("forward dependency %v", a.DependencyID))
+		}
+	}
+	if acc.ParentNode == tgt {
+		out = append(out, "subcommand of parent command")
+	}
+	if containsNode(acc.InitCmdNodes, tgt) {
+		out = append(out, "initial command")
+	}
+	return out
+}
+
+// statePath returns the path of the fragment of the state reference, from
+// the root of the state.
+func statePath(graph DependencyGraph, ref api.RefID, frag api.Fragment) string {
+	parts := []string{fmt.Sprint(frag)}
+	for {
+		refFrag, ok := graph.GetStateRef(ref)
+		if !ok {
+			parts = append(parts, fmt.Sprintf("<ref %v>", ref))
+			break
+		}
+		if refFrag.RefID == api.NilRefID {
+			parts = append(parts, "State")
+			break
+		}
+		parts = append(parts, fmt.Sprint(refFrag.Frag))
+		ref = refFrag.RefID
+	}
+	sb := strings.Builder{}
+	for i := len(parts) - 1; i >= 0; i-- {
+		sb.WriteString(parts[i])
+	}
+	return sb.String()
+}
+
+func accessModeName(m AccessMode) string {
+	switch {
+	case m&ACCESS_READ != 0 && m&ACCESS_WRITE != 0:
+		return "read-write"
+	case m&ACCESS_WRITE != 0:
+		return "write"
+	default:
+		return "read"
+	}
+}
+
+func containsNode(nodes []NodeID, n NodeID) bool {
+	for _, d := range nodes {
+		if d == n {
+			return true
+		}
+	}
+	return false
+}
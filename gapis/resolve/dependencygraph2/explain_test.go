@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph2
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+)
+
+func TestExplainDependencyChain(t *testing.T) {
+	ctx := log.Testing(t)
+	header := &capture.Header{ABI: device.LinuxX86_64}
+	cmds := []api.Cmd{TestCmd{}, TestCmd{}, TestCmd{}}
+	c, err := capture.NewGraphicsCapture(ctx, "test", header, &capture.InitialState{}, cmds)
+	if !assert.For(ctx, "capture.NewGraphicsCapture").ThatError(err).Succeeded() {
+		return
+	}
+	cfg := DependencyGraphConfig{SaveNodeAccesses: true}
+	b := newDependencyGraphBuilder(ctx, cfg, c, []api.Cmd{}, c.NewState(ctx))
+	refA, refB, refC := newTestRef(), newTestRef(), newTestRef()
+
+	b.OnBeginCmd(ctx, 0, TestCmd{})
+	b.OnWriteFrag(ctx, refA, api.FieldFragment{FIELD_A_B{}}, api.NilReference{}, refB, true)
+	b.OnEndCmd(ctx, 0, TestCmd{})
+
+	b.OnBeginCmd(ctx, 1, TestCmd{})
+	b.OnReadFrag(ctx, refA, api.FieldFragment{FIELD_A_B{}}, refB, true)
+	b.OnWriteFrag(ctx, refB, api.FieldFragment{FIELD_B_C{}}, api.NilReference{}, refC, true)
+	b.OnEndCmd(ctx, 1, TestCmd{})
+
+	b.OnBeginCmd(ctx, 2, TestCmd{})
+	b.OnReadFrag(ctx, refB, api.FieldFragment{FIELD_B_C{}}, refC, true)
+	b.OnEndCmd(ctx, 2, TestCmd{})
+
+	g := b.graphBuilder.GetGraph()
+	g.setStateRefs(b.fragWatcher.GetStateRefs())
+	node := func(cmdID uint64) NodeID {
+		return g.GetCmdNodeID(api.CmdID(cmdID), api.SubCmdIdx{})
+	}
+
+	chain, err := FindDependencyChain(g, node(2), node(0))
+	if assert.For(ctx, "FindDependencyChain").ThatError(err).Succeeded() {
+		assert.For(ctx, "chain").ThatSlice(chain).Equals([]NodeID{node(2), node(1), node(0)})
+	}
+	assert.For(ctx, "accesses 2 -> 1").ThatSlice(DescribeDependency(g, node(2), node(1))).
+		Equals([]string{"read of state State.B.C"})
+	assert.For(ctx, "accesses 1 -> 0").ThatSlice(DescribeDependency(g, node(1), node(0))).
+		Equals([]string{"read of state State.B"})
+
+	chain, err = FindDependencyChain(g, node(0), node(2))
+	if assert.For(ctx, "FindDependencyChain").ThatError(err).Succeeded() {
+		assert.For(ctx, "reversed chain").ThatSlice(chain).IsEmpty()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"fmt"
+	"sort"
+)
+
+// collapseSubCommands merges the subcommand nodes into the node of the
+// command submitting them. The dependencies of the subcommands become
+// dependencies of the command.
+func (g *graph) collapseSubCommands() {
+	commandIdToNode := map[uint64]*node{}
+	for _, currentNode := range g.nodeIdToNode {
+		if len(currentNode.commandIndex) == 1 {
+			commandIdToNode[currentNode.commandIndex[0]] = currentNode
+		}
+	}
+
+	for _, currentNode := range g.getSortedNodes() {
+		if len(currentNode.commandIndex) <= 1 {
+			continue
+		}
+		parentNode, ok := commandIdToNode[currentNode.commandIndex[0]]
+		if !ok {
+			continue
+		}
+		for idSource := range currentNode.inNeighbourIdToEdgeId {
+			if idSource != parentNode.id {
+				g.addEdgeBetweenNodesById(idSource, parentNode.id)
+			}
+		}
+		for idSink := range currentNode.outNeighbourIdToEdgeId {
+			if idSink != parentNode.id {
+				g.addEdgeBetweenNodesById(parentNode.id, idSink)
+			}
+		}
+		g.removeNodeById(currentNode.id)
+	}
+
+	for _, currentNode := range g.nodeIdToNode {
+		currentNode.subCommandNodes = nil
+	}
+}
+
+// keepCommands removes the nodes of the commands outside of the range
+// [first, last].
+func (g *graph) keepCommands(first, last uint64) {
+	g.removeNodesIf(func(currentNode *node) bool {
+		if len(currentNode.commandIndex) == 0 {
+			return true
+		}
+		id := currentNode.commandIndex[0]
+		return id < first || id > last
+	})
+}
+
+// keepFrame removes the nodes of the commands outside of the given 1-based
+// frame. A frame ends with the command flagged as end of frame.
+func (g *graph) keepFrame(frame int) {
+	commands := []uint64{}
+	commandIsEndOfFrame := map[uint64]bool{}
+	for _, currentNode := range g.nodeIdToNode {
+		if len(currentNode.commandIndex) == 1 {
+			commands = append(commands, currentNode.commandIndex[0])
+			commandIsEndOfFrame[currentNode.commandIndex[0]] = currentNode.isEndOfFrame
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i] < commands[j] })
+
+	commandIdToFrame := map[uint64]int{}
+	currentFrame := 1
+	for _, id := range commands {
+		commandIdToFrame[id] = currentFrame
+		if commandIsEndOfFrame[id] {
+			currentFrame++
+		}
+	}
+
+	g.removeNodesIf(func(currentNode *node) bool {
+		if len(currentNode.commandIndex) == 0 {
+			return true
+		}
+		return commandIdToFrame[currentNode.commandIndex[0]] != frame
+	})
+}
+
+// keepLabels removes the nodes without a label level matching one of labels.
+// A level matches either by name, or by name followed by ID.
+func (g *graph) keepLabels(labels []string) {
+	isLabel := map[string]bool{}
+	for _, label := range labels {
+		isLabel[label] = true
+	}
+	g.removeNodesIf(func(currentNode *node) bool {
+		for i, name := range currentNode.label.LevelsName {
+			if isLabel[name] || isLabel[fmt.Sprintf("%s%d", name, currentNode.label.LevelsID[i])] {
+				return false
+			}
+		}
+		return true
+	})
+}
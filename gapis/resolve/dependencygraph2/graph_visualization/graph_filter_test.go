@@ -0,0 +1,124 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"github.com/google/gapid/gapis/api"
+	"strings"
+	"testing"
+)
+
+func addCommandNode(g *graph, id int, name string, commandIndex ...uint64) *node {
+	label := &api.Label{LevelsName: []string{name}, LevelsID: []int{id}}
+	newNode := getNewNode(id, label)
+	newNode.commandIndex = commandIndex
+	g.addNode(newNode)
+	return newNode
+}
+
+func TestCollapseSubCommands(t *testing.T) {
+	wantedGraph := createGraph(0)
+	addCommandNode(wantedGraph, 1, "A", 0)
+	addCommandNode(wantedGraph, 2, "B", 1)
+	addCommandNode(wantedGraph, 5, "C", 2)
+	wantedGraph.addEdgeBetweenNodesById(2, 1)
+	wantedGraph.addEdgeBetweenNodesById(5, 2)
+
+	obtainedGraph := createGraph(0)
+	addCommandNode(obtainedGraph, 1, "A", 0)
+	parent := addCommandNode(obtainedGraph, 2, "B", 1)
+	parent.addSubCommandNode(addCommandNode(obtainedGraph, 3, "B", 1, 0))
+	parent.addSubCommandNode(addCommandNode(obtainedGraph, 4, "B", 1, 1))
+	addCommandNode(obtainedGraph, 5, "C", 2)
+	obtainedGraph.addEdgeBetweenNodesById(3, 1)
+	obtainedGraph.addEdgeBetweenNodesById(4, 3)
+	obtainedGraph.addEdgeBetweenNodesById(4, 2)
+	obtainedGraph.addEdgeBetweenNodesById(5, 4)
+	obtainedGraph.collapseSubCommands()
+
+	if !areEqualGraphs(t, wantedGraph, obtainedGraph) {
+		t.Errorf("The collapsed graph is different from the expected graph\n")
+	}
+	if len(parent.subCommandNodes) != 0 {
+		t.Errorf("The collapsed node still has %d subcommand nodes\n", len(parent.subCommandNodes))
+	}
+}
+
+func TestKeepFrame(t *testing.T) {
+	wantedGraph := createGraph(0)
+	addCommandNode(wantedGraph, 3, "C", 2)
+	addCommandNode(wantedGraph, 4, "C", 2, 0)
+	addCommandNode(wantedGraph, 5, "D", 3)
+	wantedGraph.addEdgeBetweenNodesById(4, 3)
+	wantedGraph.addEdgeBetweenNodesById(5, 4)
+
+	obtainedGraph := createGraph(0)
+	addCommandNode(obtainedGraph, 1, "A", 0)
+	addCommandNode(obtainedGraph, 2, "B", 1).isEndOfFrame = true
+	addCommandNode(obtainedGraph, 3, "C", 2)
+	addCommandNode(obtainedGraph, 4, "C", 2, 0)
+	addCommandNode(obtainedGraph, 5, "D", 3).isEndOfFrame = true
+	addCommandNode(obtainedGraph, 6, "E", 4)
+	obtainedGraph.addEdgeBetweenNodesById(2, 1)
+	obtainedGraph.addEdgeBetweenNodesById(3, 2)
+	obtainedGraph.addEdgeBetweenNodesById(4, 3)
+	obtainedGraph.addEdgeBetweenNodesById(5, 4)
+	obtainedGraph.addEdgeBetweenNodesById(6, 5)
+	obtainedGraph.keepFrame(2)
+
+	if !areEqualGraphs(t, wantedGraph, obtainedGraph) {
+		t.Errorf("The graph of the frame is different from the expected graph\n")
+	}
+}
+
+func TestKeepCommandsAndLabels(t *testing.T) {
+	wantedGraph := createGraph(0)
+	addCommandNode(wantedGraph, 2, "B", 1)
+	addCommandNode(wantedGraph, 3, "C", 2)
+	wantedGraph.addEdgeBetweenNodesById(3, 2)
+
+	obtainedGraph := createGraph(0)
+	addCommandNode(obtainedGraph, 1, "A", 0)
+	addCommandNode(obtainedGraph, 2, "B", 1)
+	addCommandNode(obtainedGraph, 3, "C", 2)
+	addCommandNode(obtainedGraph, 4, "C", 3)
+	addCommandNode(obtainedGraph, 5, "D", 4)
+	obtainedGraph.addEdgeBetweenNodesById(2, 1)
+	obtainedGraph.addEdgeBetweenNodesById(3, 2)
+	obtainedGraph.addEdgeBetweenNodesById(4, 3)
+	obtainedGraph.keepCommands(1, 3)
+	obtainedGraph.keepLabels([]string{"B", "C3"})
+
+	if !areEqualGraphs(t, wantedGraph, obtainedGraph) {
+		t.Errorf("The filtered graph is different from the expected graph\n")
+	}
+}
+
+func TestGraphMLFormat(t *testing.T) {
+	currentGraph := createGraph(0)
+	addCommandNode(currentGraph, 1, "A<B>", 0)
+	addCommandNode(currentGraph, 2, "C", 1)
+	currentGraph.addEdgeBetweenNodesById(2, 1)
+
+	output := string(currentGraph.getGraphInGraphMLFormat())
+	for _, wanted := range []string{
+		"<node id=\"n1\">\n<data key=\"label\">A&lt;B&gt;1</data>\n",
+		"<edge source=\"n2\" target=\"n1\"/>\n",
+	} {
+		if !strings.Contains(output, wanted) {
+			t.Errorf("The GraphML output does not contain %q:\n%s", wanted, output)
+		}
+	}
+}
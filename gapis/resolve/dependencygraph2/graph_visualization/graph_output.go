@@ -16,6 +16,8 @@ package graph_visualization
 
 import (
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 )
 
@@ -67,3 +69,85 @@ func (g *graph) getGraphInPbtxtFormat() []byte {
 	}
 	return output.Bytes()
 }
+
+func (g *graph) getGraphInGraphMLFormat() []byte {
+	var output bytes.Buffer
+	output.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	output.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	output.WriteString("<key id=\"label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	output.WriteString("<key id=\"command\" for=\"node\" attr.name=\"command\" attr.type=\"string\"/>\n")
+	output.WriteString("<key id=\"index\" for=\"node\" attr.name=\"index\" attr.type=\"string\"/>\n")
+	output.WriteString("<key id=\"color\" for=\"node\" attr.name=\"color\" attr.type=\"string\"/>\n")
+	output.WriteString("<key id=\"attributes\" for=\"node\" attr.name=\"attributes\" attr.type=\"string\"/>\n")
+	output.WriteString("<graph id=\"G\" edgedefault=\"directed\">\n")
+	nodes := g.getSortedNodes()
+	for _, currentNode := range nodes {
+		fmt.Fprintf(&output, "<node id=\"n%d\">\n", currentNode.id)
+		writeGraphMLData(&output, "label", currentNode.label.GetLabelAsAString())
+		writeGraphMLData(&output, "command", currentNode.label.GetCommandName())
+		writeGraphMLData(&output, "index", fmt.Sprint(currentNode.commandIndex))
+		writeGraphMLData(&output, "color", currentNode.color)
+		writeGraphMLData(&output, "attributes", currentNode.attributes)
+		output.WriteString("</node>\n")
+	}
+	for _, currentNode := range nodes {
+		outNeighbours := g.getSortedNeighbours(currentNode.outNeighbourIdToEdgeId)
+		for _, neighbour := range outNeighbours {
+			fmt.Fprintf(&output, "<edge source=\"n%d\" target=\"n%d\"/>\n", currentNode.id, neighbour.id)
+		}
+	}
+	output.WriteString("</graph>\n")
+	output.WriteString("</graphml>\n")
+	return output.Bytes()
+}
+
+func writeGraphMLData(output *bytes.Buffer, key, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(output, "<data key=\"%s\">", key)
+	xml.EscapeText(output, []byte(value))
+	output.WriteString("</data>\n")
+}
+
+// jsonElement is a node or an edge of the JSON elements format of Cytoscape.
+type jsonElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func (g *graph) getGraphInJSONFormat() ([]byte, error) {
+	elements := struct {
+		Nodes []jsonElement `json:"nodes"`
+		Edges []jsonElement `json:"edges"`
+	}{Nodes: []jsonElement{}, Edges: []jsonElement{}}
+
+	nodes := g.getSortedNodes()
+	for _, currentNode := range nodes {
+		data := map[string]interface{}{
+			"id":      fmt.Sprintf("n%d", currentNode.id),
+			"label":   currentNode.label.GetLabelAsAString(),
+			"command": currentNode.label.GetCommandName(),
+			"index":   currentNode.commandIndex,
+		}
+		if currentNode.color != "" {
+			data["color"] = currentNode.color
+		}
+		if currentNode.attributes != "" {
+			data["attributes"] = currentNode.attributes
+		}
+		elements.Nodes = append(elements.Nodes, jsonElement{data})
+	}
+	for _, currentNode := range nodes {
+		outNeighbours := g.getSortedNeighbours(currentNode.outNeighbourIdToEdgeId)
+		for _, neighbour := range outNeighbours {
+			elements.Edges = append(elements.Edges, jsonElement{map[string]interface{}{
+				"id":     fmt.Sprintf("e%d", currentNode.outNeighbourIdToEdgeId[neighbour.id]),
+				"source": fmt.Sprintf("n%d", currentNode.id),
+				"target": fmt.Sprintf("n%d", neighbour.id),
+			}})
+		}
+	}
+	return json.MarshalIndent(struct {
+		Elements interface{} `json:"elements"`
+	}{elements}, "", "  ")
+}
@@ -30,6 +30,8 @@ type node struct {
 	isEndOfFrame           bool
 	subCommandNodes        []*node
 	color                  string
+	// commandIndex is the index of the command or subcommand of the node.
+	commandIndex []uint64
 }
 
 type edge struct {
@@ -153,6 +155,30 @@ func (g *graph) removeNodeById(id int) {
 	delete(g.nodeIdToNode, id)
 }
 
+// removeNodesIf removes the nodes for which remove returns true, along with
+// their edges.
+func (g *graph) removeNodesIf(remove func(*node) bool) {
+	removed := false
+	for id, currentNode := range g.nodeIdToNode {
+		if remove(currentNode) {
+			g.removeNodeById(id)
+			removed = true
+		}
+	}
+	if !removed {
+		return
+	}
+	for _, currentNode := range g.nodeIdToNode {
+		subCommandNodes := currentNode.subCommandNodes[:0]
+		for _, subCommandNode := range currentNode.subCommandNodes {
+			if _, ok := g.nodeIdToNode[subCommandNode.id]; ok {
+				subCommandNodes = append(subCommandNodes, subCommandNode)
+			}
+		}
+		currentNode.subCommandNodes = subCommandNodes
+	}
+}
+
 func (g *graph) removeNodesWithZeroDegree() {
 	for id, currentNode := range g.nodeIdToNode {
 		if (len(currentNode.inNeighbourIdToEdgeId) + len(currentNode.outNeighbourIdToEdgeId)) == 0 {
@@ -88,6 +88,7 @@ func createGraphFromDependencyGraph(ctx context.Context, dependencyGraph depende
 					newNode := getNewNode(int(nodeId), label)
 					newNode.attributes = attributes
 					newNode.isEndOfFrame = cmdNode.CmdFlags.IsEndOfFrame()
+					newNode.commandIndex = append([]uint64{}, cmdNode.Index...)
 					if isSubCommand {
 						parentNode := currentGraph.nodeIdToNode[parentNodeId]
 						parentNode.addSubCommandNode(newNode)
@@ -111,7 +112,9 @@ func createGraphFromDependencyGraph(ctx context.Context, dependencyGraph depende
 	return currentGraph, err
 }
 
-func GetGraphVisualizationFromCapture(ctx context.Context, p *path.Capture, format service.GraphFormat) ([]byte, error) {
+// GetGraphVisualizationFromCapture returns the dependency graph of the
+// capture in the given format, restricted by opts.
+func GetGraphVisualizationFromCapture(ctx context.Context, p *path.Capture, format service.GraphFormat, opts *service.GraphVisualizationOptions) ([]byte, error) {
 	config := dependencygraph2.DependencyGraphConfig{
 		SaveNodeAccesses:       true,
 		IncludeInitialCommands: true,
@@ -125,9 +128,28 @@ func GetGraphVisualizationFromCapture(ctx context.Context, p *path.Capture, form
 	if err != nil {
 		return []byte{}, err
 	}
+	if opts.GetCollapseSubcommands() {
+		currentGraph.collapseSubCommands()
+	}
+	if commands := opts.GetCommands(); commands != nil {
+		first, last := uint64(0), ^uint64(0)
+		if len(commands.From) > 0 {
+			first = commands.From[0]
+		}
+		if len(commands.To) > 0 {
+			last = commands.To[0]
+		}
+		currentGraph.keepCommands(first, last)
+	}
+	if frame := opts.GetFrame(); frame > 0 {
+		currentGraph.keepFrame(int(frame))
+	}
 	currentGraph.assignColorToNodes()
 	currentGraph.joinNodesByFrame()
 	currentGraph.joinNodesThatDoNotBelongToAnyFrame()
+	if labels := opts.GetLabels(); len(labels) > 0 {
+		currentGraph.keepLabels(labels)
+	}
 
 	currentChunkConfig := chunkConfig{
 		maximumNumberOfNodesByLevel:   5,
@@ -135,12 +157,16 @@ func GetGraphVisualizationFromCapture(ctx context.Context, p *path.Capture, form
 	}
 	currentGraph.makeChunks(currentChunkConfig)
 
-	output := []byte{}
-	if format == service.GraphFormat_PBTXT {
-		output = currentGraph.getGraphInPbtxtFormat()
-	} else if format == service.GraphFormat_DOT {
-		output = currentGraph.getGraphInDotFormat()
+	switch format {
+	case service.GraphFormat_PBTXT:
+		return currentGraph.getGraphInPbtxtFormat(), nil
+	case service.GraphFormat_DOT:
+		return currentGraph.getGraphInDotFormat(), nil
+	case service.GraphFormat_GRAPHML:
+		return currentGraph.getGraphInGraphMLFormat(), nil
+	case service.GraphFormat_JSON:
+		return currentGraph.getGraphInJSONFormat()
+	default:
+		return []byte{}, fmt.Errorf("Unsupported graph format %v", format)
 	}
-
-	return output, err
 }
@@ -30,6 +30,7 @@ import (
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/box"
 	"github.com/google/gapid/gapis/service/path"
 )
 
@@ -56,25 +57,9 @@ func translateIDForDisplay(idx api.SubCmdIdx, data *sync.Data) (api.CmdID, bool)
 
 // Find performs a search using req and calling handler for each result.
 func Find(ctx context.Context, req *service.FindRequest, h service.FindHandler) error {
-	var pred func(s string) bool
-	text := req.Text
-	if !req.IsCaseSensitive {
-		text = strings.ToLower(text)
-	}
-	if req.IsRegex {
-		re, err := regexp.Compile(text)
-		if err != nil {
-			return log.Err(ctx, err, "Couldn't compile regular expression")
-		}
-		if req.IsCaseSensitive {
-			pred = re.MatchString
-		} else {
-			pred = func(s string) bool { return re.MatchString(strings.ToLower(s)) }
-		}
-	} else if req.IsCaseSensitive {
-		pred = func(s string) bool { return strings.Contains(s, text) }
-	} else {
-		pred = func(s string) bool { return strings.Contains(strings.ToLower(s), text) }
+	pred, err := findPredicate(ctx, req)
+	if err != nil {
+		return err
 	}
 
 	switch from := protoutil.OneOf(req.From).(type) {
@@ -99,26 +84,34 @@ func Find(ctx context.Context, req *service.FindRequest, h service.FindHandler)
 			return err
 		}
 
+		cmdPred := func(id api.CmdID) bool { return pred(fmt.Sprint(c.Commands[id])) }
+		if req.IsQuery {
+			if cmdPred, err = findQueryPredicate(ctx, req, c, cmdTree.path.Capture); err != nil {
+				return err
+			}
+		}
+
 		nodePred := func(item api.SpanItem) bool {
 			switch item := item.(type) {
 			case api.CmdIDGroup:
-				return pred(item.Name)
+				// Queries only match commands.
+				return !req.IsQuery && pred(item.Name)
 			case api.SubCmdIdx:
 				if len(item) > 1 {
 					if idx, found := translateIDForDisplay(item, snc); found {
-						return pred(fmt.Sprint(c.Commands[idx]))
+						return cmdPred(idx)
 					}
 					return false
 				}
-				return pred(fmt.Sprint(c.Commands[item[0]]))
+				return cmdPred(api.CmdID(item[0]))
 			case api.SubCmdRoot:
 				if len(item.Id) > 1 {
 					if idx, found := translateIDForDisplay(item.Id, snc); found {
-						return pred(fmt.Sprint(c.Commands[idx]))
+						return cmdPred(idx)
 					}
 					return false
 				}
-				return pred(fmt.Sprint(c.Commands[item.Id[0]]))
+				return cmdPred(api.CmdID(item.Id[0]))
 			default:
 				return false
 			}
@@ -143,12 +136,85 @@ func Find(ctx context.Context, req *service.FindRequest, h service.FindHandler)
 		}
 
 	case *path.StateTreeNode:
-		return fault.Const("TODO: Implement StateTreeNode searching") // TODO
+		if req.IsQuery {
+			return fault.Const("Queries are only supported for command tree searches")
+		}
+		boxedStateTree, err := database.Resolve(ctx, from.Tree.ID())
+		if err != nil {
+			return err
+		}
+		return findInStateTree(ctx, boxedStateTree.(*stateTree), req, from, pred, h)
+
 	default:
 		return fmt.Errorf("Unsupported FindRequest.From type %T", from)
 	}
 }
 
+// findPredicate returns the function used to match strings for req.
+func findPredicate(ctx context.Context, req *service.FindRequest) (func(s string) bool, error) {
+	if req.IsQuery {
+		// Queries are matched against commands, see findQueryPredicate.
+		return func(string) bool { return false }, nil
+	}
+	text := req.Text
+	if !req.IsCaseSensitive {
+		text = strings.ToLower(text)
+	}
+	switch {
+	case req.IsRegex:
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Couldn't compile regular expression")
+		}
+		if req.IsCaseSensitive {
+			return re.MatchString, nil
+		}
+		return func(s string) bool { return re.MatchString(strings.ToLower(s)) }, nil
+	case req.IsCaseSensitive:
+		return func(s string) bool { return strings.Contains(s, text) }, nil
+	default:
+		return func(s string) bool { return strings.Contains(strings.ToLower(s), text) }, nil
+	}
+}
+
+// findInStateTree searches the state tree starting from the node from, calling
+// h for each node whose name or value matches pred.
+func findInStateTree(ctx context.Context, tree *stateTree, req *service.FindRequest, from *path.StateTreeNode, pred func(s string) bool, h service.FindHandler) error {
+	nodePred := func(n *stn) bool {
+		if !n.isSubgroup && pred(n.name) {
+			return true
+		}
+		for _, s := range stateValueStrings(ctx, n) {
+			if pred(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	emitter := &stateEmitter{ctx, req, from, h, 0, nodePred}
+
+	// An empty starting point means the whole tree is searched, so there is
+	// nothing to wrap around to.
+	all := len(from.Indices) == 0
+
+	first, second := stateAfter, stateBefore
+	if req.Backwards {
+		first, second = stateBefore, stateAfter
+	}
+	err := emitter.traverse(tree, first, all)
+	if err == nil && req.Wrap && !all {
+		err = emitter.traverse(tree, second, false)
+	}
+
+	switch err {
+	case nil, stop:
+		return nil
+	default:
+		return err
+	}
+}
+
 type commandEmitter struct {
 	ctx      context.Context
 	req      *service.FindRequest
@@ -204,3 +270,150 @@ func (c *commandEmitter) shouldStop(indices []uint64) bool {
 	// Stop searching if we're wrapping and have arrived back where we started.
 	return c.wrapping && reflect.DeepEqual(c.from.Indices, indices)
 }
+
+// stateSide is a region of the state tree relative to the searching point,
+// in pre-order traversal order.
+type stateSide int
+
+const (
+	// stateBefore are the nodes visited before the searching point.
+	stateBefore stateSide = iota
+	// stateAfter are the nodes visited after the searching point.
+	stateAfter
+)
+
+// stateRelation is the relation of a node to the searching point.
+type stateRelation int
+
+const (
+	relBefore   stateRelation = iota // Precedes, but is not an ancestor.
+	relAncestor                      // Is an ancestor of the searching point.
+	relEqual                         // Is the searching point.
+	relAfter                         // Follows, including all descendants.
+)
+
+func relationTo(indices, from []uint64) stateRelation {
+	for i := 0; i < len(indices) && i < len(from); i++ {
+		switch {
+		case indices[i] < from[i]:
+			return relBefore
+		case indices[i] > from[i]:
+			return relAfter
+		}
+	}
+	switch {
+	case len(indices) < len(from):
+		return relAncestor
+	case len(indices) == len(from):
+		return relEqual
+	default:
+		return relAfter
+	}
+}
+
+type stateEmitter struct {
+	ctx   context.Context
+	req   *service.FindRequest
+	from  *path.StateTreeNode
+	h     service.FindHandler
+	count uint32
+	pred  func(n *stn) bool
+}
+
+// traverse visits all the nodes of tree on the given side of the searching
+// point, in the direction of the search. If all is true then every node
+// except the root is visited.
+func (s *stateEmitter) traverse(tree *stateTree, side stateSide, all bool) error {
+	return s.visit(tree, tree.root, []uint64{}, side, all, map[api.RefID]struct{}{})
+}
+
+// visit searches the node n at indices and its descendants. seen holds the
+// references of the node's ancestors, and is used to break reference cycles.
+func (s *stateEmitter) visit(tree *stateTree, n *stn, indices []uint64, side stateSide, all bool, seen map[api.RefID]struct{}) error {
+	if err := task.StopReason(s.ctx); err != nil {
+		return err
+	}
+
+	// Work out whether this node and its descendants are part of the search.
+	self, children := all && len(indices) > 0, all
+	if !all {
+		switch rel := relationTo(indices, s.from.Indices); side {
+		case stateBefore:
+			self = rel == relBefore || rel == relAncestor
+			children = self
+		case stateAfter:
+			self = rel == relAfter
+			children = rel != relBefore
+		}
+	}
+	if !children {
+		return nil
+	}
+
+	switch {
+	case !n.value.IsValid():
+		children = false
+	case box.IsMemorySlice(n.value.Type()):
+		// Do not search into memory slices, as this would load all of the
+		// observed memory for the slice.
+		children = false
+	}
+
+	if children && !isNil(n.value) {
+		if ref, ok := n.value.Interface().(api.Reference); ok {
+			if _, cyclic := seen[ref.RefID()]; cyclic {
+				children = false
+			} else {
+				seen[ref.RefID()] = struct{}{}
+				defer delete(seen, ref.RefID())
+			}
+		}
+	}
+
+	if self && !s.req.Backwards && s.pred(n) {
+		if err := s.emit(indices); err != nil {
+			return err
+		}
+	}
+
+	if children {
+		n.buildChildren(s.ctx, tree)
+		count := len(n.children)
+		for i := 0; i < count; i++ {
+			ci := i
+			if s.req.Backwards {
+				ci = count - 1 - i
+			}
+			childIndices := append(append([]uint64{}, indices...), uint64(ci))
+			if err := s.visit(tree, n.children[ci], childIndices, side, all, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	if self && s.req.Backwards && s.pred(n) {
+		if err := s.emit(indices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stateEmitter) emit(indices []uint64) error {
+	err := s.h(&service.FindResponse{
+		Result: &service.FindResponse_StateTreeNode{
+			StateTreeNode: &path.StateTreeNode{
+				Tree:    s.from.Tree,
+				Indices: indices,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.count++
+	if s.req.MaxItems != 0 && s.count >= s.req.MaxItems {
+		return stop
+	}
+	return nil
+}
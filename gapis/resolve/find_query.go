@@ -0,0 +1,68 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/cmdquery"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// findQueryPredicate returns the function used to match the commands of c
+// against the query of req. Commands that fail to evaluate do not match, and
+// the first evaluation error is logged.
+func findQueryPredicate(ctx context.Context, req *service.FindRequest, c *capture.GraphicsCapture, p *path.Capture) (func(id api.CmdID) bool, error) {
+	q, err := cmdquery.Parse(req.Text)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't parse query")
+	}
+
+	logged := false
+	match := func(ctx context.Context, cmd api.Cmd, s *api.GlobalState) bool {
+		ok, err := q.Match(ctx, cmd, s)
+		if err != nil && !logged {
+			log.W(ctx, "Query '%v' failed for %v: %v", q, cmd, err)
+			logged = true
+		}
+		return ok
+	}
+
+	if !q.NeedsState() {
+		return func(id api.CmdID) bool { return match(ctx, c.Commands[id], nil) }, nil
+	}
+
+	// The query inspects the state, so evaluate it against the state after
+	// each command in a single pass over the capture.
+	ctx = SetupContext(ctx, p, req.Config)
+	matches := make([]bool, len(c.Commands))
+	s := c.NewState(ctx)
+	err = api.ForeachCmd(ctx, c.Commands, false, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
+			return fmt.Errorf("Fail to mutate command %v: %v", cmd, err)
+		}
+		matches[id] = match(ctx, cmd, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(id api.CmdID) bool { return matches[id] }, nil
+}
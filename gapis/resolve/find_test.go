@@ -0,0 +1,132 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/test"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestFindInStateTree(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := capture.Header{ABI: device.AndroidARM64v8a}
+	cap, err := capture.NewGraphicsCapture(ctx, "test-capture", &header, nil, []api.Cmd{})
+	if err != nil {
+		panic(err)
+	}
+	c, err := cap.Path(ctx)
+	if err != nil {
+		panic(err)
+	}
+	ctx = capture.Put(ctx, c)
+	gs, err := capture.NewState(ctx)
+	if err != nil {
+		panic(err)
+	}
+	tree := &stateTree{
+		globalState: gs,
+		root: &stn{
+			name:  "root",
+			value: reflect.ValueOf(testState),
+			path:  c.Command(0).StateAfter(),
+		},
+		api:        &path.API{ID: path.NewID(id.ID(test.API{}.ID()))},
+		groupLimit: 10,
+	}
+	root := &path.StateTreeNode{Indices: []uint64{}}
+
+	type I []uint64
+	for _, test := range []struct {
+		name     string
+		req      *service.FindRequest
+		from     *path.StateTreeNode
+		expected []I
+	}{
+		{
+			"forwards from root",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true},
+			root,
+			[]I{{1}, {4, 1}, {4, 9}, {4, 9, 1}, {4, 9, 9}, {5, 1}, {5, 9}},
+		}, {
+			"backwards from root",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true, Backwards: true},
+			root,
+			[]I{{5, 9}, {5, 1}, {4, 9, 9}, {4, 9, 1}, {4, 9}, {4, 1}, {1}},
+		}, {
+			"forwards",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true},
+			root.Index(4, 9),
+			[]I{{4, 9, 1}, {4, 9, 9}, {5, 1}, {5, 9}},
+		}, {
+			"forwards wrapped",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true, Wrap: true},
+			root.Index(4, 9),
+			[]I{{4, 9, 1}, {4, 9, 9}, {5, 1}, {5, 9}, {1}, {4, 1}},
+		}, {
+			"backwards",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true, Backwards: true},
+			root.Index(4, 9),
+			[]I{{4, 1}, {1}},
+		}, {
+			"backwards wrapped",
+			&service.FindRequest{Text: "Int", IsCaseSensitive: true, Backwards: true, Wrap: true},
+			root.Index(4, 9),
+			[]I{{4, 1}, {1}, {5, 9}, {5, 1}, {4, 9, 9}, {4, 9, 1}},
+		}, {
+			"case insensitive",
+			&service.FindRequest{Text: "INT", MaxItems: 4},
+			root,
+			[]I{{1}, {4, 1}, {4, 8}, {4, 9}},
+		}, {
+			"regex",
+			&service.FindRequest{Text: "^Int$", IsRegex: true, IsCaseSensitive: true},
+			root,
+			[]I{{1}, {4, 1}, {4, 9, 1}, {5, 1}},
+		}, {
+			"values",
+			&service.FindRequest{Text: "cat"},
+			root,
+			[]I{{4, 3}},
+		}, {
+			"pointer values",
+			&service.FindRequest{Text: "4112"},
+			root,
+			[]I{{4, 8}},
+		},
+	} {
+		pred, err := findPredicate(ctx, test.req)
+		assert.For(ctx, "findPredicate(%v)", test.name).ThatError(err).Succeeded()
+
+		got := []I{}
+		err = findInStateTree(ctx, tree, test.req, test.from, pred, func(r *service.FindResponse) error {
+			got = append(got, r.GetStateTreeNode().Indices)
+			return nil
+		})
+		assert.For(ctx, "findInStateTree(%v)", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "findInStateTree(%v)", test.name).ThatSlice(got).DeepEquals(test.expected)
+	}
+}
@@ -31,5 +31,10 @@ func Framegraph(ctx context.Context, p *path.Framegraph, r *path.ResolveConfig)
 	if len(c.APIs) != 1 {
 		return nil, log.Errf(ctx, nil, "Framegraph can be obtained only on a capture with a single API, whereas this capture has %v API(s).", len(c.APIs))
 	}
-	return c.APIs[0].GetFramegraph(ctx, p.Capture)
+	fg, err := c.APIs[0].GetFramegraph(ctx, p.Capture)
+	if err != nil {
+		return nil, err
+	}
+	analyzeFramegraph(fg)
+	return fg, nil
 }
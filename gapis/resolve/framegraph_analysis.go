@@ -0,0 +1,206 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// attachmentUse is an attachment of a renderpass, as seen by the first
+// subpass using it.
+type attachmentUse struct {
+	att          *api.FramegraphAttachment
+	depthStencil bool
+}
+
+// renderpassAttachments returns the attachments of the renderpass in order of
+// first use. Load operations happen at the first use of an attachment, so the
+// first subpass using it is the relevant one.
+func renderpassAttachments(rp *api.FramegraphRenderpass) []attachmentUse {
+	uses := []attachmentUse{}
+	seen := map[uint64]bool{}
+	add := func(att *api.FramegraphAttachment, depthStencil bool) {
+		if att == nil || att.Image == nil || seen[att.ImageViewHandle] {
+			return
+		}
+		seen[att.ImageViewHandle] = true
+		uses = append(uses, attachmentUse{att, depthStencil})
+	}
+	for _, sp := range rp.Subpass {
+		for _, att := range sp.Input {
+			add(att, false)
+		}
+		for _, att := range sp.Color {
+			add(att, false)
+		}
+		for _, att := range sp.Resolve {
+			add(att, false)
+		}
+		add(sp.DepthStencil, true)
+	}
+	return uses
+}
+
+// imageAccesses returns the image accesses of the node's workload.
+func imageAccesses(node *api.FramegraphNode) []*api.FramegraphImageAccess {
+	if rp := node.GetRenderpass(); rp != nil {
+		return rp.ImageAccess
+	}
+	if c := node.GetCompute(); c != nil {
+		return c.ImageAccess
+	}
+	return nil
+}
+
+// readsImage returns true if the node reads the image, either through a
+// memory access or by loading it as an attachment.
+func readsImage(node *api.FramegraphNode, image uint64) bool {
+	for _, acc := range imageAccesses(node) {
+		if acc.Read && acc.Image.GetHandle() == image {
+			return true
+		}
+	}
+	if rp := node.GetRenderpass(); rp != nil {
+		for _, use := range renderpassAttachments(rp) {
+			if use.att.Image.Handle == image &&
+				(use.att.LoadOp == api.LoadStoreOp_LOAD || use.att.StencilLoadOp == api.LoadStoreOp_LOAD) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesImage returns true if the node accesses the image in any way.
+func usesImage(node *api.FramegraphNode, image uint64) bool {
+	for _, acc := range imageAccesses(node) {
+		if acc.Image.GetHandle() == image {
+			return true
+		}
+	}
+	if rp := node.GetRenderpass(); rp != nil {
+		for _, use := range renderpassAttachments(rp) {
+			if use.att.Image.Handle == image {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// analyzeFramegraph annotates the framegraph renderpass nodes with the
+// wasteful load/store operations and allocations that are costly on tile-based
+// GPUs. The nodes are expected to be in submission order.
+func analyzeFramegraph(fg *api.Framegraph) {
+	for i, node := range fg.Nodes {
+		rp := node.GetRenderpass()
+		if rp == nil {
+			continue
+		}
+		for _, use := range renderpassAttachments(rp) {
+			att := use.att
+			finding := func(kind api.FramegraphFindingKind) {
+				node.Findings = append(node.Findings, &api.FramegraphFinding{
+					Kind:            kind,
+					ImageViewHandle: att.ImageViewHandle,
+					ImageHandle:     att.Image.Handle,
+				})
+			}
+
+			if att.LoadOp == api.LoadStoreOp_LOAD && att.FullyCleared {
+				finding(api.FramegraphFindingKind_UNNECESSARY_LOAD)
+			}
+
+			if use.depthStencil && att.StoreOp == api.LoadStoreOp_STORE && !att.Image.Swapchain {
+				readLater := false
+				for _, later := range fg.Nodes[i+1:] {
+					if readsImage(later, att.Image.Handle) {
+						readLater = true
+						break
+					}
+				}
+				if !readLater {
+					finding(api.FramegraphFindingKind_UNNECESSARY_STORE)
+				}
+			}
+
+			if !att.Image.TransientAttachment && !att.Image.Swapchain &&
+				att.LoadOp != api.LoadStoreOp_LOAD && att.StencilLoadOp != api.LoadStoreOp_LOAD &&
+				att.StoreOp == api.LoadStoreOp_DISCARD && att.StencilStoreOp == api.LoadStoreOp_DISCARD {
+				usedElsewhere := false
+				for j, other := range fg.Nodes {
+					if j != i && usesImage(other, att.Image.Handle) {
+						usedElsewhere = true
+						break
+					}
+				}
+				if !usedElsewhere {
+					finding(api.FramegraphFindingKind_NON_TRANSIENT_ATTACHMENT)
+				}
+			}
+		}
+
+		if i+1 < len(fg.Nodes) {
+			if next := fg.Nodes[i+1].GetRenderpass(); next != nil && mergeableRenderpasses(rp, next) {
+				node.Findings = append(node.Findings, &api.FramegraphFinding{
+					Kind:      api.FramegraphFindingKind_MERGEABLE_RENDERPASS,
+					OtherNode: fg.Nodes[i+1].Id,
+				})
+			}
+		}
+	}
+}
+
+// mergeableRenderpasses returns true if next has the same framebuffer size as
+// rp, and loads an attachment that rp stores: next could then be a subpass of
+// rp that reads the attachment from tile memory.
+func mergeableRenderpasses(rp, next *api.FramegraphRenderpass) bool {
+	if rp.FramebufferWidth != next.FramebufferWidth ||
+		rp.FramebufferHeight != next.FramebufferHeight ||
+		rp.FramebufferLayers != next.FramebufferLayers {
+		return false
+	}
+	stored := map[uint64]bool{}
+	for _, use := range renderpassAttachments(rp) {
+		if use.att.StoreOp == api.LoadStoreOp_STORE || use.att.StencilStoreOp == api.LoadStoreOp_STORE {
+			stored[use.att.Image.Handle] = true
+		}
+	}
+	for _, use := range renderpassAttachments(next) {
+		if stored[use.att.Image.Handle] &&
+			(use.att.LoadOp == api.LoadStoreOp_LOAD || use.att.StencilLoadOp == api.LoadStoreOp_LOAD) {
+			return true
+		}
+	}
+	return false
+}
+
+// framegraphFindingMessage returns the report message of the finding on the
+// framegraph node.
+func framegraphFindingMessage(node *api.FramegraphNode, f *api.FramegraphFinding) *stringtable.Msg {
+	switch f.Kind {
+	case api.FramegraphFindingKind_UNNECESSARY_LOAD:
+		return messages.WarnUnnecessaryLoad(node.Id, f.ImageViewHandle)
+	case api.FramegraphFindingKind_UNNECESSARY_STORE:
+		return messages.WarnUnnecessaryStore(node.Id, f.ImageViewHandle)
+	case api.FramegraphFindingKind_NON_TRANSIENT_ATTACHMENT:
+		return messages.WarnNonTransientAttachment(f.ImageViewHandle, node.Id, f.ImageHandle)
+	case api.FramegraphFindingKind_MERGEABLE_RENDERPASS:
+		return messages.WarnMergeableRenderpass(node.Id, f.OtherNode)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func testAttachment(view, image uint64, load, store api.LoadStoreOp) *api.FramegraphAttachment {
+	return &api.FramegraphAttachment{
+		LoadOp:          load,
+		StoreOp:         store,
+		ImageViewHandle: view,
+		Image:           &api.FramegraphImage{Handle: image},
+	}
+}
+
+func testRenderpassNode(id uint64, color, depth *api.FramegraphAttachment) *api.FramegraphNode {
+	return &api.FramegraphNode{
+		Id: id,
+		Workload: &api.FramegraphNode_Renderpass{Renderpass: &api.FramegraphRenderpass{
+			FramebufferWidth:  64,
+			FramebufferHeight: 64,
+			FramebufferLayers: 1,
+			Subpass: []*api.FramegraphSubpass{{
+				Color:        []*api.FramegraphAttachment{color},
+				DepthStencil: depth,
+			}},
+		}},
+	}
+}
+
+func findingKinds(node *api.FramegraphNode) []api.FramegraphFindingKind {
+	kinds := []api.FramegraphFindingKind{}
+	for _, f := range node.Findings {
+		kinds = append(kinds, f.Kind)
+	}
+	return kinds
+}
+
+func TestAnalyzeFramegraph(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Renderpass 0 loads a color attachment it fully clears, and stores a
+	// depth attachment nobody reads afterwards. Renderpass 1 loads the color
+	// attachment stored by renderpass 0, and uses a discarded depth attachment
+	// which is not transient.
+	clearedColor := testAttachment(10, 1, api.LoadStoreOp_LOAD, api.LoadStoreOp_STORE)
+	clearedColor.FullyCleared = true
+	fg := &api.Framegraph{Nodes: []*api.FramegraphNode{
+		testRenderpassNode(0, clearedColor,
+			testAttachment(11, 2, api.LoadStoreOp_CLEAR, api.LoadStoreOp_STORE)),
+		testRenderpassNode(1, testAttachment(12, 1, api.LoadStoreOp_LOAD, api.LoadStoreOp_STORE),
+			testAttachment(13, 3, api.LoadStoreOp_CLEAR, api.LoadStoreOp_DISCARD)),
+	}}
+	analyzeFramegraph(fg)
+
+	assert.For(ctx, "renderpass 0 findings").ThatSlice(findingKinds(fg.Nodes[0])).Equals([]api.FramegraphFindingKind{
+		api.FramegraphFindingKind_UNNECESSARY_LOAD,
+		api.FramegraphFindingKind_UNNECESSARY_STORE,
+		api.FramegraphFindingKind_MERGEABLE_RENDERPASS,
+	})
+	assert.For(ctx, "mergeable with").That(fg.Nodes[0].Findings[2].OtherNode).Equals(uint64(1))
+	assert.For(ctx, "renderpass 1 findings").ThatSlice(findingKinds(fg.Nodes[1])).Equals([]api.FramegraphFindingKind{
+		api.FramegraphFindingKind_NON_TRANSIENT_ATTACHMENT,
+	})
+	assert.For(ctx, "non transient image").That(fg.Nodes[1].Findings[0].ImageHandle).Equals(uint64(3))
+
+	// Once the depth attachment of renderpass 0 is sampled by a later
+	// renderpass, storing it is necessary.
+	fg.Nodes[1].GetRenderpass().ImageAccess = []*api.FramegraphImageAccess{
+		{Read: true, Image: &api.FramegraphImage{Handle: 2}},
+	}
+	for _, node := range fg.Nodes {
+		node.Findings = nil
+	}
+	analyzeFramegraph(fg)
+	assert.For(ctx, "renderpass 0 findings").ThatSlice(findingKinds(fg.Nodes[0])).Equals([]api.FramegraphFindingKind{
+		api.FramegraphFindingKind_UNNECESSARY_LOAD,
+		api.FramegraphFindingKind_MERGEABLE_RENDERPASS,
+	})
+}
@@ -290,3 +290,15 @@ func TestSet(t *testing.T) {
 		}
 	}
 }
+
+func TestInsertCommands(t *testing.T) {
+	ctx := log.Testing(t)
+	cb := test.CommandBuilder{}
+	a, b, c := cb.CmdTypeMix(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, false, test.Voidᵖ(0), 0),
+		cb.CmdTypeMix(1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, false, test.Voidᵖ(0), 0),
+		cb.CmdTypeMix(2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, false, test.Voidᵖ(0), 0)
+	x, y := cb.PrimeState(test.U8ᵖ(0)), cb.PrimeState(test.U8ᵖ(1))
+
+	got := insertCommands([]api.Cmd{a, b, c}, map[uint64][]api.Cmd{0: {x}, 1: {y, x}})
+	assert.For(ctx, "cmds").ThatSlice(got).Equals([]api.Cmd{a, x, b, y, x, c})
+}
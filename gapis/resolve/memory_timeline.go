@@ -0,0 +1,129 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// MemoryTimeline resolves the device memory timeline of the capture.
+func MemoryTimeline(ctx context.Context, p *path.MemoryTimeline, r *path.ResolveConfig) (*api.MemoryTimeline, error) {
+	obj, err := database.Build(ctx, &MemoryTimelineResolvable{Path: p, Config: r})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*api.MemoryTimeline), nil
+}
+
+type memoryTimelineHeapKey struct {
+	device uint64
+	index  uint32
+}
+
+// memoryTimelineBuilder fills the command, frame and heap totals of the
+// events of the memory timeline, and tracks the heap peaks.
+type memoryTimelineBuilder struct {
+	events []*api.MemoryEvent
+	totals map[memoryTimelineHeapKey]uint64
+	peaks  map[memoryTimelineHeapKey]*api.MemoryEvent
+}
+
+func (b *memoryTimelineBuilder) add(cmd api.CmdID, frame uint64, events []*api.MemoryEvent) {
+	for _, e := range events {
+		key := memoryTimelineHeapKey{e.Device, e.Heap}
+		switch e.Kind {
+		case api.MemoryEvent_ALLOCATE:
+			b.totals[key] += e.Size
+		case api.MemoryEvent_FREE:
+			if b.totals[key] >= e.Size {
+				b.totals[key] -= e.Size
+			} else {
+				b.totals[key] = 0
+			}
+		}
+		e.Command = uint64(cmd)
+		e.Frame = frame
+		e.HeapTotal = b.totals[key]
+		if peak, ok := b.peaks[key]; !ok || e.HeapTotal > peak.HeapTotal {
+			b.peaks[key] = e
+		}
+		b.events = append(b.events, e)
+	}
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *MemoryTimelineResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = SetupContext(ctx, r.Path.Capture, r.Config)
+
+	c, err := capture.ResolveGraphics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := c.NewState(ctx)
+	recorders := []api.MemoryTimelineRecorder{}
+	for _, a := range c.APIs {
+		if p, ok := a.(api.MemoryTimelineProvider); ok {
+			recorders = append(recorders, p.NewMemoryTimelineRecorder())
+		}
+	}
+	if len(recorders) == 0 {
+		return nil, fmt.Errorf("Memory timeline not supported for the APIs of the capture")
+	}
+
+	b := &memoryTimelineBuilder{
+		events: []*api.MemoryEvent{},
+		totals: map[memoryTimelineHeapKey]uint64{},
+		peaks:  map[memoryTimelineHeapKey]*api.MemoryEvent{},
+	}
+	for _, rec := range recorders {
+		b.add(api.CmdNoID, 0, rec.Initial(ctx, state))
+	}
+
+	frame := uint64(0)
+	err = api.ForeachCmd(ctx, c.Commands, true, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, state, nil, nil); err != nil {
+			return fmt.Errorf("Fail to mutate command %v: %v", cmd, err)
+		}
+		for _, rec := range recorders {
+			b.add(id, frame, rec.PostCmd(ctx, id, cmd, state))
+		}
+		if cmd.CmdFlags().IsEndOfFrame() {
+			frame++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	heaps := []*api.MemoryHeap{}
+	for _, rec := range recorders {
+		for _, heap := range rec.Heaps() {
+			if peak, ok := b.peaks[memoryTimelineHeapKey{heap.Device, heap.Index}]; ok {
+				heap.Peak = peak.HeapTotal
+				heap.PeakCommand = peak.Command
+			}
+			heaps = append(heaps, heap)
+		}
+	}
+	return &api.MemoryTimeline{Heaps: heaps, Events: b.events}, nil
+}
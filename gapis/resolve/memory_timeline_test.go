@@ -0,0 +1,54 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func TestMemoryTimelineTotals(t *testing.T) {
+	ctx := log.Testing(t)
+	b := &memoryTimelineBuilder{
+		events: []*api.MemoryEvent{},
+		totals: map[memoryTimelineHeapKey]uint64{},
+		peaks:  map[memoryTimelineHeapKey]*api.MemoryEvent{},
+	}
+	b.add(api.CmdNoID, 0, []*api.MemoryEvent{
+		{Kind: api.MemoryEvent_ALLOCATE, Heap: 0, Allocation: 1, Size: 100},
+	})
+	b.add(3, 0, []*api.MemoryEvent{
+		{Kind: api.MemoryEvent_ALLOCATE, Heap: 0, Allocation: 2, Size: 50},
+		{Kind: api.MemoryEvent_ALLOCATE, Heap: 1, Allocation: 3, Size: 10},
+	})
+	b.add(4, 0, []*api.MemoryEvent{
+		{Kind: api.MemoryEvent_BIND, Heap: 0, Allocation: 2, Size: 20, Resource: 7},
+	})
+	b.add(8, 1, []*api.MemoryEvent{
+		{Kind: api.MemoryEvent_FREE, Heap: 0, Allocation: 1, Size: 100},
+	})
+
+	totals := []uint64{}
+	for _, e := range b.events {
+		totals = append(totals, e.HeapTotal)
+	}
+	assert.For(ctx, "heap totals").ThatSlice(totals).Equals([]uint64{100, 150, 10, 150, 50})
+	assert.For(ctx, "frame").That(b.events[4].Frame).Equals(uint64(1))
+	assert.For(ctx, "heap 0 peak").That(b.peaks[memoryTimelineHeapKey{0, 0}].Command).Equals(uint64(3))
+	assert.For(ctx, "heap 1 peak").That(b.peaks[memoryTimelineHeapKey{0, 1}].HeapTotal).Equals(uint64(10))
+}
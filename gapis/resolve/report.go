@@ -114,6 +114,29 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 		builder.Add(ctx, item)
 	}
 
+	lintPasses := []api.LintPass{}
+	if r.Path.Lint {
+		for _, a := range c.APIs {
+			if l, ok := a.(api.Linter); ok {
+				pass, err := l.NewLintPass(ctx, r.Path.LintRules)
+				if err != nil {
+					return nil, err
+				}
+				lintPasses = append(lintPasses, pass)
+			}
+		}
+	}
+	addLintIssues := func(lintIssues []api.LintIssue) {
+		for _, issue := range lintIssues {
+			item := r.newReportItem(issue.Severity, uint64(issue.Command), issue.Message)
+			item.Tags = append(item.Tags, messages.TagLintRule(issue.Rule))
+			if issue.Command != api.CmdNoID && uint64(issue.Command) < uint64(len(c.Commands)) {
+				item.Tags = append(item.Tags, getCommandNameTag(c.Commands[issue.Command]))
+			}
+			builder.Add(ctx, item)
+		}
+	}
+
 	// Gather report items from the state mutator, and collect together all the
 	// APIs in use.
 	api.ForeachCmd(ctx, c.Commands, true, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
@@ -143,8 +166,35 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 			}
 			builder.Add(ctx, item)
 		}
+		for _, pass := range lintPasses {
+			addLintIssues(pass.PostCmd(ctx, id, cmd, state))
+		}
 		return nil
 	})
+	for _, pass := range lintPasses {
+		addLintIssues(pass.Flush(ctx, state))
+	}
+
+	if r.Path.FramegraphAnalysis {
+		fg, err := Framegraph(ctx, r.Path.Capture.Framegraph(), r.Config)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range fg.(*api.Framegraph).Nodes {
+			rp := node.GetRenderpass()
+			for _, f := range node.Findings {
+				cmdIdx := uint64(api.CmdNoID)
+				if rp != nil && len(rp.BeginSubCmdIdx) > 0 {
+					cmdIdx = rp.BeginSubCmdIdx[0]
+				}
+				item := r.newReportItem(log.Warning, cmdIdx, framegraphFindingMessage(node, f))
+				if cmdIdx < uint64(len(c.Commands)) {
+					item.Tags = append(item.Tags, getCommandNameTag(c.Commands[cmdIdx]))
+				}
+				builder.Add(ctx, item)
+			}
+		}
+	}
 
 	return builder.Build(), nil
 }
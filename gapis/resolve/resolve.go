@@ -337,6 +337,8 @@ func ResolveInternal(ctx context.Context, p path.Node, r *path.ResolveConfig) (i
 		return Memory(ctx, p, r)
 	case *path.MemoryAsType:
 		return MemoryAsType(ctx, p, r)
+	case *path.MemoryTimeline:
+		return MemoryTimeline(ctx, p, r)
 	case *path.Metrics:
 		return Metrics(ctx, p, r)
 	case *path.Mesh:
@@ -316,8 +316,16 @@ func changeResources(ctx context.Context, after *path.Command, ids []*path.ID, d
 	cmds := make([]api.Cmd, len(oldCmds))
 	copy(cmds, oldCmds)
 
+	// Inserted commands are kept aside so that the indices passed to the
+	// callback stay valid for all the resources.
+	inserted := map[uint64][]api.Cmd{}
 	replaceCommands := func(where uint64, with interface{}) {
-		cmds[where] = with.(api.Cmd)
+		switch with := with.(type) {
+		case []api.Cmd:
+			inserted[where] = append(inserted[where], with...)
+		default:
+			cmds[where] = with.(api.Cmd)
+		}
 	}
 
 	oldCapt, err := capture.ResolveGraphicsFromPath(ctx, after.Capture)
@@ -351,6 +359,8 @@ func changeResources(ctx context.Context, after *path.Command, ids []*path.ID, d
 		initialState = oldCapt.InitialState
 	}
 
+	cmds = insertCommands(cmds, inserted)
+
 	gc, err := capture.NewGraphicsCapture(ctx, oldCapt.Name()+"*", oldCapt.Header, initialState, cmds)
 	if err != nil {
 		return nil, err
@@ -359,6 +369,20 @@ func changeResources(ctx context.Context, after *path.Command, ids []*path.ID, d
 	}
 }
 
+// insertCommands returns the commands with the inserted commands placed after
+// the command at their index.
+func insertCommands(cmds []api.Cmd, inserted map[uint64][]api.Cmd) []api.Cmd {
+	if len(inserted) == 0 {
+		return cmds
+	}
+	out := make([]api.Cmd, 0, len(cmds))
+	for i, cmd := range cmds {
+		out = append(out, cmd)
+		out = append(out, inserted[uint64(i)]...)
+	}
+	return out
+}
+
 func changeCommands(ctx context.Context, p *path.Capture, newCmds []api.Cmd) (*path.Capture, error) {
 	old, err := capture.ResolveGraphicsFromPath(ctx, p)
 	if err != nil {
@@ -368,6 +368,62 @@ func stateValuePreview(v reflect.Value) (*box.Value, bool) {
 	}
 }
 
+// stateValueStrings returns the printed forms of the node's value that are
+// matched against when searching the state tree. Only values that can be
+// displayed as a preview are printed. Unsigned integers are also printed in
+// hexadecimal, as this is how handles are usually displayed, and values with
+// a constant set are also printed as their constant names.
+func stateValueStrings(ctx context.Context, n *stn) []string {
+	v := n.value
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	if t := v.Type(); box.IsMemoryPointer(t) || box.IsMemorySlice(t) {
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return []string{s.String()}
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.Float32, reflect.Float64, reflect.String:
+		return []string{fmt.Sprint(v.Interface())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		out := []string{fmt.Sprint(v.Interface())}
+		return append(out, constantNames(ctx, n.consts, uint64(v.Int()))...)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		out := []string{fmt.Sprint(v.Interface()), fmt.Sprintf("0x%x", v.Uint())}
+		return append(out, constantNames(ctx, n.consts, v.Uint())...)
+	default:
+		return nil
+	}
+}
+
+// constantNames returns the names of the constants in the set p that
+// represent the value v.
+func constantNames(ctx context.Context, p *path.ConstantSet, v uint64) []string {
+	if p == nil {
+		return nil
+	}
+	set, err := ConstantSet(ctx, p, nil)
+	if err != nil {
+		return nil
+	}
+	out := []string{}
+	for _, c := range set.Constants {
+		switch {
+		case !set.IsBitfield && c.Value == v,
+			set.IsBitfield && c.Value != 0 && v&c.Value == c.Value:
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
 // Resolve builds and returns a *StateTree for the path.StateTreeNode.
 // Resolve implements the database.Resolver interface.
 func (r *StateTreeResolvable) Resolve(ctx context.Context) (interface{}, error) {
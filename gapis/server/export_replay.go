@@ -26,10 +26,13 @@ import (
 	"github.com/google/gapid/core/archive"
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapir"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/interpreter"
 	"github.com/google/gapid/gapis/resolve"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
@@ -178,5 +181,42 @@ func exportReplay(ctx context.Context, c *path.Capture, d *path.Device, out stri
 		ar.Write(ri.Id, obj.([]byte))
 	}
 
+	if opts.Verify {
+		return verifyReplay(ctx, cap, payload, exporter.MemoryLayout())
+	}
+	return nil
+}
+
+// verifyReplay runs the payload in the replay interpreter, failing if the
+// payload is invalid.
+func verifyReplay(ctx context.Context, c *capture.GraphicsCapture, payload *gapir.Payload, layout *device.MemoryLayout) error {
+	functions := []interpreter.Function{}
+	for _, a := range c.APIs {
+		if p, ok := a.(interpreter.FunctionProvider); ok {
+			functions = append(functions, p.ReplayFunctions()...)
+		}
+	}
+	resources := func(ctx context.Context, resID string, size uint32) ([]byte, error) {
+		rID, err := id.Parse(resID)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := database.Resolve(ctx, rID)
+		if err != nil {
+			return nil, err
+		}
+		return obj.([]byte), nil
+	}
+
+	res, err := interpreter.Verify(ctx, payload, interpreter.Config{
+		MemoryLayout: layout,
+		Functions:    functions,
+		Resources:    resources,
+	})
+	if err != nil {
+		return log.Errf(ctx, err, "Replay payload verification failed")
+	}
+	log.I(ctx, "Replay payload verified: %d instructions, %d calls, %d resources, %d postbacks, %d notifications",
+		res.Instructions, len(res.Calls), res.Resources, len(res.Posts), len(res.Notifications))
 	return nil
 }
@@ -505,15 +505,33 @@ func (s *grpcServer) DCECapture(ctx xctx.Context, req *service.DCECaptureRequest
 	return &service.DCECaptureResponse{Res: &service.DCECaptureResponse_Capture{Capture: capture}}, nil
 }
 
+func (s *grpcServer) ExplainLiveness(ctx xctx.Context, req *service.ExplainLivenessRequest) (*service.ExplainLivenessResponse, error) {
+	defer s.inRPC()()
+	chain, err := s.handler.ExplainLiveness(s.bindCtx(ctx), req.Requested, req.Kept)
+	if err := service.NewError(err); err != nil {
+		return &service.ExplainLivenessResponse{Res: &service.ExplainLivenessResponse_Error{Error: err}}, nil
+	}
+	return &service.ExplainLivenessResponse{Res: &service.ExplainLivenessResponse_Chain{Chain: chain}}, nil
+}
+
 func (s *grpcServer) GetGraphVisualization(ctx xctx.Context, req *service.GraphVisualizationRequest) (*service.GraphVisualizationResponse, error) {
 	defer s.inRPC()()
-	graphVisualization, err := s.handler.GetGraphVisualization(s.bindCtx(ctx), req.Capture, req.Format)
+	graphVisualization, err := s.handler.GetGraphVisualization(s.bindCtx(ctx), req.Capture, req.Format, req.Options)
 	if err := service.NewError(err); err != nil {
 		return &service.GraphVisualizationResponse{Res: &service.GraphVisualizationResponse_Error{Error: err}}, nil
 	}
 	return &service.GraphVisualizationResponse{Res: &service.GraphVisualizationResponse_GraphVisualization{GraphVisualization: graphVisualization}}, nil
 }
 
+func (s *grpcServer) DiffCaptures(ctx xctx.Context, req *service.DiffCapturesRequest) (*service.DiffCapturesResponse, error) {
+	defer s.inRPC()()
+	diff, err := s.handler.DiffCaptures(s.bindCtx(ctx), req.Reference, req.Value, req.Options)
+	if err := service.NewError(err); err != nil {
+		return &service.DiffCapturesResponse{Res: &service.DiffCapturesResponse_Error{Error: err}}, nil
+	}
+	return &service.DiffCapturesResponse{Res: &service.DiffCapturesResponse_Diff{Diff: diff}}, nil
+}
+
 func (s *grpcServer) GetDevices(ctx xctx.Context, req *service.GetDevicesRequest) (*service.GetDevicesResponse, error) {
 	defer s.inRPC()()
 	devices, err := s.handler.GetDevices(s.bindCtx(ctx))
@@ -44,11 +44,13 @@ import (
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/messages"
 	perfetto "github.com/google/gapid/gapis/perfetto/service"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/replay/devices"
 	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/resolve/capturediff"
 	"github.com/google/gapid/gapis/resolve/dependencygraph2"
 	"github.com/google/gapid/gapis/resolve/dependencygraph2/graph_visualization"
 	"github.com/google/gapid/gapis/service"
@@ -74,6 +76,9 @@ type Config struct {
 	DeviceScanDone   task.Signal
 	LogBroadcaster   *log.Broadcaster
 	IdleTimeout      time.Duration
+	// CapturePackVersion is the pack format version of the captures saved
+	// and exported by the server. 0 writes the latest version.
+	CapturePackVersion int
 }
 
 // Server is the server interface to GAPIS.
@@ -90,6 +95,7 @@ func New(ctx context.Context, cfg Config) Server {
 		cfg.PreloadDepGraph,
 		cfg.DeviceScanDone,
 		cfg.LogBroadcaster,
+		capture.ExportOptions{PackVersion: cfg.CapturePackVersion},
 	}
 }
 
@@ -100,6 +106,7 @@ type server struct {
 	preloadDepGraph  bool
 	deviceScanDone   task.Signal
 	logBroadcaster   *log.Broadcaster
+	exportOptions    capture.ExportOptions
 }
 
 func (s *server) Ping(ctx context.Context) error {
@@ -164,7 +171,7 @@ func (s *server) ExportCapture(ctx context.Context, c *path.Capture) ([]byte, er
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "ExportCapture")
 	b := bytes.Buffer{}
-	if err := capture.Export(ctx, c, &b); err != nil {
+	if err := capture.Export(ctx, c, &b, s.exportOptions); err != nil {
 		return nil, err
 	}
 	return b.Bytes(), nil
@@ -249,7 +256,7 @@ func (s *server) SaveCapture(ctx context.Context, c *path.Capture, path string)
 		return err
 	}
 	defer f.Close()
-	return capture.Export(ctx, c, f)
+	return capture.Export(ctx, c, f, s.exportOptions)
 }
 func (s *server) ExportReplay(ctx context.Context, c *path.Capture, d *path.Device, out string, opts *service.ExportReplayOptions) error {
 	ctx = status.Start(ctx, "RPC ExportReplay")
@@ -274,6 +281,29 @@ func (s *server) DCECapture(ctx context.Context, p *path.Capture, requested []*p
 	return trimmed, nil
 }
 
+func (s *server) ExplainLiveness(ctx context.Context, requested, kept *path.Command) (*service.LivenessChain, error) {
+	ctx = status.Start(ctx, "RPC ExplainLiveness")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "ExplainLiveness")
+	steps, err := dependencygraph2.ExplainLiveness(ctx, requested.Capture, requested.Indices, kept.Indices)
+	if err != nil {
+		return nil, err
+	}
+	chain := &service.LivenessChain{Steps: make([]*service.LivenessStep, len(steps))}
+	for i, step := range steps {
+		out := &service.LivenessStep{Accesses: step.Accesses}
+		switch node := step.Node.(type) {
+		case dependencygraph2.CmdNode:
+			out.Command = requested.Capture.Command(node.Index[0], node.Index[1:]...)
+		case dependencygraph2.ObsNode:
+			out.Command = requested.Capture.Command(uint64(node.CmdID))
+			out.Observation = true
+		}
+		chain.Steps[i] = out
+	}
+	return chain, nil
+}
+
 func (s *server) SplitCapture(ctx context.Context, rng *path.Commands) (*path.Capture, error) {
 	ctx = log.Enter(ctx, "SplitCapture")
 	c, err := capture.ResolveGraphicsFromPath(ctx, rng.Capture)
@@ -303,12 +333,12 @@ func (s *server) SplitCapture(ctx context.Context, rng *path.Commands) (*path.Ca
 	}
 }
 
-func (s *server) GetGraphVisualization(ctx context.Context, p *path.Capture, format service.GraphFormat) ([]byte, error) {
+func (s *server) GetGraphVisualization(ctx context.Context, p *path.Capture, format service.GraphFormat, opts *service.GraphVisualizationOptions) ([]byte, error) {
 	ctx = status.Start(ctx, "RPC GetGraphVisualization")
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "GetGraphVisualization")
 
-	graphVisualization, err := graph_visualization.GetGraphVisualizationFromCapture(ctx, p, format)
+	graphVisualization, err := graph_visualization.GetGraphVisualizationFromCapture(ctx, p, format, opts)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -318,6 +348,13 @@ func (s *server) GetGraphVisualization(ctx context.Context, p *path.Capture, for
 	return graphVisualization, nil
 }
 
+func (s *server) DiffCaptures(ctx context.Context, reference, value *path.Capture, opts *service.DiffCapturesOptions) (*service.CaptureDiff, error) {
+	ctx = status.Start(ctx, "RPC DiffCaptures")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "DiffCaptures")
+	return capturediff.Captures(ctx, reference, value, opts)
+}
+
 func (s *server) GetDevices(ctx context.Context) ([]*path.Device, error) {
 	ctx = status.Start(ctx, "RPC GetDevices")
 	defer status.Finish(ctx)
@@ -582,8 +619,22 @@ func (l *statusListener) OnMemorySnapshot(ctx context.Context, stats runtime.Mem
 	l.progressMutex.Lock()
 	defer l.progressMutex.Unlock()
 
+	records := database.Stats(ctx)
+	dbStats := make([]*service.DatabaseRecordStats, len(records))
+	for i, r := range records {
+		dbStats[i] = &service.DatabaseRecordStats{
+			Type:        r.Type,
+			Count:       r.Count,
+			Resolved:    r.Resolved,
+			Evicted:     r.Evicted,
+			DataBytes:   r.DataBytes,
+			ObjectBytes: r.ObjectBytes,
+		}
+	}
+
 	l.m(&service.MemoryStatus{
 		TotalHeap: stats.Alloc,
+		Database:  dbStats,
 	})
 }
 
@@ -81,6 +81,7 @@ func (n *ImageInfo) Path() *Any                 { return &Any{Path: &Any_ImageIn
 func (n *MapIndex) Path() *Any                  { return &Any{Path: &Any_MapIndex{n}} }
 func (n *Memory) Path() *Any                    { return &Any{Path: &Any_Memory{n}} }
 func (n *MemoryAsType) Path() *Any              { return &Any{Path: &Any_MemoryAsType{n}} }
+func (n *MemoryTimeline) Path() *Any            { return &Any{Path: &Any_MemoryTimeline{n}} }
 func (n *Mesh) Path() *Any                      { return &Any{Path: &Any_Mesh{n}} }
 func (n *Metrics) Path() *Any                   { return &Any{Path: &Any_Metrics{n}} }
 func (n *Parameter) Path() *Any                 { return &Any{Path: &Any_Parameter{n}} }
@@ -124,6 +125,7 @@ func (n ImageInfo) Parent() Node                 { return nil }
 func (n MapIndex) Parent() Node                  { return oneOfNode(n.Map) }
 func (n Memory) Parent() Node                    { return n.After }
 func (n MemoryAsType) Parent() Node              { return n.After }
+func (n MemoryTimeline) Parent() Node            { return n.Capture }
 func (n Mesh) Parent() Node                      { return oneOfNode(n.Object) }
 func (n Metrics) Parent() Node                   { return n.Command }
 func (n Messages) Parent() Node                  { return n.Capture }
@@ -163,6 +165,7 @@ func (n *GlobalState) SetParent(p Node)               { n.After, _ = p.(*Command
 func (n *ImageInfo) SetParent(p Node)                 {}
 func (n *Memory) SetParent(p Node)                    { n.After, _ = p.(*Command) }
 func (n *MemoryAsType) SetParent(p Node)              { n.After, _ = p.(*Command) }
+func (n *MemoryTimeline) SetParent(p Node)            { n.Capture, _ = p.(*Capture) }
 func (n *Metrics) SetParent(p Node)                   { n.Command, _ = p.(*Command) }
 func (n *Messages) SetParent(p Node)                  { n.Capture, _ = p.(*Capture) }
 func (n *Parameter) SetParent(p Node)                 { n.Command, _ = p.(*Command) }
@@ -264,6 +267,9 @@ func (n MemoryAsType) Format(f fmt.State, c rune) {
 	fmt.Fprintf(f, "%v.memory-as-type-after", n.Parent())
 }
 
+// Format implements fmt.Formatter to print the path.
+func (n MemoryTimeline) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.memory-timeline", n.Parent()) }
+
 // Format implements fmt.Formatter to print the message path.
 func (n Messages) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.messages", n.Parent()) }
 
@@ -724,6 +730,11 @@ func (n *Capture) Framegraph() *Framegraph {
 	return &Framegraph{Capture: n}
 }
 
+// MemoryTimeline returns the path node to the capture memory timeline.
+func (n *Capture) MemoryTimeline() *MemoryTimeline {
+	return &MemoryTimeline{Capture: n}
+}
+
 // Mesh returns the path node to the mesh of this command.
 func (n *Command) Mesh(options *MeshOptions) *Mesh {
 	return &Mesh{
@@ -202,6 +202,11 @@ func (n *Framegraph) Validate() error {
 	return checkNotNilAndValidate(n, n.Capture, "capture")
 }
 
+// Validate checks the path is valid.
+func (n *MemoryTimeline) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
 // Validate checks the path is valid.
 func (n *GlobalState) Validate() error {
 	return checkNotNilAndValidate(n, n.After, "after")
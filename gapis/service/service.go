@@ -88,7 +88,16 @@ type Service interface {
 	// DCECapture returns a new capture containing only the requested commands and their dependencies.
 	DCECapture(ctx context.Context, capture *path.Capture, commands []*path.Command) (*path.Capture, error)
 
-	GetGraphVisualization(ctx context.Context, capture *path.Capture, format GraphFormat) ([]byte, error)
+	// ExplainLiveness returns the shortest chain of dependencies through which
+	// the requested command keeps the kept command alive in DCECapture.
+	ExplainLiveness(ctx context.Context, requested, kept *path.Command) (*LivenessChain, error)
+
+	// GetGraphVisualization returns the dependency graph of the capture in the
+	// given format, restricted by opts.
+	GetGraphVisualization(ctx context.Context, capture *path.Capture, format GraphFormat, opts *GraphVisualizationOptions) ([]byte, error)
+
+	// DiffCaptures compares the value capture against the reference capture.
+	DiffCaptures(ctx context.Context, reference, value *path.Capture, opts *DiffCapturesOptions) (*CaptureDiff, error)
 
 	// GetDevices returns the full list of replay devices available to the server.
 	// These include local replay devices and any connected Android devices.
@@ -300,6 +309,8 @@ func NewValue(v interface{}) *Value {
 		return &Value{Val: &Value_FramebufferAttachment{v}}
 	case *api.Framegraph:
 		return &Value{Val: &Value_Framegraph{v}}
+	case *api.MemoryTimeline:
+		return &Value{Val: &Value_MemoryTimeline{v}}
 	case *DeviceTraceConfiguration:
 		return &Value{Val: &Value_TraceConfig{v}}
 	case *types.Type:
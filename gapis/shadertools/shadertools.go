@@ -319,56 +319,201 @@ func ParseAllDescriptorSets(shader []uint32) (map[string]DescriptorSets, error)
 		// arithmetic as documented in https://golang.org/pkg/unsafe/#Pointer
 		entryPointStruct := (*C.SpvReflectEntryPoint)(unsafe.Pointer(uintptr(unsafe.Pointer(entryPoints)) + uintptr(i)*unsafe.Sizeof(*(entryPoints))))
 
-		setCount := C.uint32_t(0)
-		if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
-			&module,
-			entryPointStruct.name,
-			&setCount,
-			nil)); err != nil {
+		res, err := entryPointDescriptorSets(&module, entryPointStruct)
+		if err != nil {
 			return nil, err
 		}
-		sets := make([]*C.SpvReflectDescriptorSet, setCount)
-		setsPtr := unsafe.Pointer(nil)
-		if setCount > 0 {
-			setsPtr = unsafe.Pointer(&sets[0])
+		out[C.GoString(entryPointStruct.name)] = res
+	}
+
+	return out, nil
+}
+
+// entryPointDescriptorSets returns the descriptor sets used by the entry point
+// of the module.
+func entryPointDescriptorSets(module *C.SpvReflectShaderModule, entryPoint *C.SpvReflectEntryPoint) (DescriptorSets, error) {
+	spvReflectErr := func(res C.SpvReflectResult) error {
+		if res == C.SPV_REFLECT_RESULT_SUCCESS {
+			return nil
 		}
-		if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
-			&module,
-			entryPointStruct.name,
-			&setCount,
-			(**C.SpvReflectDescriptorSet)(setsPtr),
-		)); err != nil {
-			return nil, err
+		return fmt.Errorf("SPIRV-Reflect failed with error code %v\n", res)
+	}
+
+	setCount := C.uint32_t(0)
+	if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
+		module,
+		entryPoint.name,
+		&setCount,
+		nil)); err != nil {
+		return nil, err
+	}
+	sets := make([]*C.SpvReflectDescriptorSet, setCount)
+	setsPtr := unsafe.Pointer(nil)
+	if setCount > 0 {
+		setsPtr = unsafe.Pointer(&sets[0])
+	}
+	if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
+		module,
+		entryPoint.name,
+		&setCount,
+		(**C.SpvReflectDescriptorSet)(setsPtr),
+	)); err != nil {
+		return nil, err
+	}
+
+	res := DescriptorSets{}
+	for _, set := range sets {
+		bindings := make(DescriptorSet, set.binding_count)
+		for i := C.uint32_t(0); i < set.binding_count; i++ {
+			bindingPtr := uintptr(unsafe.Pointer(set.bindings)) +
+				uintptr(i)*unsafe.Sizeof(*set.bindings)
+			binding := *(**C.SpvReflectDescriptorBinding)(unsafe.Pointer(bindingPtr))
+			// If it's an array, need to get total descriptor count
+			descriptorCount := C.uint32_t(1)
+			for j := C.uint32_t(0); j < binding.array.dims_count; j++ {
+				descriptorCount *= binding.array.dims[j]
+			}
+			bindings[i] = DescriptorBinding{
+				Set:             uint32(binding.set),
+				Binding:         uint32(binding.binding),
+				SpirvId:         uint32(binding.spirv_id),
+				DescriptorType:  uint32(binding.descriptor_type),
+				DescriptorCount: uint32(descriptorCount),
+				ShaderStage:     uint32(entryPoint.shader_stage),
+			}
 		}
+		sort.Slice(bindings, func(i, j int) bool {
+			return descriptorBindingLess(bindings[i], bindings[j])
+		})
+		res[uint32(set.set)] = bindings
+	}
+	return res, nil
+}
+
+// ShaderReflection is the reflection of an entry point of a shader.
+type ShaderReflection struct {
+	EntryPoint string
+	// ShaderStage is the VkShaderStageFlagBits of the entry point.
+	ShaderStage             uint32
+	Inputs                  []InterfaceVariable
+	Outputs                 []InterfaceVariable
+	DescriptorSets          DescriptorSets
+	PushConstants           []PushConstantBlock
+	SpecializationConstants []SpecializationConstant
+}
 
-		res := DescriptorSets{}
-		for _, set := range sets {
-			bindings := make(DescriptorSet, set.binding_count)
-			for i := C.uint32_t(0); i < set.binding_count; i++ {
-				bindingPtr := uintptr(unsafe.Pointer(set.bindings)) +
-					uintptr(i)*unsafe.Sizeof(*set.bindings)
-				binding := *(**C.SpvReflectDescriptorBinding)(unsafe.Pointer(bindingPtr))
-				// If it's an array, need to get total descriptor count
-				descriptorCount := C.uint32_t(1)
-				for j := C.uint32_t(0); j < binding.array.dims_count; j++ {
-					descriptorCount *= binding.array.dims[j]
-				}
-				bindings[i] = DescriptorBinding{
-					Set:             uint32(binding.set),
-					Binding:         uint32(binding.binding),
-					SpirvId:         uint32(binding.spirv_id),
-					DescriptorType:  uint32(binding.descriptor_type),
-					DescriptorCount: uint32(descriptorCount),
-					ShaderStage:     uint32(entryPointStruct.shader_stage),
-				}
+// InterfaceVariable is an input or output variable of an entry point.
+type InterfaceVariable struct {
+	Name     string
+	Location uint32
+	// Format is the VkFormat of the variable.
+	Format  uint32
+	BuiltIn bool
+}
+
+// PushConstantBlock is a push constant block used by an entry point.
+type PushConstantBlock struct {
+	Name   string
+	Offset uint32
+	Size   uint32
+}
+
+// Reflect returns the reflection of the given entry point of the shader.
+func Reflect(shader []uint32, entryPoint string) (ShaderReflection, error) {
+	res := ShaderReflection{EntryPoint: entryPoint}
+	spvReflectErr := func(res C.SpvReflectResult) error {
+		if res == C.SPV_REFLECT_RESULT_SUCCESS {
+			return nil
+		}
+		return fmt.Errorf("SPIRV-Reflect failed with error code %v\n", res)
+	}
+
+	if len(shader) == 0 {
+		return res, errors.New("Empty Shader")
+	}
+
+	module := C.SpvReflectShaderModule{}
+	if err := spvReflectErr(C.spvReflectCreateShaderModule(
+		C.size_t(len(shader)*4),
+		unsafe.Pointer(&shader[0]),
+		&module)); err != nil {
+		return res, err
+	}
+	defer C.spvReflectDestroyShaderModule(&module)
+
+	name := C.CString(entryPoint)
+	defer C.free(unsafe.Pointer(name))
+	entryPointStruct := C.spvReflectGetEntryPoint(&module, name)
+	if entryPointStruct == nil {
+		return res, fmt.Errorf("Entry point '%v' not found", entryPoint)
+	}
+	res.ShaderStage = uint32(entryPointStruct.shader_stage)
+
+	interfaceVariables := func(enumerate func(*C.uint32_t, **C.SpvReflectInterfaceVariable) C.SpvReflectResult) ([]InterfaceVariable, error) {
+		count := C.uint32_t(0)
+		if err := spvReflectErr(enumerate(&count, nil)); err != nil {
+			return nil, err
+		}
+		vars := make([]*C.SpvReflectInterfaceVariable, count)
+		if count > 0 {
+			if err := spvReflectErr(enumerate(&count, &vars[0])); err != nil {
+				return nil, err
 			}
-			sort.Slice(bindings, func(i, j int) bool {
-				return descriptorBindingLess(bindings[i], bindings[j])
-			})
-			res[uint32(set.set)] = bindings
 		}
-		out[C.GoString(entryPointStruct.name)] = res
+		out := make([]InterfaceVariable, len(vars))
+		for i, v := range vars {
+			out[i] = InterfaceVariable{
+				Name:     C.GoString(v.name),
+				Location: uint32(v.location),
+				Format:   uint32(v.format),
+				BuiltIn:  v.decoration_flags&C.SPV_REFLECT_DECORATION_BUILT_IN != 0,
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			if out[i].BuiltIn != out[j].BuiltIn {
+				return !out[i].BuiltIn
+			}
+			return out[i].Location < out[j].Location
+		})
+		return out, nil
 	}
 
-	return out, nil
+	var err error
+	if res.Inputs, err = interfaceVariables(func(count *C.uint32_t, vars **C.SpvReflectInterfaceVariable) C.SpvReflectResult {
+		return C.spvReflectEnumerateEntryPointInputVariables(&module, name, count, vars)
+	}); err != nil {
+		return res, err
+	}
+	if res.Outputs, err = interfaceVariables(func(count *C.uint32_t, vars **C.SpvReflectInterfaceVariable) C.SpvReflectResult {
+		return C.spvReflectEnumerateEntryPointOutputVariables(&module, name, count, vars)
+	}); err != nil {
+		return res, err
+	}
+
+	if res.DescriptorSets, err = entryPointDescriptorSets(&module, entryPointStruct); err != nil {
+		return res, err
+	}
+
+	blockCount := C.uint32_t(0)
+	if err := spvReflectErr(C.spvReflectEnumerateEntryPointPushConstantBlocks(&module, name, &blockCount, nil)); err != nil {
+		return res, err
+	}
+	blocks := make([]*C.SpvReflectBlockVariable, blockCount)
+	if blockCount > 0 {
+		if err := spvReflectErr(C.spvReflectEnumerateEntryPointPushConstantBlocks(&module, name, &blockCount, &blocks[0])); err != nil {
+			return res, err
+		}
+	}
+	for _, block := range blocks {
+		res.PushConstants = append(res.PushConstants, PushConstantBlock{
+			Name:   C.GoString(block.name),
+			Offset: uint32(block.offset),
+			Size:   uint32(block.size),
+		})
+	}
+
+	if res.SpecializationConstants, err = ParseSpecializationConstants(shader); err != nil {
+		return res, err
+	}
+	return res, nil
 }
@@ -603,3 +603,79 @@ var (
                OpReturn
                OpFunctionEnd`
 )
+
+func TestReflect(t *testing.T) {
+	ctx := log.Testing(t)
+	src := `#version 450
+layout(constant_id = 3) const int count = 4;
+layout(constant_id = 5) const bool enabled = true;
+layout(location = 0) in vec3 position;
+layout(location = 1) in vec2 uv;
+layout(location = 0) out vec2 outUV;
+layout(set = 0, binding = 1) uniform UBO { mat4 mvp; } ubo;
+layout(push_constant) uniform PC { vec4 tint; } pc;
+void main() {
+	outUV = enabled ? uv * float(count) : uv;
+	gl_Position = ubo.mvp * vec4(position, 1.0) + pc.tint;
+}`
+	shader, err := shadertools.CompileGlsl(src, shadertools.CompileOptions{
+		ShaderType: shadertools.TypeVertex,
+		ClientType: shadertools.Vulkan,
+	})
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+
+	_, err = shadertools.Reflect(shader, "other")
+	assert.For(ctx, "unknown entry point").ThatError(err).Failed()
+
+	r, err := shadertools.Reflect(shader, "main")
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "stage").That(r.ShaderStage).Equals(uint32(0x1)) // VK_SHADER_STAGE_VERTEX_BIT
+	assert.For(ctx, "inputs").ThatSlice(r.Inputs).Equals([]shadertools.InterfaceVariable{
+		{Name: "position", Location: 0, Format: 106}, // VK_FORMAT_R32G32B32_SFLOAT
+		{Name: "uv", Location: 1, Format: 103},       // VK_FORMAT_R32G32_SFLOAT
+	})
+	assert.For(ctx, "output").That(r.Outputs[0]).Equals(shadertools.InterfaceVariable{Name: "outUV", Location: 0, Format: 103})
+	assert.For(ctx, "descriptor sets").That(r.DescriptorSets[0][0].Binding).Equals(uint32(1))
+	assert.For(ctx, "descriptor type").That(r.DescriptorSets[0][0].DescriptorType).Equals(uint32(6)) // VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER
+	if assert.For(ctx, "push constants").ThatSlice(r.PushConstants).IsLength(1) {
+		assert.For(ctx, "push constant size").That(r.PushConstants[0].Size).Equals(uint32(16))
+	}
+
+	constants := r.SpecializationConstants
+	if assert.For(ctx, "specialization constants").ThatSlice(constants).IsLength(2) {
+		assert.For(ctx, "count id").That(constants[0].SpecID).Equals(uint32(3))
+		assert.For(ctx, "count name").That(constants[0].Name).Equals("count")
+		assert.For(ctx, "count default").That(constants[0].FormatValue(constants[0].Default)).Equals("4")
+		assert.For(ctx, "count value").That(constants[0].FormatValue([]uint32{0xfffffffe})).Equals("-2")
+		assert.For(ctx, "enabled id").That(constants[1].SpecID).Equals(uint32(5))
+		assert.For(ctx, "enabled default").That(constants[1].FormatValue(constants[1].Default)).Equals("true")
+	}
+}
+
+func TestSpecializationParseValue(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		constant shadertools.SpecializationConstant
+		value    string
+		expected []uint32
+	}{
+		{shadertools.SpecializationConstant{Type: "bool", Width: 32}, "true", []uint32{1}},
+		{shadertools.SpecializationConstant{Type: "int", Width: 32}, "-2", []uint32{0xfffffffe}},
+		{shadertools.SpecializationConstant{Type: "uint", Width: 16}, "16", []uint32{0x10}},
+		{shadertools.SpecializationConstant{Type: "float", Width: 32}, "1.5", []uint32{0x3fc00000}},
+		{shadertools.SpecializationConstant{Type: "uint", Width: 64}, "4294967296", []uint32{0, 1}},
+	} {
+		words, err := test.constant.ParseValue(test.value)
+		if assert.For(ctx, "err").ThatError(err).Succeeded() {
+			assert.For(ctx, "%v %v", test.constant.Type, test.value).ThatSlice(words).Equals(test.expected)
+			assert.For(ctx, "formatted %v", test.value).That(test.constant.FormatValue(words)).Equals(test.value)
+		}
+	}
+
+	_, err := shadertools.SpecializationConstant{Type: "int", Width: 32}.ParseValue("1.5")
+	assert.For(ctx, "invalid int").ThatError(err).Failed()
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shadertools
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// The SPIR-V opcodes and decorations used to find the specialization
+// constants of a shader.
+const (
+	spirvMagic = 0x07230203
+
+	spirvOpName              = 5
+	spirvOpTypeBool          = 20
+	spirvOpTypeInt           = 21
+	spirvOpTypeFloat         = 22
+	spirvOpSpecConstantTrue  = 48
+	spirvOpSpecConstantFalse = 49
+	spirvOpSpecConstant      = 50
+	spirvOpDecorate          = 71
+
+	spirvDecorationSpecID = 1
+)
+
+// SpecializationConstant is a scalar specialization constant of a shader.
+type SpecializationConstant struct {
+	SpecID  uint32
+	SpirvId uint32
+	Name    string
+	// Type is one of "bool", "int", "uint" or "float".
+	Type string
+	// Width is the width of the type in bits.
+	Width uint32
+	// Default is the default value of the constant, as SPIR-V literal words.
+	Default []uint32
+}
+
+// FormatValue returns the value encoded in the literal words, interpreted as
+// the type of the constant.
+func (c SpecializationConstant) FormatValue(words []uint32) string {
+	if len(words) == 0 {
+		return ""
+	}
+	bits := uint64(words[0])
+	if c.Width > 32 && len(words) > 1 {
+		bits |= uint64(words[1]) << 32
+	}
+	switch c.Type {
+	case "bool":
+		return fmt.Sprint(bits != 0)
+	case "int":
+		shift := 64 - c.Width
+		return fmt.Sprint(int64(bits<<shift) >> shift)
+	case "uint":
+		return fmt.Sprint(bits)
+	case "float":
+		switch c.Width {
+		case 32:
+			return fmt.Sprint(math.Float32frombits(uint32(bits)))
+		case 64:
+			return fmt.Sprint(math.Float64frombits(bits))
+		}
+	}
+	return fmt.Sprintf("%#x", bits)
+}
+
+// ParseValue returns the value in s, interpreted as the type of the constant,
+// as SPIR-V literal words. It is the inverse of FormatValue.
+func (c SpecializationConstant) ParseValue(s string) ([]uint32, error) {
+	var bits uint64
+	switch c.Type {
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			bits = 1
+		}
+	case "int":
+		i, err := strconv.ParseInt(s, 0, int(c.Width))
+		if err != nil {
+			return nil, err
+		}
+		bits = uint64(i)
+	case "uint":
+		u, err := strconv.ParseUint(s, 0, int(c.Width))
+		if err != nil {
+			return nil, err
+		}
+		bits = u
+	case "float":
+		f, err := strconv.ParseFloat(s, int(c.Width))
+		if err != nil {
+			return nil, err
+		}
+		switch c.Width {
+		case 32:
+			bits = uint64(math.Float32bits(float32(f)))
+		case 64:
+			bits = math.Float64bits(f)
+		default:
+			return nil, fmt.Errorf("Unsupported float width %v", c.Width)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported specialization constant type %v", c.Type)
+	}
+	if c.Width > 32 {
+		return []uint32{uint32(bits), uint32(bits >> 32)}, nil
+	}
+	if c.Width < 32 && c.Type != "bool" {
+		bits &= (1 << c.Width) - 1
+	}
+	return []uint32{uint32(bits)}, nil
+}
+
+// ParseSpecializationConstants returns the scalar specialization constants of
+// the shader, sorted by specialization constant ID.
+func ParseSpecializationConstants(shader []uint32) ([]SpecializationConstant, error) {
+	if len(shader) < 5 || shader[0] != spirvMagic {
+		return nil, errors.New("Invalid SPIR-V module")
+	}
+
+	type scalarType struct {
+		name  string
+		width uint32
+	}
+	names := map[uint32]string{}
+	specIDs := map[uint32]uint32{}
+	types := map[uint32]scalarType{}
+	constants := []SpecializationConstant{}
+
+	for i := 5; i < len(shader); {
+		count := int(shader[i] >> 16)
+		opcode := shader[i] & 0xffff
+		if count == 0 || i+count > len(shader) {
+			return nil, fmt.Errorf("Invalid SPIR-V instruction at word %d", i)
+		}
+		operands := shader[i+1 : i+count]
+		i += count
+
+		switch opcode {
+		case spirvOpName:
+			if len(operands) > 1 {
+				names[operands[0]] = spirvString(operands[1:])
+			}
+		case spirvOpDecorate:
+			if len(operands) > 2 && operands[1] == spirvDecorationSpecID {
+				specIDs[operands[0]] = operands[2]
+			}
+		case spirvOpTypeBool:
+			if len(operands) > 0 {
+				types[operands[0]] = scalarType{"bool", 32}
+			}
+		case spirvOpTypeInt:
+			if len(operands) > 2 {
+				t := scalarType{"uint", operands[1]}
+				if operands[2] != 0 {
+					t.name = "int"
+				}
+				types[operands[0]] = t
+			}
+		case spirvOpTypeFloat:
+			if len(operands) > 1 {
+				types[operands[0]] = scalarType{"float", operands[1]}
+			}
+		case spirvOpSpecConstantTrue, spirvOpSpecConstantFalse, spirvOpSpecConstant:
+			if len(operands) < 2 {
+				break
+			}
+			c := SpecializationConstant{
+				SpirvId: operands[1],
+				Type:    types[operands[0]].name,
+				Width:   types[operands[0]].width,
+			}
+			switch opcode {
+			case spirvOpSpecConstantTrue:
+				c.Default = []uint32{1}
+			case spirvOpSpecConstantFalse:
+				c.Default = []uint32{0}
+			default:
+				c.Default = append([]uint32{}, operands[2:]...)
+			}
+			constants = append(constants, c)
+		}
+	}
+
+	out := []SpecializationConstant{}
+	for _, c := range constants {
+		specID, ok := specIDs[c.SpirvId]
+		if !ok {
+			continue
+		}
+		c.SpecID = specID
+		c.Name = names[c.SpirvId]
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SpecID < out[j].SpecID })
+	return out, nil
+}
+
+// spirvString decodes a nul-terminated SPIR-V literal string.
+func spirvString(words []uint32) string {
+	bytes := make([]byte, 0, len(words)*4)
+	for _, w := range words {
+		for i := uint(0); i < 4; i++ {
+			b := byte(w >> (8 * i))
+			if b == 0 {
+				return string(bytes)
+			}
+			bytes = append(bytes, b)
+		}
+	}
+	return string(bytes)
+}
@@ -60,34 +60,15 @@ func ProcessProfilingData(ctx context.Context, processor *perfetto.Processor, ca
 		log.Err(ctx, err, "Failed to calculate performance data based on GPU slices and counters")
 	}
 
-	return &service.ProfilingData{
+	data := &service.ProfilingData{
 		Slices:      slices,
 		Counters:    counters,
 		GpuCounters: gpuCounters,
-	}, nil
-}
-
-func extractTraceHandles(ctx context.Context, replayHandles *[]int64, replayHandleType string, handleMapping *map[uint64][]service.VulkanHandleMappingItem) {
-	for i, v := range *replayHandles {
-		handles, ok := (*handleMapping)[uint64(v)]
-		if !ok {
-			log.E(ctx, "%v not found in replay: %v", replayHandleType, v)
-			continue
-		}
-
-		found := false
-		for _, handle := range handles {
-			if handle.HandleType == replayHandleType {
-				(*replayHandles)[i] = int64(handle.TraceValue)
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			log.E(ctx, "Incorrect Handle type for %v: %v", replayHandleType, v)
-		}
 	}
+	if err := profile.AddDerivedMetrics(ctx, data, profile.AdrenoMetrics); err != nil {
+		log.Err(ctx, err, "Failed to calculate derived GPU metrics")
+	}
+	return data, nil
 }
 
 func processGpuSlices(ctx context.Context, processor *perfetto.Processor, capture *path.Capture, handleMapping *map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
@@ -119,16 +100,16 @@ func processGpuSlices(ctx context.Context, processor *perfetto.Processor, captur
 	// Grab all the column values. Depends on the order of columns selected in slicesQuery
 
 	contextIds := slicesColumns[0].GetLongValues()
-	extractTraceHandles(ctx, &contextIds, "VkDevice", handleMapping)
+	utils.ExtractTraceHandles(ctx, &contextIds, "VkDevice", handleMapping)
 
 	renderTargets := slicesColumns[1].GetLongValues()
-	extractTraceHandles(ctx, &renderTargets, "VkFramebuffer", handleMapping)
+	utils.ExtractTraceHandles(ctx, &renderTargets, "VkFramebuffer", handleMapping)
 
 	commandBuffers := slicesColumns[5].GetLongValues()
-	extractTraceHandles(ctx, &commandBuffers, "VkCommandBuffer", handleMapping)
+	utils.ExtractTraceHandles(ctx, &commandBuffers, "VkCommandBuffer", handleMapping)
 
 	renderPasses := slicesColumns[6].GetLongValues()
-	extractTraceHandles(ctx, &renderPasses, "VkRenderPass", handleMapping)
+	utils.ExtractTraceHandles(ctx, &renderPasses, "VkRenderPass", handleMapping)
 
 	frameIds := slicesColumns[2].GetLongValues()
 	submissionIds := slicesColumns[3].GetLongValues()
@@ -0,0 +1,274 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// DeltaStatus classifies the change of a metric between two profiles.
+type DeltaStatus int
+
+const (
+	// Unchanged is a change that is not significant.
+	Unchanged DeltaStatus = iota
+	// Regression is a significant increase of a time metric.
+	Regression
+	// Improvement is a significant decrease of a time metric.
+	Improvement
+	// Increase is a significant increase of a metric without a known better
+	// direction.
+	Increase
+	// Decrease is a significant decrease of a metric without a known better
+	// direction.
+	Decrease
+)
+
+func (s DeltaStatus) String() string {
+	switch s {
+	case Unchanged:
+		return ""
+	case Regression:
+		return "regression"
+	case Improvement:
+		return "improvement"
+	case Increase:
+		return "increase"
+	case Decrease:
+		return "decrease"
+	default:
+		return "unknown"
+	}
+}
+
+// CompareOptions controls how two profiles are compared.
+type CompareOptions struct {
+	// MaxIndexShift is the largest difference of the command indices of two
+	// entries with the same label that are considered to be the same entry.
+	MaxIndexShift uint64
+	// Threshold is the smallest relative change of a metric estimate that is
+	// considered significant, e.g. 0.05 for 5%.
+	Threshold float64
+}
+
+// MetricDelta is the change of a metric of an entry between two profiles.
+type MetricDelta struct {
+	Metric   *service.ProfilingData_GpuCounters_Metric
+	Baseline *service.ProfilingData_GpuCounters_Perf
+	Current  *service.ProfilingData_GpuCounters_Perf
+	// Delta is the change of the estimate.
+	Delta float64
+	// Relative is the change of the estimate relative to the baseline
+	// estimate. It is ±Inf if the baseline estimate is zero.
+	Relative float64
+	// DeltaMin and DeltaMax are the smallest and largest changes consistent
+	// with the confidence ranges of both profiles.
+	DeltaMin, DeltaMax float64
+	Status             DeltaStatus
+}
+
+// EntryDelta is the change of the metrics of an entry between two profiles.
+// Either the baseline or current entry is nil if the entry was only found in
+// one of the profiles.
+type EntryDelta struct {
+	// Label is the name of the group of the entry, prefixed with the names of
+	// its ancestor groups.
+	Label    string
+	Baseline *service.ProfilingData_GpuCounters_Entry
+	Current  *service.ProfilingData_GpuCounters_Entry
+	Metrics  []*MetricDelta
+}
+
+// Command returns the command of the entry in the current profile, or in the
+// baseline if the entry was removed.
+func (e *EntryDelta) Command() []uint64 {
+	if e.Current != nil {
+		return entryIndices(e.Current)
+	}
+	return entryIndices(e.Baseline)
+}
+
+// Comparison is the result of the comparison of two profiles.
+type Comparison struct {
+	Entries []*EntryDelta
+}
+
+// Regressions returns the number of metric regressions of the comparison.
+func (c *Comparison) Regressions() int {
+	count := 0
+	for _, e := range c.Entries {
+		for _, m := range e.Metrics {
+			if m.Status == Regression {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// groupLabel returns the name of the group, prefixed with the names of its
+// ancestor groups.
+func groupLabel(g *service.ProfilingData_GpuSlices_Group) string {
+	names := []string{}
+	for ; g != nil; g = g.Parent {
+		names = append([]string{g.Name}, names...)
+	}
+	return strings.Join(names, " / ")
+}
+
+func entryIndices(e *service.ProfilingData_GpuCounters_Entry) []uint64 {
+	if e.Group == nil || e.Group.Link == nil {
+		return nil
+	}
+	return e.Group.Link.Indices
+}
+
+// indexDistance returns the sum of the differences of the command indices,
+// and false if they have a different number of indices.
+func indexDistance(a, b []uint64) (uint64, bool) {
+	if len(a) != len(b) {
+		return 0, false
+	}
+	d := uint64(0)
+	for i := range a {
+		if a[i] > b[i] {
+			d += a[i] - b[i]
+		} else {
+			d += b[i] - a[i]
+		}
+	}
+	return d, true
+}
+
+func lessIndices(a, b []uint64) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// isTimeMetric returns true if the metric is measured in nanoseconds, for
+// which lower values are better.
+func isTimeMetric(m *service.ProfilingData_GpuCounters_Metric) bool {
+	return m.Unit == strconv.Itoa(int(device.GpuCounterDescriptor_NANOSECOND))
+}
+
+// compareMetric returns the change of the metric between the perf values.
+func compareMetric(m *service.ProfilingData_GpuCounters_Metric, baseline, current *service.ProfilingData_GpuCounters_Perf, threshold float64) *MetricDelta {
+	d := &MetricDelta{
+		Metric:   m,
+		Baseline: baseline,
+		Current:  current,
+		Delta:    current.Estimate - baseline.Estimate,
+		DeltaMin: current.Min - baseline.Max,
+		DeltaMax: current.Max - baseline.Min,
+	}
+	switch {
+	case baseline.Estimate != 0:
+		d.Relative = d.Delta / math.Abs(baseline.Estimate)
+	case d.Delta != 0:
+		d.Relative = math.Inf(int(math.Copysign(1, d.Delta)))
+	}
+
+	// The change is significant if the confidence ranges of the two profiles
+	// do not overlap, and the estimate changed by more than the threshold.
+	if (d.DeltaMin > 0 || d.DeltaMax < 0) && math.Abs(d.Relative) >= threshold {
+		increase := d.Delta > 0
+		switch {
+		case isTimeMetric(m) && increase:
+			d.Status = Regression
+		case isTimeMetric(m):
+			d.Status = Improvement
+		case increase:
+			d.Status = Increase
+		default:
+			d.Status = Decrease
+		}
+	}
+	return d
+}
+
+// Compare matches the entries of the current profile to the entries of the
+// baseline profile, and returns the changes of their metrics.
+// Entries are matched by the label of their group and by the command they
+// link to, allowing the command indices to differ by up to
+// opts.MaxIndexShift. Metrics are matched by name.
+func Compare(baseline, current *service.ProfilingData_GpuCounters, opts CompareOptions) *Comparison {
+	baselineMetrics := map[string]int32{}
+	for _, m := range baseline.Metrics {
+		baselineMetrics[m.Name] = m.Id
+	}
+
+	byLabel := map[string][]*service.ProfilingData_GpuCounters_Entry{}
+	for _, e := range baseline.Entries {
+		label := groupLabel(e.Group)
+		byLabel[label] = append(byLabel[label], e)
+	}
+	matched := map[*service.ProfilingData_GpuCounters_Entry]bool{}
+
+	entries := append([]*service.ProfilingData_GpuCounters_Entry{}, current.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lessIndices(entryIndices(entries[i]), entryIndices(entries[j]))
+	})
+
+	out := &Comparison{}
+	for _, e := range entries {
+		delta := &EntryDelta{Label: groupLabel(e.Group), Current: e}
+
+		// Match the closest unmatched baseline entry with the same label.
+		bestDistance := opts.MaxIndexShift
+		for _, b := range byLabel[delta.Label] {
+			if matched[b] {
+				continue
+			}
+			d, ok := indexDistance(entryIndices(b), entryIndices(e))
+			if ok && d <= bestDistance && (delta.Baseline == nil || d < bestDistance) {
+				delta.Baseline, bestDistance = b, d
+			}
+		}
+
+		if delta.Baseline != nil {
+			matched[delta.Baseline] = true
+			for _, m := range current.Metrics {
+				baselineID, ok := baselineMetrics[m.Name]
+				if !ok {
+					continue
+				}
+				b, c := delta.Baseline.MetricToValue[baselineID], e.MetricToValue[m.Id]
+				if b == nil || c == nil {
+					continue
+				}
+				delta.Metrics = append(delta.Metrics, compareMetric(m, b, c, opts.Threshold))
+			}
+		}
+		out.Entries = append(out.Entries, delta)
+	}
+
+	// Add the entries that are only in the baseline.
+	for _, e := range baseline.Entries {
+		if !matched[e] {
+			out.Entries = append(out.Entries, &EntryDelta{Label: groupLabel(e.Group), Baseline: e})
+		}
+	}
+	return out
+}
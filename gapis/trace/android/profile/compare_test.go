@@ -0,0 +1,131 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestCompare(t *testing.T) {
+	ns := strconv.Itoa(int(device.GpuCounterDescriptor_NANOSECOND))
+	metrics := func(counterID int32) []*service.ProfilingData_GpuCounters_Metric {
+		return []*service.ProfilingData_GpuCounters_Metric{
+			{Id: gpuTimeMetricId, Name: "GPU Time", Unit: ns},
+			{Id: counterID, Name: "Shaded Fragments", Unit: "1"},
+		}
+	}
+	perf := func(estimate, min, max float64) *service.ProfilingData_GpuCounters_Perf {
+		return &service.ProfilingData_GpuCounters_Perf{Estimate: estimate, Min: min, Max: max}
+	}
+	submission := &service.ProfilingData_GpuSlices_Group{Name: "Submission: 0"}
+	entry := func(name string, index uint64, time float64, counterID int32, counter *service.ProfilingData_GpuCounters_Perf) *service.ProfilingData_GpuCounters_Entry {
+		return &service.ProfilingData_GpuCounters_Entry{
+			Group: &service.ProfilingData_GpuSlices_Group{
+				Name:   name,
+				Parent: submission,
+				Link:   &path.Command{Indices: []uint64{index, 0}},
+			},
+			MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+				gpuTimeMetricId: perf(time, time, time),
+				counterID:       counter,
+			},
+		}
+	}
+
+	// The counter metric has a different ID in each profile.
+	baseline := &service.ProfilingData_GpuCounters{
+		Metrics: metrics(2),
+		Entries: []*service.ProfilingData_GpuCounters_Entry{
+			entry("slower", 10, 100, 2, perf(50, 40, 60)),
+			entry("same", 20, 100, 2, perf(50, 40, 60)),
+			entry("faster", 30, 100, 2, perf(50, 40, 60)),
+			entry("removed", 40, 100, 2, perf(50, 40, 60)),
+			entry("shifted too far", 50, 100, 2, perf(50, 40, 60)),
+		},
+	}
+	current := &service.ProfilingData_GpuCounters{
+		Metrics: metrics(3),
+		Entries: []*service.ProfilingData_GpuCounters_Entry{
+			entry("slower", 12, 150, 3, perf(80, 70, 90)),
+			entry("same", 21, 101, 3, perf(55, 45, 65)),
+			entry("faster", 30, 50, 3, perf(20, 10, 30)),
+			entry("added", 60, 100, 3, perf(50, 40, 60)),
+			entry("shifted too far", 60, 100, 3, perf(50, 40, 60)),
+		},
+	}
+
+	res := Compare(baseline, current, CompareOptions{MaxIndexShift: 5, Threshold: 0.05})
+
+	type expectation struct {
+		count             int
+		baseline, current bool
+		time, counter     DeltaStatus
+	}
+	expected := map[string]expectation{
+		"Submission: 0 / slower":  {1, true, true, Regression, Increase},
+		"Submission: 0 / same":    {1, true, true, Unchanged, Unchanged},
+		"Submission: 0 / faster":  {1, true, true, Improvement, Decrease},
+		"Submission: 0 / added":   {1, false, true, Unchanged, Unchanged},
+		"Submission: 0 / removed": {1, true, false, Unchanged, Unchanged},
+		// Reported as both added and removed.
+		"Submission: 0 / shifted too far": {2, false, false, Unchanged, Unchanged},
+	}
+	counts := map[string]int{}
+	for _, e := range res.Entries {
+		counts[e.Label]++
+		exp, ok := expected[e.Label]
+		if !ok {
+			t.Errorf("Unexpected entry %v", e.Label)
+			continue
+		}
+		if exp.count == 1 {
+			if got := e.Baseline != nil; got != exp.baseline {
+				t.Errorf("Entry %v has baseline %v, expected %v", e.Label, got, exp.baseline)
+			}
+			if got := e.Current != nil; got != exp.current {
+				t.Errorf("Entry %v has current %v, expected %v", e.Label, got, exp.current)
+			}
+		}
+		if e.Baseline == nil || e.Current == nil {
+			if len(e.Metrics) != 0 {
+				t.Errorf("Unmatched entry %v has metrics", e.Label)
+			}
+			continue
+		}
+		if len(e.Metrics) != 2 {
+			t.Errorf("Entry %v has %v metrics, expected 2", e.Label, len(e.Metrics))
+			continue
+		}
+		if got := e.Metrics[0].Status; got != exp.time {
+			t.Errorf("Entry %v GPU time status was %v, expected %v", e.Label, got, exp.time)
+		}
+		if got := e.Metrics[1].Status; got != exp.counter {
+			t.Errorf("Entry %v counter status was %v, expected %v", e.Label, got, exp.counter)
+		}
+	}
+	for label, exp := range expected {
+		if counts[label] != exp.count {
+			t.Errorf("Got %v entries %v, expected %v", counts[label], label, exp.count)
+		}
+	}
+	if got := res.Regressions(); got != 1 {
+		t.Errorf("Got %v regressions, expected 1", got)
+	}
+}
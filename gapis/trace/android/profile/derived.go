@@ -0,0 +1,248 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// DerivedMetric is the definition of a metric computed from the values of
+// other metrics with an expression. See Expression for the syntax of the
+// expression.
+type DerivedMetric struct {
+	Name            string `json:"name"`
+	Unit            string `json:"unit"`
+	Description     string `json:"description"`
+	Expression      string `json:"expression"`
+	SelectByDefault bool   `json:"select_by_default"`
+}
+
+// ParseDerivedMetrics parses a metric definition file, which is a JSON object
+// of the form:
+//
+//	{
+//	  "metrics": [
+//	    {
+//	      "name": "Fragment Active Ratio",
+//	      "unit": "%",
+//	      "description": "Fragment active cycles per GPU active cycle",
+//	      "expression": "100 * counter(196) / counter(6)",
+//	      "select_by_default": true
+//	    }
+//	  ]
+//	}
+func ParseDerivedMetrics(data []byte) ([]*DerivedMetric, error) {
+	var file struct {
+		Metrics []*DerivedMetric `json:"metrics"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, m := range file.Metrics {
+		if m.Name == "" {
+			return nil, fmt.Errorf("Derived metric with expression %q has no name", m.Expression)
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("Derived metric %q is defined more than once", m.Name)
+		}
+		names[m.Name] = true
+		if _, err := ParseExpression(m.Expression); err != nil {
+			return nil, fmt.Errorf("Derived metric %q: %v", m.Name, err)
+		}
+	}
+	return file.Metrics, nil
+}
+
+// AddDerivedMetrics appends the derived metrics to the GPU counters of the
+// profiling data, and sets their values for each entry.
+// The expressions are evaluated on the aggregated metric values of each entry,
+// so a ratio of counters is the ratio of the counters over the whole entry,
+// rather than an aggregate of per-sample ratios. The derived metrics sum only
+// if their expression is a linear combination of summed metrics, and are
+// averaged over time otherwise. Metrics referencing a counter or metric missing
+// from the profile are skipped, as are the values of entries missing a
+// referenced metric value.
+func AddDerivedMetrics(ctx context.Context, data *service.ProfilingData, defs []*DerivedMetric) error {
+	gpuCounters := data.GpuCounters
+	if gpuCounters == nil {
+		return nil
+	}
+
+	metricsByName := map[string]*service.ProfilingData_GpuCounters_Metric{}
+	metricsByCounter := map[uint32]*service.ProfilingData_GpuCounters_Metric{}
+	nextID := int32(0)
+	for _, m := range gpuCounters.Metrics {
+		metricsByName[m.Name] = m
+		if m.Id >= counterMetricIdOffset {
+			metricsByCounter[m.CounterId] = m
+		}
+		if m.Id >= nextID {
+			nextID = m.Id + 1
+		}
+	}
+	countersByID := map[uint32]*service.ProfilingData_GpuCounters_Metric{}
+	countersByName := map[string]*service.ProfilingData_GpuCounters_Metric{}
+	for _, c := range data.Counters {
+		m, ok := metricsByCounter[c.Id]
+		if !ok || m.Name != c.Name {
+			continue
+		}
+		countersByName[c.Name] = m
+		if c.Spec != nil {
+			countersByID[c.Spec.CounterId] = m
+		}
+	}
+
+	for _, def := range defs {
+		e, err := ParseExpression(def.Expression)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to parse derived metric %v", def.Name)
+		}
+		if _, ok := metricsByName[def.Name]; ok {
+			log.W(ctx, "Skipping derived metric %v: a metric with this name already exists", def.Name)
+			continue
+		}
+
+		// Bind the references to the metrics of the profile.
+		bound := true
+		for _, ref := range e.refs() {
+			var m *service.ProfilingData_GpuCounters_Metric
+			switch ref.kind {
+			case counterIDRef:
+				m = countersByID[ref.id]
+			case counterNameRef:
+				m = countersByName[ref.name]
+			default:
+				m = metricsByName[ref.name]
+			}
+			if m == nil {
+				log.D(ctx, "Skipping derived metric %v: %v is not in the profile", def.Name, ref)
+				bound = false
+				break
+			}
+			ref.metricID, ref.op = m.Id, m.Op
+		}
+		if !bound {
+			continue
+		}
+
+		metric := &service.ProfilingData_GpuCounters_Metric{
+			Id:              nextID,
+			Name:            def.Name,
+			Unit:            def.Unit,
+			Op:              e.aggregationOp(),
+			Description:     def.Description,
+			SelectByDefault: def.SelectByDefault,
+		}
+		nextID++
+		gpuCounters.Metrics = append(gpuCounters.Metrics, metric)
+		metricsByName[metric.Name] = metric
+
+		for _, entry := range gpuCounters.Entries {
+			v, ok := e.root.eval(entry.MetricToValue)
+			if !ok || math.IsNaN(v.estimate) || math.IsInf(v.estimate, 0) {
+				continue
+			}
+			if entry.MetricToValue == nil {
+				entry.MetricToValue = map[int32]*service.ProfilingData_GpuCounters_Perf{}
+			}
+			entry.MetricToValue[metric.Id] = &service.ProfilingData_GpuCounters_Perf{
+				Estimate: v.estimate,
+				Min:      finiteOr(v.min, -math.MaxFloat64),
+				Max:      finiteOr(v.max, math.MaxFloat64),
+			}
+		}
+	}
+	return nil
+}
+
+// finiteOr returns v if it is finite, otherwise bound.
+func finiteOr(v, bound float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return bound
+	}
+	return v
+}
+
+var nanosecondUnit = strconv.Itoa(int(device.GpuCounterDescriptor_NANOSECOND))
+
+// AdrenoMetrics is the library of derived metrics of Adreno GPUs.
+var AdrenoMetrics = []*DerivedMetric{
+	{
+		Name:            "GPU Busy Time",
+		Unit:            nanosecondUnit,
+		Description:     "GPU time weighted by the GPU utilization",
+		Expression:      `metric("GPU Time") * counter(3) / 100`,
+		SelectByDefault: true,
+	},
+	{
+		Name:            "Fragment ALU Instructions / Clock (Full)",
+		Unit:            "instructions/clock",
+		Description:     "Full precision fragment ALU instructions executed per GPU clock",
+		Expression:      "counter(26) / counter(1)",
+		SelectByDefault: true,
+	},
+	{
+		Name:        "% Time Shading",
+		Unit:        "%",
+		Description: "Percentage of time spent shading fragments, vertices and compute work",
+		Expression:  "counter(37) + counter(38) + counter(39)",
+	},
+	{
+		Name:        "% Fragment Shading",
+		Unit:        "%",
+		Description: "Percentage of the shading time spent shading fragments",
+		Expression:  "100 * counter(37) / (counter(37) + counter(38) + counter(39))",
+	},
+}
+
+// MaliMetrics is the library of derived metrics of Mali GPUs.
+var MaliMetrics = []*DerivedMetric{
+	{
+		Name:            "GPU Active Time",
+		Unit:            nanosecondUnit,
+		Description:     "GPU time weighted by the GPU utilization",
+		Expression:      `metric("GPU Time") * counter(65536) / 100`,
+		SelectByDefault: true,
+	},
+	{
+		Name:            "Fragment Active Ratio",
+		Unit:            "%",
+		Description:     "Percentage of GPU active cycles with fragment work active",
+		Expression:      "100 * counter(196) / counter(6)",
+		SelectByDefault: true,
+	},
+	{
+		Name:        "Cycles / Fragment Job",
+		Unit:        "cycles",
+		Description: "GPU active cycles per fragment job",
+		Expression:  "counter(6) / counter(8)",
+	},
+	{
+		Name:        "Execution Core Headroom",
+		Unit:        "%",
+		Description: "Percentage of time the execution cores are idle",
+		Expression:  "max(0, 100 - counter(65579))",
+	},
+}
@@ -0,0 +1,275 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestExpression(t *testing.T) {
+	values := map[int32]*service.ProfilingData_GpuCounters_Perf{
+		0: {Estimate: 10, Min: 8, Max: 12},
+		1: {Estimate: 4, Min: 2, Max: 5},
+		2: {Estimate: 1, Min: -1, Max: 2},
+	}
+	for _, test := range []struct {
+		expr     string
+		expected value
+	}{
+		{"1 + 2 * 3", value{7, 7, 7}},
+		{"(1 + 2) * 3", value{9, 9, 9}},
+		{"-2 - -3", value{1, 1, 1}},
+		{"1.5e2 / 3", value{50, 50, 50}},
+		{`metric("a") + metric("b")`, value{14, 10, 17}},
+		{`metric("a") - metric("b")`, value{6, 3, 10}},
+		{`metric("a") * metric("b")`, value{40, 16, 60}},
+		{`metric("a") / metric("b")`, value{2.5, 1.6, 6}},
+		{`-metric("a")`, value{-10, -12, -8}},
+		{`metric("a") / metric("c")`, value{10, math.Inf(-1), math.Inf(1)}},
+		{`max(metric("b"), metric("c"), 3)`, value{4, 3, 5}},
+		{`min(metric("b"), 3)`, value{3, 2, 3}},
+	} {
+		e, err := ParseExpression(test.expr)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) failed: %v", test.expr, err)
+			continue
+		}
+		for _, ref := range e.refs() {
+			ref.metricID = int32(ref.name[0] - 'a')
+		}
+		got, ok := e.root.eval(values)
+		if !ok || got != test.expected {
+			t.Errorf("Evaluation of %q gave %v, %v. Expected %v", test.expr, got, ok, test.expected)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1",
+		"1 2",
+		"foo(1)",
+		"counter()",
+		"counter(-1)",
+		"metric(1)",
+		`metric("a`,
+		`1 + "a`,
+		"min()",
+	} {
+		if _, err := ParseExpression(expr); err == nil {
+			t.Errorf("ParseExpression(%q) succeeded, expected an error", expr)
+		}
+	}
+}
+
+func TestAddDerivedMetrics(t *testing.T) {
+	ctx := context.Background()
+	counter := func(id, counterID uint32, name string) *service.ProfilingData_Counter {
+		return &service.ProfilingData_Counter{
+			Id:   id,
+			Name: name,
+			Spec: &device.GpuCounterDescriptor_GpuCounterSpec{CounterId: counterID},
+		}
+	}
+	perf := func(estimate, min, max float64) *service.ProfilingData_GpuCounters_Perf {
+		return &service.ProfilingData_GpuCounters_Perf{Estimate: estimate, Min: min, Max: max}
+	}
+	parent := &service.ProfilingData_GpuCounters_Entry{
+		MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			gpuTimeMetricId: perf(300, 300, 300),
+			2:               perf(600, 500, 700),
+			3:               perf(200, 200, 200),
+		},
+	}
+	child := &service.ProfilingData_GpuCounters_Entry{
+		MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			gpuTimeMetricId: perf(100, 100, 100),
+			2:               perf(100, 100, 100),
+		},
+	}
+	data := &service.ProfilingData{
+		Counters: []*service.ProfilingData_Counter{
+			counter(7, 196, "Fragment active cycles"),
+			counter(8, 6, "GPU active cycles"),
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: gpuTimeMetricId, Name: "GPU Time"},
+				{Id: 2, CounterId: 7, Name: "Fragment active cycles", Op: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+				{Id: 3, CounterId: 8, Name: "GPU active cycles", Op: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{parent, child},
+		},
+	}
+
+	defs, err := ParseDerivedMetrics([]byte(`{
+		"metrics": [
+			{"name": "Ratio", "unit": "%", "expression": "100 * counter(196) / counter(\"GPU active cycles\")"},
+			{"name": "Half Time", "expression": "metric(\"GPU Time\") / 2", "select_by_default": true},
+			{"name": "Quarter Time", "expression": "metric(\"Half Time\") / 2"},
+			{"name": "Missing", "expression": "counter(1)"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseDerivedMetrics failed: %v", err)
+	}
+	if err := AddDerivedMetrics(ctx, data, defs); err != nil {
+		t.Fatalf("AddDerivedMetrics failed: %v", err)
+	}
+
+	metrics := data.GpuCounters.Metrics
+	if len(metrics) != 6 {
+		t.Fatalf("Got %v metrics, expected 6", len(metrics))
+	}
+	ratio, half, quarter := metrics[3], metrics[4], metrics[5]
+	if ratio.Id != 4 || ratio.Name != "Ratio" || ratio.Unit != "%" || ratio.Op != service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg {
+		t.Errorf("Unexpected ratio metric %v", ratio)
+	}
+	if half.Id != 5 || !half.SelectByDefault || half.Op != service.ProfilingData_GpuCounters_Metric_Summation {
+		t.Errorf("Unexpected half time metric %v", half)
+	}
+	if quarter.Id != 6 {
+		t.Errorf("Unexpected quarter time metric %v", quarter)
+	}
+
+	// The ratio is computed from the aggregated counters of each entry.
+	if got, expected := parent.MetricToValue[4], perf(300, 250, 350); !perfEqual(got, expected) {
+		t.Errorf("Parent ratio is %v, expected %v", got, expected)
+	}
+	if got, ok := child.MetricToValue[4]; ok {
+		t.Errorf("Child without GPU active cycles has ratio %v", got)
+	}
+	if got, expected := child.MetricToValue[6], perf(25, 25, 25); !perfEqual(got, expected) {
+		t.Errorf("Child quarter time is %v, expected %v", got, expected)
+	}
+
+	for _, defs := range [][]byte{
+		[]byte(`{"metrics": [{"expression": "1"}]}`),
+		[]byte(`{"metrics": [{"name": "a", "expression": "1"}, {"name": "a", "expression": "2"}]}`),
+		[]byte(`{"metrics": [{"name": "a", "expression": "1 +"}]}`),
+		[]byte(`{"metrics": `),
+	} {
+		if _, err := ParseDerivedMetrics(defs); err == nil {
+			t.Errorf("ParseDerivedMetrics(%s) succeeded, expected an error", defs)
+		}
+	}
+}
+
+func TestDerivedMetricAggregation(t *testing.T) {
+	ctx := context.Background()
+	perf := func(v float64) *service.ProfilingData_GpuCounters_Perf {
+		return &service.ProfilingData_GpuCounters_Perf{Estimate: v, Min: v, Max: v}
+	}
+	// Two entries, with their GPU time, their wall time, and a counter.
+	entries := []*service.ProfilingData_GpuCounters_Entry{
+		{MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			gpuTimeMetricId: perf(100), gpuWallTimeMetricId: perf(50), 2: perf(20),
+		}},
+		{MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			gpuTimeMetricId: perf(300), gpuWallTimeMetricId: perf(300), 2: perf(40),
+		}},
+	}
+	data := &service.ProfilingData{
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: gpuTimeMetricId, Name: "GPU Time", Op: service.ProfilingData_GpuCounters_Metric_Summation},
+				{Id: gpuWallTimeMetricId, Name: "GPU Wall Time", Op: service.ProfilingData_GpuCounters_Metric_Summation},
+				{Id: 2, Name: "Utilization", Op: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+			},
+			Entries: entries,
+		},
+	}
+
+	defs := []*DerivedMetric{
+		{Name: "Overlap", Expression: `metric("GPU Time") / metric("GPU Wall Time")`},
+		{Name: "Overlapped Time", Expression: `(metric("GPU Time") - metric("GPU Wall Time")) * 1e-3`},
+		{Name: "Negated Time", Expression: `-metric("GPU Time") / 2`},
+		{Name: "Offset Time", Expression: `metric("GPU Time") + 1`},
+		{Name: "Time Squared", Expression: `metric("GPU Time") * metric("GPU Time")`},
+		{Name: "Busy Time", Expression: `metric("GPU Time") * metric("Utilization") / 100`},
+		{Name: "Longest Time", Expression: `max(metric("GPU Time"), metric("GPU Wall Time"))`},
+		{Name: "Constant", Expression: "1 + 2"},
+	}
+	if err := AddDerivedMetrics(ctx, data, defs); err != nil {
+		t.Fatalf("AddDerivedMetrics failed: %v", err)
+	}
+
+	expected := map[string]service.ProfilingData_GpuCounters_Metric_AggregationOperator{
+		"Overlap":         service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		"Overlapped Time": service.ProfilingData_GpuCounters_Metric_Summation,
+		"Negated Time":    service.ProfilingData_GpuCounters_Metric_Summation,
+		"Offset Time":     service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		"Time Squared":    service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		"Busy Time":       service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		"Longest Time":    service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		"Constant":        service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+	}
+	metrics := map[string]*service.ProfilingData_GpuCounters_Metric{}
+	for _, m := range data.GpuCounters.Metrics {
+		metrics[m.Name] = m
+		if op, ok := expected[m.Name]; ok && m.Op != op {
+			t.Errorf("Derived metric %v is aggregated with %v, expected %v", m.Name, m.Op, op)
+		}
+	}
+
+	// Aggregating the ratio over both entries gives a ratio between the ratios
+	// of the entries, rather than their sum.
+	overlap := metrics["Overlap"]
+	if got := aggregateMetric(overlap, entries); got < 1 || got > 2 {
+		t.Errorf("Aggregated overlap is %v, expected a value between 1 and 2", got)
+	}
+	if got, expected := aggregateMetric(metrics["Overlapped Time"], entries), 0.05; math.Abs(got-expected) > 1e-9 {
+		t.Errorf("Aggregated overlapped time is %v, expected %v", got, expected)
+	}
+}
+
+// aggregateMetric aggregates the values of the metric over the entries, as
+// clients aggregate the entries of a group, weighting the time weighted
+// averages by GPU time.
+func aggregateMetric(m *service.ProfilingData_GpuCounters_Metric, entries []*service.ProfilingData_GpuCounters_Entry) float64 {
+	sum, time := 0.0, 0.0
+	for _, e := range entries {
+		v := e.MetricToValue[m.Id].Estimate
+		if m.Op == service.ProfilingData_GpuCounters_Metric_Summation {
+			sum += v
+			continue
+		}
+		t := e.MetricToValue[gpuTimeMetricId].Estimate
+		sum, time = sum+v*t, time+t
+	}
+	if m.Op == service.ProfilingData_GpuCounters_Metric_Summation {
+		return sum
+	}
+	return sum / time
+}
+
+func TestDerivedMetricLibraries(t *testing.T) {
+	for _, defs := range [][]*DerivedMetric{AdrenoMetrics, MaliMetrics} {
+		for _, def := range defs {
+			if _, err := ParseExpression(def.Expression); err != nil {
+				t.Errorf("Derived metric %v: %v", def.Name, err)
+			}
+		}
+	}
+}
+
+func perfEqual(a, b *service.ProfilingData_GpuCounters_Perf) bool {
+	return a != nil && b != nil && a.Estimate == b.Estimate && a.Min == b.Min && a.Max == b.Max
+}
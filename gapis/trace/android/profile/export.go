@@ -0,0 +1,241 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// gpuProcessID is the process ID of the GPU in exported traces.
+const gpuProcessID = 1
+
+// CommandLabels maps the IDs of the slice groups of a profile to the labels of
+// the commands the groups link to.
+type CommandLabels map[int32]string
+
+// command returns the label of the command of the group, or the name of the
+// group if it has no label.
+func (l CommandLabels) command(g *service.ProfilingData_GpuSlices_Group) string {
+	if label, ok := l[g.Id]; ok {
+		return label
+	}
+	return g.Name
+}
+
+// unitName returns the name of the unit, which is either the number of a
+// GpuCounterDescriptor.MeasureUnit or a name.
+func unitName(unit string) string {
+	if n, err := strconv.Atoi(unit); err == nil {
+		if name, ok := device.GpuCounterDescriptor_MeasureUnit_name[int32(n)]; ok {
+			return name
+		}
+	}
+	return unit
+}
+
+func extraValue(e *service.ProfilingData_GpuSlices_Slice_Extra) interface{} {
+	switch v := e.Value.(type) {
+	case *service.ProfilingData_GpuSlices_Slice_Extra_IntValue:
+		return v.IntValue
+	case *service.ProfilingData_GpuSlices_Slice_Extra_DoubleValue:
+		return v.DoubleValue
+	case *service.ProfilingData_GpuSlices_Slice_Extra_StringValue:
+		return v.StringValue
+	default:
+		return nil
+	}
+}
+
+// sliceArgs returns the arguments of the slice: its extras, and the command and
+// group it belongs to.
+func sliceArgs(s *service.ProfilingData_GpuSlices_Slice, groups map[int32]*service.ProfilingData_GpuSlices_Group, labels CommandLabels) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, e := range s.Extras {
+		if v := extraValue(e); v != nil {
+			args[e.Name] = v
+		}
+	}
+	if g, ok := groups[s.GroupId]; ok {
+		args["command"] = labels.command(g)
+		args["group"] = groupLabel(g)
+		if g.Link != nil {
+			args["indices"] = fmt.Sprint(g.Link.Indices)
+		}
+	}
+	return args
+}
+
+func groupsByID(data *service.ProfilingData) map[int32]*service.ProfilingData_GpuSlices_Group {
+	groups := map[int32]*service.ProfilingData_GpuSlices_Group{}
+	for _, g := range data.GetSlices().GetGroups() {
+		groups[g.Id] = g
+	}
+	return groups
+}
+
+type chromeEvent struct {
+	Name      string                 `json:"name,omitempty"`
+	Category  string                 `json:"cat,omitempty"`
+	ProcessID uint64                 `json:"pid"`
+	ThreadID  int64                  `json:"tid"`
+	EventType string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes the GPU slices and counters of the profile as a
+// Chrome JSON trace. Each GPU track is a thread of a single GPU process.
+func WriteChromeTrace(w io.Writer, data *service.ProfilingData, labels CommandLabels) error {
+	events := []chromeEvent{{
+		Name:      "process_name",
+		ProcessID: gpuProcessID,
+		EventType: "M",
+		Args:      map[string]interface{}{"name": "GPU"},
+	}}
+	for _, t := range data.GetSlices().GetTracks() {
+		events = append(events, chromeEvent{
+			Name:      "thread_name",
+			ProcessID: gpuProcessID,
+			ThreadID:  int64(t.Id),
+			EventType: "M",
+			Args:      map[string]interface{}{"name": t.Name},
+		})
+	}
+
+	// Chrome trace timestamps are in microseconds.
+	groups := groupsByID(data)
+	for _, s := range data.GetSlices().GetSlices() {
+		events = append(events, chromeEvent{
+			Name:      s.Label,
+			Category:  "gpu",
+			ProcessID: gpuProcessID,
+			ThreadID:  int64(s.TrackId),
+			EventType: "X",
+			Timestamp: float64(s.Ts) / 1000,
+			Duration:  float64(s.Dur) / 1000,
+			Args:      sliceArgs(s, groups, labels),
+		})
+	}
+	for _, c := range data.GetCounters() {
+		for i, ts := range c.Timestamps {
+			if i >= len(c.Values) {
+				break
+			}
+			events = append(events, chromeEvent{
+				Name:      c.Name,
+				Category:  "gpu",
+				ProcessID: gpuProcessID,
+				EventType: "C",
+				Timestamp: float64(ts) / 1000,
+				Args:      map[string]interface{}{"value": c.Values[i]},
+			})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{events, "ns"})
+}
+
+func writeCSV(w io.Writer, header []string, records [][]string) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	if err := out.WriteAll(records); err != nil {
+		return err
+	}
+	return out.Error()
+}
+
+// WriteSlicesCSV writes a CSV table of the GPU slices of the profile, with the
+// commands they belong to.
+func WriteSlicesCSV(w io.Writer, data *service.ProfilingData, labels CommandLabels) error {
+	tracks := map[int32]string{}
+	for _, t := range data.GetSlices().GetTracks() {
+		tracks[t.Id] = t.Name
+	}
+	groups := groupsByID(data)
+	records := [][]string{}
+	for _, s := range data.GetSlices().GetSlices() {
+		command, indices := "", ""
+		if g, ok := groups[s.GroupId]; ok {
+			command = labels.command(g)
+			if g.Link != nil {
+				indices = fmt.Sprint(g.Link.Indices)
+			}
+		}
+		records = append(records, []string{
+			fmt.Sprint(s.Id), tracks[s.TrackId], fmt.Sprint(s.Ts), fmt.Sprint(s.Dur),
+			fmt.Sprint(s.Depth), s.Label, fmt.Sprint(s.GroupId), indices, command,
+		})
+	}
+	return writeCSV(w, []string{"Id", "Track", "Ts", "Dur", "Depth", "Label", "GroupId", "Indices", "Command"}, records)
+}
+
+// WriteCountersCSV writes a CSV table of the samples of the GPU counters of
+// the profile.
+func WriteCountersCSV(w io.Writer, data *service.ProfilingData) error {
+	records := [][]string{}
+	for _, c := range data.GetCounters() {
+		unit := unitName(c.Unit)
+		for i, ts := range c.Timestamps {
+			if i >= len(c.Values) {
+				break
+			}
+			records = append(records, []string{c.Name, unit, fmt.Sprint(ts), fmt.Sprint(c.Values[i])})
+		}
+	}
+	return writeCSV(w, []string{"Counter", "Unit", "Ts", "Value"}, records)
+}
+
+// WriteCommandsCSV writes a CSV table of the metrics of each command of the
+// profile, with a row per command and metric, sorted by command.
+func WriteCommandsCSV(w io.Writer, data *service.ProfilingData, labels CommandLabels) error {
+	gpuCounters := data.GetGpuCounters()
+	entries := append([]*service.ProfilingData_GpuCounters_Entry{}, gpuCounters.GetEntries()...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lessIndices(entryIndices(entries[i]), entryIndices(entries[j]))
+	})
+
+	records := [][]string{}
+	for _, e := range entries {
+		if e.Group == nil {
+			continue
+		}
+		command, indices := labels.command(e.Group), fmt.Sprint(entryIndices(e))
+		for _, m := range gpuCounters.Metrics {
+			p, ok := e.MetricToValue[m.Id]
+			if !ok || p == nil {
+				continue
+			}
+			records = append(records, []string{
+				indices, command, groupLabel(e.Group), m.Name, unitName(m.Unit),
+				fmt.Sprint(p.Estimate), fmt.Sprint(p.Min), fmt.Sprint(p.Max),
+			})
+		}
+	}
+	return writeCSV(w, []string{"Indices", "Command", "Group", "Metric", "Unit", "Estimate", "Min", "Max"}, records)
+}
@@ -0,0 +1,252 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// The field numbers of the Perfetto trace protos. The trace is encoded
+// directly, as the trace protos are not part of the Perfetto protos built for
+// Go.
+const (
+	tracePacketField = 1 // Trace.packet
+
+	packetTimestamp       = 8  // TracePacket.timestamp
+	packetSequenceID      = 10 // TracePacket.trusted_packet_sequence_id
+	packetTrackEvent      = 11 // TracePacket.track_event
+	packetSequenceFlags   = 13 // TracePacket.sequence_flags
+	packetTrackDescriptor = 60 // TracePacket.track_descriptor
+
+	trackUUID       = 1 // TrackDescriptor.uuid
+	trackName       = 2 // TrackDescriptor.name
+	trackProcess    = 3 // TrackDescriptor.process
+	trackParentUUID = 5 // TrackDescriptor.parent_uuid
+	trackCounter    = 8 // TrackDescriptor.counter
+
+	processPid  = 1 // ProcessDescriptor.pid
+	processName = 6 // ProcessDescriptor.process_name
+
+	eventDebugAnnotations = 4  // TrackEvent.debug_annotations
+	eventType             = 9  // TrackEvent.type
+	eventTrackUUID        = 11 // TrackEvent.track_uuid
+	eventCategories       = 22 // TrackEvent.categories
+	eventName             = 23 // TrackEvent.name
+	eventDoubleValue      = 44 // TrackEvent.double_counter_value
+
+	annotationUintValue   = 3  // DebugAnnotation.uint_value
+	annotationDoubleValue = 5  // DebugAnnotation.double_value
+	annotationStringValue = 6  // DebugAnnotation.string_value
+	annotationName        = 10 // DebugAnnotation.name
+)
+
+// TrackEvent.Type values.
+const (
+	eventSliceBegin = 1
+	eventSliceEnd   = 2
+	eventInstant    = 3
+	eventCounter    = 4
+)
+
+// TracePacket.SequenceFlags values.
+const (
+	sequenceIncrementalStateCleared = 1
+	sequenceNeedsIncrementalState   = 2
+)
+
+const (
+	traceSequenceID = 1
+	gpuTrackUUID    = 1
+)
+
+func sliceTrackUUID(id int32) uint64    { return 1<<32 | uint64(uint32(id)) }
+func counterTrackUUID(id uint32) uint64 { return 2<<32 | uint64(id) }
+
+// protoMessage is an encoded protobuf message.
+type protoMessage []byte
+
+func (m protoMessage) tag(field, wireType int) protoMessage {
+	return m.rawVarint(uint64(field<<3 | wireType))
+}
+
+func (m protoMessage) rawVarint(v uint64) protoMessage {
+	var buf [binary.MaxVarintLen64]byte
+	return append(m, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (m protoMessage) varint(field int, v uint64) protoMessage {
+	return m.tag(field, 0).rawVarint(v)
+}
+
+func (m protoMessage) double(field int, v float64) protoMessage {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(m.tag(field, 1), buf[:]...)
+}
+
+func (m protoMessage) bytes(field int, b []byte) protoMessage {
+	return append(m.tag(field, 2).rawVarint(uint64(len(b))), b...)
+}
+
+func (m protoMessage) string(field int, s string) protoMessage {
+	return m.bytes(field, []byte(s))
+}
+
+func (m protoMessage) annotation(name string, value interface{}) protoMessage {
+	a := protoMessage{}.string(annotationName, name)
+	switch v := value.(type) {
+	case uint64:
+		a = a.varint(annotationUintValue, v)
+	case float64:
+		a = a.double(annotationDoubleValue, v)
+	default:
+		a = a.string(annotationStringValue, fmt.Sprint(v))
+	}
+	return m.bytes(eventDebugAnnotations, a)
+}
+
+// perfettoWriter writes the packets of a Perfetto trace.
+type perfettoWriter struct {
+	w     io.Writer
+	first bool
+	err   error
+}
+
+func (p *perfettoWriter) packet(ts uint64, field int, payload protoMessage) {
+	if p.err != nil {
+		return
+	}
+	packet := protoMessage{}
+	if field == packetTrackEvent {
+		packet = packet.varint(packetTimestamp, ts)
+	}
+	packet = packet.varint(packetSequenceID, traceSequenceID)
+	if p.first {
+		packet = packet.varint(packetSequenceFlags, sequenceIncrementalStateCleared)
+		p.first = false
+	} else if field == packetTrackEvent {
+		packet = packet.varint(packetSequenceFlags, sequenceNeedsIncrementalState)
+	}
+	packet = packet.bytes(field, payload)
+	_, p.err = p.w.Write(protoMessage{}.bytes(tracePacketField, packet))
+}
+
+// sliceEvent is the begin or end of a slice.
+type sliceEvent struct {
+	ts    uint64
+	begin bool
+	slice *service.ProfilingData_GpuSlices_Slice
+}
+
+// sortSliceEvents sorts the slice events by time, so that the slices of a track
+// are properly nested: at the same time, slices end before others begin,
+// deeper slices end first, and shallower slices begin first.
+func sortSliceEvents(events []sliceEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		switch {
+		case a.ts != b.ts:
+			return a.ts < b.ts
+		case a.begin != b.begin:
+			return !a.begin
+		case a.begin:
+			return a.slice.Depth < b.slice.Depth
+		default:
+			return a.slice.Depth > b.slice.Depth
+		}
+	})
+}
+
+// WritePerfettoTrace writes the GPU slices and counters of the profile as a
+// Perfetto trace, with a track for each GPU track and counter. The slices are
+// annotated with their extras, and the command and group they belong to.
+func WritePerfettoTrace(w io.Writer, data *service.ProfilingData, labels CommandLabels) error {
+	p := &perfettoWriter{w: w, first: true}
+
+	process := protoMessage{}.varint(processPid, gpuProcessID).string(processName, "GPU")
+	p.packet(0, packetTrackDescriptor, protoMessage{}.
+		varint(trackUUID, gpuTrackUUID).
+		bytes(trackProcess, process))
+	for _, t := range data.GetSlices().GetTracks() {
+		p.packet(0, packetTrackDescriptor, protoMessage{}.
+			varint(trackUUID, sliceTrackUUID(t.Id)).
+			string(trackName, t.Name).
+			varint(trackParentUUID, gpuTrackUUID))
+	}
+	for _, c := range data.GetCounters() {
+		name := c.Name
+		if unit := unitName(c.Unit); unit != "" {
+			name = fmt.Sprintf("%v (%v)", c.Name, unit)
+		}
+		p.packet(0, packetTrackDescriptor, protoMessage{}.
+			varint(trackUUID, counterTrackUUID(c.Id)).
+			string(trackName, name).
+			varint(trackParentUUID, gpuTrackUUID).
+			bytes(trackCounter, nil))
+	}
+
+	groups := groupsByID(data)
+	events := []sliceEvent{}
+	for _, s := range data.GetSlices().GetSlices() {
+		events = append(events, sliceEvent{s.Ts, true, s})
+		if s.Dur > 0 {
+			events = append(events, sliceEvent{s.Ts + s.Dur, false, s})
+		}
+	}
+	sortSliceEvents(events)
+	for _, e := range events {
+		event := protoMessage{}.varint(eventTrackUUID, sliceTrackUUID(e.slice.TrackId))
+		switch {
+		case !e.begin:
+			event = event.varint(eventType, eventSliceEnd)
+		case e.slice.Dur == 0:
+			event = event.varint(eventType, eventInstant)
+		default:
+			event = event.varint(eventType, eventSliceBegin)
+		}
+		if e.begin {
+			event = event.string(eventCategories, "gpu").string(eventName, e.slice.Label)
+			args := sliceArgs(e.slice, groups, labels)
+			names := make([]string, 0, len(args))
+			for name := range args {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				event = event.annotation(name, args[name])
+			}
+		}
+		p.packet(e.ts, packetTrackEvent, event)
+	}
+
+	for _, c := range data.GetCounters() {
+		for i, ts := range c.Timestamps {
+			if i >= len(c.Values) {
+				break
+			}
+			p.packet(ts, packetTrackEvent, protoMessage{}.
+				varint(eventType, eventCounter).
+				varint(eventTrackUUID, counterTrackUUID(c.Id)).
+				double(eventDoubleValue, c.Values[i]))
+		}
+	}
+	return p.err
+}
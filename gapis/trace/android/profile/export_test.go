@@ -0,0 +1,220 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func exportTestData() (*service.ProfilingData, CommandLabels) {
+	submission := &service.ProfilingData_GpuSlices_Group{
+		Id:   0,
+		Name: "Submission: 0",
+		Link: &path.Command{Indices: []uint64{5}},
+	}
+	renderPass := &service.ProfilingData_GpuSlices_Group{
+		Id:     1,
+		Name:   "RenderPass 1, RenderTarget 2",
+		Parent: submission,
+		Link:   &path.Command{Indices: []uint64{5, 0, 1}},
+	}
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Id: 1, Ts: 1000, Dur: 500, Label: "vertex", TrackId: 7, GroupId: 1, Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{
+					{Name: "frameId", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: 3}},
+				}},
+				{Id: 2, Ts: 1000, Dur: 200, Depth: 1, Label: "binning", TrackId: 7, GroupId: 1},
+				{Id: 3, Ts: 1500, Dur: 1000, Label: "fragment", TrackId: 7, GroupId: -1},
+			},
+			Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 7, Name: "GPU Queue 0"}},
+			Groups: []*service.ProfilingData_GpuSlices_Group{submission, renderPass},
+		},
+		Counters: []*service.ProfilingData_Counter{{
+			Id:         4,
+			Name:       "GPU Busy",
+			Unit:       strconv.Itoa(int(device.GpuCounterDescriptor_PERCENT)),
+			Timestamps: []uint64{1000, 2000},
+			Values:     []float64{50, 75.5},
+		}},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: gpuTimeMetricId, Name: "GPU Time", Unit: strconv.Itoa(int(device.GpuCounterDescriptor_NANOSECOND))},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{
+				{Group: renderPass, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+					gpuTimeMetricId: {Estimate: 500, Min: 500, Max: 500},
+				}},
+				{Group: submission, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+					gpuTimeMetricId: {Estimate: 1500, Min: 1500, Max: 1500},
+				}},
+			},
+		},
+	}
+	return data, CommandLabels{1: "vkCmdBeginRenderPass"}
+}
+
+func TestExportCSV(t *testing.T) {
+	data, labels := exportTestData()
+	for _, test := range []struct {
+		name     string
+		write    func(*bytes.Buffer) error
+		expected string
+	}{
+		{
+			"slices",
+			func(b *bytes.Buffer) error { return WriteSlicesCSV(b, data, labels) },
+			"Id,Track,Ts,Dur,Depth,Label,GroupId,Indices,Command\n" +
+				"1,GPU Queue 0,1000,500,0,vertex,1,[5 0 1],vkCmdBeginRenderPass\n" +
+				"2,GPU Queue 0,1000,200,1,binning,1,[5 0 1],vkCmdBeginRenderPass\n" +
+				"3,GPU Queue 0,1500,1000,0,fragment,-1,,\n",
+		},
+		{
+			"counters",
+			func(b *bytes.Buffer) error { return WriteCountersCSV(b, data) },
+			"Counter,Unit,Ts,Value\n" +
+				"GPU Busy,PERCENT,1000,50\n" +
+				"GPU Busy,PERCENT,2000,75.5\n",
+		},
+		{
+			"commands",
+			func(b *bytes.Buffer) error { return WriteCommandsCSV(b, data, labels) },
+			"Indices,Command,Group,Metric,Unit,Estimate,Min,Max\n" +
+				"[5],Submission: 0,Submission: 0,GPU Time,NANOSECOND,1500,1500,1500\n" +
+				"[5 0 1],vkCmdBeginRenderPass,\"Submission: 0 / RenderPass 1, RenderTarget 2\",GPU Time,NANOSECOND,500,500,500\n",
+		},
+	} {
+		b := &bytes.Buffer{}
+		if err := test.write(b); err != nil {
+			t.Errorf("Writing the %v table failed: %v", test.name, err)
+		} else if got := b.String(); got != test.expected {
+			t.Errorf("Unexpected %v table.\nGot:\n%v\nExpected:\n%v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestExportChromeTrace(t *testing.T) {
+	data, labels := exportTestData()
+	b := &bytes.Buffer{}
+	if err := WriteChromeTrace(b, data, labels); err != nil {
+		t.Fatalf("WriteChromeTrace failed: %v", err)
+	}
+	var trace struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &trace); err != nil {
+		t.Fatalf("The Chrome trace is not valid JSON: %v", err)
+	}
+	phases := ""
+	for _, e := range trace.TraceEvents {
+		phases += e.EventType
+	}
+	if expected := "MMXXXCC"; phases != expected {
+		t.Errorf("Got events %v, expected %v", phases, expected)
+	}
+	vertex := trace.TraceEvents[2]
+	if vertex.Name != "vertex" || vertex.ThreadID != 7 || vertex.Timestamp != 1 || vertex.Duration != 0.5 ||
+		vertex.Args["command"] != "vkCmdBeginRenderPass" || vertex.Args["frameId"] != 3.0 {
+		t.Errorf("Unexpected slice event %+v", vertex)
+	}
+	if counter := trace.TraceEvents[6]; counter.Name != "GPU Busy" || counter.Timestamp != 2 || counter.Args["value"] != 75.5 {
+		t.Errorf("Unexpected counter event %+v", counter)
+	}
+}
+
+// protoFields decodes the fields of an encoded protobuf message, returning the
+// values of varint and fixed64 fields as uint64 and of other fields as bytes.
+func protoFields(t *testing.T, m []byte) map[int][]interface{} {
+	out := map[int][]interface{}{}
+	for len(m) > 0 {
+		tag, n := binary.Uvarint(m)
+		m = m[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(m)
+			out[field], m = append(out[field], v), m[n:]
+		case 1:
+			out[field], m = append(out[field], binary.LittleEndian.Uint64(m)), m[8:]
+		case 2:
+			l, n := binary.Uvarint(m)
+			m = m[n:]
+			out[field], m = append(out[field], m[:l]), m[l:]
+		default:
+			t.Fatalf("Unexpected wire type %v", tag&7)
+		}
+	}
+	return out
+}
+
+func TestExportPerfettoTrace(t *testing.T) {
+	data, labels := exportTestData()
+	b := &bytes.Buffer{}
+	if err := WritePerfettoTrace(b, data, labels); err != nil {
+		t.Fatalf("WritePerfettoTrace failed: %v", err)
+	}
+
+	packets := protoFields(t, b.Bytes())[tracePacketField]
+	descriptors, events := []map[int][]interface{}{}, []string{}
+	for i, p := range packets {
+		packet := protoFields(t, p.([]byte))
+		if i == 0 && packet[packetSequenceFlags][0] != uint64(sequenceIncrementalStateCleared) {
+			t.Errorf("The first packet does not clear the incremental state")
+		}
+		if d, ok := packet[packetTrackDescriptor]; ok {
+			descriptors = append(descriptors, protoFields(t, d[0].([]byte)))
+			continue
+		}
+		event := protoFields(t, packet[packetTrackEvent][0].([]byte))
+		ts := packet[packetTimestamp][0].(uint64)
+		switch event[eventType][0] {
+		case uint64(eventSliceBegin):
+			events = append(events, "B"+string(event[eventName][0].([]byte))+"@"+strconv.Itoa(int(ts)))
+		case uint64(eventSliceEnd):
+			events = append(events, "E@"+strconv.Itoa(int(ts)))
+		case uint64(eventCounter):
+			value := math.Float64frombits(event[eventDoubleValue][0].(uint64))
+			events = append(events, "C"+strconv.FormatFloat(value, 'g', -1, 64)+"@"+strconv.Itoa(int(ts)))
+			if event[eventTrackUUID][0] != counterTrackUUID(4) {
+				t.Errorf("Counter event on track %v", event[eventTrackUUID][0])
+			}
+		}
+	}
+
+	if len(descriptors) != 3 {
+		t.Fatalf("Got %v track descriptors, expected 3", len(descriptors))
+	}
+	if name := string(descriptors[1][trackName][0].([]byte)); name != "GPU Queue 0" {
+		t.Errorf("Unexpected slice track name %q", name)
+	}
+	if name := string(descriptors[2][trackName][0].([]byte)); name != "GPU Busy (PERCENT)" {
+		t.Errorf("Unexpected counter track name %q", name)
+	}
+
+	expected := "Bvertex@1000 Bbinning@1000 E@1200 E@1500 Bfragment@1500 E@2500 C50@1000 C75.5@2000"
+	if got := strings.Join(events, " "); got != expected {
+		t.Errorf("Unexpected events %v, expected %v", got, expected)
+	}
+}
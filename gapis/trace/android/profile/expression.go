@@ -0,0 +1,477 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// Expression is a parsed derived metric expression.
+//
+// The grammar of expressions is:
+//
+//	expr    := term (('+' | '-') term)*
+//	term    := unary (('*' | '/') unary)*
+//	unary   := '-' unary | primary
+//	primary := number | '(' expr ')' | call
+//	call    := 'counter' '(' (number | string) ')'
+//	         | 'metric' '(' string ')'
+//	         | ('min' | 'max') '(' expr (',' expr)* ')'
+//
+// counter(N) refers to the metric of the GPU counter with the counter ID N of
+// the GPU counter descriptor, and counter("name") to the metric of the GPU
+// counter with that name. metric("name") refers to any metric by name,
+// including previously defined derived metrics. Strings are double quoted.
+type Expression struct {
+	source string
+	root   expr
+}
+
+func (e *Expression) String() string { return e.source }
+
+// value is the value of an expression, with its confidence range.
+type value struct {
+	estimate, min, max float64
+}
+
+// bounds returns the value with the range spanning the values.
+func bounds(estimate float64, values ...float64) value {
+	v := value{estimate, values[0], values[0]}
+	for _, x := range values[1:] {
+		v.min, v.max = math.Min(v.min, x), math.Max(v.max, x)
+	}
+	return v
+}
+
+type expr interface {
+	// eval returns the value of the expression for the metric values of an
+	// entry, or false if a referenced metric has no value.
+	eval(values map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool)
+}
+
+type numberExpr float64
+
+func (n numberExpr) eval(map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool) {
+	return value{float64(n), float64(n), float64(n)}, true
+}
+
+type refKind int
+
+const (
+	counterIDRef refKind = iota
+	counterNameRef
+	metricNameRef
+)
+
+// refExpr is a reference to a metric, bound to the metric ID and its
+// aggregation operator before evaluation.
+type refExpr struct {
+	kind     refKind
+	id       uint32
+	name     string
+	metricID int32
+	op       service.ProfilingData_GpuCounters_Metric_AggregationOperator
+}
+
+func (r *refExpr) String() string {
+	switch r.kind {
+	case counterIDRef:
+		return fmt.Sprintf("counter(%v)", r.id)
+	case counterNameRef:
+		return fmt.Sprintf("counter(%q)", r.name)
+	default:
+		return fmt.Sprintf("metric(%q)", r.name)
+	}
+}
+
+func (r *refExpr) eval(values map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool) {
+	p, ok := values[r.metricID]
+	if !ok || p == nil {
+		return value{}, false
+	}
+	return value{p.Estimate, p.Min, p.Max}, true
+}
+
+type negateExpr struct{ x expr }
+
+func (n negateExpr) eval(values map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool) {
+	x, ok := n.x.eval(values)
+	return value{-x.estimate, -x.max, -x.min}, ok
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (b binaryExpr) eval(values map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool) {
+	x, ok := b.x.eval(values)
+	if !ok {
+		return value{}, false
+	}
+	y, ok := b.y.eval(values)
+	if !ok {
+		return value{}, false
+	}
+	// The ranges are propagated with interval arithmetic.
+	switch b.op {
+	case '+':
+		return value{x.estimate + y.estimate, x.min + y.min, x.max + y.max}, true
+	case '-':
+		return value{x.estimate - y.estimate, x.min - y.max, x.max - y.min}, true
+	case '*':
+		return bounds(x.estimate*y.estimate, x.min*y.min, x.min*y.max, x.max*y.min, x.max*y.max), true
+	default:
+		if y.min <= 0 && y.max >= 0 {
+			// The range of the divisor includes zero, so the range of the
+			// quotient is unbounded.
+			return value{x.estimate / y.estimate, math.Inf(-1), math.Inf(1)}, true
+		}
+		return bounds(x.estimate/y.estimate, x.min/y.min, x.min/y.max, x.max/y.min, x.max/y.max), true
+	}
+}
+
+type callExpr struct {
+	min  bool
+	args []expr
+}
+
+func (c callExpr) eval(values map[int32]*service.ProfilingData_GpuCounters_Perf) (value, bool) {
+	pick := math.Max
+	if c.min {
+		pick = math.Min
+	}
+	out, ok := c.args[0].eval(values)
+	if !ok {
+		return value{}, false
+	}
+	for _, a := range c.args[1:] {
+		v, ok := a.eval(values)
+		if !ok {
+			return value{}, false
+		}
+		out = value{pick(out.estimate, v.estimate), pick(out.min, v.min), pick(out.max, v.max)}
+	}
+	return out, true
+}
+
+// ParseExpression parses the derived metric expression.
+func ParseExpression(s string) (*Expression, error) {
+	p := &exprParser{src: s}
+	p.next()
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok != tokEOF {
+		return nil, p.errorf("unexpected %v", p.describe())
+	}
+	return &Expression{source: s, root: root}, nil
+}
+
+// refs returns the metric references of the expression.
+func (e *Expression) refs() []*refExpr {
+	out := []*refExpr{}
+	var visit func(expr)
+	visit = func(x expr) {
+		switch x := x.(type) {
+		case *refExpr:
+			out = append(out, x)
+		case negateExpr:
+			visit(x.x)
+		case binaryExpr:
+			visit(x.x)
+			visit(x.y)
+		case callExpr:
+			for _, a := range x.args {
+				visit(a)
+			}
+		}
+	}
+	visit(e.root)
+	return out
+}
+
+// linearity is the way an expression depends on the metrics it references.
+type linearity int
+
+const (
+	constant  linearity = iota // Doesn't depend on any metric.
+	summing                    // A linear combination of summed metrics.
+	nonLinear                  // Any other expression.
+)
+
+// aggregationOp returns the aggregation operator of the values of the bound
+// expression. The values only sum if the expression is a linear combination
+// of summed metrics, e.g. a difference of times. Other expressions, such as
+// ratios, are averaged over time.
+func (e *Expression) aggregationOp() service.ProfilingData_GpuCounters_Metric_AggregationOperator {
+	if linearityOf(e.root) == summing {
+		return service.ProfilingData_GpuCounters_Metric_Summation
+	}
+	return service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg
+}
+
+func linearityOf(x expr) linearity {
+	switch x := x.(type) {
+	case numberExpr:
+		return constant
+	case *refExpr:
+		if x.op == service.ProfilingData_GpuCounters_Metric_Summation {
+			return summing
+		}
+		return nonLinear
+	case negateExpr:
+		return linearityOf(x.x)
+	case binaryExpr:
+		l, r := linearityOf(x.x), linearityOf(x.y)
+		switch {
+		case l == nonLinear || r == nonLinear:
+			return nonLinear
+		case l == constant && r == constant:
+			return constant
+		}
+		switch x.op {
+		case '+', '-':
+			// A constant offset doesn't sum.
+			if l == summing && r == summing {
+				return summing
+			}
+		case '*':
+			// Scaling by a constant.
+			if l == constant || r == constant {
+				return summing
+			}
+		case '/':
+			if r == constant {
+				return summing
+			}
+		}
+		return nonLinear
+	case callExpr:
+		for _, a := range x.args {
+			if linearityOf(a) != constant {
+				return nonLinear
+			}
+		}
+		return constant
+	}
+	return nonLinear
+}
+
+type token int
+
+const (
+	tokEOF token = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokPunct
+)
+
+type exprParser struct {
+	src    string
+	pos    int
+	tokPos int
+	tok    token
+	text   string
+	err    error
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid expression %q at offset %d: %v", p.src, p.tokPos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) describe() string {
+	if p.tok == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", p.text)
+}
+
+// next scans the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos >= len(p.src) {
+		p.tok, p.text = tokEOF, ""
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		end := p.pos
+		for end < len(p.src) {
+			d := p.src[end]
+			if d >= '0' && d <= '9' || d == '.' {
+				end++
+			} else if (d == 'e' || d == 'E') && end+1 < len(p.src) {
+				end++
+				if p.src[end] == '+' || p.src[end] == '-' {
+					end++
+				}
+			} else {
+				break
+			}
+		}
+		p.tok, p.text, p.pos = tokNumber, p.src[p.pos:end], end
+	case c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			p.err = p.errorf("unterminated string")
+			p.tok, p.text, p.pos = tokEOF, "", len(p.src)
+			return
+		}
+		p.tok, p.text, p.pos = tokString, p.src[p.pos+1:p.pos+1+end], p.pos+end+2
+	case c == '_' || unicode.IsLetter(rune(c)):
+		end := p.pos
+		for end < len(p.src) && (p.src[end] == '_' || unicode.IsLetter(rune(p.src[end])) || unicode.IsDigit(rune(p.src[end]))) {
+			end++
+		}
+		p.tok, p.text, p.pos = tokIdent, p.src[p.pos:end], end
+	default:
+		p.tok, p.text, p.pos = tokPunct, p.src[p.pos:p.pos+1], p.pos+1
+	}
+}
+
+func (p *exprParser) expect(punct string) error {
+	if p.tok != tokPunct || p.text != punct {
+		return p.errorf("expected %q, got %v", punct, p.describe())
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) parseExpr() (expr, error) {
+	x, err := p.parseTerm()
+	for err == nil && p.tok == tokPunct && (p.text == "+" || p.text == "-") {
+		op := p.text[0]
+		p.next()
+		var y expr
+		if y, err = p.parseTerm(); err == nil {
+			x = binaryExpr{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseTerm() (expr, error) {
+	x, err := p.parseUnary()
+	for err == nil && p.tok == tokPunct && (p.text == "*" || p.text == "/") {
+		op := p.text[0]
+		p.next()
+		var y expr
+		if y, err = p.parseUnary(); err == nil {
+			x = binaryExpr{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.tok == tokPunct && p.text == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		return negateExpr{x}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	switch p.tok {
+	case tokNumber:
+		f, err := strconv.ParseFloat(p.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.text)
+		}
+		p.next()
+		return numberExpr(f), nil
+	case tokPunct:
+		if p.text == "(" {
+			p.next()
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	case tokIdent:
+		return p.parseCall()
+	}
+	return nil, p.errorf("unexpected %v", p.describe())
+}
+
+func (p *exprParser) parseCall() (expr, error) {
+	name := p.text
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var out expr
+	switch name {
+	case "counter":
+		switch p.tok {
+		case tokNumber:
+			id, err := strconv.ParseUint(p.text, 10, 32)
+			if err != nil {
+				return nil, p.errorf("invalid counter ID %q", p.text)
+			}
+			out = &refExpr{kind: counterIDRef, id: uint32(id)}
+		case tokString:
+			out = &refExpr{kind: counterNameRef, name: p.text}
+		default:
+			return nil, p.errorf("expected a counter ID or name, got %v", p.describe())
+		}
+		p.next()
+	case "metric":
+		if p.tok != tokString {
+			return nil, p.errorf("expected a metric name, got %v", p.describe())
+		}
+		out = &refExpr{kind: metricNameRef, name: p.text}
+		p.next()
+	case "min", "max":
+		call := callExpr{min: name == "min"}
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.tok != tokPunct || p.text != "," {
+				break
+			}
+			p.next()
+		}
+		out = call
+	default:
+		return nil, p.errorf("unknown function %q", name)
+	}
+	return out, p.expect(")")
+}
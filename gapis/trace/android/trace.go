@@ -53,6 +53,7 @@ import (
 	"github.com/google/gapid/gapis/trace/android/adreno"
 	"github.com/google/gapid/gapis/trace/android/mali"
 	"github.com/google/gapid/gapis/trace/android/validate"
+	"github.com/google/gapid/gapis/trace/generic"
 	"github.com/google/gapid/gapis/trace/tracer"
 )
 
@@ -146,7 +147,7 @@ func (t *androidTracer) ProcessProfilingData(ctx context.Context, buffer *bytes.
 	} else if strings.Contains(gpuName, "Mali") {
 		return mali.ProcessProfilingData(ctx, processor, capture, desc, handleMappings, syncData)
 	}
-	return nil, log.Errf(ctx, nil, "Failed to process Perfetto trace for device %v", gpuName)
+	return generic.ProcessProfilingData(ctx, processor, capture, desc, handleMappings, syncData)
 }
 
 func (t *androidTracer) Validate(ctx context.Context) error {
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
@@ -55,3 +56,28 @@ func FindParentGroup(ctx context.Context, subOrder, cb uint64, groupsMap map[api
 		return commandBufferGroup
 	}
 }
+
+// ExtractTraceHandles replaces the replay handles of the type with the
+// handles of the trace they map to.
+func ExtractTraceHandles(ctx context.Context, replayHandles *[]int64, replayHandleType string, handleMapping *map[uint64][]service.VulkanHandleMappingItem) {
+	for i, v := range *replayHandles {
+		handles, ok := (*handleMapping)[uint64(v)]
+		if !ok {
+			log.E(ctx, "%v not found in replay: %v", replayHandleType, v)
+			continue
+		}
+
+		found := false
+		for _, handle := range handles {
+			if handle.HandleType == replayHandleType {
+				(*replayHandles)[i] = int64(handle.TraceValue)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			log.E(ctx, "Incorrect Handle type for %v: %v", replayHandleType, v)
+		}
+	}
+}
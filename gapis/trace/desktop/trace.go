@@ -33,9 +33,11 @@ import (
 	"github.com/google/gapid/core/vulkan/loader"
 	gapii "github.com/google/gapid/gapii/client"
 	"github.com/google/gapid/gapis/api/sync"
+	perfetto_processor "github.com/google/gapid/gapis/perfetto"
 	perfetto "github.com/google/gapid/gapis/perfetto/desktop"
 	"github.com/google/gapid/gapis/service"
 	gapis_path "github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/generic"
 	"github.com/google/gapid/gapis/trace/tracer"
 )
 
@@ -52,7 +54,18 @@ func (t *DesktopTracer) GetDevice() bind.Device {
 }
 
 func (t *DesktopTracer) ProcessProfilingData(ctx context.Context, buffer *bytes.Buffer, capture *gapis_path.Capture, handleMapping *map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
-	return nil, log.Err(ctx, nil, "Desktop replay profiling is unsupported.")
+	// Load Perfetto trace and create trace processor.
+	rawData := make([]byte, buffer.Len())
+	if _, err := buffer.Read(rawData); err != nil {
+		return nil, log.Err(ctx, err, "Failed to read trace buffer")
+	}
+	processor, err := perfetto_processor.NewProcessor(ctx, rawData)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to create trace processor")
+	}
+	defer processor.Close()
+	desc := t.b.Instance().GetConfiguration().GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor()
+	return generic.ProcessProfilingData(ctx, processor, capture, desc, handleMapping, syncData)
 }
 
 func (t *DesktopTracer) Validate(ctx context.Context) error {
@@ -0,0 +1,84 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+var (
+	counterTracksQuery = "" +
+		"SELECT id, name, unit, description FROM gpu_counter_track ORDER BY id"
+	countersQueryFmt = "" +
+		"SELECT ts, value FROM counter c WHERE c.track_id = %d ORDER BY ts"
+)
+
+// processCounters returns the samples of the GPU counter tracks of the trace.
+// The counters are matched by name to the specs of the counter descriptor.
+func processCounters(ctx context.Context, processor *perfetto.Processor, desc *device.GpuCounterDescriptor) ([]*service.ProfilingData_Counter, error) {
+	counterTracksQueryResult, err := processor.Query(counterTracksQuery)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "SQL query failed: %v", counterTracksQuery)
+	}
+	// t.id, name, unit, description, ts, value
+	tracksColumns := counterTracksQueryResult.GetColumns()
+	numTracksRows := counterTracksQueryResult.GetNumRecords()
+	counters := make([]*service.ProfilingData_Counter, numTracksRows)
+	// Grab all the column values. Depends on the order of columns selected in countersQuery
+	trackIds := tracksColumns[0].GetLongValues()
+	names := tracksColumns[1].GetStringValues()
+	units := tracksColumns[2].GetStringValues()
+	descriptions := tracksColumns[3].GetStringValues()
+
+	nameToSpec := map[string]*device.GpuCounterDescriptor_GpuCounterSpec{}
+	if desc != nil {
+		for _, spec := range desc.Specs {
+			nameToSpec[spec.Name] = spec
+		}
+	}
+
+	for i := uint64(0); i < numTracksRows; i++ {
+		countersQuery := fmt.Sprintf(countersQueryFmt, trackIds[i])
+		countersQueryResult, err := processor.Query(countersQuery)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "SQL query failed: %v", countersQuery)
+		}
+		countersColumns := countersQueryResult.GetColumns()
+		timestampsLong := countersColumns[0].GetLongValues()
+		timestamps := make([]uint64, len(timestampsLong))
+		for i, t := range timestampsLong {
+			timestamps[i] = uint64(t)
+		}
+		values := countersColumns[1].GetDoubleValues()
+
+		// TODO(apbodnar) Populate the `default` field once the trace processor supports it (b/147432390)
+		counters[i] = &service.ProfilingData_Counter{
+			Id:          uint32(trackIds[i]),
+			Name:        names[i],
+			Unit:        units[i],
+			Description: descriptions[i],
+			Spec:        nameToSpec[names[i]],
+			Timestamps:  timestamps,
+			Values:      values,
+		}
+	}
+	return counters, nil
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generic processes the GPU profiling data of any GPU from the
+// standard Perfetto GPU render stage and GPU counter tables.
+package generic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// ProcessProfilingData returns the profiling data of the trace, built from the
+// standard GPU render stage slices and GPU counter tracks, without any
+// knowledge of the GPU that produced them.
+func ProcessProfilingData(ctx context.Context, processor *perfetto.Processor, capture *path.Capture, desc *device.GpuCounterDescriptor, handleMapping *map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+	slices, err := processGpuSlices(ctx, processor, capture, handleMapping, syncData)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to get GPU slices")
+	}
+	counters, err := processCounters(ctx, processor, desc)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to get GPU counters")
+	}
+	gpuCounters, err := profile.ComputeCounters(ctx, slices, counters)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to calculate performance data based on GPU slices and counters")
+	}
+
+	return &service.ProfilingData{
+		Slices:      slices,
+		Counters:    counters,
+		GpuCounters: gpuCounters,
+	}, nil
+}
+
+// groupBuilder creates the groups of the render stages.
+type groupBuilder struct {
+	capture *path.Capture
+	links   map[api.CmdSubmissionKey][]api.SubCmdIdx
+	groups  []*service.ProfilingData_GpuSlices_Group
+	// byKey holds the submission and command buffer groups.
+	byKey map[api.CmdSubmissionKey]*service.ProfilingData_GpuSlices_Group
+}
+
+func (b *groupBuilder) add(name string, parent *service.ProfilingData_GpuSlices_Group, indices api.SubCmdIdx) *service.ProfilingData_GpuSlices_Group {
+	group := &service.ProfilingData_GpuSlices_Group{
+		Id:     int32(len(b.groups)),
+		Name:   name,
+		Parent: parent,
+		Link:   &path.Command{Capture: b.capture, Indices: indices},
+	}
+	b.groups = append(b.groups, group)
+	return group
+}
+
+// commandBuffer returns the group of the command buffer of the submission,
+// creating it and its submission group if needed, or nil if the command buffer
+// is not linked to a command.
+func (b *groupBuilder) commandBuffer(order, cb uint64) *service.ProfilingData_GpuSlices_Group {
+	key := api.CmdSubmissionKey{order, cb, 0, 0}
+	if group, ok := b.byKey[key]; ok {
+		return group
+	}
+	links, ok := b.links[key]
+	if !ok {
+		return nil
+	}
+
+	submissionKey := api.CmdSubmissionKey{order, 0, 0, 0}
+	submission, ok := b.byKey[submissionKey]
+	if !ok {
+		if submissionLinks, ok := b.links[submissionKey]; ok {
+			submission = b.add(fmt.Sprintf("Submission: %v", order), nil, submissionLinks[0])
+			b.byKey[submissionKey] = submission
+		}
+	}
+
+	group := b.add(fmt.Sprintf("Command Buffer: %v", cb), submission, links[0])
+	b.byKey[key] = group
+	return group
+}
+
+// groupRenderStages groups the render stages, which must be sorted by start
+// time, by the render pass instance, command buffer and submission they
+// belong to. It returns the groups, and the group ID of each stage, or -1 for
+// stages that are not grouped. The names of the grouped render pass stages are
+// prefixed with the indices of the command beginning the render pass.
+//
+// Render stages only identify the render pass and render target they belong
+// to, so a new instance of a render pass starts when a top level stage of the
+// render pass follows a stage of a different render pass on the same hardware
+// queue. Stages outside of render passes belong to their command buffer.
+func groupRenderStages(ctx context.Context, stages []renderStage, submissionOrdering map[int64]uint64, links map[api.CmdSubmissionKey][]api.SubCmdIdx, capture *path.Capture) ([]*service.ProfilingData_GpuSlices_Group, []int32) {
+	b := &groupBuilder{
+		capture: capture,
+		links:   links,
+		byKey:   map[api.CmdSubmissionKey]*service.ProfilingData_GpuSlices_Group{},
+	}
+	groupIds := make([]int32, len(stages))
+	lastKeys := map[int64]api.CmdSubmissionKey{}
+	renderPasses := map[api.CmdSubmissionKey]*service.ProfilingData_GpuSlices_Group{}
+	instances := map[api.CmdSubmissionKey]int{}
+
+	for i := range stages {
+		s := &stages[i]
+		groupIds[i] = -1
+
+		order, ok := submissionOrdering[s.SubmissionID]
+		if !ok {
+			log.W(ctx, "Encountered submission ID mismatch %v", s.SubmissionID)
+			continue
+		}
+		key := api.CmdSubmissionKey{order, s.CommandBuffer, s.RenderPass, s.RenderTarget}
+		newInstance := false
+		if s.Depth == 0 {
+			newInstance = lastKeys[s.TrackID] != key
+			lastKeys[s.TrackID] = key
+		}
+
+		if s.RenderPass == 0 {
+			if group := b.commandBuffer(order, s.CommandBuffer); group != nil {
+				groupIds[i] = group.Id
+			}
+			continue
+		}
+
+		indices, ok := links[key]
+		if !ok {
+			continue
+		}
+		group, ok := renderPasses[key]
+		if !ok || (newInstance && instances[key] < len(indices)) {
+			parent := b.commandBuffer(order, s.CommandBuffer)
+			name := fmt.Sprintf("RenderPass %v, RenderTarget %v", s.RenderPass, s.RenderTarget)
+			group = b.add(name, parent, indices[instances[key]])
+			renderPasses[key] = group
+			instances[key]++
+		}
+		groupIds[i] = group.Id
+		s.Name = fmt.Sprintf("%v %v", group.Link.Indices, s.Name)
+	}
+	return b.groups, groupIds
+}
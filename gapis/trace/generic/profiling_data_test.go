@@ -0,0 +1,219 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestGroupRenderStages(t *testing.T) {
+	const (
+		cb       = 0x10
+		rp       = 0x20
+		fb       = 0x30
+		other    = 0x21
+		graphics = 1
+		compute  = 2
+	)
+	links := map[api.CmdSubmissionKey][]api.SubCmdIdx{
+		{0, 0, 0, 0}:       {{5}},
+		{0, cb, 0, 0}:      {{5, 0}},
+		{0, cb, rp, fb}:    {{5, 0, 1}, {5, 0, 9}},
+		{0, cb, other, fb}: {{5, 0, 4}},
+	}
+	// Submission 100 is the first submission, 200 is unknown.
+	submissions := map[int64]uint64{100: 0}
+	stage := func(name string, depth, track int64, submission int64, renderPass uint64) renderStage {
+		return renderStage{
+			Name:          name,
+			Depth:         depth,
+			TrackID:       track,
+			SubmissionID:  submission,
+			CommandBuffer: cb,
+			RenderPass:    renderPass,
+			RenderTarget:  fb,
+		}
+	}
+	stages := []renderStage{
+		stage("vertex", 0, graphics, 100, rp),
+		stage("binning", 1, graphics, 100, rp),
+		stage("fragment", 0, graphics, 100, rp),
+		stage("dispatch", 0, compute, 100, 0),
+		stage("vertex", 0, graphics, 100, other),
+		stage("vertex", 0, graphics, 100, rp),
+		stage("fragment", 0, graphics, 100, other),
+		stage("fragment", 0, graphics, 100, rp),
+		stage("lost", 0, graphics, 200, rp),
+	}
+
+	groups, groupIds := groupRenderStages(context.Background(), stages, submissions, links, nil)
+
+	type group struct {
+		name    string
+		parent  string
+		indices api.SubCmdIdx
+	}
+	got := []group{}
+	for i, g := range groups {
+		if g.Id != int32(i) {
+			t.Errorf("Group %v has ID %v", i, g.Id)
+		}
+		parent := ""
+		if g.Parent != nil {
+			parent = g.Parent.Name
+		}
+		got = append(got, group{g.Name, parent, g.Link.Indices})
+	}
+	rpName := fmt.Sprintf("RenderPass %v, RenderTarget %v", rp, fb)
+	otherName := fmt.Sprintf("RenderPass %v, RenderTarget %v", other, fb)
+	cbName := fmt.Sprintf("Command Buffer: %v", cb)
+	expected := []group{
+		{"Submission: 0", "", api.SubCmdIdx{5}},
+		{cbName, "Submission: 0", api.SubCmdIdx{5, 0}},
+		{rpName, cbName, api.SubCmdIdx{5, 0, 1}},
+		{otherName, cbName, api.SubCmdIdx{5, 0, 4}},
+		{rpName, cbName, api.SubCmdIdx{5, 0, 9}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected groups.\nGot:      %v\nExpected: %v", got, expected)
+	}
+
+	// Stages beyond the known instances of a render pass stay in its last
+	// instance, and the compute stage on its own queue doesn't start a new
+	// instance.
+	if expected := []int32{2, 2, 2, 1, 3, 4, 3, 4, -1}; !reflect.DeepEqual(groupIds, expected) {
+		t.Errorf("Unexpected group IDs %v, expected %v", groupIds, expected)
+	}
+	if expected := "[5 0 1] fragment"; stages[2].Name != expected {
+		t.Errorf("Unexpected stage name %q, expected %q", stages[2].Name, expected)
+	}
+	if expected := "dispatch"; stages[3].Name != expected {
+		t.Errorf("Unexpected stage name %q, expected %q", stages[3].Name, expected)
+	}
+}
+
+// TestProcessProfilingData processes testdata/render_stages.perfetto, which
+// holds:
+//   - a vkQueueSubmit of the command buffer 0xc0 as submission 1 at 1500ns,
+//   - a Vertex and a Fragment render stage of the submission on the Graphics
+//     queue, for the render pass 0xa0 and the framebuffer 0xf0 of the command
+//     buffer, from 2000ns to 3000ns and from 3000ns to 5000ns,
+//   - samples of the GPU Utilization counter from 1000ns to 6000ns.
+func TestProcessProfilingData(t *testing.T) {
+	ctx := log.Testing(t)
+	trace, err := ioutil.ReadFile("testdata/render_stages.perfetto")
+	if err != nil {
+		t.Fatalf("Failed to read the trace: %v", err)
+	}
+	processor, err := perfetto.NewProcessor(ctx, trace)
+	if err != nil {
+		t.Fatalf("Failed to create the trace processor: %v", err)
+	}
+	defer processor.Close()
+
+	// The handles of the replay are mapped to the handles of the capture.
+	const (
+		vkDevice      = 0x10d
+		commandBuffer = 0x1c0
+		renderPass    = 0x1a0
+		framebuffer   = 0x1f0
+	)
+	handleMapping := map[uint64][]service.VulkanHandleMappingItem{
+		0xd:  {{HandleType: "VkDevice", TraceValue: vkDevice, ReplayValue: 0xd}},
+		0xc0: {{HandleType: "VkCommandBuffer", TraceValue: commandBuffer, ReplayValue: 0xc0}},
+		0xa0: {{HandleType: "VkRenderPass", TraceValue: renderPass, ReplayValue: 0xa0}},
+		0xf0: {{HandleType: "VkFramebuffer", TraceValue: framebuffer, ReplayValue: 0xf0}},
+	}
+	syncData := sync.NewData()
+	syncData.SubmissionIndices[api.CmdSubmissionKey{0, 0, 0, 0}] = []api.SubCmdIdx{{3}}
+	syncData.SubmissionIndices[api.CmdSubmissionKey{0, commandBuffer, 0, 0}] = []api.SubCmdIdx{{3, 0}}
+	syncData.SubmissionIndices[api.CmdSubmissionKey{0, commandBuffer, renderPass, framebuffer}] = []api.SubCmdIdx{{3, 0, 1}}
+	desc := &device.GpuCounterDescriptor{
+		Specs: []*device.GpuCounterDescriptor_GpuCounterSpec{{CounterId: 1, Name: "GPU Utilization"}},
+	}
+
+	out, err := ProcessProfilingData(ctx, processor, nil, desc, &handleMapping, syncData)
+	if err != nil {
+		t.Fatalf("ProcessProfilingData failed: %v", err)
+	}
+
+	slices := out.Slices
+	if len(slices.Tracks) != 1 || slices.Tracks[0].Name != "Graphics" {
+		t.Errorf("Unexpected tracks %v", slices.Tracks)
+	}
+	groupNames := []string{}
+	for _, g := range slices.Groups {
+		groupNames = append(groupNames, g.Name)
+	}
+	expectedGroups := []string{
+		"Submission: 0",
+		fmt.Sprintf("Command Buffer: %v", commandBuffer),
+		fmt.Sprintf("RenderPass %v, RenderTarget %v", renderPass, framebuffer),
+	}
+	if !reflect.DeepEqual(groupNames, expectedGroups) {
+		t.Errorf("Unexpected groups %v, expected %v", groupNames, expectedGroups)
+	}
+
+	type slice struct {
+		label   string
+		ts, dur uint64
+		group   int32
+	}
+	got := []slice{}
+	for _, s := range slices.Slices {
+		got = append(got, slice{s.Label, s.Ts, s.Dur, s.GroupId})
+		for _, e := range s.Extras {
+			if e.Name == "commandBuffer" && e.GetIntValue() != commandBuffer {
+				t.Errorf("Slice %v has the command buffer %v, expected %v", s.Label, e.GetIntValue(), commandBuffer)
+			}
+		}
+	}
+	expectedSlices := []slice{
+		{"[3 0 1] Vertex", 2000, 1000, 2},
+		{"[3 0 1] Fragment", 3000, 2000, 2},
+	}
+	if !reflect.DeepEqual(got, expectedSlices) {
+		t.Errorf("Unexpected slices %v, expected %v", got, expectedSlices)
+	}
+
+	if len(out.Counters) != 1 {
+		t.Fatalf("Got %v counters, expected 1", len(out.Counters))
+	}
+	counter := out.Counters[0]
+	if counter.Name != "GPU Utilization" || counter.Spec != desc.Specs[0] {
+		t.Errorf("Unexpected counter %v", counter)
+	}
+	if n := len(counter.Values); n < 5 || n != len(counter.Timestamps) || counter.Values[n-2] != 100 {
+		t.Errorf("Unexpected counter samples %v at %v", counter.Values, counter.Timestamps)
+	}
+
+	// The GPU time of the render pass is the time of its stages.
+	for _, entry := range out.GpuCounters.Entries {
+		if gpuTime := entry.MetricToValue[0]; gpuTime == nil || gpuTime.Estimate != 3000 {
+			t.Errorf("Group %v has the GPU time %v, expected 3000", entry.Group.Name, gpuTime)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/utils"
+)
+
+var (
+	slicesQuery = "" +
+		"SELECT s.context_id, s.render_target, s.frame_id, s.submission_id, s.hw_queue_id, s.command_buffer, s.render_pass, s.ts, s.dur, s.id, s.name, depth, arg_set_id, track_id, t.name " +
+		"FROM gpu_track t LEFT JOIN gpu_slice s " +
+		"ON s.track_id = t.id WHERE t.scope = 'gpu_render_stage' ORDER BY s.ts"
+	argsQueryFmt = "" +
+		"SELECT key, string_value FROM args WHERE args.arg_set_id = %d"
+	queueSubmitQuery = "" +
+		"SELECT submission_id, command_buffer FROM gpu_slice s JOIN track t ON s.track_id = t.id WHERE s.name = 'vkQueueSubmit' AND t.name = 'Vulkan Events' ORDER BY submission_id"
+)
+
+// renderStage is a GPU render stage slice of a trace. The handles are the
+// handles of the capture.
+type renderStage struct {
+	Name          string
+	Depth         int64
+	TrackID       int64
+	SubmissionID  int64
+	CommandBuffer uint64
+	RenderPass    uint64
+	RenderTarget  uint64
+}
+
+// processGpuSlices returns the GPU render stage slices of the trace, grouped
+// by groupRenderStages.
+func processGpuSlices(ctx context.Context, processor *perfetto.Processor, capture *path.Capture, handleMapping *map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
+	slicesQueryResult, err := processor.Query(slicesQuery)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "SQL query failed: %v", slicesQuery)
+	}
+
+	queueSubmitQueryResult, err := processor.Query(queueSubmitQuery)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "SQL query failed: %v", queueSubmitQuery)
+	}
+	queueSubmitColumns := queueSubmitQueryResult.GetColumns()
+	queueSubmitIds := queueSubmitColumns[0].GetLongValues()
+	queueSubmitCommandBuffers := queueSubmitColumns[1].GetLongValues()
+	submissionOrdering := make(map[int64]uint64)
+
+	order := 0
+	for i, v := range queueSubmitIds {
+		if queueSubmitCommandBuffers[i] == 0 {
+			// This is a spurious submission. See b/150854367
+			log.W(ctx, "Spurious vkQueueSubmit slice with submission id %v", v)
+			continue
+		}
+		submissionOrdering[v] = uint64(order)
+		order++
+	}
+
+	slicesColumns := slicesQueryResult.GetColumns()
+	numSliceRows := slicesQueryResult.GetNumRecords()
+	// Grab all the column values. Depends on the order of columns selected in slicesQuery
+
+	contextIds := slicesColumns[0].GetLongValues()
+	utils.ExtractTraceHandles(ctx, &contextIds, "VkDevice", handleMapping)
+
+	renderTargets := slicesColumns[1].GetLongValues()
+	utils.ExtractTraceHandles(ctx, &renderTargets, "VkFramebuffer", handleMapping)
+
+	commandBuffers := slicesColumns[5].GetLongValues()
+	utils.ExtractTraceHandles(ctx, &commandBuffers, "VkCommandBuffer", handleMapping)
+
+	renderPasses := slicesColumns[6].GetLongValues()
+	utils.ExtractTraceHandles(ctx, &renderPasses, "VkRenderPass", handleMapping)
+
+	frameIds := slicesColumns[2].GetLongValues()
+	submissionIds := slicesColumns[3].GetLongValues()
+	hwQueueIds := slicesColumns[4].GetLongValues()
+	timestamps := slicesColumns[7].GetLongValues()
+	durations := slicesColumns[8].GetLongValues()
+	ids := slicesColumns[9].GetLongValues()
+	names := slicesColumns[10].GetStringValues()
+	depths := slicesColumns[11].GetLongValues()
+	argSetIds := slicesColumns[12].GetLongValues()
+	trackIds := slicesColumns[13].GetLongValues()
+	trackNames := slicesColumns[14].GetStringValues()
+
+	stages := make([]renderStage, numSliceRows)
+	for i := range stages {
+		stages[i] = renderStage{
+			Name:          names[i],
+			Depth:         depths[i],
+			TrackID:       trackIds[i],
+			SubmissionID:  submissionIds[i],
+			CommandBuffer: uint64(commandBuffers[i]),
+			RenderPass:    uint64(renderPasses[i]),
+			RenderTarget:  uint64(renderTargets[i]),
+		}
+	}
+	groups, groupIds := groupRenderStages(ctx, stages, submissionOrdering, syncData.SubmissionIndices, capture)
+
+	trackIdCache := make(map[int64]bool)
+	argsQueryCache := make(map[int64]*perfetto_service.QueryResult)
+	slices := make([]*service.ProfilingData_GpuSlices_Slice, numSliceRows)
+	var tracks []*service.ProfilingData_GpuSlices_Track
+	for i := uint64(0); i < numSliceRows; i++ {
+		var argsQueryResult *perfetto_service.QueryResult
+		var ok bool
+		if argsQueryResult, ok = argsQueryCache[argSetIds[i]]; !ok {
+			argsQuery := fmt.Sprintf(argsQueryFmt, argSetIds[i])
+			argsQueryResult, err = processor.Query(argsQuery)
+			if err != nil {
+				log.W(ctx, "SQL query failed: %v", argsQuery)
+			}
+			argsQueryCache[argSetIds[i]] = argsQueryResult
+		}
+		argsColumns := argsQueryResult.GetColumns()
+		numArgsRows := argsQueryResult.GetNumRecords()
+		var extras []*service.ProfilingData_GpuSlices_Slice_Extra
+		for j := uint64(0); j < numArgsRows; j++ {
+			keys := argsColumns[0].GetStringValues()
+			values := argsColumns[1].GetStringValues()
+			extras = append(extras, &service.ProfilingData_GpuSlices_Slice_Extra{
+				Name:  keys[j],
+				Value: &service.ProfilingData_GpuSlices_Slice_Extra_StringValue{StringValue: values[j]},
+			})
+		}
+		for _, extra := range []struct {
+			name  string
+			value int64
+		}{
+			{"contextId", contextIds[i]},
+			{"renderTarget", renderTargets[i]},
+			{"commandBuffer", commandBuffers[i]},
+			{"renderPass", renderPasses[i]},
+			{"frameId", frameIds[i]},
+			{"submissionId", submissionIds[i]},
+			{"hwQueueId", hwQueueIds[i]},
+		} {
+			extras = append(extras, &service.ProfilingData_GpuSlices_Slice_Extra{
+				Name:  extra.name,
+				Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(extra.value)},
+			})
+		}
+
+		slices[i] = &service.ProfilingData_GpuSlices_Slice{
+			Ts:      uint64(timestamps[i]),
+			Dur:     uint64(durations[i]),
+			Id:      uint64(ids[i]),
+			Label:   stages[i].Name,
+			Depth:   int32(depths[i]),
+			Extras:  extras,
+			TrackId: int32(trackIds[i]),
+			GroupId: groupIds[i],
+		}
+
+		if _, ok := trackIdCache[trackIds[i]]; !ok {
+			trackIdCache[trackIds[i]] = true
+			tracks = append(tracks, &service.ProfilingData_GpuSlices_Track{
+				Id:   int32(trackIds[i]),
+				Name: trackNames[i],
+			})
+		}
+	}
+
+	return &service.ProfilingData_GpuSlices{
+		Slices: slices,
+		Tracks: tracks,
+		Groups: groups,
+	}, nil
+}